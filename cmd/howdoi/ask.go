@@ -0,0 +1,934 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const rootLong = `Ask a model about files, URLs, images, and text. Without a command, howdoi
+asks: "howdoi main.go 'why does this panic?'" is "howdoi ask main.go 'why does
+this panic?'".
+
+Quote the question. Unquoted, each word is an argument, and a question that
+starts with the name of a command, like history of the Roman empire, runs
+the command instead. "howdoi ask" never does.`
+
+const summarizeQuestion = "Summarize the attached content: start with a one-sentence overview, then list the key points, and end with anything that needs follow-up."
+
+// rootArgs takes any arguments as the question, except a lone word close to
+// the name of a command, which is more likely a typo than a question.
+func rootArgs(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 || strings.Contains(args[0], " ") || howdoi.IsFile(args[0]) || howdoi.IsURL(args[0]) {
+		return nil
+	}
+	if cmd.SuggestionsMinimumDistance <= 0 {
+		cmd.SuggestionsMinimumDistance = 2
+	}
+	if s := cmd.SuggestionsFor(args[0]); len(s) > 0 {
+		return fmt.Errorf("unknown command %q, did you mean %s? To ask it, use howdoi ask %q", args[0], strings.Join(s, " or "), args[0])
+	}
+	return nil
+}
+
+// The flags of howdoi ask, which the root command and howdoi summarize also
+// take.
+var (
+	model                    string
+	maxTokens                int
+	temperature              float32
+	verbose                  bool
+	systemPrompt             string
+	storeIDs                 []string
+	pdfHybrid                bool
+	pdfAsImages              bool
+	maxPageTokens            int
+	render                   bool
+	concurrency              int
+	wayback                  bool
+	refresh                  bool
+	compare                  []string
+	compareColumns           bool
+	questionFirst            bool
+	repeatQuestion           bool
+	profile                  string
+	promptName               string
+	noCtx                    bool
+	noCache                  bool
+	noHistory                bool
+	continueConv             bool
+	resumeID                 int64
+	jsonOutput               bool
+	thinking                 int
+	schemaFile               string
+	raw                      bool
+	baseURL                  string
+	modelIDFlag              string
+	apiKeyEnv                string
+	fallback                 string
+	fallbackAny              bool
+	toolNames                []string
+	codeExec, search         bool
+	web                      bool
+	webResults               int
+	maxWait                  time.Duration
+	timeout                  time.Duration
+	maxRetries               int
+	confirmOver              float64
+	paste                    bool
+	edit                     bool
+	unbuffered, lineBuffered bool
+	tags                     map[string]string
+	copyAnswer               bool
+	shareAnswer              bool
+	sharePrompt              bool
+	shareURL                 string
+	globs                    []string
+	contextArgs              []string
+	tableRows                int
+	depth, maxLinks          int
+	ragIndex                 string
+	toFormat                 string
+	topK                     int
+	savePrompt               string
+	dryRun                   bool
+	codeOnly                 string
+	fromPrompt               string
+	captionImages            bool
+	outputFile               string
+	anthropicBetas           []string
+	outputPrompt             bool
+)
+
+// addAskFlags adds the flags of howdoi ask to fs.
+func addAskFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&model, "model", "m", "sonnet", "Model to use)")
+	fs.IntVarP(&maxTokens, "max-tokens", "t", 4096, "Maximum number of tokens to generate")
+	fs.Float32VarP(&temperature, "temperature", "e", 0.10, "Temperature")
+	fs.BoolVarP(&verbose, "verbose", "v", true, "Verbosity")
+	fs.StringVarP(&systemPrompt, "system", "s", "", "System prompt (can be text or a file path)")
+	fs.StringVarP(&promptName, "prompt", "p", "", "Named prompt template (see howdoi prompts)")
+	fs.StringVar(&baseURL, "base-url", "", "Base URL of an OpenAI-compatible API, e.g. http://localhost:8000/v1")
+	fs.StringVar(&modelIDFlag, "model-id", "", "Model name sent to the provider, overriding the alias")
+	fs.StringVar(&apiKeyEnv, "api-key-env", "", "Environment variable holding the API key")
+	fs.StringVar(&profile, "profile", "", "Config profile to use")
+	fs.BoolVar(&pdfHybrid, "pdf-hybrid", false, "Send PDF text plus page images for pages with tables, figures, or poor text extraction")
+	fs.BoolVar(&pdfAsImages, "pdf-as-images", false, "Send PDFs as page images, or as documents to models that read PDFs natively")
+	fs.IntVarP(&concurrency, "concurrency", "j", 4, "Number of files and URLs loaded at once")
+	fs.BoolVar(&render, "render", false, "Load web pages with little text in headless Chrome, for pages built with JavaScript")
+	fs.BoolVar(&refresh, "refresh", false, "Scrape web pages again instead of reusing the saved copy")
+	fs.BoolVar(&wayback, "wayback", false, "Read web pages that are gone, paywalled, or empty from their latest Wayback Machine snapshot")
+	fs.IntVar(&depth, "depth", 0, "Also attach the pages of the same site linked from attached web pages, this many links away")
+	fs.IntVar(&maxLinks, "max-links", howdoi.DefaultMaxLinks, "Most linked pages --depth attaches per web page")
+	fs.IntVar(&maxPageTokens, "max-page-tokens", 8000, "Keep only the sections of longer web pages most relevant to the question (0 sends everything)")
+	fs.BoolVar(&questionFirst, "question-first", false, "Put the question before the attached documents instead of after them")
+	fs.BoolVar(&repeatQuestion, "repeat-question", false, "Put the question both before and after the attached documents")
+	fs.BoolVar(&noCtx, "no-ctx", false, "Do not attach the directory context set with howdoi ctx")
+	fs.BoolVar(&jsonOutput, "json", false, "Ask for a JSON answer and print it with the reasoning and model as JSON")
+	fs.StringVar(&toFormat, "to", "", "Print the answer only as table, csv, json, or yaml, asking the model again until it parses")
+	fs.DurationVar(&timeout, "timeout", 0, "Cancel the request if the answer is not complete within this duration, e.g. 2m")
+	fs.DurationVar(&maxWait, "max-wait", 0, "Cancel the request if no output arrives within this duration, e.g. 10s")
+	fs.IntVar(&maxRetries, "max-retries", defaultMaxRetries, "Retries for rate limited, failed, or overloaded API calls")
+	fs.Float64Var(&confirmOver, "confirm-over", 0, "Ask before sending a request whose estimated cost is over this many dollars")
+	fs.StringSliceVar(&compare, "compare", nil, "Send the prompt to these models at once and compare the answers, e.g. sonnet,mini,flash")
+	fs.BoolVar(&compareColumns, "side-by-side", false, "Print --compare answers in columns instead of one after the other")
+	fs.StringVar(&fallback, "fallback", "", "Model to retry with when --max-wait passes without output or the provider is overloaded")
+	fs.BoolVar(&fallbackAny, "fallback-any", false, "Answer with a model of another provider when the API key of the requested one is missing, instead of asking")
+	fs.StringSliceVar(&anthropicBetas, "anthropic-beta", nil, "Anthropic beta features to turn on, e.g. token-efficient-tools,fine-grained-tool-streaming")
+	fs.StringSliceVar(&toolNames, "tools", nil, "Tools the model can call, e.g. run_shell (all when given without a value)")
+	fs.Lookup("tools").NoOptDefVal = "all"
+	fs.BoolVar(&codeExec, "code-exec", false, "Let Gemini models write and run Python in Google's sandbox, printing the code and its output")
+	fs.BoolVar(&search, "search", false, "Ground the answers of Gemini models in Google Search results, listing the sources")
+	fs.BoolVar(&web, "web", false, "Search the web with the provider's search tool, citing the pages as footnotes, or attach the top results for models without one")
+	fs.IntVar(&webResults, "web-results", 3, "Number of search results --web attaches for models without a search tool")
+	fs.StringToStringVar(&tags, "tag", nil, "Tag the request for cost attribution, e.g. --tag project=alpha (repeatable)")
+	fs.StringArrayVar(&contextArgs, "context", nil, "Put a file, directory, or URL in the system prompt as background, apart from the question (repeatable)")
+	fs.IntVar(&tableRows, "rows", howdoi.DefaultTableRows, "Rows of attached CSV, TSV, and Parquet files to send, after a summary of their columns")
+	fs.StringArrayVar(&globs, "glob", nil, "Attach the files below the current directory matching a pattern, e.g. \"**/*.go\" (repeatable)")
+	fs.StringVar(&ragIndex, "rag", "", "Attach the chunks of this index (see howdoi index) most relevant to the question")
+	fs.IntVar(&topK, "top-k", defaultTopK, "Number of chunks --rag attaches")
+	fs.BoolVar(&paste, "paste", false, "Attach the clipboard contents, text or an image")
+	fs.BoolVar(&edit, "edit", false, "Write the prompt in $VISUAL or $EDITOR, starting from the text arguments")
+	fs.BoolVar(&copyAnswer, "copy", false, "Copy the answer to the clipboard")
+	fs.BoolVar(&shareAnswer, "share", false, "Upload the answer to a secret GitHub gist or --share-url and print the link")
+	fs.BoolVar(&sharePrompt, "share-prompt", false, "Include the question when sharing with --share")
+	fs.StringVar(&shareURL, "share-url", "", "Paste service to share to instead of a gist, e.g. https://paste.rs")
+	fs.BoolVar(&raw, "raw", false, "Print the answer as plain text instead of rendered markdown")
+	fs.BoolVar(&unbuffered, "unbuffered", false, "Write every token as it arrives, even on a terminal, without rendering or wrapping the answer")
+	fs.BoolVar(&lineBuffered, "line-buffered", false, "Write the answer a whole line at a time")
+	fs.StringVarP(&outputFile, "output", "o", "", "Also write the answer, as it streams, to this file, e.g. answer.md")
+	fs.BoolVar(&outputPrompt, "output-prompt", false, "Start the --output file with the question as a heading")
+	fs.StringVar(&schemaFile, "schema", "", "JSON schema file the answer must match (with --json)")
+	fs.IntVar(&thinking, "thinking", 0, "Extended thinking token budget (Anthropic models)")
+	fs.BoolVarP(&continueConv, "continue", "c", false, "Continue the most recent conversation")
+	fs.Int64Var(&resumeID, "resume", 0, "Continue the conversation with this id (see howdoi history list)")
+	fs.BoolVar(&noHistory, "no-history", false, "Do not save this exchange to the history")
+	fs.BoolVar(&captionImages, "caption-images", false, "Store a one-line caption of attached images with the history, written by the title model, so howdoi history search finds them")
+	fs.StringVar(&savePrompt, "save-prompt", "", "Write the rendered request to this file, e.g. out.prompt.json")
+	fs.StringVar(&codeOnly, "code", "", "Print only the fenced code blocks of the answer, or with --code=first only the first one")
+	fs.Lookup("code").NoOptDefVal = "all"
+	fs.BoolVar(&dryRun, "dry-run", false, "Print the rendered request with its estimated tokens and cost instead of sending it")
+	fs.StringVar(&fromPrompt, "from-prompt", "", "Resend a request saved with --save-prompt")
+	fs.BoolVar(&noCache, "no-cache", false, "Do not read or write the response cache")
+	fs.StringSliceVar(&storeIDs, "store", nil, "OpenAI vector store IDs to search with the file_search tool")
+
+	// --system-prompt is the original name of --system.
+	fs.SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "system-prompt" {
+			name = "system"
+		}
+		return pflag.NormalizedName(name)
+	})
+}
+
+func newAskCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ask [files, URLs, and question...]",
+		Short: "Ask a question, with files, URLs, and images as context (the default command)",
+		Example: `  howdoi ask "history of the Roman empire"
+  howdoi ask main.go "why does this panic?"`,
+		Args: cobra.ArbitraryArgs,
+		Run:  runAsk,
+	}
+	addAskFlags(cmd.Flags())
+	return cmd
+}
+
+func newSummarizeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "summarize [files or URLs...]",
+		Short: "Summarize files, URLs, or stdin",
+		Example: `  howdoi summarize https://go.dev/blog/loopvar-preview
+  git log -20 | howdoi summarize`,
+		Args: cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runAsk(cmd, append(args, summarizeQuestion))
+		},
+	}
+	addAskFlags(cmd.Flags())
+	return cmd
+}
+
+// runAsk sends the question, files, URLs, and images in args, with stdin, to
+// the model and prints the answer.
+func runAsk(cmd *cobra.Command, args []string) {
+	// Told apart before the defaults below set the flag.
+	systemFlag := cmd.Flags().Changed("system")
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Println("Error reading the config file:", err)
+		os.Exit(exitUsage)
+	}
+	settings, err := cfg.settings(profile)
+	if err != nil {
+		log.Println("Error:", err)
+		os.Exit(exitUsage)
+	}
+	// The defaults of the directory or repository win over the
+	// config file.
+	pc, err := loadProjectConfig()
+	if err != nil {
+		log.Println("Error reading the project config:", err)
+		os.Exit(exitUsage)
+	}
+	if err := applySettings(cmd.Flags(), pc.settings()); err != nil {
+		log.Println("Error applying the project config:", err)
+		os.Exit(exitUsage)
+	}
+	if err := applySettings(cmd.Flags(), settings); err != nil {
+		log.Println("Error applying the config file:", err)
+		os.Exit(exitUsage)
+	}
+
+	var snap *howdoi.Snapshot
+	if fromPrompt != "" {
+		if len(args) > 0 || promptName != "" || paste || len(globs) > 0 || continueConv || resumeID != 0 {
+			log.Println("Error: --from-prompt resends a saved request and can't be combined with messages or --continue")
+			os.Exit(exitUsage)
+		}
+		snap, err = howdoi.LoadSnapshot(fromPrompt)
+		if err != nil {
+			log.Println("Error reading the prompt file:", err)
+			os.Exit(exitUsage)
+		}
+		// The snapshot has everything the flags and arguments would
+		// render.
+		model, maxTokens, temperature, thinking = snap.Model, snap.MaxTokens, snap.Temperature, snap.Thinking
+		storeIDs, jsonOutput, toolNames = snap.StoreIDs, snap.JSONMode, snap.Tools
+		codeExec, search, web = snap.CodeExecution, snap.GoogleSearch, snap.WebSearch
+		noCtx = true
+	}
+
+	if toFormat != "" {
+		if _, ok := formatInstructions[toFormat]; !ok {
+			log.Println("Error: --to must be table, csv, json, or yaml")
+			os.Exit(exitUsage)
+		}
+		if jsonOutput || len(compare) > 0 {
+			log.Println("Error: --to can't be combined with --json or --compare")
+			os.Exit(exitUsage)
+		}
+	}
+	if unbuffered && lineBuffered {
+		log.Println("Error: --unbuffered and --line-buffered can't be combined")
+		os.Exit(exitUsage)
+	}
+	if codeOnly != "" {
+		if codeOnly != "all" && codeOnly != "first" {
+			log.Println("Error: --code must be all or first")
+			os.Exit(exitUsage)
+		}
+		if jsonOutput || toFormat != "" || len(compare) > 0 {
+			log.Println("Error: --code can't be combined with --json, --to, or --compare")
+			os.Exit(exitUsage)
+		}
+	}
+	if len(compare) > 0 {
+		if jsonOutput || snap != nil || outputFile != "" || web {
+			log.Println("Error: --compare can't be combined with --json, --from-prompt, --output, or --web")
+			os.Exit(exitUsage)
+		}
+		// The content is loaded for the first model and adapted to
+		// the others.
+		model = compare[0]
+	}
+
+	if id, ok := settings.Models[model]; ok && modelIDFlag == "" {
+		modelIDFlag = id
+	}
+	m, err := howdoi.ResolveModel(model, baseURL, modelIDFlag, apiKeyEnv)
+	if errors.Is(err, howdoi.ErrUnsupportedModel) && isTerminal(os.Stderr) {
+		if c, perr := pickModel(model); perr == nil {
+			// Raw IDs without an alias go to the OpenAI API, as
+			// with --model-id.
+			model = c.name()
+			if c.alias == "" {
+				modelIDFlag = c.id
+			}
+			m, err = howdoi.ResolveModel(model, baseURL, modelIDFlag, apiKeyEnv)
+		}
+	}
+	if errors.Is(err, howdoi.ErrNoAPIKey) && snap == nil && !offline && !dryRun && len(compare) == 0 {
+		need := howdoi.Capabilities{JSONMode: jsonOutput, Tools: len(toolNames) > 0, Thinking: thinking > 0}
+		if alias := degradeModel(model, m.ModelID, m.Vendor.KeyEnv, need, fallbackAny); alias != "" {
+			model, modelIDFlag = alias, ""
+			m, err = howdoi.ResolveModel(model, "", "", "")
+		}
+	}
+	if snap != nil {
+		m, err = snap.Resolve()
+	}
+	if offline {
+		if web {
+			log.Println("Error: --web can't be combined with --offline")
+			os.Exit(exitUsage)
+		}
+		// Checked before err, which may only be a missing cloud API key.
+		if err := checkOffline(m, storeIDs, fallback); err != nil {
+			log.Println("Error:", err)
+			os.Exit(exitUsage)
+		}
+	}
+	// A dry run sends nothing, so it needs no key.
+	if err != nil && !(dryRun && errors.Is(err, howdoi.ErrNoAPIKey)) {
+		if errors.Is(err, howdoi.ErrNoAPIKey) {
+			err = fmt.Errorf("%w, with howdoi auth set", err)
+		}
+		log.Println("Error:", err)
+		os.Exit(exitCode(err))
+	}
+	modelID, provider := m.ModelID, m.Provider
+	var betas []string
+	for _, b := range anthropicBetas {
+		betas = append(betas, howdoi.AnthropicBeta(b))
+	}
+	headers := make(map[string]string, len(settings.Headers))
+	for k, v := range settings.Headers {
+		headers[k] = os.ExpandEnv(v)
+	}
+
+	systemMessage, err := readSystemPrompt(systemPrompt)
+	if err != nil {
+		log.Println("Error reading system prompt file:", err)
+		os.Exit(exitUsage)
+	}
+
+	stdinContent, err := readStdin()
+	if err != nil {
+		log.Println("Error reading stdin:", err)
+		os.Exit(exitCode(err))
+	}
+
+	var promptText string
+	if promptName != "" {
+		tmplText, err := loadPromptTemplate(promptName)
+		if err != nil {
+			log.Println("Error:", err)
+			os.Exit(exitUsage)
+		}
+		promptText, args, err = renderPromptTemplate(tmplText, args)
+		if err != nil {
+			log.Println("Error rendering the prompt template:", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	var clip []byte
+	var clipImage bool
+	if paste {
+		clip, clipImage, err = readClipboard()
+		if err != nil {
+			log.Println("Error reading the clipboard:", err)
+			os.Exit(exitCode(err))
+		}
+	}
+
+	// Without anything to ask on a terminal, or with --edit, the
+	// prompt is written in the editor, starting from the text
+	// arguments.
+	noInput := snap == nil && len(args) == 0 && len(globs) == 0 && stdinContent == "" && promptText == "" && len(clip) == 0
+	if edit || (noInput && isTerminal(os.Stdin) && isTerminal(os.Stderr)) {
+		if snap != nil {
+			log.Println("Error: --edit can't be combined with --from-prompt")
+			os.Exit(exitUsage)
+		}
+		var draft, attached, rest []string
+		for _, a := range args {
+			if howdoi.IsFile(a) || howdoi.IsURL(a) {
+				attached = append(attached, a)
+				rest = append(rest, a)
+			} else {
+				draft = append(draft, a)
+			}
+		}
+		prompt, err := editPrompt(strings.Join(draft, "\n"), model, attached)
+		if err != nil {
+			log.Println("Error editing the prompt:", err)
+			os.Exit(exitCode(err))
+		}
+		if prompt == "" {
+			log.Println("Error: the prompt is empty, nothing was sent")
+			os.Exit(exitUsage)
+		}
+		args = append(rest, prompt)
+	}
+
+	// Combine context and user message
+	if snap == nil && len(args) <= 0 && len(globs) == 0 && stdinContent == "" && promptText == "" && len(clip) == 0 {
+		log.Println("Error: No messages provided")
+		os.Exit(exitUsage)
+	}
+
+	message := howdoi.Message{Role: "user"}
+	var attachments []howdoi.Attachment
+	if pdfHybrid && pdfAsImages {
+		log.Println("Error: --pdf-hybrid and --pdf-as-images can't be combined")
+		os.Exit(exitUsage)
+	}
+	// The text arguments are the question long web pages are
+	// clipped to.
+	question := []string{promptText}
+	for _, a := range args {
+		if !howdoi.IsFile(a) && !howdoi.IsURL(a) {
+			question = append(question, a)
+		}
+	}
+	loadOpts := howdoi.LoadOptions{
+		Provider:      provider,
+		ModelID:       modelID,
+		PDFHybrid:     pdfHybrid,
+		PDFAsImages:   pdfAsImages,
+		Question:      strings.TrimSpace(strings.Join(question, "\n")),
+		MaxPageTokens: maxPageTokens,
+		Render:        render,
+		Wayback:       wayback,
+		Refresh:       refresh,
+		Rows:          tableRows,
+		Depth:         depth,
+		MaxLinks:      maxLinks,
+	}
+	loadOpts.Embeddings, err = clipEmbeddings(settings.Embeddings, m.Vendor)
+	if err != nil {
+		log.Println("Error in the config file:", err)
+		os.Exit(exitUsage)
+	}
+	if !noCtx {
+		files, err := pc.contextFiles()
+		if err != nil {
+			log.Println("Error reading the context:", err)
+			os.Exit(exitUsage)
+		}
+		for _, f := range files {
+			parts, att, err := howdoi.LoadFile(f, loadOpts)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			message.Content = append(message.Content, parts...)
+			attachments = append(attachments, *att)
+		}
+	}
+	// --context documents go in the system prompt, apart from the
+	// question and what it is about.
+	var systemContext string
+	if len(contextArgs) > 0 {
+		var contextAttachments []howdoi.Attachment
+		systemContext, contextAttachments, err = loadSystemContext(contextArgs, loadOpts, concurrency)
+		if err != nil {
+			log.Println("Error:", err)
+			os.Exit(exitCode(err))
+		}
+		attachments = append(attachments, contextAttachments...)
+	}
+	if stdinContent != "" {
+		lang := howdoi.DetectLanguage("", stdinContent)
+		doc, err := howdoi.RenderDocument(howdoi.Document{Source: "stdin", Language: lang, Content: stdinContent})
+		if err != nil {
+			log.Println("Error:", err)
+			os.Exit(exitCode(err))
+		}
+		message.Content = append(message.Content, doc)
+		attachments = append(attachments, *howdoi.NewAttachment("stdin", "stdin", lang, []byte(stdinContent)))
+	}
+	if clipImage {
+		attachments = append(attachments, *howdoi.NewAttachment("clipboard", "clipboard", "png", clip))
+		ext, img, err := howdoi.PrepareImage("", ".png", clip)
+		if err != nil {
+			log.Println("Error preparing the clipboard image:", err)
+			os.Exit(exitCode(err))
+		}
+		message.Content = append(message.Content, howdoi.NewImageContent(provider, ext, img))
+	} else if text := strings.TrimSpace(string(clip)); text != "" {
+		lang := howdoi.DetectLanguage("", text)
+		doc, err := howdoi.RenderDocument(howdoi.Document{Source: "clipboard", Language: lang, Content: text})
+		if err != nil {
+			log.Println("Error:", err)
+			os.Exit(exitCode(err))
+		}
+		message.Content = append(message.Content, doc)
+		attachments = append(attachments, *howdoi.NewAttachment("clipboard", "clipboard", lang, []byte(text)))
+	}
+	// questionParts are the indexes of the text arguments in the
+	// content, the rest being documents.
+	var questionParts []int
+	// Files found by walking directories and globs, with their
+	// estimated tokens.
+	walked := map[string]int{}
+	// toLoad are the files, URLs, and text arguments to load, and
+	// fromWalk marks the files found by walking.
+	var toLoad []string
+	var fromWalk []bool
+	addWalked := func(files []string) {
+		for _, f := range files {
+			toLoad = append(toLoad, f)
+			fromWalk = append(fromWalk, true)
+		}
+	}
+	if len(globs) > 0 {
+		files, err := globFiles(globs)
+		if err != nil {
+			log.Println("Error matching --glob:", err)
+			os.Exit(exitUsage)
+		}
+		if len(files) == 0 {
+			log.Println("Error: no files match --glob", strings.Join(globs, ", "))
+			os.Exit(exitUsage)
+		}
+		addWalked(files)
+	}
+	// The retrieved chunks go after the globbed files.
+	ragAt := len(toLoad)
+	var ragParts []any
+	var ragAttachments []howdoi.Attachment
+	if ragIndex != "" {
+		chunks, err := retrieveChunks(ragIndex, loadOpts.Question, topK)
+		if err != nil {
+			log.Println("Error searching the index:", err)
+			os.Exit(exitCode(err))
+		}
+		for _, c := range chunks {
+			lang := howdoi.DetectLanguage(c.path, c.content)
+			doc, err := howdoi.RenderDocument(howdoi.Document{Source: c.source(), Language: lang, Content: c.content})
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			ragParts = append(ragParts, doc)
+			ragAttachments = append(ragAttachments, *howdoi.NewAttachment(c.source(), "rag", ragIndex, []byte(c.content)))
+		}
+	}
+	// Models without a web search tool of their own get the pages of
+	// the top results, ahead of the arguments.
+	webFallback := web && snap == nil && !howdoi.NativeWebSearch(provider, m.Vendor)
+	if webFallback {
+		ws := cfg.WebSearch
+		engine := howdoi.SearchEngine{Provider: ws.Provider, URL: ws.URL, KeyEnv: ws.KeyEnv}
+		urls, err := howdoi.SearchWeb(context.Background(), engine, loadOpts.Question, webResults)
+		if errors.Is(err, howdoi.ErrNoSearchEngine) {
+			log.Printf("Error: %s has no web search tool, set a search API under web_search in the config file\n", model)
+			os.Exit(exitUsage)
+		}
+		if err != nil {
+			log.Println("Error:", err)
+			os.Exit(exitCode(err))
+		}
+		if len(urls) == 0 {
+			log.Println("Warning: the web search found no results")
+		}
+		if verbose {
+			log.Println("Attaching the top results:", strings.Join(urls, " "))
+		}
+		for _, u := range urls {
+			toLoad = append(toLoad, u)
+			fromWalk = append(fromWalk, false)
+		}
+	}
+	for _, a := range args {
+		if fi, err := os.Stat(a); err == nil && fi.IsDir() {
+			files, err := walkFiles(a, nil)
+			if err != nil {
+				log.Println("Error reading the directory:", err)
+				os.Exit(exitUsage)
+			}
+			addWalked(files)
+			continue
+		}
+		if offline && !howdoi.IsFile(a) && howdoi.IsURL(a) && !howdoi.IsLocalURL(a) {
+			log.Printf("Error: %s is not on localhost, which --offline does not allow\n", a)
+			os.Exit(exitUsage)
+		}
+		toLoad = append(toLoad, a)
+		fromWalk = append(fromWalk, false)
+	}
+
+	results := loadArgs(toLoad, loadOpts, concurrency)
+	for i := 0; i <= len(results); i++ {
+		if i == ragAt {
+			message.Content = append(message.Content, ragParts...)
+			attachments = append(attachments, ragAttachments...)
+		}
+		if i == len(results) {
+			break
+		}
+		l := results[i]
+		if l.err != nil {
+			log.Println("Error:", l.err)
+			os.Exit(exitCode(l.err))
+		}
+		if l.att == nil {
+			questionParts = append(questionParts, len(message.Content))
+		}
+		message.Content = append(message.Content, l.parts...)
+		if l.att != nil {
+			attachments = append(attachments, *l.att)
+		}
+		if fromWalk[i] {
+			walked[l.arg] = howdoi.EstimateContentTokens(l.parts)
+		}
+	}
+
+	if promptText != "" {
+		questionParts = append(questionParts, len(message.Content))
+		message.Content = append(message.Content, howdoi.TextContent{Type: "text", Text: promptText})
+	}
+	if questionFirst || repeatQuestion {
+		message.Content = orderContent(message.Content, questionParts, questionFirst, repeatQuestion)
+	}
+	warnContextWindow(modelID, walked)
+
+	var schema map[string]any
+	if schemaFile != "" {
+		if !jsonOutput {
+			log.Println("Error: --schema requires --json")
+			os.Exit(exitUsage)
+		}
+		schema, err = howdoi.LoadSchema(schemaFile)
+		if err != nil {
+			log.Println("Error reading the schema:", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	tools, err := lookupTools(toolNames)
+	if err != nil {
+		log.Println("Error:", err)
+		os.Exit(exitUsage)
+	}
+	// Tool output and search results change from run to run, so
+	// answers that used them are not cached.
+	if len(tools) > 0 || codeExec || search || web {
+		noCache = true
+	}
+
+	var conv *Conversation
+	if continueConv || resumeID != 0 {
+		conv, err = loadConversation(resumeID)
+		if err != nil {
+			log.Println("Error loading the conversation:", err)
+			os.Exit(exitUsage)
+		}
+		// The conversation keeps its system prompt over the
+		// defaults; --system replaces it for this and later turns.
+		if systemMessage == "" || (!systemFlag && conv.System != "") {
+			systemMessage = conv.System
+		}
+	}
+
+	messages := []howdoi.Message{message}
+	if conv != nil {
+		messages = nil
+		for _, m := range conv.Messages {
+			messages = append(messages, howdoi.Message{Role: m.Role, Content: howdoi.AdaptContent(provider, m.Content)})
+		}
+		messages = append(messages, message)
+	}
+	metadata := mergeMaps(settings.Metadata, tags)
+	if snap != nil {
+		systemMessage, messages, schema, metadata = snap.System, snap.Messages, snap.Schema, snap.Metadata
+		message = messages[len(messages)-1]
+	}
+
+	q := Query{
+		Request: howdoi.Request{
+			Model:          model,
+			ModelID:        modelID,
+			Provider:       provider,
+			Vendor:         m.Vendor,
+			URL:            m.URL,
+			APIKey:         m.APIKey,
+			System:         systemMessage,
+			Messages:       messages,
+			MaxTokens:      maxTokens,
+			Temperature:    temperature,
+			StoreIDs:       storeIDs,
+			Thinking:       thinking,
+			Verbose:        verbose,
+			JSONMode:       jsonOutput,
+			Schema:         schema,
+			Tools:          tools,
+			CodeExecution:  codeExec,
+			GoogleSearch:   search,
+			WebSearch:      web && !webFallback,
+			Headers:        headers,
+			Betas:          betas,
+			Metadata:       metadata,
+			MetadataHeader: settings.MetadataHeader,
+		},
+		Quiet:      jsonOutput,
+		Markdown:   useMarkdown(raw),
+		Width:      answerWidth(),
+		MaxWait:    maxWait,
+		Timeout:    timeout,
+		MaxRetries: maxRetries,
+	}
+	if systemContext != "" && snap == nil {
+		// Sent with this turn only: the conversation keeps the system
+		// prompt without it, so --continue does not add it again.
+		q.System = strings.TrimSpace(q.System + "\n\n" + systemContext)
+	}
+	if fallback == "" {
+		// Without a model to switch to, wait for the overload to pass.
+		q.OverloadRetries = maxRetries
+	}
+	if toFormat != "" {
+		// The answer is printed once it parses.
+		q.System = strings.TrimSpace(q.System + "\n\n" + formatInstructions[toFormat])
+		q.Quiet = true
+	}
+	if codeOnly != "" {
+		// The code is printed once the whole answer is in.
+		q.Quiet = true
+	}
+	if webFallback {
+		q.System = strings.TrimSpace(q.System + "\n\n" + webCitationInstruction)
+	}
+	if unbuffered {
+		// Rendering waits for the whole answer and wrapping for the
+		// end of each word.
+		q.Markdown, q.Width = false, 0
+	}
+	q.LineBuffered = lineBuffered
+
+	if dryRun {
+		printDryRun(os.Stdout, q)
+		return
+	}
+
+	if len(compare) > 0 {
+		if confirmOver > 0 {
+			if err := checkConfirmOver(q, compare, confirmOver); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+		}
+		printCompare(runCompare(q, compare), compareColumns)
+		return
+	}
+
+	if err := howdoi.CheckCapabilities(q.Request); err != nil {
+		log.Println("Error:", err)
+		os.Exit(exitUsage)
+	}
+	if savePrompt != "" {
+		if err := howdoi.SaveSnapshot(savePrompt, q.Request); err != nil {
+			log.Println("Error saving the prompt:", err)
+			os.Exit(exitCode(err))
+		}
+	}
+
+	// stdout is teed to --output, which gets the raw answer even when
+	// stdout shows it rendered.
+	stdout := io.Writer(os.Stdout)
+	if outputFile != "" {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			log.Println("Error creating the output file:", err)
+			os.Exit(exitUsage)
+		}
+		defer f.Close()
+		if outputPrompt && loadOpts.Question != "" {
+			fmt.Fprintf(f, "# %s\n\n", strings.Join(strings.Fields(loadOpts.Question), " "))
+		}
+		q.Output = f
+		stdout = io.MultiWriter(os.Stdout, f)
+	}
+
+	var res Result
+	cached := false
+	if !noCache {
+		res.Answer, cached = lookupCachedResponse(q)
+	}
+	if cached {
+		if verbose {
+			log.Println("Using the cached response")
+		}
+		printAnswer(res.Answer, q)
+		if q.Output != nil && !q.Quiet {
+			io.WriteString(q.Output, res.Answer)
+		}
+	} else {
+		if confirmOver > 0 {
+			if err := checkConfirmOver(q, nil, confirmOver); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+		}
+		res, err = runQuery(q)
+		if (errors.Is(err, errNoFirstToken) || errors.Is(err, howdoi.ErrOverloaded)) && fallback != "" {
+			log.Printf("%s: %v, retrying with %s\n", model, err, fallback)
+			fm, ferr := howdoi.ResolveModel(fallback, "", "", "")
+			if ferr != nil {
+				log.Println("Error:", ferr)
+				os.Exit(exitCode(ferr))
+			}
+			model, modelID = fallback, fm.ModelID
+			q.Model, q.ModelID, q.Provider, q.Vendor, q.URL, q.APIKey = fallback, fm.ModelID, fm.Provider, fm.Vendor, fm.URL, fm.APIKey
+			q.MaxWait = 0
+			q.OverloadRetries = maxRetries
+			for i, msg := range q.Messages {
+				q.Messages[i].Content = howdoi.AdaptContent(fm.Provider, msg.Content)
+			}
+			if err := howdoi.CheckCapabilities(q.Request); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitUsage)
+			}
+			res, err = runQuery(q)
+		}
+		if errors.Is(err, errInterrupted) {
+			os.Exit(exitInterrupted)
+		}
+		if err != nil {
+			log.Println("Error calling the API:", err)
+			if jsonOutput {
+				writeJSONError(stdout, modelID, err)
+			}
+			os.Exit(exitCode(err))
+		}
+		if !noCache {
+			if err := storeCachedResponse(q, res.Answer); err != nil {
+				log.Println("Error caching the response:", err)
+			}
+		}
+	}
+
+	if toFormat != "" {
+		res.Answer, err = convertAnswer(q, res.Answer, toFormat)
+		if err != nil {
+			log.Println("Error:", err)
+			os.Exit(exitCode(err))
+		}
+		fmt.Fprintln(stdout, res.Answer)
+	}
+
+	if codeOnly != "" {
+		code, ok := extractCode(res.Answer, codeOnly == "first")
+		if !ok {
+			log.Println("Error: the answer has no code blocks")
+			os.Exit(exitError)
+		}
+		io.WriteString(stdout, code)
+	}
+
+	if jsonOutput {
+		answer, err := howdoi.ParseJSONAnswer(res.Answer, schema)
+		if err != nil {
+			log.Println("Error:", err)
+			writeJSONError(stdout, modelID, err)
+			os.Exit(exitCode(err))
+		}
+		out := JSONOutput{Model: modelID, Answer: answer, Reasoning: res.Reasoning, Cached: cached}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			log.Println("Error encoding the output:", err)
+			os.Exit(exitCode(err))
+		}
+	}
+
+	if q.Output != nil && !q.Quiet && !strings.HasSuffix(res.Answer, "\n") {
+		io.WriteString(q.Output, "\n")
+	}
+
+	if copyAnswer {
+		if err := writeClipboard(res.Answer); err != nil {
+			log.Println("Error copying the answer:", err)
+		}
+	}
+
+	if shareAnswer {
+		question := ""
+		if sharePrompt {
+			question = loadOpts.Question
+		}
+		link, err := share(shareText(modelID, question, res.Answer), shareURL)
+		if err != nil {
+			log.Println("Error sharing the answer:", err)
+		} else {
+			log.Println("Shared:", link)
+		}
+	}
+
+	if !noHistory {
+		var convID int64
+		if conv != nil {
+			convID = conv.ID
+		}
+		reply := howdoi.Message{Role: "assistant", Content: []any{howdoi.TextContent{Type: "text", Text: res.Answer}}}
+		id, err := saveExchange(convID, model, systemMessage, attachments, res.Usage, res.Cost, message, reply)
+		if err != nil {
+			log.Println("Error saving the conversation:", err)
+		} else if captionImages && mayTitle(m, offline) {
+			captionAttachments(id, message, attachments, verbose)
+		}
+	}
+}
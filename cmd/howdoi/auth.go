@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// readKey reads an API key, without echoing it when stdin is a terminal.
+func readKey(provider string) (string, error) {
+	if isTerminal(os.Stdin) {
+		fmt.Fprintf(os.Stderr, "%s API key: ", provider)
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return strings.TrimSpace(string(b)), err
+	}
+	b, err := io.ReadAll(os.Stdin)
+	return strings.TrimSpace(string(b)), err
+}
+
+// providerKeyEnv returns the environment variable a provider's key stands in
+// for, exiting on unknown providers.
+func providerKeyEnv(provider string) string {
+	env, err := howdoi.KeyEnv(provider)
+	if err != nil {
+		log.Printf("Error: %v (known providers: %s)", err, strings.Join(howdoi.Providers(), ", "))
+		os.Exit(exitUsage)
+	}
+	return env
+}
+
+func newAuthCmd() *cobra.Command {
+	authCmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Manage API keys stored in the OS keychain",
+		Long: `Manage API keys stored in the OS keychain. A stored key is used
+before the provider's environment variable.`,
+	}
+
+	authCmd.AddCommand(&cobra.Command{
+		Use:   "set <provider>",
+		Short: "Store a provider's API key, read from the terminal or stdin",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			env := providerKeyEnv(args[0])
+			key, err := readKey(args[0])
+			if err != nil {
+				log.Println("Error reading the key:", err)
+				os.Exit(exitCode(err))
+			}
+			if key == "" {
+				log.Println("Error: the key is empty")
+				os.Exit(exitUsage)
+			}
+			if err := howdoi.SetStoredKey(env, key); err != nil {
+				log.Println("Error storing the key:", err)
+				os.Exit(exitCode(err))
+			}
+			fmt.Fprintf(os.Stderr, "Stored the %s key in the keychain\n", args[0])
+		},
+	})
+
+	authCmd.AddCommand(&cobra.Command{
+		Use:   "rm <provider>",
+		Short: "Remove a provider's API key from the keychain",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := howdoi.DeleteStoredKey(providerKeyEnv(args[0])); err != nil {
+				log.Println("Error removing the key:", err)
+				os.Exit(exitCode(err))
+			}
+		},
+	})
+
+	authCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Show where each provider's API key comes from",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, p := range howdoi.Providers() {
+				env, err := howdoi.KeyEnv(p)
+				if err != nil {
+					continue
+				}
+				source := "not set"
+				stored, err := howdoi.StoredKey(env)
+				switch {
+				case err != nil:
+					source = "keychain error: " + err.Error()
+				case stored:
+					source = "keychain"
+				case os.Getenv(env) != "":
+					source = env
+				}
+				fmt.Printf("%-12s %s\n", p, source)
+			}
+		},
+	})
+
+	return authCmd
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// cacheKey hashes everything in the query that affects the answer.
+func cacheKey(q Query) (string, error) {
+	b, err := json.Marshal(struct {
+		Model       string
+		System      string
+		Messages    []howdoi.Message
+		MaxTokens   int
+		Temperature float32
+		StoreIDs    []string
+		Thinking    int
+		JSONMode    bool
+		Schema      map[string]any
+	}{q.ModelID, q.System, q.Messages, q.MaxTokens, q.Temperature, q.StoreIDs, q.Thinking, q.JSONMode, q.Schema})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lookupCachedResponse returns the cached answer for the query, if any.
+// Cache errors are treated as misses.
+func lookupCachedResponse(q Query) (string, bool) {
+	key, err := cacheKey(q)
+	if err != nil {
+		return "", false
+	}
+	db, err := openDB()
+	if err != nil {
+		return "", false
+	}
+	defer db.Close()
+
+	var response string
+	err = db.QueryRow("SELECT response FROM cache WHERE key = ?", key).Scan(&response)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("Error reading the response cache:", err)
+		}
+		return "", false
+	}
+	return response, true
+}
+
+func storeCachedResponse(q Query, response string) error {
+	key, err := cacheKey(q)
+	if err != nil {
+		return err
+	}
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("INSERT OR REPLACE INTO cache (key, model, response) VALUES (?, ?, ?)", key, q.ModelID, response)
+	return err
+}
+
+func newCacheCmd() *cobra.Command {
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the response cache",
+	}
+
+	cacheCmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Delete all cached responses and rendered PDF pages",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			db, err := openDB()
+			if err != nil {
+				log.Println("Error opening the database:", err)
+				os.Exit(exitCode(err))
+			}
+			defer db.Close()
+			res, err := db.Exec("DELETE FROM cache")
+			if err != nil {
+				log.Println("Error clearing the cache:", err)
+				os.Exit(exitCode(err))
+			}
+			n, _ := res.RowsAffected()
+			pages, err := howdoi.ClearPageCache()
+			if err != nil {
+				log.Println("Error clearing the page cache:", err)
+				os.Exit(exitCode(err))
+			}
+			fmt.Printf("Removed %d cached responses and %d rendered pages and images\n", n, pages)
+		},
+	})
+
+	return cacheCmd
+}
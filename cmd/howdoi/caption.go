@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+const captionSystemPrompt = "Describe the image in one line of at most 20 words, naming what it shows and any text in it that matters. Reply with only the description."
+
+// imageData returns the bytes of an image content part.
+func imageData(part any) ([]byte, bool) {
+	switch v := part.(type) {
+	case howdoi.ImageContent:
+		if v.Raw != nil {
+			return v.Raw, true
+		}
+		b, err := base64.StdEncoding.DecodeString(v.Source.Data)
+		return b, err == nil
+	case howdoi.ImageContentOpenAI:
+		_, data, ok := strings.Cut(v.ImageURL.Url, ";base64,")
+		if !ok {
+			return nil, false
+		}
+		b, err := base64.StdEncoding.DecodeString(data)
+		return b, err == nil
+	}
+	return nil, false
+}
+
+// generateCaption asks the title model for a one-line description of an
+// image content part.
+func generateCaption(image any) (string, error) {
+	caption, err := askTitleModel(captionSystemPrompt, []any{image}, 60)
+	if err != nil {
+		return "", err
+	}
+	caption, _, _ = strings.Cut(strings.TrimSpace(caption), "\n")
+	if len(caption) > 200 {
+		caption = caption[:197] + "..."
+	}
+	return strings.TrimSpace(caption), nil
+}
+
+func saveCaption(conversationID int64, sum, caption string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(`UPDATE attachments SET caption = ?
+		WHERE sha256 = ? AND caption = '' AND message_id IN (SELECT id FROM messages WHERE conversation_id = ?)`,
+		caption, sum, conversationID)
+	return err
+}
+
+// captionAttachments stores a caption with every image attached to a message,
+// so conversations about images can be found with howdoi history search.
+// Like titles, captions are a nicety, so failures are only logged in
+// verbose mode. Callers check mayTitle first.
+func captionAttachments(conversationID int64, m howdoi.Message, attachments []howdoi.Attachment, verbose bool) {
+	attached := map[string]bool{}
+	for _, a := range attachments {
+		attached[a.SHA256] = true
+	}
+	for _, part := range m.Content {
+		data, ok := imageData(part)
+		if !ok {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		key := hex.EncodeToString(sum[:])
+		// Images without an attachment, such as PDF pages, are skipped.
+		if !attached[key] {
+			continue
+		}
+		delete(attached, key)
+		caption, err := generateCaption(part)
+		if err == nil && caption != "" {
+			err = saveCaption(conversationID, key, caption)
+		}
+		if err != nil && verbose {
+			log.Println("Error generating an image caption:", err)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// costWarnFraction is how much of --max-cost is spent before the chat warns.
+const costWarnFraction = 0.8
+
+const chatHelp = `/model <alias>   switch models, keeping the conversation
+/model           list the models by price
+/cost            show the tokens and cost of the session
+/max-cost <$>    change the session cost ceiling
+/system          show the system prompt pinned to the conversation
+/system <text>   replace it, or remove it with /system clear
+/regen [alias]   send the last message again, with another model if given,
+                 replacing its answer
+/quit            end the session
+
+Ctrl-C stops an answer without ending the session.`
+
+// chatSession is the state of an interactive chat.
+type chatSession struct {
+	q        Query
+	messages []howdoi.Message
+	convID   int64
+	usage    howdoi.Usage
+	cost     float64
+	maxCost  float64
+	warned   bool
+	// last is the last message sent, kept for /regen, and answered whether
+	// its exchange ends the conversation.
+	last      *howdoi.Message
+	answered  bool
+	noHistory bool
+}
+
+// inputPrice is the price in dollars of a million input tokens of a model.
+func inputPrice(modelID string) float64 {
+	return howdoi.CalculateCost(modelID, howdoi.Usage{InputTokens: 1000000})
+}
+
+// printModelPrices lists the aliases from cheapest to most expensive.
+func printModelPrices(w io.Writer) {
+	aliases := make([]string, 0, len(howdoi.Models))
+	for alias := range howdoi.Models {
+		aliases = append(aliases, alias)
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		pi, pj := inputPrice(howdoi.Models[aliases[i]]), inputPrice(howdoi.Models[aliases[j]])
+		if pi != pj {
+			return pi < pj
+		}
+		return aliases[i] < aliases[j]
+	})
+	for _, alias := range aliases {
+		fmt.Fprintf(w, "%-14s $%.2f/M input\n", alias, inputPrice(howdoi.Models[alias]))
+	}
+}
+
+// setModel switches the session to another model, adapting the conversation
+// so far to its provider.
+func (s *chatSession) setModel(alias string) error {
+	m, err := howdoi.ResolveModel(alias, "", "", "")
+	if err != nil {
+		return err
+	}
+	s.q.Model, s.q.ModelID, s.q.Provider, s.q.Vendor, s.q.URL, s.q.APIKey = alias, m.ModelID, m.Provider, m.Vendor, m.URL, m.APIKey
+	for i, msg := range s.messages {
+		s.messages[i].Content = howdoi.AdaptContent(m.Provider, msg.Content)
+	}
+	return nil
+}
+
+// setSystem replaces the system prompt for the rest of the session, and in
+// the history once the conversation is saved.
+func (s *chatSession) setSystem(system string) {
+	s.q.System = system
+	if s.convID == 0 {
+		return
+	}
+	if err := setConversationSystem(s.convID, system); err != nil {
+		log.Println("Error saving the system prompt:", err)
+	}
+}
+
+// command runs a slash command and reports whether the session goes on.
+func (s *chatSession) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/quit", "/exit":
+		return false
+	case "/model":
+		if arg == "" {
+			printModelPrices(os.Stderr)
+			break
+		}
+		if err := s.setModel(arg); err != nil {
+			log.Println("Error:", err)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "Switched to %s ($%.2f/M input)\n", s.q.ModelID, inputPrice(s.q.ModelID))
+	case "/cost":
+		fmt.Fprintf(os.Stderr, "%s, $%.4f", s.usage, s.cost)
+		if s.maxCost > 0 {
+			fmt.Fprintf(os.Stderr, " of $%.2f", s.maxCost)
+		}
+		fmt.Fprintln(os.Stderr)
+	case "/max-cost":
+		v, err := strconv.ParseFloat(strings.TrimPrefix(arg, "$"), 64)
+		if err != nil {
+			log.Println("Error: /max-cost needs an amount in dollars")
+			break
+		}
+		s.maxCost, s.warned = v, false
+	case "/system":
+		if arg == "" {
+			if s.q.System == "" {
+				fmt.Fprintln(os.Stderr, "No system prompt")
+			} else {
+				fmt.Fprintln(os.Stderr, s.q.System)
+			}
+			break
+		}
+		if arg == "clear" {
+			arg = ""
+		}
+		s.setSystem(arg)
+	case "/regen":
+		if s.last == nil {
+			log.Println("Error: there is no message to send again")
+			break
+		}
+		if arg != "" {
+			if err := s.setModel(arg); err != nil {
+				log.Println("Error:", err)
+				break
+			}
+		}
+		s.send(*s.last, s.answered)
+	default:
+		fmt.Fprintln(os.Stderr, chatHelp)
+	}
+	return true
+}
+
+// checkCeiling refuses to send once the session cost reaches --max-cost and
+// warns once when it gets close, or when the next request could cross it.
+func (s *chatSession) checkCeiling() bool {
+	if s.maxCost <= 0 {
+		return true
+	}
+	if s.cost >= s.maxCost {
+		log.Printf("The session cost ceiling of $%.2f is reached ($%.4f spent). Raise it with /max-cost or end the session.\n", s.maxCost, s.cost)
+		return false
+	}
+	if !s.warned && (s.cost >= costWarnFraction*s.maxCost || s.cost+howdoi.EstimateCost(s.q.Request) > s.maxCost) {
+		s.warned = true
+		log.Printf("Warning: $%.4f of the $%.2f session ceiling is spent. Switch to a cheaper model with /model <alias> (/model lists them).\n", s.cost, s.maxCost)
+	}
+	return true
+}
+
+// ask sends a message with the conversation so far.
+func (s *chatSession) ask(text string) {
+	s.send(howdoi.Message{Role: "user", Content: []any{howdoi.TextContent{Type: "text", Text: text}}}, false)
+}
+
+// send sends a message and keeps the exchange when it completes. With
+// replace, the message is that of the last exchange, whose answer the new one
+// replaces; until it completes the old answer stays.
+func (s *chatSession) send(message howdoi.Message, replace bool) {
+	history := s.messages
+	if replace {
+		history = history[:len(history)-2]
+	} else {
+		s.last, s.answered = &message, false
+	}
+	s.q.Messages = append(history[:len(history):len(history)], message)
+	if !s.checkCeiling() {
+		return
+	}
+	if err := howdoi.CheckCapabilities(s.q.Request); err != nil {
+		log.Println("Error:", err)
+		return
+	}
+	res, err := runQuery(s.q)
+	s.usage = s.usage.Add(res.Usage)
+	s.cost += res.Cost
+	if errors.Is(err, errInterrupted) {
+		// The partial answer is dropped along with its question, which
+		// /regen sends again.
+		return
+	}
+	if err != nil {
+		log.Println("Error calling the API:", err)
+		return
+	}
+	if !s.q.Markdown && !strings.HasSuffix(res.Answer, "\n") {
+		fmt.Println()
+	}
+	reply := howdoi.Message{Role: "assistant", Content: []any{howdoi.TextContent{Type: "text", Text: res.Answer}}}
+	s.messages = append(history, message, reply)
+	s.answered = true
+	if replace {
+		if s.convID != 0 {
+			if err := replaceLastReply(s.convID, s.q.Model, res.Usage, res.Cost, reply); err != nil {
+				log.Println("Error saving the conversation:", err)
+			}
+		}
+		return
+	}
+	if !s.noHistory {
+		id, err := saveExchange(s.convID, s.q.Model, s.q.System, nil, res.Usage, res.Cost, message, reply)
+		if err != nil {
+			log.Println("Error saving the conversation:", err)
+			return
+		}
+		// The title is written while the chat goes on. One that is not
+		// done before the chat ends is made by howdoi history list.
+		if s.convID == 0 && mayTitle(howdoi.ResolvedModel{Vendor: s.q.Vendor, URL: s.q.URL}, false) {
+			go titleConversation(id, message, reply, s.q.Verbose)
+		}
+		s.convID = id
+	}
+}
+
+func newChatCmd() *cobra.Command {
+	var model string
+	var systemPrompt string
+	var maxTokens int
+	var temperature float32
+	var maxCost float64
+	var resumeID int64
+	var noHistory bool
+	var raw bool
+
+	cmd := &cobra.Command{
+		Use:   "chat",
+		Short: "Chat with a model interactively",
+		Long:  "Chat with a model, one message per line, keeping the conversation in the history. The prompt shows the cost of the session so far, and --max-cost sets a ceiling: howdoi warns when it gets close and stops sending once it is reached. Ctrl-C stops an answer without ending the session, and /regen sends the last message again, optionally to another model. Type /help for the commands, such as /model to switch to a cheaper model mid-session.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			s := &chatSession{
+				q: Query{
+					Request: howdoi.Request{
+						System:      systemPrompt,
+						MaxTokens:   maxTokens,
+						Temperature: temperature,
+					},
+					Markdown:        useMarkdown(raw),
+					Width:           answerWidth(),
+					MaxRetries:      defaultMaxRetries,
+					OverloadRetries: defaultMaxRetries,
+				},
+				maxCost:   maxCost,
+				noHistory: noHistory,
+			}
+			if resumeID != 0 {
+				conv, err := loadConversation(resumeID)
+				if err != nil {
+					log.Println("Error loading the conversation:", err)
+					os.Exit(exitCode(err))
+				}
+				s.convID, s.messages = conv.ID, conv.Messages
+				if s.q.System == "" {
+					s.q.System = conv.System
+				}
+				if !cmd.Flags().Changed("model") {
+					model = conv.Model
+				}
+			}
+			if err := s.setModel(model); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+
+			in := bufio.NewReader(os.Stdin)
+			for {
+				fmt.Fprintf(os.Stderr, "%s $%.4f> ", s.q.Model, s.cost)
+				line, err := in.ReadString('\n')
+				line = strings.TrimSpace(line)
+				if line != "" {
+					if strings.HasPrefix(line, "/") {
+						if !s.command(line) {
+							return
+						}
+					} else {
+						s.ask(line)
+					}
+				}
+				if err != nil {
+					fmt.Fprintln(os.Stderr)
+					return
+				}
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&model, "model", "m", "sonnet", "Model to start with")
+	cmd.Flags().StringVarP(&systemPrompt, "system", "s", "", "System prompt")
+	cmd.Flags().IntVarP(&maxTokens, "max-tokens", "t", 4096, "Maximum number of tokens to generate per answer")
+	cmd.Flags().Float32VarP(&temperature, "temperature", "e", 0.10, "Temperature")
+	cmd.Flags().Float64Var(&maxCost, "max-cost", 0, "Session cost ceiling in dollars: warn when close and stop sending once reached")
+	cmd.Flags().Int64Var(&resumeID, "resume", 0, "Continue the conversation with this id (see howdoi history list)")
+	cmd.Flags().BoolVar(&noHistory, "no-history", false, "Do not save the session to the history")
+	cmd.Flags().BoolVar(&raw, "raw", false, "Print answers as plain text instead of rendered markdown")
+	return cmd
+}
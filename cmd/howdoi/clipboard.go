@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var errNoClipboard = errors.New("no clipboard tool found, install wl-clipboard or xclip")
+
+// have reports whether a command is on the PATH.
+func have(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+func commandOutput(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
+// readClipboard returns the clipboard contents and whether they are a PNG
+// image, which is preferred when the clipboard holds both.
+func readClipboard() ([]byte, bool, error) {
+	switch {
+	case runtime.GOOS == "darwin":
+		// osascript prints images as «data PNGf89504E47...».
+		if b, err := commandOutput("osascript", "-e", "the clipboard as «class PNGf»"); err == nil {
+			s := strings.TrimSpace(string(b))
+			s = strings.TrimSuffix(strings.TrimPrefix(s, "«data PNGf"), "»")
+			if png, err := hex.DecodeString(s); err == nil {
+				return png, true, nil
+			}
+		}
+		b, err := commandOutput("pbpaste")
+		return b, false, err
+	case runtime.GOOS == "windows":
+		b, err := commandOutput("powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw")
+		return b, false, err
+	case have("wl-paste"):
+		if types, err := commandOutput("wl-paste", "--list-types"); err == nil && bytes.Contains(types, []byte("image/png")) {
+			b, err := commandOutput("wl-paste", "--no-newline", "--type", "image/png")
+			return b, true, err
+		}
+		b, err := commandOutput("wl-paste", "--no-newline")
+		return b, false, err
+	case have("xclip"):
+		if targets, err := commandOutput("xclip", "-selection", "clipboard", "-t", "TARGETS", "-o"); err == nil && bytes.Contains(targets, []byte("image/png")) {
+			b, err := commandOutput("xclip", "-selection", "clipboard", "-t", "image/png", "-o")
+			return b, true, err
+		}
+		b, err := commandOutput("xclip", "-selection", "clipboard", "-o")
+		return b, false, err
+	}
+	return nil, false, errNoClipboard
+}
+
+// writeClipboard puts text on the clipboard.
+func writeClipboard(text string) error {
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "darwin":
+		cmd = exec.Command("pbcopy")
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("clip")
+	case have("wl-copy"):
+		cmd = exec.Command("wl-copy")
+	case have("xclip"):
+		cmd = exec.Command("xclip", "-selection", "clipboard")
+	default:
+		return errNoClipboard
+	}
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+)
+
+// codeBlocks returns the code of the fenced blocks of a markdown answer,
+// following the fences the way the renderer does. The indentation of a
+// fence, as in a list item, is removed from its lines, and a block left open
+// by a cut off answer runs to the end.
+func codeBlocks(md string) []string {
+	var blocks []string
+	var fence, indent string
+	var lines []string
+	for _, line := range strings.Split(md, "\n") {
+		m := mdFenceRe.FindStringSubmatch(line)
+		if fence == "" {
+			if m != nil {
+				fence = m[1]
+				indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			}
+			continue
+		}
+		if m != nil && strings.HasPrefix(m[1], fence[:1]) && len(m[1]) >= len(fence) && m[2] == "" {
+			blocks = append(blocks, strings.TrimRight(strings.Join(lines, "\n"), "\n"))
+			fence, lines = "", nil
+			continue
+		}
+		lines = append(lines, strings.TrimPrefix(line, indent))
+	}
+	if fence != "" {
+		blocks = append(blocks, strings.TrimRight(strings.Join(lines, "\n"), "\n"))
+	}
+	return blocks
+}
+
+// extractCode returns the code of the first block, or of all of them
+// separated by blank lines, with a trailing newline. ok is false when the
+// answer has no code.
+func extractCode(answer string, first bool) (code string, ok bool) {
+	blocks := codeBlocks(answer)
+	if len(blocks) == 0 {
+		return "", false
+	}
+	if first {
+		blocks = blocks[:1]
+	}
+	return strings.Join(blocks, "\n\n") + "\n", true
+}
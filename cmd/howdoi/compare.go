@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+// compareResult is the answer of one model in --compare mode.
+type compareResult struct {
+	model   string
+	res     Result
+	err     error
+	latency time.Duration
+}
+
+// runCompare sends the query to every model at once and waits for all the
+// answers. The content is adapted to each provider.
+func runCompare(q Query, models []string) []compareResult {
+	results := make([]compareResult, len(models))
+	var wg sync.WaitGroup
+	for i, name := range models {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			r := &results[i]
+			r.model = name
+			m, err := howdoi.ResolveModel(name, "", "", "")
+			if err != nil {
+				r.err = err
+				return
+			}
+			mq := q
+			mq.Model, mq.ModelID, mq.Provider, mq.Vendor, mq.URL, mq.APIKey = name, m.ModelID, m.Provider, m.Vendor, m.URL, m.APIKey
+			mq.Quiet = true
+			mq.Messages = make([]howdoi.Message, len(q.Messages))
+			for j, msg := range q.Messages {
+				msg.Content = howdoi.AdaptContent(m.Provider, msg.Content)
+				mq.Messages[j] = msg
+			}
+			if err := howdoi.CheckCapabilities(mq.Request); err != nil {
+				r.err = err
+				return
+			}
+			start := time.Now()
+			r.res, r.err = runQuery(mq)
+			r.latency = time.Since(start)
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
+
+// printCompare prints the answers one after the other with headers, or in
+// columns, followed by the latency, tokens, and cost of each model.
+func printCompare(results []compareResult, columns bool) {
+	texts := make([]string, len(results))
+	for i, r := range results {
+		texts[i] = r.res.Answer
+		if r.err != nil {
+			texts[i] = "Error: " + r.err.Error()
+		}
+	}
+	if columns {
+		cols := make([]string, len(results))
+		for i, r := range results {
+			cols[i] = r.model + "\n\n" + texts[i]
+		}
+		for _, line := range sideBySide(cols, terminalWidth()) {
+			fmt.Println(line)
+		}
+	} else {
+		for i, r := range results {
+			fmt.Printf("=== %s ===\n\n%s\n\n", r.model, texts[i])
+		}
+	}
+
+	fmt.Println("\nmodel\tlatency\tinput\toutput\tcost")
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Printf("%s\t-\t-\t-\t-\n", r.model)
+			continue
+		}
+		fmt.Printf("%s\t%.1fs\t%d\t%d\t$%.4f\n", r.model, r.latency.Seconds(), r.res.Usage.PromptTokens(), r.res.Usage.OutputTokens, r.res.Cost)
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Settings are the values that can be set in the config file, either at the
+// top level or inside a profile. Unset fields leave the flag defaults alone.
+type Settings struct {
+	Model        string   `yaml:"model"`
+	Temperature  *float32 `yaml:"temperature"`
+	MaxTokens    int      `yaml:"max_tokens"`
+	SystemPrompt string   `yaml:"system_prompt"`
+	Verbose      *bool    `yaml:"verbose"`
+	BaseURL      string   `yaml:"base_url"`
+	ModelID      string   `yaml:"model_id"`
+	APIKeyEnv    string   `yaml:"api_key_env"`
+	Fallback     string   `yaml:"fallback"`
+	FallbackAny  *bool    `yaml:"fallback_any"`
+	MaxWait      string   `yaml:"max_wait"`
+	Timeout      string   `yaml:"timeout"`
+	MaxRetries   *int     `yaml:"max_retries"`
+	Budget       float64  `yaml:"budget"`
+	ConfirmOver  float64  `yaml:"confirm_over"`
+	Offline      *bool    `yaml:"offline"`
+	ShareURL     string   `yaml:"share_url"`
+	// QuestionFirst and RepeatQuestion place the question relative to the
+	// attached documents.
+	QuestionFirst  *bool `yaml:"question_first"`
+	RepeatQuestion *bool `yaml:"repeat_question"`
+	// CaptionImages stores a caption of attached images with the history.
+	CaptionImages *bool `yaml:"caption_images"`
+	// Width is the column answers are wrapped at.
+	Width *int `yaml:"width"`
+	// AnthropicBeta lists the Anthropic beta features to turn on.
+	AnthropicBeta []string `yaml:"anthropic_beta"`
+	// Headers are sent with every request, with $VARS expanded, for the
+	// auth of LLM gateways.
+	Headers map[string]string `yaml:"headers"`
+	// Metadata tags every request to a gateway, e.g. user and project.
+	Metadata map[string]string `yaml:"metadata"`
+	// MetadataHeader is the header the gateway reads the metadata from, as
+	// JSON, such as x-portkey-metadata.
+	MetadataHeader string `yaml:"metadata_header"`
+	// Models maps virtual model names to the model IDs sent to the server.
+	Models map[string]string `yaml:"models"`
+	// Embeddings ranks the sections of long web pages: empty for the
+	// embeddings of the model's provider, openai, or none for keywords.
+	Embeddings string `yaml:"embeddings"`
+}
+
+type Config struct {
+	Settings `yaml:",inline"`
+	// Profile is the profile used when --profile is not given.
+	Profile  string              `yaml:"profile"`
+	Profiles map[string]Settings `yaml:"profiles"`
+	// Registry defines model aliases on top of the built-in ones, and
+	// Providers the OpenAI-compatible or Anthropic-compatible APIs they can
+	// use.
+	Registry  map[string]ModelEntry    `yaml:"registry"`
+	Providers map[string]ProviderEntry `yaml:"providers"`
+	// TitleModel generates the titles of new conversations, "none" to
+	// turn them off.
+	TitleModel string `yaml:"title_model"`
+	// Scraper sets how web pages are fetched.
+	Scraper ScraperEntry `yaml:"scraper"`
+	// Network sets the proxy and certificates of every connection.
+	Network NetworkEntry `yaml:"network"`
+	// Images sets how attached images are scaled down and re-encoded.
+	Images ImagesEntry `yaml:"images"`
+	// WebSearch is the search API --web attaches results from for models
+	// without a search tool.
+	WebSearch WebSearchEntry `yaml:"web_search"`
+	// OCRLanguages are the Tesseract languages scans are read in, like
+	// eng+deu.
+	OCRLanguages string `yaml:"ocr_languages"`
+	// ServeToken is the bearer token howdoi serve requires, with $VARS
+	// expanded. A random one is made when it is empty.
+	ServeToken string `yaml:"serve_token"`
+}
+
+// ImagesEntry is the images section of the config file. A max_dimension of
+// -1 sends images at their size.
+type ImagesEntry struct {
+	MaxDimension int `yaml:"max_dimension"`
+	Quality      int `yaml:"quality"`
+}
+
+// WebSearchEntry is the web_search section of the config file. Provider is
+// brave, searxng, or tavily.
+type WebSearchEntry struct {
+	Provider string `yaml:"provider"`
+	URL      string `yaml:"url"`
+	KeyEnv   string `yaml:"key_env"`
+}
+
+// NetworkEntry is the network section of the config file. CACert is a PEM
+// file.
+type NetworkEntry struct {
+	Proxy    string `yaml:"proxy"`
+	CACert   string `yaml:"ca_cert"`
+	Insecure bool   `yaml:"insecure"`
+}
+
+// ScraperEntry is the scraper section of the config file. Delay is a
+// duration such as 2s.
+type ScraperEntry struct {
+	UserAgent      string `yaml:"user_agent"`
+	AcceptLanguage string `yaml:"accept_language"`
+	Delay          string `yaml:"delay"`
+	Timeout        string `yaml:"timeout"`
+}
+
+// ModelEntry is a model alias in the config file. Prices are in dollars per
+// million tokens. The capabilities are only checked when the context window
+// is set, and the output is not limited when max_output is not.
+type ModelEntry struct {
+	ID              string  `yaml:"id"`
+	Provider        string  `yaml:"provider"`
+	InputPrice      float64 `yaml:"input_price"`
+	OutputPrice     float64 `yaml:"output_price"`
+	CacheReadPrice  float64 `yaml:"cache_read_price"`
+	CacheWritePrice float64 `yaml:"cache_write_price"`
+	ContextWindow   int     `yaml:"context_window"`
+	MaxOutput       int     `yaml:"max_output"`
+	Vision          bool    `yaml:"vision"`
+	Audio           bool    `yaml:"audio"`
+	Tools           bool    `yaml:"tools"`
+	JSONMode        bool    `yaml:"json_mode"`
+	Thinking        bool    `yaml:"thinking"`
+	PDF             bool    `yaml:"pdf"`
+}
+
+// ProviderEntry is a provider in the config file. API defaults to openai.
+type ProviderEntry struct {
+	API    string `yaml:"api"`
+	URL    string `yaml:"url"`
+	KeyEnv string `yaml:"key_env"`
+}
+
+// applyRegistry registers the providers and models of the config file.
+func applyRegistry(cfg *Config) error {
+	for name, p := range cfg.Providers {
+		if p.API == "" {
+			p.API = "openai"
+		}
+		v := howdoi.Vendor{API: p.API, URL: p.URL, KeyEnv: p.KeyEnv}
+		if err := howdoi.RegisterVendor(name, v); err != nil {
+			return err
+		}
+	}
+	for alias, m := range cfg.Registry {
+		d := howdoi.ModelDef{
+			ID:       m.ID,
+			Provider: m.Provider,
+			Cost: howdoi.Cost{
+				Input:      m.InputPrice / 1000000,
+				Output:     m.OutputPrice / 1000000,
+				CacheRead:  m.CacheReadPrice / 1000000,
+				CacheWrite: m.CacheWritePrice / 1000000,
+			},
+		}
+		if m.ContextWindow > 0 {
+			if m.MaxOutput == 0 {
+				m.MaxOutput = m.ContextWindow
+			}
+			d.Capabilities = &howdoi.Capabilities{
+				Vision:        m.Vision,
+				Audio:         m.Audio,
+				Tools:         m.Tools,
+				JSONMode:      m.JSONMode,
+				Thinking:      m.Thinking,
+				PDF:           m.PDF,
+				ContextWindow: m.ContextWindow,
+				MaxOutput:     m.MaxOutput,
+			}
+		}
+		if err := howdoi.RegisterModel(alias, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyScraper sets the scraper settings of the config file over the
+// defaults.
+func applyScraper(cfg *Config) error {
+	sc := cfg.Scraper
+	if sc.UserAgent != "" {
+		howdoi.Scraper.UserAgent = sc.UserAgent
+	}
+	if sc.AcceptLanguage != "" {
+		howdoi.Scraper.AcceptLanguage = sc.AcceptLanguage
+	}
+	if sc.Delay != "" {
+		d, err := time.ParseDuration(sc.Delay)
+		if err != nil {
+			return fmt.Errorf("scraper delay: %w", err)
+		}
+		howdoi.Scraper.Delay = d
+	}
+	if sc.Timeout != "" {
+		d, err := time.ParseDuration(sc.Timeout)
+		if err != nil {
+			return fmt.Errorf("scraper timeout: %w", err)
+		}
+		howdoi.Scraper.Timeout = d
+	}
+	return nil
+}
+
+// applyImages sets the image settings of the config file over the defaults.
+func applyImages(cfg *Config) error {
+	im := cfg.Images
+	if im.MaxDimension < 0 {
+		howdoi.Images.MaxDimension = 0
+	} else if im.MaxDimension > 0 {
+		howdoi.Images.MaxDimension = im.MaxDimension
+	}
+	if im.Quality != 0 {
+		if im.Quality < 1 || im.Quality > 100 {
+			return errors.New("images quality must be between 1 and 100")
+		}
+		howdoi.Images.Quality = im.Quality
+	}
+	return nil
+}
+
+// setTransport builds the transport of every connection in one place and
+// sets it as http.DefaultTransport, which http.DefaultClient and the clients
+// howdoi gives the genai SDK use. From the network out, it has the proxy and certificates of the
+// network section of the config file, which the flags override, then offline
+// mode, which refuses connections to other machines, and then the debug log
+// of what offline mode let through.
+func setTransport(cfg *Config, o howdoi.TransportOptions, offline bool, debug io.Writer) error {
+	if o.Proxy == "" {
+		o.Proxy = cfg.Network.Proxy
+	}
+	if len(o.CACerts) == 0 && cfg.Network.CACert != "" {
+		o.CACerts = []string{cfg.Network.CACert}
+	}
+	o.Insecure = o.Insecure || cfg.Network.Insecure
+	t := http.DefaultTransport
+	if o.Proxy != "" || len(o.CACerts) > 0 || o.Insecure {
+		var err error
+		if t, err = howdoi.NewTransport(o); err != nil {
+			return err
+		}
+		if o.Insecure {
+			log.Println("Warning: TLS certificates are not verified")
+		}
+	}
+	if offline {
+		t = howdoi.OfflineTransport{Base: t}
+	}
+	if debug != nil {
+		t = howdoi.NewDebugTransport(debug, t)
+	}
+	http.DefaultTransport = t
+	return nil
+}
+
+// configDir returns the howdoi config directory, following XDG_CONFIG_HOME.
+func configDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "howdoi")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config", "howdoi")
+}
+
+// loadConfig reads the user config file. A missing file is not an error.
+func loadConfig() (*Config, error) {
+	var cfg Config
+	for _, name := range []string{"config.yaml", "config.yml"} {
+		b, err := os.ReadFile(filepath.Join(configDir(), name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(b, &cfg); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", name, err)
+		}
+		break
+	}
+	return &cfg, nil
+}
+
+// settings returns the top level settings overlaid with the named profile.
+func (c *Config) settings(profile string) (Settings, error) {
+	s := c.Settings
+	if profile == "" {
+		profile = c.Profile
+	}
+	if profile == "" {
+		return s, nil
+	}
+	p, ok := c.Profiles[profile]
+	if !ok {
+		return s, fmt.Errorf("unknown profile %q", profile)
+	}
+	if p.Model != "" {
+		s.Model = p.Model
+	}
+	if p.Temperature != nil {
+		s.Temperature = p.Temperature
+	}
+	if p.MaxTokens != 0 {
+		s.MaxTokens = p.MaxTokens
+	}
+	if p.SystemPrompt != "" {
+		s.SystemPrompt = p.SystemPrompt
+	}
+	if p.Verbose != nil {
+		s.Verbose = p.Verbose
+	}
+	if p.BaseURL != "" {
+		s.BaseURL = p.BaseURL
+	}
+	if p.ModelID != "" {
+		s.ModelID = p.ModelID
+	}
+	if p.APIKeyEnv != "" {
+		s.APIKeyEnv = p.APIKeyEnv
+	}
+	if p.Fallback != "" {
+		s.Fallback = p.Fallback
+	}
+	if p.MaxWait != "" {
+		s.MaxWait = p.MaxWait
+	}
+	if p.Timeout != "" {
+		s.Timeout = p.Timeout
+	}
+	if p.MaxRetries != nil {
+		s.MaxRetries = p.MaxRetries
+	}
+	if p.Budget != 0 {
+		s.Budget = p.Budget
+	}
+	if p.ConfirmOver != 0 {
+		s.ConfirmOver = p.ConfirmOver
+	}
+	if p.ShareURL != "" {
+		s.ShareURL = p.ShareURL
+	}
+	if p.CaptionImages != nil {
+		s.CaptionImages = p.CaptionImages
+	}
+	if p.FallbackAny != nil {
+		s.FallbackAny = p.FallbackAny
+	}
+	if p.Width != nil {
+		s.Width = p.Width
+	}
+	if p.AnthropicBeta != nil {
+		s.AnthropicBeta = p.AnthropicBeta
+	}
+	if p.Embeddings != "" {
+		s.Embeddings = p.Embeddings
+	}
+	if p.MetadataHeader != "" {
+		s.MetadataHeader = p.MetadataHeader
+	}
+	s.Headers = mergeMaps(s.Headers, p.Headers)
+	s.Metadata = mergeMaps(s.Metadata, p.Metadata)
+	s.Models = mergeMaps(s.Models, p.Models)
+	return s, nil
+}
+
+// mergeMaps returns base overlaid with override, without modifying either.
+func mergeMaps(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+	m := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		m[k] = v
+	}
+	for k, v := range override {
+		m[k] = v
+	}
+	return m
+}
+
+// applySettings sets every flag that was not given on the command line from
+// the config settings, so flags always win over the config file.
+func applySettings(flags *pflag.FlagSet, s Settings) error {
+	set := func(name, value string) error {
+		if flags.Changed(name) || value == "" {
+			return nil
+		}
+		return flags.Set(name, value)
+	}
+	if err := set("model", s.Model); err != nil {
+		return err
+	}
+	if s.Temperature != nil {
+		if err := set("temperature", fmt.Sprint(*s.Temperature)); err != nil {
+			return err
+		}
+	}
+	if s.MaxTokens != 0 {
+		if err := set("max-tokens", fmt.Sprint(s.MaxTokens)); err != nil {
+			return err
+		}
+	}
+	if err := set("system", s.SystemPrompt); err != nil {
+		return err
+	}
+	if s.Verbose != nil {
+		if err := set("verbose", fmt.Sprint(*s.Verbose)); err != nil {
+			return err
+		}
+	}
+	if err := set("base-url", s.BaseURL); err != nil {
+		return err
+	}
+	if err := set("model-id", s.ModelID); err != nil {
+		return err
+	}
+	if err := set("api-key-env", s.APIKeyEnv); err != nil {
+		return err
+	}
+	if err := set("fallback", s.Fallback); err != nil {
+		return err
+	}
+	if err := set("max-wait", s.MaxWait); err != nil {
+		return err
+	}
+	if err := set("timeout", s.Timeout); err != nil {
+		return err
+	}
+	if s.MaxRetries != nil {
+		if err := set("max-retries", fmt.Sprint(*s.MaxRetries)); err != nil {
+			return err
+		}
+	}
+	if s.Budget != 0 {
+		if err := set("budget", fmt.Sprint(s.Budget)); err != nil {
+			return err
+		}
+	}
+	if s.ConfirmOver != 0 {
+		if err := set("confirm-over", fmt.Sprint(s.ConfirmOver)); err != nil {
+			return err
+		}
+	}
+	if err := set("share-url", s.ShareURL); err != nil {
+		return err
+	}
+	if s.Offline != nil {
+		if err := set("offline", fmt.Sprint(*s.Offline)); err != nil {
+			return err
+		}
+	}
+	if s.QuestionFirst != nil {
+		if err := set("question-first", fmt.Sprint(*s.QuestionFirst)); err != nil {
+			return err
+		}
+	}
+	if s.RepeatQuestion != nil {
+		if err := set("repeat-question", fmt.Sprint(*s.RepeatQuestion)); err != nil {
+			return err
+		}
+	}
+	if s.CaptionImages != nil {
+		if err := set("caption-images", fmt.Sprint(*s.CaptionImages)); err != nil {
+			return err
+		}
+	}
+	if s.FallbackAny != nil {
+		if err := set("fallback-any", fmt.Sprint(*s.FallbackAny)); err != nil {
+			return err
+		}
+	}
+	if s.Width != nil {
+		if err := set("width", fmt.Sprint(*s.Width)); err != nil {
+			return err
+		}
+	}
+	return set("anthropic-beta", strings.Join(s.AnthropicBeta, ","))
+}
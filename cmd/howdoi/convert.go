@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"gopkg.in/yaml.v3"
+)
+
+// maxFormatRetries is how many times the model is asked again when its
+// answer does not parse in the --to format.
+const maxFormatRetries = 2
+
+// formatInstructions are added to the system prompt for each --to format.
+var formatInstructions = map[string]string{
+	"table": "Reply with only a markdown table: a header row, a separator row, and the data rows. No prose before or after it and no code fences.",
+	"csv":   "Reply with only CSV: a header row followed by the data rows, quoting fields as needed. No prose before or after it and no code fences.",
+	"json":  "Reply with only a single valid JSON value. No prose before or after it and no code fences.",
+	"yaml":  "Reply with only a YAML document whose top level is a mapping or a list. No prose before or after it and no code fences.",
+}
+
+var tableSeparator = regexp.MustCompile(`^\|(\s*:?-+:?\s*\|)+$`)
+
+// stripFences removes the code fence models sometimes wrap output in anyway.
+func stripFences(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "```") {
+		s = s[strings.IndexByte(s+"\n", '\n'):]
+		s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+	}
+	return strings.TrimSpace(s)
+}
+
+// parseFormat checks that the answer is in the format and returns it without
+// code fences.
+func parseFormat(format, answer string) (string, error) {
+	s := stripFences(answer)
+	if s == "" {
+		return "", errors.New("the answer is empty")
+	}
+	switch format {
+	case "json":
+		var v any
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return "", err
+		}
+	case "csv":
+		// Records must all have as many fields as the header.
+		if _, err := csv.NewReader(strings.NewReader(s)).ReadAll(); err != nil {
+			return "", err
+		}
+	case "yaml":
+		var v any
+		if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+			return "", err
+		}
+		switch v.(type) {
+		case map[string]any, []any:
+		default:
+			return "", errors.New("the top level is not a mapping or a list")
+		}
+	case "table":
+		lines := strings.Split(s, "\n")
+		if len(lines) < 2 || !tableSeparator.MatchString(strings.TrimSpace(lines[1])) {
+			return "", errors.New("no header and separator rows")
+		}
+		// Escaped pipes are part of a cell.
+		cols := strings.Count(strings.ReplaceAll(lines[0], `\|`, ""), "|")
+		for i, line := range lines {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "|") || !strings.HasSuffix(line, "|") {
+				return "", fmt.Errorf("line %d is not a table row", i+1)
+			}
+			if n := strings.Count(strings.ReplaceAll(line, `\|`, ""), "|"); n != cols {
+				return "", fmt.Errorf("line %d has %d columns instead of %d", i+1, n-1, cols-1)
+			}
+		}
+	default:
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+	return s, nil
+}
+
+// convertAnswer returns the answer in the format, asking the model again
+// with the parse error when it is not.
+func convertAnswer(q Query, answer, format string) (string, error) {
+	for attempt := 0; ; attempt++ {
+		out, err := parseFormat(format, answer)
+		if err == nil {
+			return out, nil
+		}
+		if attempt == maxFormatRetries {
+			return "", fmt.Errorf("the answer is not valid %s after %d retries: %w", format, maxFormatRetries, err)
+		}
+		if q.Verbose {
+			log.Printf("The answer is not valid %s (%v), asking again\n", format, err)
+		}
+		q.Messages = append(slices.Clip(q.Messages),
+			howdoi.Message{Role: "assistant", Content: []any{howdoi.TextContent{Type: "text", Text: answer}}},
+			howdoi.Message{Role: "user", Content: []any{howdoi.TextContent{Type: "text", Text: fmt.Sprintf("That is not valid %s: %v. %s", format, err, formatInstructions[format])}}},
+		)
+		res, err := runQuery(q)
+		if err != nil {
+			return "", err
+		}
+		answer = res.Answer
+	}
+}
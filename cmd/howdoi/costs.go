@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// costGroups are the SQL expressions the costs report can group by. Times are
+// stored in UTC and reported in local time.
+var costGroups = map[string]string{
+	"day":   "date(created_at, 'localtime')",
+	"week":  "strftime('%Y-W%W', created_at, 'localtime')",
+	"month": "strftime('%Y-%m', created_at, 'localtime')",
+	"model": "model",
+}
+
+// recordUsage adds a request and its tags to the usage ledger, with the ids
+// the provider gave its API calls, to match it against the provider's logs.
+func recordUsage(modelID string, usage howdoi.Usage, cost float64, requestIDs []string, tags map[string]string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO usage (model, input_tokens, output_tokens, cache_read_tokens, cache_write_tokens, cost, request_ids) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		modelID, usage.InputTokens, usage.OutputTokens, usage.CacheReadTokens, usage.CacheWriteTokens, cost, strings.Join(requestIDs, " "))
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for k, v := range tags {
+		if _, err := tx.Exec("INSERT INTO usage_tags (usage_id, key, value) VALUES (?, ?, ?)", id, k, v); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// monthSpend returns the dollars spent in the current calendar month.
+func monthSpend() (float64, error) {
+	db, err := openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	var spent float64
+	err = db.QueryRow(`SELECT COALESCE(SUM(cost), 0) FROM usage
+		WHERE strftime('%Y-%m', created_at, 'localtime') = strftime('%Y-%m', 'now', 'localtime')`).Scan(&spent)
+	return spent, err
+}
+
+// budget is the monthly spend limit in dollars of --budget or the config
+// file, or 0 for none.
+var budget float64
+
+// checkBudget refuses the request once the monthly budget is spent and warns
+// when the request could take the spend over it. Models served on this
+// machine cost nothing and are always allowed.
+func checkBudget(req howdoi.Request) error {
+	if budget <= 0 || howdoi.IsLocalURL(req.URL) {
+		return nil
+	}
+	spent, err := monthSpend()
+	if err != nil {
+		return fmt.Errorf("reading the usage ledger: %w", err)
+	}
+	if spent >= budget {
+		return fmt.Errorf("the monthly budget of $%.2f is spent ($%.2f so far)", budget, spent)
+	}
+	if estimate := howdoi.EstimateCost(req); spent+estimate > budget {
+		log.Printf("Warning: this request could cost up to $%.4f, over the $%.2f left of the monthly budget\n", estimate, budget-spent)
+	}
+	return nil
+}
+
+// complete sends the request once checkBudget allows it. Every command sends
+// its requests through it, titles and captions included, so the budget holds
+// for all of them.
+func complete(ctx context.Context, client *howdoi.Client, req howdoi.Request) (<-chan howdoi.Delta, error) {
+	if err := checkBudget(req); err != nil {
+		return nil, err
+	}
+	return client.Complete(ctx, req)
+}
+
+// checkConfirmOver asks on the terminal before sending a request that could
+// cost more than limit: its estimated prompt and MaxTokens of output, to every
+// model compared when there are any. Without a terminal to ask on the
+// request is refused.
+func checkConfirmOver(q Query, compare []string, limit float64) error {
+	modelIDs := []string{q.ModelID}
+	if len(compare) > 0 {
+		modelIDs = nil
+		for _, name := range compare {
+			if m, err := howdoi.ResolveModel(name, "", "", ""); err == nil {
+				modelIDs = append(modelIDs, m.ModelID)
+			}
+		}
+	}
+	input := howdoi.EstimateTokens(q.Request)
+	var inputCost, outputCost float64
+	for _, id := range modelIDs {
+		inputCost += howdoi.CalculateCost(id, howdoi.Usage{InputTokens: input})
+		outputCost += howdoi.CalculateCost(id, howdoi.Usage{OutputTokens: q.MaxTokens})
+	}
+	estimate := inputCost + outputCost
+	if estimate <= limit {
+		return nil
+	}
+	if !isTerminal(os.Stderr) {
+		return fmt.Errorf("the request could cost up to $%.4f, over --confirm-over $%.2f, and there is no terminal to confirm on", estimate, limit)
+	}
+	ok, err := confirm(fmt.Sprintf("This request to %s could cost up to $%.4f, over $%.2f: about %d input tokens ($%.4f) and up to %d output tokens ($%.4f). Send it?",
+		strings.Join(modelIDs, ", "), estimate, limit, input, inputCost, q.MaxTokens, outputCost))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("not sent")
+	}
+	return nil
+}
+
+func newCostsCmd() *cobra.Command {
+	var by string
+	var days int
+
+	cmd := &cobra.Command{
+		Use:     "costs",
+		Aliases: []string{"cost"},
+		Short:   "Report spend from the usage ledger",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			group, ok := costGroups[by]
+			var params []any
+			if key, isTag := strings.CutPrefix(by, "tag:"); isTag && key != "" {
+				// Untagged requests are grouped under "-".
+				group, ok = "COALESCE((SELECT value FROM usage_tags WHERE usage_id = usage.id AND key = ?), '-')", true
+				params = append(params, key)
+			}
+			if !ok {
+				log.Println("Error: --by must be day, week, month, model, or tag:<key>")
+				os.Exit(exitUsage)
+			}
+			db, err := openDB()
+			if err != nil {
+				log.Println("Error opening the database:", err)
+				os.Exit(exitCode(err))
+			}
+			defer db.Close()
+
+			rows, err := db.Query(`SELECT `+group+` AS g, COUNT(*), SUM(input_tokens + cache_read_tokens + cache_write_tokens), SUM(output_tokens), SUM(cost)
+				FROM usage WHERE created_at >= datetime('now', ?)
+				GROUP BY g ORDER BY g`, append(params, fmt.Sprintf("-%d days", days))...)
+			if err != nil {
+				log.Println("Error reading the usage ledger:", err)
+				os.Exit(exitCode(err))
+			}
+			defer rows.Close()
+
+			fmt.Printf("%s\trequests\tinput\toutput\tcost\n", by)
+			var total float64
+			for rows.Next() {
+				var key string
+				var requests, input, output int
+				var cost float64
+				if err := rows.Scan(&key, &requests, &input, &output, &cost); err != nil {
+					log.Println("Error reading the usage ledger:", err)
+					os.Exit(exitCode(err))
+				}
+				total += cost
+				fmt.Printf("%s\t%d\t%d\t%d\t$%.4f\n", key, requests, input, output, cost)
+			}
+			if err := rows.Err(); err != nil {
+				log.Println("Error reading the usage ledger:", err)
+				os.Exit(exitCode(err))
+			}
+			fmt.Printf("total\t\t\t\t$%.4f\n", total)
+		},
+	}
+	cmd.Flags().StringVar(&by, "by", "day", "Group by day, week, month, model, or a tag like tag:project")
+	cmd.Flags().IntVar(&days, "days", 30, "Only include the last this many days")
+	cmd.AddCommand(newCostsVerifyCmd())
+	return cmd
+}
+
+// costDriftWarning is the difference between the provider's cost and the
+// price table's estimate of the same tokens over which a model's prices are
+// probably out of date.
+const costDriftWarning = 0.05
+
+// localSpend is the ledger's requests and cost of a priced model.
+type localSpend struct {
+	requests int
+	cost     float64
+}
+
+// ledgerSpend returns the ledger's spend since a time per priced model.
+func ledgerSpend(since time.Time) (map[string]localSpend, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT model, COUNT(*), SUM(cost) FROM usage WHERE created_at >= ? GROUP BY model",
+		since.UTC().Format(time.DateTime))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	spend := map[string]localSpend{}
+	for rows.Next() {
+		var model string
+		var s localSpend
+		if err := rows.Scan(&model, &s.requests, &s.cost); err != nil {
+			return nil, err
+		}
+		if priced, ok := howdoi.PricedModel(model); ok {
+			model = priced
+		}
+		total := spend[model]
+		total.requests += s.requests
+		total.cost += s.cost
+		spend[model] = total
+	}
+	return spend, rows.Err()
+}
+
+func newCostsVerifyCmd() *cobra.Command {
+	var days int
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check the price table against the providers' usage reports",
+		Long: `Fetch the usage and cost reports of each provider with an admin key (OPENAI_ADMIN_KEY or
+ANTHROPIC_ADMIN_KEY) and price the reported tokens with howdoi's price table. A model whose estimate is off
+from what the provider charged by more than 5% has out of date prices. The reports cover
+the whole organization, so the ledger's spend, shown next to them, is usually lower.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			since := time.Now().AddDate(0, 0, -days)
+			local, err := ledgerSpend(since)
+			if err != nil {
+				log.Println("Error reading the usage ledger:", err)
+				os.Exit(exitCode(err))
+			}
+
+			client := howdoi.Client{}
+			checked := 0
+			var drifted []string
+			fmt.Println("model\tlocal requests\tlocal cost\tprovider requests\tprovider cost\ttable estimate\tdrift")
+			for _, provider := range slices.Sorted(maps.Keys(howdoi.AdminKeyEnvs)) {
+				env := howdoi.AdminKeyEnvs[provider]
+				if howdoi.APIKey(env) == "" {
+					log.Printf("Skipping %s: %s is not set\n", provider, env)
+					continue
+				}
+				usages, err := client.FetchProviderUsage(cmd.Context(), provider, since)
+				if err != nil {
+					log.Printf("Error fetching the usage of %s: %v\n", provider, err)
+					os.Exit(exitCode(err))
+				}
+				checked++
+
+				// Dated snapshots are summed under the model they are priced as.
+				byModel := map[string]howdoi.ProviderUsage{}
+				var models []string
+				for _, u := range usages {
+					priced, ok := howdoi.PricedModel(u.Model)
+					if !ok {
+						fmt.Printf("%s\t\t\t%d\t$%.4f\t-\tnot in the price table\n", u.Model, u.Requests, u.Cost)
+						continue
+					}
+					total, seen := byModel[priced]
+					if !seen {
+						models = append(models, priced)
+					}
+					total.Usage = total.Usage.Add(u.Usage)
+					total.Requests += u.Requests
+					total.Cost += u.Cost
+					byModel[priced] = total
+				}
+				for _, model := range models {
+					u := byModel[model]
+					estimate := howdoi.TableCost(model, u.Usage)
+					l := local[model]
+					drift := "-"
+					if u.Cost > 0 {
+						d := (estimate - u.Cost) / u.Cost
+						drift = fmt.Sprintf("%+.1f%%", d*100)
+						if math.Abs(d) > costDriftWarning {
+							drifted = append(drifted, model)
+						}
+					}
+					fmt.Printf("%s\t%d\t$%.4f\t%d\t$%.4f\t$%.4f\t%s\n", model, l.requests, l.cost, u.Requests, u.Cost, estimate, drift)
+				}
+			}
+			var unsupported []string
+			for _, provider := range howdoi.Providers() {
+				if _, ok := howdoi.AdminKeyEnvs[provider]; !ok {
+					unsupported = append(unsupported, provider)
+				}
+			}
+			log.Printf("Skipped %s, which have no usage API\n", strings.Join(unsupported, ", "))
+			if checked == 0 {
+				log.Println("Error: no provider has an admin key; set OPENAI_ADMIN_KEY or ANTHROPIC_ADMIN_KEY")
+				os.Exit(exitAuth)
+			}
+			if len(drifted) > 0 {
+				log.Printf("Warning: the prices of %s look out of date; set input_price and output_price for them in the config registry\n", strings.Join(drifted, ", "))
+			}
+		},
+	}
+	cmd.Flags().IntVar(&days, "days", 7, "Compare the last this many days")
+	return cmd
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// defaultCrawlDelay is the least time between two requests of a crawl when
+// the config file sets no scraper delay.
+const defaultCrawlDelay = 250 * time.Millisecond
+
+var unsafeFileRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// crawlFile is the file a crawled page is written to below dir: the page's
+// host and path, with .md for its extension, index.md for a directory, and
+// its query, if any, in the name.
+func crawlFile(dir, pageURL string) (string, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return "", err
+	}
+	p := u.Path
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += "index"
+	}
+	switch strings.ToLower(path.Ext(p)) {
+	case ".html", ".htm", ".xhtml", ".php", ".asp", ".aspx", ".md":
+		p = strings.TrimSuffix(p, path.Ext(p))
+	}
+	if u.RawQuery != "" {
+		p += "_" + strings.Trim(unsafeFileRe.ReplaceAllString(u.RawQuery, "_"), "_")
+	}
+	host := unsafeFileRe.ReplaceAllString(u.Host, "_")
+	return filepath.Join(dir, host, filepath.FromSlash(path.Clean("/"+p))+".md"), nil
+}
+
+func newCrawlCmd() *cobra.Command {
+	var out string
+	var maxPages int
+	var delay time.Duration
+	var render bool
+	var refresh bool
+
+	cmd := &cobra.Command{
+		Use:   "crawl <url>",
+		Short: "Save the pages of a documentation site for --rag",
+		Long:  "Read the pages of a site below the directory of the URL, from its sitemap or by following its links when it has none, and save their readable text to the scrappy database, which questions about the pages then read instead of scraping them again. Pages the robots.txt of the site disallows are skipped, and its Crawl-delay is kept when longer than --delay. With --out, every page is also written as markdown below the directory, by host and path, for howdoi index.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if !howdoi.IsURL(args[0]) {
+				log.Println("Error: crawl needs a URL")
+				os.Exit(exitUsage)
+			}
+			if cmd.Flags().Changed("delay") {
+				howdoi.Scraper.Delay = delay
+			} else if howdoi.Scraper.Delay == 0 {
+				howdoi.Scraper.Delay = defaultCrawlDelay
+			}
+			opts := howdoi.LoadOptions{Render: render, Refresh: refresh}
+			pages := 0
+			// Ctrl-C stops the crawl after the pages saved so far.
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			err := howdoi.Crawl(ctx, args[0], maxPages, opts, func(pageURL, content string) error {
+				pages++
+				log.Printf("Crawled %d: %s\n", pages, pageURL)
+				if out == "" {
+					return nil
+				}
+				file, err := crawlFile(out, pageURL)
+				if err != nil {
+					return err
+				}
+				if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+					return err
+				}
+				return os.WriteFile(file, []byte("URL: "+pageURL+"\n\n"+content+"\n"), 0o644)
+			})
+			if errors.Is(err, context.Canceled) {
+				log.Printf("Interrupted after %d pages\n", pages)
+				os.Exit(exitInterrupted)
+			}
+			if err != nil {
+				log.Println("Error crawling the site:", err)
+				os.Exit(exitError)
+			}
+			if out == "" {
+				fmt.Printf("Crawled %d pages\n", pages)
+				return
+			}
+			fmt.Printf("Crawled %d pages to %s, index them with: howdoi index %s\n", pages, out, out)
+		},
+	}
+	cmd.Flags().StringVar(&out, "out", "", "Directory to write the pages to as markdown")
+	cmd.Flags().IntVar(&maxPages, "max-pages", 200, "Most pages to crawl")
+	cmd.Flags().DurationVar(&delay, "delay", defaultCrawlDelay, "Least time between two requests (the scraper delay of the config file by default, or 250ms)")
+	cmd.Flags().BoolVar(&render, "render", false, "Load pages with little text in headless Chrome, for sites built with JavaScript")
+	cmd.Flags().BoolVar(&refresh, "refresh", false, "Scrape pages again instead of reusing the saved copy")
+	return cmd
+}
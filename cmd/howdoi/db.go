@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// dataDir returns the directory holding howdoi's databases, following XDG_DATA_HOME.
+func dataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "howdoi")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "share", "howdoi")
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS cache (
+	key        TEXT PRIMARY KEY,
+	model      TEXT NOT NULL,
+	response   TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS conversations (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	model      TEXT NOT NULL,
+	system     TEXT NOT NULL DEFAULT '',
+	title      TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS messages (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	role            TEXT NOT NULL,
+	content         TEXT NOT NULL,
+	model           TEXT NOT NULL DEFAULT '',
+	input_tokens    INTEGER NOT NULL DEFAULT 0,
+	output_tokens   INTEGER NOT NULL DEFAULT 0,
+	cost            REAL NOT NULL DEFAULT 0,
+	created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS attachments (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	source     TEXT NOT NULL,
+	kind       TEXT NOT NULL,
+	detail     TEXT NOT NULL DEFAULT '',
+	size       INTEGER NOT NULL,
+	sha256     TEXT NOT NULL,
+	caption    TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS usage (
+	id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+	model              TEXT NOT NULL,
+	input_tokens       INTEGER NOT NULL,
+	output_tokens      INTEGER NOT NULL,
+	cache_read_tokens  INTEGER NOT NULL DEFAULT 0,
+	cache_write_tokens INTEGER NOT NULL DEFAULT 0,
+	cost               REAL NOT NULL,
+	request_ids        TEXT NOT NULL DEFAULT '',
+	created_at         DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS usage_tags (
+	usage_id INTEGER NOT NULL REFERENCES usage(id) ON DELETE CASCADE,
+	key      TEXT NOT NULL,
+	value    TEXT NOT NULL,
+	PRIMARY KEY (usage_id, key)
+);
+CREATE TABLE IF NOT EXISTS rag_files (
+	index_name TEXT NOT NULL,
+	path       TEXT NOT NULL,
+	sha256     TEXT NOT NULL,
+	PRIMARY KEY (index_name, path)
+);
+CREATE TABLE IF NOT EXISTS rag_chunks (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	index_name TEXT NOT NULL,
+	path       TEXT NOT NULL,
+	start_line INTEGER NOT NULL,
+	end_line   INTEGER NOT NULL,
+	content    TEXT NOT NULL,
+	embedding  BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS rag_chunks_index ON rag_chunks (index_name, path);
+`
+
+// openDB opens the howdoi database, creating it and its tables if needed.
+func openDB() (*sql.DB, error) {
+	if err := os.MkdirAll(dataDir(), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dataDir(), "howdoi.db"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	// Databases created before these columns need them added.
+	for _, c := range [][3]string{
+		{"conversations", "title", "TEXT NOT NULL DEFAULT ''"},
+		{"attachments", "caption", "TEXT NOT NULL DEFAULT ''"},
+		{"messages", "input_tokens", "INTEGER NOT NULL DEFAULT 0"},
+		{"messages", "output_tokens", "INTEGER NOT NULL DEFAULT 0"},
+		{"messages", "cost", "REAL NOT NULL DEFAULT 0"},
+		{"usage", "request_ids", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if err := addColumn(db, c[0], c[1], c[2]); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// addColumn adds a column to a table unless it is already there.
+func addColumn(db *sql.DB, table, column, def string) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, def))
+	return err
+}
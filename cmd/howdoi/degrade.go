@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+// keyFallbacks returns the model aliases with an API key that have the
+// capabilities in need, to answer with when the key of the requested model
+// is missing. Models that keep more of the requested model's capabilities
+// come first, then those closest to it in price.
+func keyFallbacks(requestedID string, need howdoi.Capabilities) []string {
+	want, known := howdoi.ModelCapabilities[requestedID]
+	price := inputPrice(requestedID)
+	type candidate struct {
+		alias string
+		kept  int
+		diff  float64
+	}
+	var candidates []candidate
+	for alias := range howdoi.Models {
+		m, err := howdoi.ResolveModel(alias, "", "", "")
+		if err != nil || m.APIKey == "" || m.ModelID == requestedID {
+			continue
+		}
+		caps, ok := howdoi.ModelCapabilities[m.ModelID]
+		if !ok || !hasCapabilities(caps, need) {
+			continue
+		}
+		c := candidate{alias: alias, diff: math.Abs(inputPrice(m.ModelID) - price)}
+		if known {
+			c.kept = sharedCapabilities(caps, want)
+		}
+		candidates = append(candidates, c)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.kept != b.kept {
+			return a.kept > b.kept
+		}
+		if a.diff != b.diff {
+			return a.diff < b.diff
+		}
+		return a.alias < b.alias
+	})
+	aliases := make([]string, len(candidates))
+	for i, c := range candidates {
+		aliases[i] = c.alias
+	}
+	return aliases
+}
+
+// capabilityFlags lists the boolean capabilities of c.
+func capabilityFlags(c howdoi.Capabilities) []bool {
+	return []bool{c.Vision, c.Audio, c.Tools, c.JSONMode, c.Thinking, c.PDF}
+}
+
+// hasCapabilities reports whether c has every capability set in need.
+func hasCapabilities(c, need howdoi.Capabilities) bool {
+	have := capabilityFlags(c)
+	for i, n := range capabilityFlags(need) {
+		if n && !have[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sharedCapabilities counts the capabilities of want that c has too.
+func sharedCapabilities(c, want howdoi.Capabilities) int {
+	have, n := capabilityFlags(c), 0
+	for i, w := range capabilityFlags(want) {
+		if w && have[i] {
+			n++
+		}
+	}
+	return n
+}
+
+// degradeModel picks a model to answer with when the key of the requested
+// one is missing: the best of keyFallbacks with --fallback-any, or the one
+// the user agrees to on the terminal. It returns "" when there is none.
+func degradeModel(model, requestedID, keyEnv string, need howdoi.Capabilities, auto bool) string {
+	aliases := keyFallbacks(requestedID, need)
+	if len(aliases) == 0 {
+		return ""
+	}
+	if auto {
+		log.Printf("%s is not set, answering with %s instead of %s\n", keyEnv, aliases[0], model)
+		return aliases[0]
+	}
+	if !isTerminal(os.Stderr) {
+		return ""
+	}
+	ok, err := confirm(fmt.Sprintf("%s is not set, so %s can't be used. Answer with %s instead?", keyEnv, model, aliases[0]))
+	if err != nil || !ok {
+		return ""
+	}
+	return aliases[0]
+}
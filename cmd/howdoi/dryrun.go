@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+// partPlaceholder describes a content part that is not text, such as an
+// image, in place of its data.
+func partPlaceholder(part any) string {
+	switch v := part.(type) {
+	case howdoi.ImageContent:
+		data, _ := imageData(v)
+		return fmt.Sprintf("[%s, %s]", v.Source.MediaType, formatSize(len(data)))
+	case howdoi.ImageContentOpenAI:
+		mediaType, _, _ := strings.Cut(strings.TrimPrefix(v.ImageURL.Url, "data:"), ";")
+		data, _ := imageData(v)
+		return fmt.Sprintf("[%s, %s]", mediaType, formatSize(len(data)))
+	case howdoi.DocumentContent:
+		return fmt.Sprintf("[%s, %d pages, %s]", v.Source.MediaType, v.Pages, formatSize(len(v.Source.Data)*3/4))
+	case howdoi.ToolUseContent:
+		return fmt.Sprintf("[tool call %s]", v.Name)
+	case howdoi.ToolResultContent:
+		return fmt.Sprintf("[tool result, %s]", formatSize(len(v.Content)))
+	}
+	return fmt.Sprintf("[%T]", part)
+}
+
+func formatSize(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	return fmt.Sprintf("%.1f KB", float64(n)/1024)
+}
+
+// printDryRun writes the request as it would be sent, with placeholders for
+// images and documents, followed by its estimated tokens and cost.
+func printDryRun(w io.Writer, q Query) {
+	fmt.Fprintf(w, "model: %s (%s)\n\n", q.Model, q.ModelID)
+	if q.System != "" {
+		fmt.Fprintf(w, "## system\n\n%s\n\n", strings.TrimSpace(q.System))
+	}
+	for _, m := range q.Messages {
+		fmt.Fprintf(w, "## %s\n\n", m.Role)
+		for _, part := range m.Content {
+			if t, ok := part.(howdoi.TextContent); ok {
+				fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(t.Text))
+				continue
+			}
+			fmt.Fprintf(w, "%s\n\n", partPlaceholder(part))
+		}
+	}
+	fmt.Fprintf(w, "---\n~%d input tokens, up to %d output tokens, about $%.4f\n",
+		howdoi.EstimateTokens(q.Request), q.MaxTokens, howdoi.EstimateCost(q.Request))
+	if err := howdoi.CheckCapabilities(q.Request); err != nil {
+		fmt.Fprintf(w, "Warning: %v\n", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// editScissors separates the prompt from the help below it in the editor,
+// the way git separates a commit message from its diff. Unlike a # comment
+// prefix, it leaves markdown headings and code comments in the prompt alone.
+const editScissors = "# ------------------------ >8 ------------------------"
+
+// editorCommand returns $VISUAL, $EDITOR, or the platform's default editor.
+func editorCommand() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if e := strings.TrimSpace(os.Getenv(env)); e != "" {
+			return e
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// editPrompt opens the editor on a file holding draft and returns what is
+// above the scissors line once the editor exits. The editor reads from the
+// terminal even when stdin is piped in.
+func editPrompt(draft, model string, attached []string) (string, error) {
+	f, err := os.CreateTemp("", "howdoi-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	help := fmt.Sprintf("%s\n# Write the prompt above this line; everything below it is ignored.\n# Save and quit to send it to %s, or leave it empty to cancel.\n", editScissors, model)
+	for _, a := range attached {
+		help += "# Attached: " + a + "\n"
+	}
+	if draft != "" {
+		draft += "\n"
+	}
+	_, err = f.WriteString(draft + "\n" + help)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", editorCommand()+" "+f.Name())
+	} else {
+		// Through the shell, so an editor with arguments like
+		// "code --wait" works.
+		cmd = exec.Command("sh", "-c", editorCommand()+` "$1"`, "sh", f.Name())
+	}
+	// The editor draws on stderr, as stdout may be redirected to save the
+	// answer.
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if !isTerminal(os.Stdin) {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return "", errors.New("the editor needs a terminal")
+		}
+		defer tty.Close()
+		cmd.Stdin = tty
+	}
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %s: %w", editorCommand(), err)
+	}
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	prompt, _, _ := strings.Cut(string(b), editScissors)
+	return strings.TrimSpace(prompt), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+// Exit codes, so scripts can tell failures apart. Answers are the only thing
+// written to stdout; errors and diagnostics go to stderr.
+const (
+	exitError       = 1
+	exitUsage       = 2 // bad flags, arguments, or files
+	exitAuth        = 3 // missing or rejected API key
+	exitRateLimit   = 4 // rate limited or overloaded provider
+	exitNetwork     = 5 // unreachable provider or timed out request
+	exitInterrupted = 130
+)
+
+// exitCode returns the exit code for an error from calling a model.
+func exitCode(err error) int {
+	var apiErr *howdoi.APIError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errInterrupted):
+		return exitInterrupted
+	case errors.Is(err, howdoi.ErrNoAPIKey):
+		return exitAuth
+	case errors.Is(err, howdoi.ErrOverloaded):
+		return exitRateLimit
+	case errors.Is(err, howdoi.ErrUnsupportedModel), errors.Is(err, howdoi.ErrContextWindow):
+		return exitUsage
+	case errors.Is(err, errTimeout), errors.Is(err, errNoFirstToken):
+		return exitNetwork
+	case errors.As(err, &apiErr):
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitAuth
+		case http.StatusTooManyRequests:
+			return exitRateLimit
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+			return exitUsage
+		}
+	case errors.As(err, &netErr):
+		return exitNetwork
+	}
+	return exitError
+}
+
+// JSONError is the error of --json output, so wrappers can implement their
+// own retries and fallbacks around howdoi.
+type JSONError struct {
+	Message string `json:"message"`
+	// Provider, Status, and Code are set for errors returned by the API.
+	Provider  string `json:"provider,omitempty"`
+	Status    int    `json:"status,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Retryable bool   `json:"retryable"`
+	ExitCode  int    `json:"exit_code"`
+}
+
+func newJSONError(err error) *JSONError {
+	e := &JSONError{Message: err.Error(), ExitCode: exitCode(err)}
+	var apiErr *howdoi.APIError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr):
+		e.Provider, e.Status, e.Code, e.Retryable = apiErr.Provider, apiErr.StatusCode, apiErr.Code, apiErr.Retryable
+	case errors.Is(err, errTimeout), errors.Is(err, errNoFirstToken), errors.As(err, &netErr):
+		e.Retryable = true
+	}
+	return e
+}
+
+// writeJSONError writes the --json output of a failed request.
+func writeJSONError(w io.Writer, model string, err error) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(JSONOutput{Model: model, Error: newJSONError(err)})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+// ExportedConversation is a conversation as written by history export
+// --format json.
+type ExportedConversation struct {
+	ID        int64             `json:"id"`
+	Title     string            `json:"title"`
+	Model     string            `json:"model"`
+	System    string            `json:"system,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Messages  []ExportedMessage `json:"messages"`
+	// Cost is the total of the replies, in dollars.
+	Cost float64 `json:"cost"`
+}
+
+type ExportedMessage struct {
+	Role string `json:"role"`
+	// Text leaves out the content of attached documents, which are listed
+	// in Attachments instead.
+	Text         string               `json:"text"`
+	Attachments  []ExportedAttachment `json:"attachments,omitempty"`
+	InputTokens  int                  `json:"input_tokens,omitempty"`
+	OutputTokens int                  `json:"output_tokens,omitempty"`
+	Cost         float64              `json:"cost,omitempty"`
+}
+
+type ExportedAttachment struct {
+	Source  string `json:"source"`
+	Kind    string `json:"kind"`
+	Detail  string `json:"detail,omitempty"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	Caption string `json:"caption,omitempty"`
+}
+
+// exportConversation gathers a conversation and its attachments for export.
+func exportConversation(c *Conversation, attachments map[int64][]howdoi.Attachment) ExportedConversation {
+	e := ExportedConversation{
+		ID:        c.ID,
+		Title:     conversationTitle(c),
+		Model:     c.Model,
+		System:    c.System,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
+	for i, m := range c.Messages {
+		em := ExportedMessage{
+			Role:         m.Role,
+			Text:         strings.TrimSpace(messageText(m)),
+			InputTokens:  c.Usages[i].InputTokens,
+			OutputTokens: c.Usages[i].OutputTokens,
+			Cost:         c.Costs[i],
+		}
+		if m.Role == "user" {
+			em.Text = strings.TrimSpace(questionText(m))
+		}
+		for _, a := range attachments[c.MessageIDs[i]] {
+			em.Attachments = append(em.Attachments, ExportedAttachment{
+				Source: a.Source, Kind: a.Kind, Detail: a.Detail, Size: a.Size, SHA256: a.SHA256, Caption: a.Caption,
+			})
+		}
+		e.Messages = append(e.Messages, em)
+		e.Cost += em.Cost
+	}
+	return e
+}
+
+// writeExportMarkdown writes a conversation as markdown to paste into a pull
+// request or ticket.
+func writeExportMarkdown(w io.Writer, e ExportedConversation) {
+	fmt.Fprintf(w, "# %s\n\n", e.Title)
+	fmt.Fprintf(w, "Model: `%s` · %s · $%.4f\n\n", e.Model, e.CreatedAt.Local().Format("2006-01-02 15:04"), e.Cost)
+	if e.System != "" {
+		fmt.Fprintf(w, "## System\n\n%s\n\n", strings.TrimSpace(e.System))
+	}
+	for _, m := range e.Messages {
+		switch {
+		case m.Role == "user":
+			fmt.Fprintf(w, "## Prompt\n\n")
+		case m.InputTokens > 0 || m.OutputTokens > 0:
+			fmt.Fprintf(w, "## Response\n\n_%d input tokens, %d output tokens, $%.4f_\n\n", m.InputTokens, m.OutputTokens, m.Cost)
+		default:
+			fmt.Fprintf(w, "## Response\n\n")
+		}
+		if len(m.Attachments) > 0 {
+			fmt.Fprintf(w, "Attachments:\n\n")
+			for _, a := range m.Attachments {
+				kind := a.Kind
+				if a.Detail != "" {
+					kind += ", " + a.Detail
+				}
+				fmt.Fprintf(w, "- `%s` (%s, %s, sha256 `%.12s`)", a.Source, kind, formatSize(int(a.Size)), a.SHA256)
+				if a.Caption != "" {
+					fmt.Fprintf(w, ": %s", a.Caption)
+				}
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w)
+		}
+		if m.Text != "" {
+			fmt.Fprintf(w, "%s\n\n", m.Text)
+		}
+	}
+}
+
+// writeExportJSON writes a conversation as indented JSON.
+func writeExportJSON(w io.Writer, e ExportedConversation) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
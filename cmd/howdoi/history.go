@@ -0,0 +1,568 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// Conversation is a stored exchange with a model. Its title is generated
+// after the first exchange and empty until then.
+type Conversation struct {
+	ID        int64
+	Model     string
+	System    string
+	Title     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Messages  []howdoi.Message
+	// MessageIDs are the database ids of Messages.
+	MessageIDs []int64
+	// Usages and Costs are the tokens and dollars of each of Messages, set
+	// on the replies. Replies saved before they were recorded have none.
+	Usages []howdoi.Usage
+	Costs  []float64
+}
+
+// loadConversation loads a conversation and its messages. An id of 0 loads
+// the most recently updated conversation.
+func loadConversation(id int64) (*Conversation, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var c Conversation
+	row := db.QueryRow("SELECT id, model, system, title, created_at, updated_at FROM conversations WHERE id = ?", id)
+	if id == 0 {
+		row = db.QueryRow("SELECT id, model, system, title, created_at, updated_at FROM conversations ORDER BY updated_at DESC, id DESC LIMIT 1")
+	}
+	if err := row.Scan(&c.ID, &c.Model, &c.System, &c.Title, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			if id == 0 {
+				return nil, errors.New("no conversations in the history")
+			}
+			return nil, fmt.Errorf("no conversation with id %d", id)
+		}
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT id, content, input_tokens, output_tokens, cost FROM messages WHERE conversation_id = ? ORDER BY id", c.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var content string
+		var usage howdoi.Usage
+		var cost float64
+		if err := rows.Scan(&id, &content, &usage.InputTokens, &usage.OutputTokens, &cost); err != nil {
+			return nil, err
+		}
+		var m howdoi.Message
+		if err := json.Unmarshal([]byte(content), &m); err != nil {
+			return nil, err
+		}
+		c.Messages = append(c.Messages, m)
+		c.MessageIDs = append(c.MessageIDs, id)
+		c.Usages = append(c.Usages, usage)
+		c.Costs = append(c.Costs, cost)
+	}
+	return &c, rows.Err()
+}
+
+// saveExchange appends messages to a conversation, creating a new one when
+// conversationID is 0, and pins system as its system prompt. The attachments
+// belong to the first message and the usage and cost to the last, the reply.
+// It returns the conversation id.
+func saveExchange(conversationID int64, model, system string, attachments []howdoi.Attachment, usage howdoi.Usage, cost float64, messages ...howdoi.Message) (int64, error) {
+	db, err := openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if conversationID == 0 {
+		res, err := tx.Exec("INSERT INTO conversations (model, system) VALUES (?, ?)", model, system)
+		if err != nil {
+			return 0, err
+		}
+		if conversationID, err = res.LastInsertId(); err != nil {
+			return 0, err
+		}
+	} else {
+		if _, err := tx.Exec("UPDATE conversations SET model = ?, system = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", model, system, conversationID); err != nil {
+			return 0, err
+		}
+	}
+
+	for i, m := range messages {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return 0, err
+		}
+		var u howdoi.Usage
+		var c float64
+		if i == len(messages)-1 {
+			u, c = usage, cost
+		}
+		res, err := tx.Exec("INSERT INTO messages (conversation_id, role, content, model, input_tokens, output_tokens, cost) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			conversationID, m.Role, string(b), model, u.PromptTokens(), u.OutputTokens, c)
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 && len(attachments) > 0 {
+			messageID, err := res.LastInsertId()
+			if err != nil {
+				return 0, err
+			}
+			if err := saveAttachments(tx, messageID, attachments); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return conversationID, tx.Commit()
+}
+
+// replaceLastReply replaces the last reply of a conversation with a
+// regenerated one, along with the model, usage, and cost it was recorded with.
+func replaceLastReply(conversationID int64, model string, usage howdoi.Usage, cost float64, reply howdoi.Message) error {
+	b, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE messages SET content = ?, model = ?, input_tokens = ?, output_tokens = ?, cost = ?, created_at = CURRENT_TIMESTAMP
+		WHERE id = (SELECT MAX(id) FROM messages WHERE conversation_id = ? AND role = 'assistant')`,
+		string(b), model, usage.PromptTokens(), usage.OutputTokens, cost, conversationID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("conversation %d has no reply", conversationID)
+	}
+	if _, err := tx.Exec("UPDATE conversations SET model = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", model, conversationID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setConversationSystem replaces the system prompt pinned to a conversation.
+func setConversationSystem(conversationID int64, system string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	res, err := db.Exec("UPDATE conversations SET system = ? WHERE id = ?", system, conversationID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no conversation with id %d", conversationID)
+	}
+	return nil
+}
+
+// messageText returns the text parts of a message joined together.
+func messageText(m howdoi.Message) string {
+	var parts []string
+	for _, c := range m.Content {
+		if t, ok := c.(howdoi.TextContent); ok {
+			parts = append(parts, t.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// questionText returns the text of a message without the attached
+// documents, which is usually the question.
+func questionText(m howdoi.Message) string {
+	var parts []string
+	for _, p := range m.Content {
+		if t, ok := p.(howdoi.TextContent); ok && !strings.HasPrefix(strings.TrimSpace(t.Text), "<document>") {
+			parts = append(parts, t.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// conversationTitle is the generated title of a conversation, or a short
+// one-line preview of the first prompt when it has none.
+func conversationTitle(c *Conversation) string {
+	if c.Title != "" {
+		return c.Title
+	}
+	if len(c.Messages) == 0 {
+		return ""
+	}
+	title := strings.Join(strings.Fields(questionText(c.Messages[0])), " ")
+	if len(title) > 60 {
+		title = title[:57] + "..."
+	}
+	return title
+}
+
+func newHistoryCmd() *cobra.Command {
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "Browse stored conversations",
+	}
+
+	var limit int
+	var noTitles, verbose bool
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List recent conversations",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			db, err := openDB()
+			if err != nil {
+				log.Println("Error opening the history:", err)
+				os.Exit(exitCode(err))
+			}
+			defer db.Close()
+
+			rows, err := db.Query("SELECT id FROM conversations ORDER BY updated_at DESC, id DESC LIMIT ?", limit)
+			if err != nil {
+				log.Println("Error reading the history:", err)
+				os.Exit(exitCode(err))
+			}
+			var ids []int64
+			for rows.Next() {
+				var id int64
+				if err := rows.Scan(&id); err != nil {
+					log.Println("Error reading the history:", err)
+					os.Exit(exitCode(err))
+				}
+				ids = append(ids, id)
+			}
+			rows.Close()
+
+			var convs []*Conversation
+			for _, id := range ids {
+				c, err := loadConversation(id)
+				if err != nil {
+					log.Println("Error reading the history:", err)
+					os.Exit(exitCode(err))
+				}
+				convs = append(convs, c)
+			}
+			if !noTitles {
+				// --offline is set from the config file by then.
+				offline, _ := cmd.Flags().GetBool("offline")
+				titleUntitled(convs, offline, verbose)
+			}
+			for _, c := range convs {
+				printConversationLine(c)
+			}
+		},
+	}
+	listCmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of conversations to list")
+	listCmd.Flags().BoolVar(&noTitles, "no-titles", false, "Do not generate the titles of untitled conversations")
+	listCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Log the errors of generating titles")
+	historyCmd.AddCommand(listCmd)
+
+	var searchLimit int
+	searchCmd := &cobra.Command{
+		Use:   "search <text>",
+		Short: "List the conversations whose title, messages, attachment names, or image captions contain the text",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			convs, err := searchHistory(strings.Join(args, " "), searchLimit)
+			if err != nil {
+				log.Println("Error searching the history:", err)
+				os.Exit(exitCode(err))
+			}
+			for _, c := range convs {
+				printConversationLine(c)
+			}
+		},
+	}
+	searchCmd.Flags().IntVarP(&searchLimit, "limit", "n", 20, "Number of conversations to list")
+	historyCmd.AddCommand(searchCmd)
+
+	var showAttachments bool
+	showCmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Print a conversation",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				log.Println("Error: invalid conversation id", args[0])
+				os.Exit(exitUsage)
+			}
+			c, err := loadConversation(id)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			var attachments map[int64][]howdoi.Attachment
+			if showAttachments {
+				attachments, err = loadAttachments(c.ID)
+				if err != nil {
+					log.Println("Error reading the attachments:", err)
+					os.Exit(exitCode(err))
+				}
+			}
+			if c.System != "" {
+				fmt.Printf("## system\n\n%s\n\n", c.System)
+			}
+			for i, m := range c.Messages {
+				fmt.Printf("## %s\n\n%s\n\n", m.Role, messageText(m))
+				if atts := attachments[c.MessageIDs[i]]; len(atts) > 0 {
+					fmt.Printf("### attachments\n\n")
+					for _, a := range atts {
+						fmt.Printf("%s\t%s\t%s\t%d bytes\tsha256:%s\t%s\t%s\n", a.Source, a.Kind, a.Detail, a.Size, a.SHA256, a.Status(), a.Caption)
+					}
+					fmt.Println()
+				}
+			}
+		},
+	}
+	showCmd.Flags().BoolVar(&showAttachments, "attachments", false, "List the files, URLs, and stdin sent with each message, with their hashes")
+	historyCmd.AddCommand(showCmd)
+
+	var exportFormat string
+	exportCmd := &cobra.Command{
+		Use:   "export <id>",
+		Short: "Print a conversation as markdown or JSON, with its attachments, models, and costs, for sharing",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if exportFormat != "md" && exportFormat != "json" {
+				log.Println("Error: --format must be md or json")
+				os.Exit(exitUsage)
+			}
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				log.Println("Error: invalid conversation id", args[0])
+				os.Exit(exitUsage)
+			}
+			c, err := loadConversation(id)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			attachments, err := loadAttachments(c.ID)
+			if err != nil {
+				log.Println("Error reading the attachments:", err)
+				os.Exit(exitCode(err))
+			}
+			e := exportConversation(c, attachments)
+			if exportFormat == "md" {
+				writeExportMarkdown(os.Stdout, e)
+				return
+			}
+			if err := writeExportJSON(os.Stdout, e); err != nil {
+				log.Println("Error encoding the conversation:", err)
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+	exportCmd.Flags().StringVar(&exportFormat, "format", "md", "Output format: md or json")
+	historyCmd.AddCommand(exportCmd)
+
+	historyCmd.AddCommand(&cobra.Command{
+		Use:   "rm <id>",
+		Short: "Delete a conversation",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			db, err := openDB()
+			if err != nil {
+				log.Println("Error opening the history:", err)
+				os.Exit(exitCode(err))
+			}
+			defer db.Close()
+			if _, err := db.Exec("DELETE FROM attachments WHERE message_id IN (SELECT id FROM messages WHERE conversation_id = ?)", args[0]); err != nil {
+				log.Println("Error deleting the conversation:", err)
+				os.Exit(exitCode(err))
+			}
+			if _, err := db.Exec("DELETE FROM messages WHERE conversation_id = ?", args[0]); err != nil {
+				log.Println("Error deleting the conversation:", err)
+				os.Exit(exitCode(err))
+			}
+			if _, err := db.Exec("DELETE FROM conversations WHERE id = ?", args[0]); err != nil {
+				log.Println("Error deleting the conversation:", err)
+				os.Exit(exitCode(err))
+			}
+		},
+	})
+
+	var clearSystem bool
+	systemCmd := &cobra.Command{
+		Use:   "system <id> [prompt]",
+		Short: "Print or replace the system prompt pinned to a conversation",
+		Long:  "Print the system prompt pinned to a conversation, which --continue, --resume, and chat --resume keep using, or replace it with a prompt given as text or a file path.",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				log.Println("Error: invalid conversation id", args[0])
+				os.Exit(exitUsage)
+			}
+			if len(args) == 1 && !clearSystem {
+				c, err := loadConversation(id)
+				if err != nil {
+					log.Println("Error:", err)
+					os.Exit(exitCode(err))
+				}
+				if c.System != "" {
+					fmt.Println(c.System)
+				}
+				return
+			}
+			var system string
+			if len(args) == 2 {
+				if system, err = readSystemPrompt(args[1]); err != nil {
+					log.Println("Error reading the system prompt file:", err)
+					os.Exit(exitUsage)
+				}
+			}
+			if err := setConversationSystem(id, system); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+	systemCmd.Flags().BoolVar(&clearSystem, "clear", false, "Unpin the system prompt")
+	historyCmd.AddCommand(systemCmd)
+
+	return historyCmd
+}
+
+func printConversationLine(c *Conversation) {
+	fmt.Printf("%d\t%s\t%s\t%d turns\t%s\n", c.ID, c.UpdatedAt.Local().Format("2006-01-02 15:04"), c.Model, len(c.Messages)/2, conversationTitle(c))
+}
+
+// searchHistory returns the most recently updated conversations containing
+// text, ignoring case. Messages are stored as JSON with their images, so the
+// database only narrows down the candidates and the text of each message is
+// checked here, where base64 data can't match by chance.
+func searchHistory(text string, limit int) ([]*Conversation, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text) + "%"
+	rows, err := db.Query(`SELECT c.id FROM conversations c
+		JOIN messages m ON m.conversation_id = c.id
+		LEFT JOIN attachments a ON a.message_id = m.id
+		WHERE c.title LIKE ?1 ESCAPE '\' OR m.content LIKE ?1 ESCAPE '\' OR a.source LIKE ?1 ESCAPE '\' OR a.caption LIKE ?1 ESCAPE '\'
+		GROUP BY c.id ORDER BY c.updated_at DESC, c.id DESC`, pattern)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	text = strings.ToLower(text)
+	contains := func(s string) bool { return strings.Contains(strings.ToLower(s), text) }
+	var found []*Conversation
+	for _, id := range ids {
+		if len(found) == limit {
+			break
+		}
+		c, err := loadConversation(id)
+		if err != nil {
+			return nil, err
+		}
+		match := contains(c.Title)
+		for _, m := range c.Messages {
+			match = match || contains(messageText(m))
+		}
+		if !match {
+			attachments, err := loadAttachments(c.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, atts := range attachments {
+				for _, a := range atts {
+					match = match || contains(a.Source) || contains(a.Caption)
+				}
+			}
+		}
+		if match {
+			found = append(found, c)
+		}
+	}
+	return found, nil
+}
+
+func saveAttachments(tx *sql.Tx, messageID int64, attachments []howdoi.Attachment) error {
+	for _, a := range attachments {
+		if _, err := tx.Exec("INSERT INTO attachments (message_id, source, kind, detail, size, sha256, caption) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			messageID, a.Source, a.Kind, a.Detail, a.Size, a.SHA256, a.Caption); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAttachments returns the attachments of a conversation by message id.
+func loadAttachments(conversationID int64) (map[int64][]howdoi.Attachment, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT a.message_id, a.source, a.kind, a.detail, a.size, a.sha256, a.caption
+		FROM attachments a JOIN messages m ON m.id = a.message_id
+		WHERE m.conversation_id = ? ORDER BY a.id`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byMessage := map[int64][]howdoi.Attachment{}
+	for rows.Next() {
+		var id int64
+		var a howdoi.Attachment
+		if err := rows.Scan(&id, &a.Source, &a.Kind, &a.Detail, &a.Size, &a.SHA256, &a.Caption); err != nil {
+			return nil, err
+		}
+		byMessage[id] = append(byMessage[id], a)
+	}
+	return byMessage, rows.Err()
+}
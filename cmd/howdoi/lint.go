@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+const lintSystemPrompt = `You review prompt templates for a command line LLM tool. {{1}}, {{2}}, ... and {{args}} are placeholders filled from the command line and must be kept.
+
+Find ambiguous wording, a missing or unclear output format, and instructions that conflict with each other. Then write a revised template that fixes the issues without changing what the prompt is for. Keep the revision about as long as the original unless an issue needs more words.`
+
+const lintSchema = `{
+	"type": "object",
+	"properties": {
+		"issues": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"kind": {"type": "string", "enum": ["ambiguity", "output format", "conflict", "other"]},
+					"detail": {"type": "string"}
+				},
+				"required": ["kind", "detail"]
+			}
+		},
+		"revised": {"type": "string"}
+	},
+	"required": ["issues", "revised"]
+}`
+
+type lintResult struct {
+	Issues []struct {
+		Kind   string `json:"kind"`
+		Detail string `json:"detail"`
+	} `json:"issues"`
+	Revised string `json:"revised"`
+}
+
+// wrapText breaks s into lines of at most width runes, at spaces when it can.
+func wrapText(s string, width int) []string {
+	var lines []string
+	for _, para := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			for utf8.RuneCountInString(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				r := []rune(word)
+				lines = append(lines, string(r[:width]))
+				word = string(r[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// sideBySide lays out texts in columns that fit in width.
+func sideBySide(texts []string, width int) []string {
+	col := (width - 3*(len(texts)-1)) / len(texts)
+	cols := make([][]string, len(texts))
+	rows := 0
+	for i, t := range texts {
+		cols[i] = wrapText(t, col)
+		rows = max(rows, len(cols[i]))
+	}
+	out := make([]string, rows)
+	for i := range out {
+		var line strings.Builder
+		for j, c := range cols {
+			var cell string
+			if i < len(c) {
+				cell = c[i]
+			}
+			if j > 0 {
+				line.WriteString(" | ")
+			}
+			line.WriteString(cell)
+			if j < len(cols)-1 {
+				line.WriteString(strings.Repeat(" ", col-utf8.RuneCountInString(cell)))
+			}
+		}
+		out[i] = strings.TrimRight(line.String(), " ")
+	}
+	return out
+}
+
+// terminalWidth returns the width of the terminal on stdout, or $COLUMNS,
+// or 100 when neither is known.
+func terminalWidth() int {
+	if n := windowWidth(os.Stdout); n >= 40 {
+		return n
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n >= 40 {
+		return n
+	}
+	return 100
+}
+
+func newLintPromptCmd() *cobra.Command {
+	var model string
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:   "lint-prompt <name>",
+		Short: "Review a prompt template and suggest a revised version",
+		Long:  "Ask a cheap model to find ambiguity, a missing output format, and conflicting instructions in a saved prompt template, and show its revision next to the original.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			tmpl, err := loadPromptTemplate(args[0])
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			m, err := howdoi.ResolveModel(model, "", "", "")
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			var schema map[string]any
+			if err := json.Unmarshal([]byte(lintSchema), &schema); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+
+			q := Query{
+				Request: howdoi.Request{
+					Model:       model,
+					ModelID:     m.ModelID,
+					Provider:    m.Provider,
+					Vendor:      m.Vendor,
+					URL:         m.URL,
+					APIKey:      m.APIKey,
+					System:      lintSystemPrompt,
+					Messages:    []howdoi.Message{{Role: "user", Content: []any{howdoi.TextContent{Type: "text", Text: tmpl}}}},
+					MaxTokens:   4096,
+					Temperature: 0.2,
+					Verbose:     verbose,
+					JSONMode:    true,
+					Schema:      schema,
+				},
+				Quiet:           true,
+				MaxRetries:      defaultMaxRetries,
+				OverloadRetries: defaultMaxRetries,
+			}
+			if err := howdoi.CheckCapabilities(q.Request); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			res, err := runQuery(q)
+			if err != nil {
+				log.Println("Error calling the API:", err)
+				os.Exit(exitCode(err))
+			}
+			answer, err := howdoi.ParseJSONAnswer(res.Answer, schema)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			var lint lintResult
+			if err := json.Unmarshal(answer, &lint); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+
+			if len(lint.Issues) == 0 {
+				fmt.Println("No issues found.")
+				return
+			}
+			for _, issue := range lint.Issues {
+				fmt.Printf("- %s: %s\n", issue.Kind, issue.Detail)
+			}
+			fmt.Println()
+			for _, line := range sideBySide([]string{"original\n\n" + tmpl, "revised\n\n" + lint.Revised}, terminalWidth()) {
+				fmt.Println(line)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&model, "model", "m", "flash", "Model to review the prompt with")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbosity")
+	return cmd
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+// loaded is an argument loaded into message content.
+type loaded struct {
+	arg   string
+	parts []any
+	att   *howdoi.Attachment
+	err   error
+}
+
+// loadArgs loads files, URLs, and text arguments with at most concurrency of
+// them at once, since PDFs and web pages spend most of their time waiting.
+// The results are in the order of args.
+func loadArgs(args []string, opts howdoi.LoadOptions, concurrency int) []loaded {
+	results := make([]loaded, len(args))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, a := range args {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, a string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			parts, att, err := howdoi.LoadArg(context.Background(), a, opts)
+			if errors.Is(err, howdoi.ErrNoReadableContent) && !opts.Render {
+				err = fmt.Errorf("%w, pages built with JavaScript need --render", err)
+			}
+			results[i] = loaded{arg: a, parts: parts, att: att, err: err}
+		}(i, a)
+	}
+	wg.Wait()
+	return results
+}
+
+// loadSystemContext loads the files, directories, and URLs given with
+// --context into text for the system prompt, which takes nothing else.
+func loadSystemContext(args []string, opts howdoi.LoadOptions, concurrency int) (string, []howdoi.Attachment, error) {
+	var toLoad []string
+	for _, a := range args {
+		if fi, err := os.Stat(a); err == nil && fi.IsDir() {
+			files, err := walkFiles(a, nil)
+			if err != nil {
+				return "", nil, err
+			}
+			toLoad = append(toLoad, files...)
+			continue
+		}
+		if !howdoi.IsFile(a) && !howdoi.IsURL(a) {
+			return "", nil, fmt.Errorf("--context %s is not a file, directory, or URL", a)
+		}
+		toLoad = append(toLoad, a)
+	}
+	var docs []string
+	var attachments []howdoi.Attachment
+	for _, l := range loadArgs(toLoad, opts, concurrency) {
+		if l.err != nil {
+			return "", nil, l.err
+		}
+		for _, p := range l.parts {
+			t, ok := p.(howdoi.TextContent)
+			if !ok {
+				return "", nil, fmt.Errorf("the system prompt only takes text, attach %s as an argument instead of with --context", l.arg)
+			}
+			docs = append(docs, t.Text)
+		}
+		if l.att != nil {
+			attachments = append(attachments, *l.att)
+		}
+	}
+	return strings.Join(docs, "\n"), attachments, nil
+}
+
+// clipEmbeddings returns the embeddings long web pages are ranked with, given
+// the embeddings setting of the config file. By default they are those of the
+// model's provider, which gets the pages anyway, and pages sent to providers
+// without embeddings are ranked by keywords. OpenAI's are only used for other
+// providers when the setting is openai, and none always ranks by keywords.
+func clipEmbeddings(setting string, v howdoi.Vendor) (*howdoi.Embeddings, error) {
+	switch setting {
+	case "":
+		if e, ok := v.Embeddings(); ok {
+			return &e, nil
+		}
+		return nil, nil
+	case "openai":
+		e := howdoi.OpenAIEmbeddings
+		return &e, nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("embeddings must be openai or none, not %q", setting)
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/spf13/cobra"
+)
+
+// JSONOutput is what --json prints. Reasoning is kept apart from the answer
+// so tools can ignore or log it separately.
+type JSONOutput struct {
+	Model string `json:"model"`
+	// Answer is the JSON value produced by the model in JSON mode.
+	Answer    json.RawMessage `json:"answer,omitempty"`
+	Reasoning string          `json:"reasoning,omitempty"`
+	Cached    bool            `json:"cached"`
+	// Error is set instead of Answer when the request failed.
+	Error *JSONError `json:"error,omitempty"`
+}
+
+// Query is a request to a model along with how its answer is shown.
+type Query struct {
+	howdoi.Request
+	// Quiet disables streaming the answer to stdout.
+	Quiet bool
+	// Markdown renders the answer as styled markdown as it streams.
+	Markdown bool
+	// Width word wraps the answer on stdout at this column, 0 to not wrap.
+	Width int
+	// MaxWait cancels the request if no output arrives in time.
+	MaxWait time.Duration
+	// Timeout cancels the request if the answer is not complete in time.
+	Timeout time.Duration
+	// MaxRetries and OverloadRetries are how many times the request is
+	// retried when rate limited or failing, and while the provider is
+	// overloaded.
+	MaxRetries      int
+	OverloadRetries int
+	// Output receives the raw answer as it streams, unless Quiet is set.
+	Output io.Writer
+	// LineBuffered writes the streamed answer to stdout a line at a time
+	// instead of as each token arrives.
+	LineBuffered bool
+
+	onFirstToken func()
+}
+
+// Result is the complete output of a query.
+type Result struct {
+	Answer    string
+	Reasoning string
+	Usage     howdoi.Usage
+	// Cost is in dollars.
+	Cost float64
+	// RequestIDs are the provider's ids of the API calls made.
+	RequestIDs []string
+	// elapsed is the time from the first token to the end of the stream.
+	elapsed time.Duration
+}
+
+// errNoFirstToken is returned by runQuery when nothing arrives within
+// Query.MaxWait.
+var errNoFirstToken = errors.New("no response within the maximum wait")
+
+// errTimeout is returned by runQuery when the answer is not complete within
+// Query.Timeout.
+var errTimeout = errors.New("no complete answer within the timeout")
+
+// errInterrupted is returned by runQuery when the user presses Ctrl-C. The
+// partial answer has been printed by then.
+var errInterrupted = errors.New("interrupted")
+
+// defaultMaxRetries is the default of --max-retries.
+const defaultMaxRetries = 3
+
+// webCitationInstruction asks models given search results by --web to cite
+// them the way the providers' own search tools are rendered.
+const webCitationInstruction = "The attached web pages are the top search results for the question. Cite the pages you use with markdown footnotes like [^1], and end the answer with a footnote for each, like [^1]: [title](url)."
+
+// runQuery sends the query to the provider, streams the answer to stdout,
+// and returns the full answer. The request is cancelled when q.MaxWait is set
+// and passes before the first token arrives, when q.Timeout passes, or on
+// Ctrl-C, which ends the stream and reports the usage of the partial answer.
+func runQuery(q Query) (Result, error) {
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// A second Ctrl-C kills the process as usual.
+	context.AfterFunc(sigCtx, stop)
+	ctx := sigCtx
+	if q.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, q.Timeout)
+		defer cancelTimeout()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var timedOut atomic.Bool
+	if q.MaxWait > 0 {
+		timer := time.AfterFunc(q.MaxWait, func() {
+			timedOut.Store(true)
+			cancel()
+		})
+		q.onFirstToken = func() { timer.Stop() }
+	}
+	client := howdoi.Client{MaxRetries: q.MaxRetries, OverloadRetries: q.OverloadRetries}
+	var res Result
+	respChan, err := complete(ctx, &client, q.Request)
+	streamed := err == nil
+	if streamed {
+		res, err = printStream(respChan, q)
+	}
+	switch {
+	case sigCtx.Err() != nil:
+		return res, stopPartial(q, res, errInterrupted)
+	case q.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return res, stopPartial(q, res, fmt.Errorf("%w of %s", errTimeout, q.Timeout))
+	case timedOut.Load():
+		return Result{}, fmt.Errorf("%w of %s", errNoFirstToken, q.MaxWait)
+	}
+	if streamed && q.Verbose && !q.Quiet && res.Usage != (howdoi.Usage{}) {
+		fmt.Fprint(os.Stderr, "\n\n")
+		log.Printf("Usage: %s, Total Cost: $%.6f\n", res.Usage, res.Cost)
+		if res.elapsed > 0 {
+			log.Printf("Tokens per second: %.2f\n", float64(res.Usage.OutputTokens)/res.elapsed.Seconds())
+		}
+	}
+	// A stream that failed partway was still billed for.
+	if streamed {
+		if err := recordUsage(q.ModelID, res.Usage, res.Cost, res.RequestIDs, q.Metadata); err != nil {
+			log.Println("Error recording usage:", err)
+		}
+	}
+	return res, err
+}
+
+// stopPartial ends a cancelled answer cleanly and records what it cost.
+// Providers only report usage at the end of a stream, so usage that was not
+// reported is estimated from the prompt and the partial answer.
+func stopPartial(q Query, res Result, err error) error {
+	if !q.Quiet && !q.Markdown && res.Answer != "" && !strings.HasSuffix(res.Answer, "\n") {
+		fmt.Println()
+	}
+	estimated := ""
+	if res.Usage == (howdoi.Usage{}) {
+		res.Usage = howdoi.Usage{InputTokens: howdoi.EstimateTokens(q.Request), OutputTokens: len(res.Answer) / 4}
+		res.Cost = howdoi.CalculateCost(q.ModelID, res.Usage)
+		estimated = " (estimated)"
+	}
+	log.Printf("%v: %d input and %d output tokens, $%.4f%s\n", err, res.Usage.PromptTokens(), res.Usage.OutputTokens, res.Cost, estimated)
+	if rerr := recordUsage(q.ModelID, res.Usage, res.Cost, res.RequestIDs, q.Metadata); rerr != nil {
+		log.Println("Error recording usage:", rerr)
+	}
+	return err
+}
+
+// printStream prints streamed text as it arrives and returns all of it, with
+// the error that ended the stream early, if any. Reasoning is shown on stderr
+// in verbose mode so it never mixes with the answer on stdout.
+func printStream(respChan <-chan howdoi.Delta, q Query) (Result, error) {
+	var answer, reasoning strings.Builder
+	var res Result
+	var streamErr error
+	// Every token is written to stdout as it arrives, which is unbuffered,
+	// except with q.LineBuffered, while wrapping holds back a word, or while
+	// rendering markdown holds back the start of a line.
+	stdout := io.Writer(os.Stdout)
+	if q.LineBuffered {
+		lw := &lineWriter{w: os.Stdout}
+		defer lw.Flush()
+		stdout = lw
+	}
+	if q.Markdown {
+		mw := newMarkdownWriter(stdout)
+		defer mw.Flush()
+		stdout = mw
+	}
+	if q.Width > 0 {
+		ww := newWrapWriter(stdout, q.Width)
+		defer ww.Flush()
+		stdout = ww
+	}
+	started := false
+	var start time.Time
+	for d := range respChan {
+		if !started {
+			start = time.Now()
+			if q.onFirstToken != nil {
+				q.onFirstToken()
+			}
+		}
+		started = true
+		if d.Usage != nil {
+			res.Usage = res.Usage.Add(*d.Usage)
+			res.Cost += howdoi.CalculateCost(q.ModelID, *d.Usage)
+			if d.RequestID != "" {
+				res.RequestIDs = append(res.RequestIDs, d.RequestID)
+			}
+			continue
+		}
+		if d.Err != nil {
+			streamErr = d.Err
+			continue
+		}
+		if !q.Quiet {
+			if d.Reasoning != "" && q.Verbose {
+				fmt.Fprint(os.Stderr, d.Reasoning)
+			}
+			io.WriteString(stdout, d.Text)
+			if q.Output != nil {
+				io.WriteString(q.Output, d.Text)
+			}
+		}
+		answer.WriteString(d.Text)
+		reasoning.WriteString(d.Reasoning)
+	}
+	res.Answer, res.Reasoning = answer.String(), reasoning.String()
+	if started {
+		res.elapsed = time.Since(start)
+	}
+	if streamErr != nil && !q.Quiet && !q.Markdown && res.Answer != "" && !strings.HasSuffix(res.Answer, "\n") {
+		fmt.Println()
+	}
+	return res, streamErr
+}
+
+// printAnswer prints a complete answer, rendering it when q.Markdown is set.
+func printAnswer(text string, q Query) {
+	if q.Quiet {
+		return
+	}
+	if q.Markdown {
+		fmt.Println(renderMarkdown(wrapMarkdown(strings.TrimRight(text, "\n"), q.Width)))
+		return
+	}
+	fmt.Print(wrapMarkdown(text, q.Width))
+}
+
+// readSystemPrompt returns a system prompt given as text or a file path.
+func readSystemPrompt(s string) (string, error) {
+	if s == "" || !howdoi.IsFile(s) {
+		return s, nil
+	}
+	b, err := os.ReadFile(s)
+	return string(b), err
+}
+
+// printProgress shows the progress of a long job on a terminal's stderr, on
+// one line that is rewritten as the job goes.
+func printProgress(task string, done, total int, finished bool) {
+	if !isTerminal(os.Stderr) {
+		return
+	}
+	end := ""
+	if finished {
+		end = "\n"
+	}
+	fmt.Fprintf(os.Stderr, "\r%s: %d/%d%s", task, done, total, end)
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// readStdin returns the piped input when stdin is not a terminal.
+func readStdin() (string, error) {
+	if isTerminal(os.Stdin) {
+		return "", nil
+	}
+	content, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// The persistent flags of the root command, which the config file can also
+// set.
+var (
+	offline   bool
+	debugHTTP string
+	network   howdoi.TransportOptions
+)
+
+func main() {
+	var rootCmd = &cobra.Command{
+		Use:   "howdoi [files, URLs, and question...]",
+		Short: "CLI tool to interact with LLM APIs. Messages can be written text or image files.",
+		Long:  rootLong,
+		Args:  rootArgs,
+		// Models defined in the config file are available to every
+		// subcommand.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			cfg, err := loadConfig()
+			if err != nil {
+				log.Println("Error reading the config file:", err)
+				os.Exit(exitUsage)
+			}
+			if err := applyRegistry(cfg); err != nil {
+				log.Println("Error in the config file:", err)
+				os.Exit(exitUsage)
+			}
+			if err := applyScraper(cfg); err != nil {
+				log.Println("Error in the config file:", err)
+				os.Exit(exitUsage)
+			}
+			if err := applyImages(cfg); err != nil {
+				log.Println("Error in the config file:", err)
+				os.Exit(exitUsage)
+			}
+			titleModel = cfg.TitleModel
+			howdoi.OCRLanguages = cfg.OCRLanguages
+			settings, err := cfg.settings(profile)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitUsage)
+			}
+			if !cmd.Flags().Changed("budget") {
+				budget = settings.Budget
+			}
+			if !cmd.Flags().Changed("offline") && settings.Offline != nil {
+				offline = *settings.Offline
+			}
+			var debug io.Writer
+			if debugHTTP != "" {
+				f, err := os.OpenFile(debugHTTP, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+				if err != nil {
+					log.Println("Error opening the debug file:", err)
+					os.Exit(exitUsage)
+				}
+				debug = f
+			}
+			if err := setTransport(cfg, network, offline, debug); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitUsage)
+			}
+		},
+		Run: runAsk,
+	}
+
+	rootCmd.PersistentFlags().Float64Var(&budget, "budget", 0, "Monthly spend limit in dollars: warn when a request could exceed it and refuse once it is spent")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Refuse network calls to anything but localhost, e.g. Ollama or LM Studio")
+	rootCmd.PersistentFlags().IntVar(&width, "width", 0, "Word wrap answers at this column (0 wraps terminals at their width, -1 turns wrapping off)")
+	rootCmd.PersistentFlags().StringVar(&network.Proxy, "proxy", "", "Send requests through this proxy URL instead of the one in HTTPS_PROXY (hosts in NO_PROXY are still reached directly)")
+	rootCmd.PersistentFlags().StringArrayVar(&network.CACerts, "ca-cert", nil, "Also trust the certificate authorities in this PEM file, like that of a proxy that intercepts TLS (can be repeated)")
+	rootCmd.PersistentFlags().BoolVar(&network.Insecure, "insecure", false, "Do not verify TLS certificates")
+	rootCmd.PersistentFlags().StringVar(&debugHTTP, "debug-http", "", "Append the HTTP requests and responses, with credentials redacted and SSE frames as they arrive, to this file")
+	addAskFlags(rootCmd.Flags())
+
+	rootCmd.AddCommand(newAskCmd())
+	rootCmd.AddCommand(newSummarizeCmd())
+	rootCmd.AddCommand(newStoreCmd())
+	rootCmd.AddCommand(newPromptsCmd())
+	rootCmd.AddCommand(newCtxCmd())
+	rootCmd.AddCommand(newCacheCmd())
+	rootCmd.AddCommand(newHistoryCmd())
+	rootCmd.AddCommand(newModelsCmd())
+	rootCmd.AddCommand(newReplayCmd())
+	rootCmd.AddCommand(newLintPromptCmd())
+	rootCmd.AddCommand(newCostsCmd())
+	rootCmd.AddCommand(newCmdCmd())
+	rootCmd.AddCommand(newRPCCmd())
+	rootCmd.AddCommand(newServeCmd())
+	rootCmd.AddCommand(newIndexCmd())
+	rootCmd.AddCommand(newCrawlCmd())
+	rootCmd.AddCommand(newMapCmd())
+	rootCmd.AddCommand(newTokensCmd())
+	rootCmd.AddCommand(newChatCmd())
+	rootCmd.AddCommand(newReviewCmd())
+	rootCmd.AddCommand(newTraceCmd())
+	rootCmd.AddCommand(newAuthCmd())
+	rootCmd.AddCommand(newStatusCmd())
+
+	howdoi.Logf = log.Printf
+	howdoi.Progress = printProgress
+	if err := rootCmd.Execute(); err != nil {
+		log.Println(err)
+		os.Exit(exitUsage)
+	}
+}
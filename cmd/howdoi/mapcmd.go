@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// readCSVRows reads a CSV file into its header row and the rows after it.
+func readCSVRows(file string) ([]string, [][]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("the file has no header row")
+	}
+	return records[0], records[1:], nil
+}
+
+// renderRow renders the prompt template with the row's columns as fields.
+func renderRow(tmpl *template.Template, header, row []string) (string, error) {
+	data := make(map[string]string, len(header))
+	for i, col := range header {
+		if i < len(row) {
+			data[col] = row[i]
+		}
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func newMapCmd() *cobra.Command {
+	var input string
+	var prompt string
+	var output string
+	var column string
+	var model string
+	var maxTokens int
+	var temperature float32
+	var concurrency int
+	var noCache bool
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:   "map --input data.csv --prompt <template>",
+		Short: "Ask a question for every row of a CSV file and add the answers as a column",
+		Long:  "Render the prompt, a Go template with the columns of the CSV header as fields (e.g. {{.description}}), for every row, ask the model with bounded concurrency, and write the CSV with the answers in a new column. Answers are cached, so rerunning after a failure only asks for the missing rows.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if input == "" || prompt == "" {
+				log.Println("Error: map needs --input and --prompt")
+				os.Exit(exitUsage)
+			}
+			// missingkey=error catches misspelled column names.
+			tmpl, err := template.New("prompt").Option("missingkey=error").Parse(prompt)
+			if err != nil {
+				log.Println("Error parsing the prompt:", err)
+				os.Exit(exitCode(err))
+			}
+			header, rows, err := readCSVRows(input)
+			if err != nil {
+				log.Println("Error reading the input:", err)
+				os.Exit(exitCode(err))
+			}
+			prompts := make([]string, len(rows))
+			for i, row := range rows {
+				prompts[i], err = renderRow(tmpl, header, row)
+				if err != nil {
+					log.Printf("Error rendering the prompt for row %d: %v\n", i+1, err)
+					os.Exit(exitCode(err))
+				}
+			}
+			m, err := howdoi.ResolveModel(model, "", "", "")
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+
+			answers := make([]string, len(rows))
+			var failed atomic.Int64
+			sem := make(chan struct{}, max(concurrency, 1))
+			var wg sync.WaitGroup
+			for i, p := range prompts {
+				wg.Add(1)
+				sem <- struct{}{}
+				go func(i int, p string) {
+					defer wg.Done()
+					defer func() { <-sem }()
+					q := Query{
+						Request: howdoi.Request{
+							Model:       model,
+							ModelID:     m.ModelID,
+							Provider:    m.Provider,
+							Vendor:      m.Vendor,
+							URL:         m.URL,
+							APIKey:      m.APIKey,
+							Messages:    []howdoi.Message{{Role: "user", Content: []any{howdoi.TextContent{Type: "text", Text: p}}}},
+							MaxTokens:   maxTokens,
+							Temperature: temperature,
+						},
+						Quiet:           true,
+						MaxRetries:      defaultMaxRetries,
+						OverloadRetries: defaultMaxRetries,
+					}
+					if !noCache {
+						if answer, ok := lookupCachedResponse(q); ok {
+							answers[i] = strings.TrimSpace(answer)
+							return
+						}
+					}
+					res, err := runQuery(q)
+					if err != nil {
+						log.Printf("Error on row %d: %v\n", i+1, err)
+						failed.Add(1)
+						return
+					}
+					answers[i] = strings.TrimSpace(res.Answer)
+					if verbose {
+						log.Printf("Row %d: %s\n", i+1, res.Usage)
+					}
+					if !noCache {
+						if err := storeCachedResponse(q, res.Answer); err != nil {
+							log.Println("Error caching the response:", err)
+						}
+					}
+				}(i, p)
+			}
+			wg.Wait()
+
+			out := os.Stdout
+			if output != "" {
+				out, err = os.Create(output)
+				if err != nil {
+					log.Println("Error creating the output:", err)
+					os.Exit(exitCode(err))
+				}
+				defer out.Close()
+			}
+			w := csv.NewWriter(out)
+			w.Write(append(header, column))
+			for i, row := range rows {
+				w.Write(append(row, answers[i]))
+			}
+			w.Flush()
+			if err := w.Error(); err != nil {
+				log.Println("Error writing the output:", err)
+				os.Exit(exitCode(err))
+			}
+
+			if n := failed.Load(); n > 0 {
+				log.Printf("Error: %d of %d rows failed and have no answer\n", n, len(rows))
+				out.Close()
+				os.Exit(exitError)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&input, "input", "", "CSV file with a header row")
+	cmd.Flags().StringVar(&prompt, "prompt", "", "Prompt template with the columns as fields, e.g. \"classify: {{.description}}\"")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File to write the CSV to instead of stdout")
+	cmd.Flags().StringVar(&column, "column", "answer", "Name of the answer column")
+	cmd.Flags().StringVarP(&model, "model", "m", "sonnet", "Model to use")
+	cmd.Flags().IntVarP(&maxTokens, "max-tokens", "t", 1024, "Maximum number of tokens to generate per row")
+	cmd.Flags().Float32VarP(&temperature, "temperature", "e", 0.10, "Temperature")
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "j", 4, "Number of rows asked at once")
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "Do not read or write the response cache")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Log the usage of every row")
+	return cmd
+}
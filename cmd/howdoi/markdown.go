@@ -0,0 +1,490 @@
+package main
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+// ANSI escape sequences used when rendering markdown.
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiItalic    = "\x1b[3m"
+	ansiUnderline = "\x1b[4m"
+	ansiGreen     = "\x1b[32m"
+	ansiYellow    = "\x1b[33m"
+	ansiBlue      = "\x1b[34m"
+	ansiMagenta   = "\x1b[35m"
+	ansiCyan      = "\x1b[36m"
+)
+
+// useMarkdown reports whether answers should be rendered as styled markdown:
+// only when stdout is a terminal and NO_COLOR is unset.
+func useMarkdown(raw bool) bool {
+	return !raw && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
+
+// mdRenderer renders markdown to ANSI styled text line by line, keeping track
+// of whether it is inside a fenced code block.
+type mdRenderer struct {
+	fence string
+	lang  string
+}
+
+var (
+	mdHeadingRe = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdFenceRe   = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([\\w+#.-]*)")
+	mdBulletRe  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdNumberRe  = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	mdRuleRe    = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	mdInlineRe  = regexp.MustCompile("`[^`]+`|\\*\\*[^*]+\\*\\*|__[^_]+__|\\*[^*\\s][^*]*\\*|\\b_[^_\\s][^_]*_\\b|\\[[^\\]]+\\]\\([^)]+\\)")
+)
+
+// renderMarkdown renders a complete markdown document.
+func renderMarkdown(md string) string {
+	var r mdRenderer
+	var b strings.Builder
+	lines := strings.Split(md, "\n")
+	for i, line := range lines {
+		b.WriteString(r.renderLine(line))
+		if i < len(lines)-1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// renderLine renders a single line without its trailing newline.
+func (r *mdRenderer) renderLine(line string) string {
+	if m := mdFenceRe.FindStringSubmatch(line); m != nil {
+		if r.fence == "" {
+			r.fence, r.lang = m[1], howdoi.NormalizeLanguage(m[2])
+			label := r.lang
+			if label == "" {
+				label = "code"
+			}
+			return ansiDim + "── " + label + " " + strings.Repeat("─", max(0, 36-len(label))) + ansiReset
+		}
+		if strings.HasPrefix(m[1], r.fence[:1]) && len(m[1]) >= len(r.fence) && m[2] == "" {
+			r.fence, r.lang = "", ""
+			return ansiDim + strings.Repeat("─", 40) + ansiReset
+		}
+	}
+	if r.fence != "" {
+		return highlightCode(line, r.lang)
+	}
+
+	if m := mdHeadingRe.FindStringSubmatch(line); m != nil {
+		color := ansiMagenta
+		if len(m[1]) > 1 {
+			color = ansiCyan
+		}
+		return ansiBold + color + renderInline(m[2], ansiBold+color) + ansiReset
+	}
+	if mdRuleRe.MatchString(line) {
+		return ansiDim + strings.Repeat("─", 40) + ansiReset
+	}
+	if rest, ok := strings.CutPrefix(strings.TrimLeft(line, " "), ">"); ok {
+		rest = strings.TrimPrefix(rest, " ")
+		return ansiDim + "│ " + ansiReset + ansiItalic + renderInline(rest, ansiItalic) + ansiReset
+	}
+	if m := mdBulletRe.FindStringSubmatch(line); m != nil {
+		item := m[2]
+		if rest, ok := strings.CutPrefix(item, "[ ] "); ok {
+			item = "☐ " + rest
+		} else if len(item) > 4 && strings.EqualFold(item[:4], "[x] ") {
+			item = "☑ " + item[4:]
+		}
+		return m[1] + ansiYellow + "•" + ansiReset + " " + renderInline(item, "")
+	}
+	if m := mdNumberRe.FindStringSubmatch(line); m != nil {
+		return m[1] + ansiYellow + m[2] + ansiReset + " " + renderInline(m[3], "")
+	}
+	return renderInline(line, "")
+}
+
+// renderInline styles inline code, emphasis, and links. outer is the style
+// of the surrounding text, restored after each span.
+func renderInline(s, outer string) string {
+	return mdInlineRe.ReplaceAllStringFunc(s, func(m string) string {
+		var styled string
+		switch {
+		case strings.HasPrefix(m, "`"):
+			styled = ansiYellow + m[1:len(m)-1]
+		case strings.HasPrefix(m, "**"), strings.HasPrefix(m, "__"):
+			styled = ansiBold + m[2:len(m)-2]
+		case strings.HasPrefix(m, "["):
+			text, url, _ := strings.Cut(m[1:len(m)-1], "](")
+			styled = ansiUnderline + ansiBlue + text + ansiReset + ansiDim + " (" + url + ")"
+		default:
+			styled = ansiItalic + m[1:len(m)-1]
+		}
+		return styled + ansiReset + outer
+	})
+}
+
+// maxLinkLen is the most text held back waiting for the end of what may be
+// a link.
+const maxLinkLen = 500
+
+var (
+	mdHeadingStartRe = regexp.MustCompile(`^#{1,6}$`)
+	mdRuleStartRe    = regexp.MustCompile(`^\s*[-*_][-*_\s]*$`)
+	mdNumberStartRe  = regexp.MustCompile(`^\s*\d+[.)]?\s*$`)
+)
+
+// markdownWriter renders markdown as it streams. The start of a line is held
+// back only until it shows what the line is. Headings, rules, and fenced code
+// are written once their line is complete, and the text of paragraphs, list
+// items, and quotes as it arrives, in the style of the code spans, emphasis,
+// and links open so far, which carries over from one write to the next.
+// Unlike renderMarkdown, emphasis is styled as soon as it opens, so a marker
+// that is never closed styles the rest of its line.
+type markdownWriter struct {
+	w io.Writer
+	r mdRenderer
+	// line holds the start of a line until its kind is known, and all of a
+	// line that is written whole.
+	line   strings.Builder
+	whole  bool
+	inline bool
+
+	// outer is the style of the line's text, and pend holds a marker until
+	// the text after it tells what it is.
+	outer              string
+	pend               string
+	code, bold, italic bool
+	prev               byte
+}
+
+func newMarkdownWriter(w io.Writer) *markdownWriter {
+	return &markdownWriter{w: w, prev: ' '}
+}
+
+func (mw *markdownWriter) Write(p []byte) (int, error) {
+	s := string(p)
+	for {
+		line, rest, nl := strings.Cut(s, "\n")
+		if mw.inline {
+			mw.text(line, false)
+		} else {
+			mw.line.WriteString(line)
+			if !mw.whole {
+				mw.startLine()
+			}
+		}
+		if !nl {
+			return len(p), nil
+		}
+		mw.endLine()
+		s = rest
+	}
+}
+
+// startLine decides how the line begun in mw.line is written, once enough
+// of it has arrived, and starts writing its text unless it is written whole.
+func (mw *markdownWriter) startLine() {
+	line := mw.line.String()
+	trimmed := strings.TrimLeft(line, " \t")
+	switch {
+	case mw.r.fence != "", strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"), mdHeadingRe.MatchString(line):
+		mw.whole = true
+		return
+	case trimmed == "", strings.HasPrefix("```", trimmed), strings.HasPrefix("~~~", trimmed),
+		mdHeadingStartRe.MatchString(line), mdRuleStartRe.MatchString(line), mdNumberStartRe.MatchString(line):
+		return
+	}
+
+	var lead, text string
+	if rest, ok := strings.CutPrefix(strings.TrimLeft(line, " "), ">"); ok {
+		if rest == "" {
+			return
+		}
+		lead, text, mw.outer = ansiDim+"│ "+ansiReset, strings.TrimPrefix(rest, " "), ansiItalic
+	} else if m := mdBulletRe.FindStringSubmatch(line); m != nil {
+		item := m[2]
+		if len(item) < 4 && (strings.HasPrefix("[ ] ", item) || strings.HasPrefix("[x] ", strings.ToLower(item))) {
+			return
+		}
+		if rest, ok := strings.CutPrefix(item, "[ ] "); ok {
+			item = "☐ " + rest
+		} else if len(item) >= 4 && strings.EqualFold(item[:4], "[x] ") {
+			item = "☑ " + item[4:]
+		}
+		lead, text = m[1]+ansiYellow+"•"+ansiReset+" ", item
+	} else if m := mdNumberRe.FindStringSubmatch(line); m != nil {
+		lead, text = m[1]+ansiYellow+m[2]+ansiReset+" ", m[3]
+	} else {
+		text = line
+	}
+	mw.inline = true
+	mw.line.Reset()
+	io.WriteString(mw.w, lead+mw.outer)
+	mw.text(text, false)
+}
+
+// endLine writes what is left of the line and its newline.
+func (mw *markdownWriter) endLine() {
+	if mw.inline {
+		mw.text("", true)
+		if mw.outer != "" || mw.code || mw.bold || mw.italic {
+			io.WriteString(mw.w, ansiReset)
+		}
+	} else {
+		io.WriteString(mw.w, mw.r.renderLine(mw.line.String()))
+	}
+	io.WriteString(mw.w, "\n")
+	mw.line.Reset()
+	mw.whole, mw.inline = false, false
+	mw.outer, mw.code, mw.bold, mw.italic, mw.prev = "", false, false, false, ' '
+}
+
+// Flush writes the rest of the last line and ends it.
+func (mw *markdownWriter) Flush() {
+	if mw.inline || mw.line.Len() > 0 {
+		mw.endLine()
+	}
+}
+
+// text writes the text of a line. final is set at the end of the line, when
+// a held back marker has nothing more to wait for.
+func (mw *markdownWriter) text(s string, final bool) {
+	s = mw.pend + s
+	mw.pend = ""
+	for s != "" {
+		n := mw.span(s, final)
+		if n == 0 {
+			mw.pend = s
+			return
+		}
+		s = s[n:]
+	}
+}
+
+// span writes the start of s, plain text up to the next marker or what a
+// marker starts, and returns how much of s it wrote, 0 when it needs more
+// text to tell.
+func (mw *markdownWriter) span(s string, final bool) int {
+	c := s[0]
+	if mw.code {
+		if c == '`' {
+			mw.code = false
+			mw.restyle()
+			return 1
+		}
+		n := strings.IndexByte(s, '`')
+		if n < 0 {
+			n = len(s)
+		}
+		mw.plain(s[:n])
+		return n
+	}
+	switch c {
+	case '`':
+		mw.code = true
+		mw.restyle()
+		return 1
+	case '*', '_':
+		n := 1
+		if len(s) > 1 && s[1] == c {
+			n = 2
+		}
+		if len(s) <= n && !final {
+			return 0
+		}
+		next := byte(' ')
+		if len(s) > n {
+			next = s[n]
+		}
+		open := &mw.italic
+		if n == 2 {
+			open = &mw.bold
+		}
+		// Underscores only mark emphasis at the edges of words, so
+		// snake_case is left alone.
+		switch {
+		case *open && mw.prev != ' ' && mw.prev != '\t' && (c == '*' || !isWordByte(next)):
+			*open = false
+		case !*open && next != ' ' && next != '\t' && (c == '*' || !isWordByte(mw.prev)):
+			*open = true
+		default:
+			mw.plain(s[:n])
+			return n
+		}
+		mw.restyle()
+		return n
+	case '[':
+		end := strings.IndexByte(s, ']')
+		if end < 0 || end+1 == len(s) {
+			if !final && len(s) < maxLinkLen {
+				return 0
+			}
+			mw.plain("[")
+			return 1
+		}
+		text := s[1:end]
+		if s[end+1] != '(' || text == "" || strings.Contains(text, "[") {
+			mw.plain("[")
+			return 1
+		}
+		close := strings.IndexByte(s[end:], ')')
+		if close < 0 {
+			if !final && len(s) < maxLinkLen {
+				return 0
+			}
+			mw.plain("[")
+			return 1
+		}
+		close += end
+		url := s[end+2 : close]
+		if url == "" {
+			mw.plain("[")
+			return 1
+		}
+		io.WriteString(mw.w, ansiUnderline+ansiBlue+text+ansiReset+ansiDim+" ("+url+")")
+		mw.restyle()
+		mw.prev = ')'
+		return close + 1
+	}
+	n := strings.IndexAny(s, "`*_[")
+	if n < 0 {
+		n = len(s)
+	}
+	mw.plain(s[:n])
+	return n
+}
+
+func (mw *markdownWriter) plain(s string) {
+	if s != "" {
+		io.WriteString(mw.w, s)
+		mw.prev = s[len(s)-1]
+	}
+}
+
+// restyle switches to the style of the line and the spans open in it.
+func (mw *markdownWriter) restyle() {
+	style := ansiReset + mw.outer
+	if mw.bold {
+		style += ansiBold
+	}
+	if mw.italic {
+		style += ansiItalic
+	}
+	if mw.code {
+		style += ansiYellow
+	}
+	io.WriteString(mw.w, style)
+}
+
+// codeSyntax describes just enough of a language to highlight it.
+type codeSyntax struct {
+	comment  string
+	keywords map[string]bool
+}
+
+func keywordSet(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, k := range strings.Fields(s) {
+		m[k] = true
+	}
+	return m
+}
+
+var (
+	cKeywords  = keywordSet("auto break case char const continue default do double else enum extern float for goto if int long return short signed sizeof static struct switch typedef union unsigned void volatile while bool true false NULL")
+	jsKeywords = keywordSet("async await break case catch class const continue default delete do else enum export extends false finally for from function if implements import in instanceof interface let new null of return super switch this throw true try type typeof undefined var void while yield")
+	shKeywords = keywordSet("if then else elif fi for while until do done case esac function in return local export readonly exit echo set unset source")
+)
+
+var syntaxes = map[string]codeSyntax{
+	"go":         {"//", keywordSet("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota")},
+	"python":     {"#", keywordSet("and as assert async await break class continue def del elif else except False finally for from global if import in is lambda None nonlocal not or pass raise return self True try while with yield")},
+	"javascript": {"//", jsKeywords},
+	"typescript": {"//", jsKeywords},
+	"jsx":        {"//", jsKeywords},
+	"tsx":        {"//", jsKeywords},
+	"rust":       {"//", keywordSet("as async await break const continue crate dyn else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while")},
+	"c":          {"//", cKeywords},
+	"cpp":        {"//", keywordSet("auto bool break case catch char class const constexpr continue default delete do double else enum explicit extern false float for friend goto if inline int long namespace new nullptr operator private protected public return short signed sizeof static struct switch template this throw true try typedef typename union unsigned using virtual void volatile while")},
+	"java":       {"//", keywordSet("abstract boolean break byte case catch char class const continue default do double else enum extends final finally float for if implements import instanceof int interface long new null package private protected public return short static super switch this throw throws true false try void volatile while var record")},
+	"kotlin":     {"//", keywordSet("as break class continue do else false for fun if in interface is null object package return super this throw true try typealias val var when while")},
+	"csharp":     {"//", keywordSet("abstract as bool break case catch class const continue default do double else enum false finally for foreach if in int interface namespace new null out override private protected public return static string struct switch this throw true try using var void while")},
+	"swift":      {"//", keywordSet("as break case class continue default defer do else enum extension false for func guard if import in init let nil protocol return self struct switch throw throws true try var while")},
+	"ruby":       {"#", keywordSet("alias and begin break case class def do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield")},
+	"bash":       {"#", shKeywords},
+	"zsh":        {"#", shKeywords},
+	"fish":       {"#", keywordSet("and begin break case continue else end for function if in not or return set switch while")},
+	"lua":        {"--", keywordSet("and break do else elseif end false for function goto if in local nil not or repeat return then true until while")},
+	"sql":        {"--", keywordSet("select from where and or not insert into values update set delete create table drop alter index join left right inner outer on group by order having limit as distinct union all null is in like between case when then else end primary key")},
+	"haskell":    {"--", keywordSet("case class data deriving do else if import in infix instance let module newtype of then type where")},
+	"yaml":       {"#", keywordSet("true false null yes no")},
+	"toml":       {"#", keywordSet("true false")},
+	"json":       {"", keywordSet("true false null")},
+	"r":          {"#", keywordSet("if else repeat while function for in next break TRUE FALSE NULL Inf NaN NA")},
+	"julia":      {"#", keywordSet("begin break catch const continue do else elseif end export false finally for function global if import let local macro module quote return struct true try using while")},
+}
+
+// highlightCode colors comments, strings, numbers, and keywords in a line of
+// code. Unknown languages are printed as is.
+func highlightCode(line, lang string) string {
+	syn, ok := syntaxes[lang]
+	if !ok {
+		return line
+	}
+	// SQL keywords are case insensitive.
+	fold := lang == "sql"
+
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case syn.comment != "" && strings.HasPrefix(line[i:], syn.comment):
+			b.WriteString(ansiDim + line[i:] + ansiReset)
+			return b.String()
+		case c == '"' || c == '\'' || c == '`':
+			j := i + 1
+			for j < len(line) && line[j] != c {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(line))
+			b.WriteString(ansiGreen + line[i:j] + ansiReset)
+			i = j
+		case isWordByte(c):
+			j := i
+			for j < len(line) && isWordByte(line[j]) {
+				j++
+			}
+			word := line[i:j]
+			key := word
+			if fold {
+				key = strings.ToLower(word)
+			}
+			switch {
+			case syn.keywords[key]:
+				b.WriteString(ansiMagenta + word + ansiReset)
+			case unicode.IsDigit(rune(word[0])):
+				b.WriteString(ansiCyan + word + ansiReset)
+			default:
+				b.WriteString(word)
+			}
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// modelInfo is a model alias as listed by howdoi models --json. Prices are in
+// dollars per million tokens, and null when unknown.
+type modelInfo struct {
+	Alias         string   `json:"alias"`
+	ModelID       string   `json:"model_id"`
+	Provider      string   `json:"provider"`
+	ContextWindow int      `json:"context_window"`
+	MaxOutput     int      `json:"max_output"`
+	Vision        bool     `json:"vision"`
+	Audio         bool     `json:"audio"`
+	Tools         bool     `json:"tools"`
+	JSONMode      bool     `json:"json"`
+	Thinking      bool     `json:"thinking"`
+	PDF           bool     `json:"pdf"`
+	InputPrice    *float64 `json:"input_price"`
+	OutputPrice   *float64 `json:"output_price"`
+}
+
+// listModels returns the model aliases, registered ones included, sorted.
+func listModels() []modelInfo {
+	aliases := make([]string, 0, len(howdoi.Models))
+	for a := range howdoi.Models {
+		aliases = append(aliases, a)
+	}
+	sort.Strings(aliases)
+	models := make([]modelInfo, len(aliases))
+	for i, a := range aliases {
+		id := howdoi.Models[a]
+		c := howdoi.ModelCapabilities[id]
+		m := modelInfo{
+			Alias:         a,
+			ModelID:       id,
+			Provider:      howdoi.ModelProvider(a),
+			ContextWindow: c.ContextWindow,
+			MaxOutput:     c.MaxOutput,
+			Vision:        c.Vision,
+			Audio:         c.Audio,
+			Tools:         c.Tools,
+			JSONMode:      c.JSONMode,
+			Thinking:      c.Thinking,
+			PDF:           c.PDF,
+		}
+		if cost, ok := howdoi.ModelCost(id); ok {
+			input, output := cost.Input*1e6, cost.Output*1e6
+			m.InputPrice, m.OutputPrice = &input, &output
+		}
+		models[i] = m
+	}
+	return models
+}
+
+func newModelsCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "models",
+		Short: "List the model aliases and their capabilities",
+		Long:  "List the model aliases that -m accepts, with the model ID and provider they are sent to, the context window and output limit in tokens, what the model accepts, and its price in dollars per million input and output tokens. Models registered in the config are included.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			models := listModels()
+			if jsonOutput {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(models); err != nil {
+					log.Println("Error:", err)
+					os.Exit(exitCode(err))
+				}
+				return
+			}
+			yes := func(b bool) string {
+				if b {
+					return "yes"
+				}
+				return "-"
+			}
+			price := func(p *float64) string {
+				if p == nil {
+					return "-"
+				}
+				return fmt.Sprintf("$%.2f", *p)
+			}
+			fmt.Println("alias\tmodel\tprovider\tcontext\toutput\tvision\taudio\ttools\tjson\tthinking\tpdf\tinput/M\toutput/M")
+			for _, m := range models {
+				fmt.Printf("%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", m.Alias, m.ModelID, m.Provider, m.ContextWindow, m.MaxOutput,
+					yes(m.Vision), yes(m.Audio), yes(m.Tools), yes(m.JSONMode), yes(m.Thinking), yes(m.PDF), price(m.InputPrice), price(m.OutputPrice))
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the models as a JSON array")
+	return cmd
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+// checkOffline fails fast when --offline is combined with anything that
+// needs a cloud API.
+func checkOffline(m howdoi.ResolvedModel, storeIDs []string, fallback string) error {
+	if !howdoi.IsLocalURL(m.URL) {
+		return errors.New("--offline only allows models served from localhost, e.g. --base-url http://localhost:11434/v1 for Ollama")
+	}
+	if len(storeIDs) > 0 {
+		return errors.New("--store needs the OpenAI API, which --offline does not allow")
+	}
+	if fallback != "" {
+		return fmt.Errorf("the fallback model %s is a cloud model, which --offline does not allow", fallback)
+	}
+	return nil
+}
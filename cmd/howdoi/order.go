@@ -0,0 +1,31 @@
+package main
+
+// orderContent moves the question, the parts of content at the indexes in
+// question, before the documents, or to both sides of them with repeat.
+// Without documents the content is returned as is.
+func orderContent(content []any, question []int, questionFirst, repeat bool) []any {
+	isQuestion := make(map[int]bool, len(question))
+	for _, i := range question {
+		isQuestion[i] = true
+	}
+	var q, docs []any
+	for i, c := range content {
+		if isQuestion[i] {
+			q = append(q, c)
+		} else {
+			docs = append(docs, c)
+		}
+	}
+	if len(docs) == 0 || len(q) == 0 {
+		return content
+	}
+	out := make([]any, 0, len(content)+len(q))
+	if questionFirst || repeat {
+		out = append(out, q...)
+	}
+	out = append(out, docs...)
+	if !questionFirst || repeat {
+		out = append(out, q...)
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+// maxPickerChoices is the most models the picker lists at once.
+const maxPickerChoices = 10
+
+var errNoPick = errors.New("no model picked")
+
+// modelChoice is a model offered by the picker. Raw model IDs from the
+// usage ledger have no alias.
+type modelChoice struct {
+	alias  string
+	id     string
+	recent bool
+}
+
+func (c modelChoice) name() string {
+	if c.alias != "" {
+		return c.alias
+	}
+	return c.id
+}
+
+// modelChoices returns the recently used models, most recent first, then the
+// other aliases.
+func modelChoices() []modelChoice {
+	aliases := make(map[string]string, len(howdoi.Models))
+	for alias, id := range howdoi.Models {
+		aliases[id] = alias
+	}
+	var choices []modelChoice
+	seen := map[string]bool{}
+	// The ledger is only a hint, so it is fine for it to be missing.
+	recent, _ := recentModelIDs()
+	for _, id := range recent {
+		c := modelChoice{alias: aliases[id], id: id, recent: true}
+		if !seen[c.name()] {
+			seen[c.name()] = true
+			choices = append(choices, c)
+		}
+	}
+	var rest []modelChoice
+	for alias, id := range howdoi.Models {
+		if !seen[alias] {
+			rest = append(rest, modelChoice{alias: alias, id: id})
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i].alias < rest[j].alias })
+	return append(choices, rest...)
+}
+
+// recentModelIDs returns the model IDs in the usage ledger, most recently
+// used first.
+func recentModelIDs() ([]string, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT model FROM usage GROUP BY model ORDER BY MAX(created_at) DESC LIMIT 20")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// fuzzyScore ranks how well s matches the query, lower being better:
+// substrings first, then subsequences, then by edit distance.
+func fuzzyScore(query, s string) int {
+	query, s = strings.ToLower(query), strings.ToLower(s)
+	switch {
+	case strings.Contains(s, query):
+		return 0
+	case isSubsequence(query, s):
+		return 1
+	}
+	return 2 + editDistance(query, s)
+}
+
+func isSubsequence(sub, s string) bool {
+	i := 0
+	for j := 0; i < len(sub) && j < len(s); j++ {
+		if sub[i] == s[j] {
+			i++
+		}
+	}
+	return i == len(sub)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// rankChoices sorts the choices by how well their alias or ID matches the
+// query, keeping the recent ones first among equals.
+func rankChoices(query string, choices []modelChoice) []modelChoice {
+	score := func(c modelChoice) int {
+		s := fuzzyScore(query, c.id)
+		if c.alias != "" {
+			s = min(s, fuzzyScore(query, c.alias))
+		}
+		return s
+	}
+	ranked := append([]modelChoice(nil), choices...)
+	sort.SliceStable(ranked, func(i, j int) bool { return score(ranked[i]) < score(ranked[j]) })
+	return ranked[:min(len(ranked), maxPickerChoices)]
+}
+
+// pickModel asks on the terminal which model was meant by an unknown alias.
+// A number picks a model, other text filters the list again.
+func pickModel(unknown string) (modelChoice, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return modelChoice{}, fmt.Errorf("no terminal to pick a model on: %w", err)
+	}
+	defer tty.Close()
+	in := bufio.NewReader(tty)
+
+	choices := modelChoices()
+	query := unknown
+	fmt.Fprintf(tty, "Unknown model %q.\n", unknown)
+	for {
+		ranked := rankChoices(query, choices)
+		for i, c := range ranked {
+			line := fmt.Sprintf("%3d) %s", i+1, c.id)
+			if c.alias != "" {
+				line = fmt.Sprintf("%3d) %-14s %s", i+1, c.alias, c.id)
+			}
+			if c.recent {
+				line += " (recent)"
+			}
+			fmt.Fprintln(tty, line)
+		}
+		fmt.Fprint(tty, "Pick a number, type to filter, or press enter to quit: ")
+		answer, err := in.ReadString('\n')
+		if err != nil {
+			return modelChoice{}, err
+		}
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			return modelChoice{}, errNoPick
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(ranked) {
+			return ranked[n-1], nil
+		}
+		query = answer
+	}
+}
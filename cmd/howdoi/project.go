@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// projectConfigFile is the per-directory config file.
+const projectConfigFile = ".howdoi.yaml"
+
+// ProjectConfig holds the defaults of a directory or git repository. Paths
+// in it are relative to its directory.
+type ProjectConfig struct {
+	// Model and SystemPrompt are used instead of the config file's when no
+	// flag sets them. The system prompt can be text or a file path.
+	Model        string `yaml:"model,omitempty"`
+	SystemPrompt string `yaml:"system_prompt,omitempty"`
+	// Context is the list of files and directories attached to every prompt
+	// run from this directory.
+	Context []string `yaml:"context,omitempty"`
+
+	// path is where the config is read from and saved to.
+	path string
+}
+
+// projectConfigPath returns the project config that applies in the current
+// directory: the nearest .howdoi.yaml up to the root of the git repository,
+// or the one in the current directory, which may not exist yet.
+func projectConfigPath() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return projectConfigFile
+	}
+	out, err := commandOutput("git", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return filepath.Join(cwd, projectConfigFile)
+	}
+	// The root is compared as a file, as git resolves symlinks and the
+	// working directory may not.
+	root, err := os.Stat(strings.TrimSpace(string(out)))
+	if err != nil {
+		return filepath.Join(cwd, projectConfigFile)
+	}
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		p := filepath.Join(dir, projectConfigFile)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+		fi, err := os.Stat(dir)
+		if err != nil || os.SameFile(fi, root) || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	return filepath.Join(cwd, projectConfigFile)
+}
+
+// loadProjectConfig reads the project config that applies in the current
+// directory. A missing file is not an error.
+func loadProjectConfig() (*ProjectConfig, error) {
+	pc := ProjectConfig{path: projectConfigPath()}
+	b, err := os.ReadFile(pc.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &pc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, &pc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", pc.path, err)
+	}
+	return &pc, nil
+}
+
+func (pc *ProjectConfig) save() error {
+	b, err := yaml.Marshal(pc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(pc.path, b, 0o644)
+}
+
+// resolve returns a path of the config relative to the current directory.
+func (pc *ProjectConfig) resolve(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	p = filepath.Join(filepath.Dir(pc.path), p)
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, p); err == nil {
+			return rel
+		}
+	}
+	return p
+}
+
+// relative returns a path given in the current directory relative to the
+// config's directory, as it is stored.
+func (pc *ProjectConfig) relative(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return filepath.Clean(p)
+	}
+	if rel, err := filepath.Rel(filepath.Dir(pc.path), abs); err == nil {
+		return rel
+	}
+	return abs
+}
+
+// settings returns the model and system prompt of the project as config
+// settings. A system prompt naming a file is resolved against the config's
+// directory.
+func (pc *ProjectConfig) settings() Settings {
+	s := Settings{Model: pc.Model, SystemPrompt: pc.SystemPrompt}
+	if p := pc.resolve(pc.SystemPrompt); pc.SystemPrompt != "" && howdoi.IsFile(p) {
+		s.SystemPrompt = p
+	}
+	return s
+}
+
+// contextFiles expands the context entries into the list of files to attach.
+func (pc *ProjectConfig) contextFiles() ([]string, error) {
+	var files []string
+	for _, p := range pc.Context {
+		expanded, err := expandPath(pc.resolve(p))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, expanded...)
+	}
+	return files, nil
+}
+
+// expandPath returns the path itself for files and the files below it for
+// directories, as walkFiles finds them.
+func expandPath(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{path}, nil
+	}
+	return walkFiles(path, nil)
+}
+
+func newCtxCmd() *cobra.Command {
+	ctxCmd := &cobra.Command{
+		Use:   "ctx",
+		Short: "Manage the context attached to every prompt in this directory or repository",
+	}
+
+	load := func() *ProjectConfig {
+		pc, err := loadProjectConfig()
+		if err != nil {
+			log.Println("Error reading the project config:", err)
+			os.Exit(exitCode(err))
+		}
+		return pc
+	}
+	save := func(pc *ProjectConfig) {
+		if err := pc.save(); err != nil {
+			log.Println("Error saving the project config:", err)
+			os.Exit(exitCode(err))
+		}
+	}
+
+	ctxCmd.AddCommand(&cobra.Command{
+		Use:   "add <paths...>",
+		Short: "Add files or directories to the context",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pc := load()
+			for _, a := range args {
+				if _, err := os.Stat(a); err != nil {
+					log.Println("Error:", err)
+					os.Exit(exitCode(err))
+				}
+				p := pc.relative(a)
+				if !slices.Contains(pc.Context, p) {
+					pc.Context = append(pc.Context, p)
+				}
+			}
+			save(pc)
+		},
+	})
+
+	ctxCmd.AddCommand(&cobra.Command{
+		Use:   "rm <paths...>",
+		Short: "Remove files or directories from the context",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pc := load()
+			for _, a := range args {
+				pc.Context = slices.DeleteFunc(pc.Context, func(p string) bool {
+					return p == pc.relative(a)
+				})
+			}
+			save(pc)
+		},
+	})
+
+	ctxCmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Show the context and the files it expands to",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pc := load()
+			for _, p := range pc.Context {
+				files, err := expandPath(pc.resolve(p))
+				if err != nil {
+					fmt.Printf("%s\t(missing)\n", p)
+					continue
+				}
+				if len(files) == 1 && files[0] == pc.resolve(p) {
+					fmt.Println(p)
+					continue
+				}
+				fmt.Printf("%s\t(%d files)\n", p, len(files))
+			}
+		},
+	})
+
+	ctxCmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Remove everything from the context",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pc := load()
+			pc.Context = nil
+			save(pc)
+		},
+	})
+
+	return ctxCmd
+}
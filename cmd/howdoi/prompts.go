@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// placeholderRe matches {{1}}, {{2}}, ... and {{args}} in prompt templates.
+var placeholderRe = regexp.MustCompile(`\{\{\s*(\d+|args)\s*\}\}`)
+
+func promptsDir() string {
+	return filepath.Join(configDir(), "prompts")
+}
+
+func promptPath(name string) string {
+	return filepath.Join(promptsDir(), name+".txt")
+}
+
+func loadPromptTemplate(name string) (string, error) {
+	b, err := os.ReadFile(promptPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("no prompt template named %q", name)
+	}
+	return string(b), err
+}
+
+// renderPromptTemplate fills the placeholders of a template from the text
+// arguments. {{N}} is the Nth text argument and {{args}} is all of them joined
+// by spaces. File arguments are never substituted. It returns the rendered
+// prompt and the arguments that were not consumed by a placeholder.
+func renderPromptTemplate(tmpl string, args []string) (string, []string, error) {
+	var texts []int
+	for i, a := range args {
+		if !howdoi.IsFile(a) {
+			texts = append(texts, i)
+		}
+	}
+
+	used := map[int]bool{}
+	var missing error
+	rendered := placeholderRe.ReplaceAllStringFunc(tmpl, func(m string) string {
+		key := placeholderRe.FindStringSubmatch(m)[1]
+		if key == "args" {
+			parts := make([]string, 0, len(texts))
+			for _, i := range texts {
+				parts = append(parts, args[i])
+				used[i] = true
+			}
+			return strings.Join(parts, " ")
+		}
+		n, _ := strconv.Atoi(key)
+		if n < 1 || n > len(texts) {
+			missing = fmt.Errorf("template placeholder %s has no matching argument", m)
+			return m
+		}
+		used[texts[n-1]] = true
+		return args[texts[n-1]]
+	})
+	if missing != nil {
+		return "", nil, missing
+	}
+
+	var rest []string
+	for i, a := range args {
+		if !used[i] {
+			rest = append(rest, a)
+		}
+	}
+	return rendered, rest, nil
+}
+
+func newPromptsCmd() *cobra.Command {
+	promptsCmd := &cobra.Command{
+		Use:   "prompts",
+		Short: "Manage named prompt templates used with --prompt",
+	}
+
+	promptsCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List prompt templates",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			matches, err := filepath.Glob(filepath.Join(promptsDir(), "*.txt"))
+			if err != nil {
+				log.Println("Error listing prompt templates:", err)
+				os.Exit(exitCode(err))
+			}
+			sort.Strings(matches)
+			for _, m := range matches {
+				fmt.Println(strings.TrimSuffix(filepath.Base(m), ".txt"))
+			}
+		},
+	})
+
+	promptsCmd.AddCommand(&cobra.Command{
+		Use:   "show <name>",
+		Short: "Print a prompt template",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			tmpl, err := loadPromptTemplate(args[0])
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			fmt.Print(tmpl)
+		},
+	})
+
+	promptsCmd.AddCommand(&cobra.Command{
+		Use:   "add <name> [text or file]",
+		Short: "Save a prompt template from text, a file, or stdin",
+		Long:  "Save a prompt template. Use {{1}}, {{2}}, ... to refer to the text arguments and {{args}} for all of them.",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var content []byte
+			var err error
+			switch {
+			case len(args) == 2 && howdoi.IsFile(args[1]):
+				content, err = os.ReadFile(args[1])
+			case len(args) == 2:
+				content = []byte(args[1])
+			default:
+				content, err = io.ReadAll(os.Stdin)
+			}
+			if err != nil {
+				log.Println("Error reading the prompt template:", err)
+				os.Exit(exitCode(err))
+			}
+			if err := os.MkdirAll(promptsDir(), 0o755); err != nil {
+				log.Println("Error creating the prompts directory:", err)
+				os.Exit(exitCode(err))
+			}
+			if err := os.WriteFile(promptPath(args[0]), content, 0o644); err != nil {
+				log.Println("Error saving the prompt template:", err)
+				os.Exit(exitCode(err))
+			}
+		},
+	})
+
+	promptsCmd.AddCommand(&cobra.Command{
+		Use:   "rm <name>",
+		Short: "Delete a prompt template",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := os.Remove(promptPath(args[0])); err != nil {
+				log.Println("Error deleting the prompt template:", err)
+				os.Exit(exitCode(err))
+			}
+		},
+	})
+
+	return promptsCmd
+}
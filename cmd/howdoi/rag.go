@@ -0,0 +1,334 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// ragChunkChars is the size of the chunks files are indexed in.
+const ragChunkChars = 1600
+
+// defaultTopK is the default of --top-k.
+const defaultTopK = 8
+
+// ragChunk is a run of whole lines of an indexed file.
+type ragChunk struct {
+	path       string
+	start, end int
+	content    string
+}
+
+// source names the chunk by its file and lines.
+func (c ragChunk) source() string {
+	return fmt.Sprintf("%s:%d-%d", c.path, c.start, c.end)
+}
+
+// chunkLines packs the lines of text into chunks of about size bytes,
+// numbering lines from 1. Lines longer than size are split.
+func chunkLines(text string, size int) []ragChunk {
+	var chunks []ragChunk
+	var cur strings.Builder
+	start := 1
+	flush := func(end int) {
+		if strings.TrimSpace(cur.String()) != "" {
+			chunks = append(chunks, ragChunk{start: start, end: end, content: cur.String()})
+		}
+		cur.Reset()
+		start = end + 1
+	}
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		n := i + 1
+		for len(line) > size {
+			flush(n - 1)
+			chunks = append(chunks, ragChunk{start: n, end: n, content: line[:size]})
+			line = line[size:]
+			start = n
+		}
+		if cur.Len() > 0 && cur.Len()+len(line) > size {
+			flush(n - 1)
+		}
+		cur.WriteString(line + "\n")
+	}
+	flush(len(lines))
+	return chunks
+}
+
+// encodeVector stores an embedding as little endian float32s.
+func encodeVector(v []float64) []byte {
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(float32(f)))
+	}
+	return b
+}
+
+func decodeVector(b []byte) []float64 {
+	v := make([]float64, len(b)/4)
+	for i := range v {
+		v[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:])))
+	}
+	return v
+}
+
+// indexDir chunks and embeds the text files below dir into the named index.
+// Files that did not change since the last run are skipped, and files that
+// are gone are removed.
+func indexDir(db *sql.DB, name, dir string, verbose bool) (int, int, error) {
+	files, err := walkFiles(dir, func(rel string) bool {
+		return !documentExts[strings.ToLower(filepath.Ext(rel))]
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	indexed := map[string]string{}
+	rows, err := db.Query("SELECT path, sha256 FROM rag_files WHERE index_name = ?", name)
+	if err != nil {
+		return 0, 0, err
+	}
+	for rows.Next() {
+		var path, sum string
+		if err := rows.Scan(&path, &sum); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		indexed[path] = sum
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	var chunks []ragChunk
+	sums := map[string]string{}
+	for _, f := range files {
+		path, err := filepath.Abs(f)
+		if err != nil {
+			return 0, 0, err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return 0, 0, err
+		}
+		sum := sha256.Sum256(b)
+		sums[path] = hex.EncodeToString(sum[:])
+		if indexed[path] == sums[path] {
+			continue
+		}
+		if verbose {
+			log.Println("Indexing", path)
+		}
+		for _, c := range chunkLines(string(b), ragChunkChars) {
+			c.path = path
+			chunks = append(chunks, c)
+		}
+	}
+
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		// The path gives the embedding some context about the chunk.
+		texts[i] = c.source() + "\n" + c.content
+	}
+	var vecs [][]float64
+	if len(texts) > 0 {
+		vecs, err = howdoi.OpenAIEmbeddings.Embed(texts)
+		if err != nil {
+			return 0, 0, fmt.Errorf("embedding the chunks: %w", err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	changed, removed := 0, 0
+	for path, sum := range indexed {
+		if _, ok := sums[path]; !ok {
+			removed++
+		} else if sums[path] == sum {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM rag_chunks WHERE index_name = ? AND path = ?", name, path); err != nil {
+			return 0, 0, err
+		}
+		if _, err := tx.Exec("DELETE FROM rag_files WHERE index_name = ? AND path = ?", name, path); err != nil {
+			return 0, 0, err
+		}
+	}
+	for path, sum := range sums {
+		if indexed[path] == sum {
+			continue
+		}
+		changed++
+		if _, err := tx.Exec("INSERT INTO rag_files (index_name, path, sha256) VALUES (?, ?, ?)", name, path, sum); err != nil {
+			return 0, 0, err
+		}
+	}
+	for i, c := range chunks {
+		if _, err := tx.Exec("INSERT INTO rag_chunks (index_name, path, start_line, end_line, content, embedding) VALUES (?, ?, ?, ?, ?, ?)",
+			name, c.path, c.start, c.end, c.content, encodeVector(vecs[i])); err != nil {
+			return 0, 0, err
+		}
+	}
+	return changed, removed, tx.Commit()
+}
+
+// retrieveChunks returns the k chunks of the named index most similar to the
+// question, most similar first.
+func retrieveChunks(name, question string, k int) ([]ragChunk, error) {
+	if strings.TrimSpace(question) == "" {
+		return nil, fmt.Errorf("--rag needs a question to search the index with")
+	}
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT path, start_line, end_line, content, embedding FROM rag_chunks WHERE index_name = ?", name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var chunks []ragChunk
+	var vecs [][]float64
+	for rows.Next() {
+		var c ragChunk
+		var vec []byte
+		if err := rows.Scan(&c.path, &c.start, &c.end, &c.content, &vec); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+		vecs = append(vecs, decodeVector(vec))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("no index named %q, create it with howdoi index", name)
+	}
+
+	q, err := howdoi.OpenAIEmbeddings.Embed([]string{question})
+	if err != nil {
+		return nil, fmt.Errorf("embedding the question: %w", err)
+	}
+	scores := make([]float64, len(chunks))
+	for i := range chunks {
+		scores[i] = howdoi.Cosine(q[0], vecs[i])
+	}
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	top := make([]ragChunk, 0, k)
+	for _, i := range order[:min(k, len(order))] {
+		top = append(top, chunks[i])
+	}
+	return top, nil
+}
+
+func newIndexCmd() *cobra.Command {
+	var name string
+	var verbose bool
+
+	indexCmd := &cobra.Command{
+		Use:   "index <dir>",
+		Short: "Chunk and embed the files of a directory for --rag",
+		Long:  "Split the text files below a directory into chunks and store their embeddings in the howdoi database, so --rag can attach only the chunks relevant to a question. Running it again only embeds the files that changed. Embeddings use the OpenAI API and need OPENAI_API_KEY.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir, err := filepath.Abs(args[0])
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			if name == "" {
+				name = filepath.Base(dir)
+			}
+			db, err := openDB()
+			if err != nil {
+				log.Println("Error opening the database:", err)
+				os.Exit(exitCode(err))
+			}
+			defer db.Close()
+			changed, removed, err := indexDir(db, name, dir, verbose)
+			if err != nil {
+				log.Println("Error indexing the directory:", err)
+				os.Exit(exitCode(err))
+			}
+			fmt.Printf("Index %s: %d files indexed, %d removed\n", name, changed, removed)
+		},
+	}
+	indexCmd.Flags().StringVar(&name, "name", "", "Name of the index (the directory name by default)")
+	indexCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Log every file indexed")
+
+	indexCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the indexes with their files and chunks",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			db, err := openDB()
+			if err != nil {
+				log.Println("Error opening the database:", err)
+				os.Exit(exitCode(err))
+			}
+			defer db.Close()
+			rows, err := db.Query("SELECT index_name, COUNT(DISTINCT path), COUNT(*) FROM rag_chunks GROUP BY index_name ORDER BY index_name")
+			if err != nil {
+				log.Println("Error listing the indexes:", err)
+				os.Exit(exitCode(err))
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var name string
+				var files, chunks int
+				if err := rows.Scan(&name, &files, &chunks); err != nil {
+					log.Println("Error listing the indexes:", err)
+					os.Exit(exitCode(err))
+				}
+				fmt.Printf("%s\t%d files\t%d chunks\n", name, files, chunks)
+			}
+		},
+	})
+
+	indexCmd.AddCommand(&cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete an index",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			db, err := openDB()
+			if err != nil {
+				log.Println("Error opening the database:", err)
+				os.Exit(exitCode(err))
+			}
+			defer db.Close()
+			if _, err := db.Exec("DELETE FROM rag_files WHERE index_name = ?", args[0]); err != nil {
+				log.Println("Error deleting the index:", err)
+				os.Exit(exitCode(err))
+			}
+			res, err := db.Exec("DELETE FROM rag_chunks WHERE index_name = ?", args[0])
+			if err != nil {
+				log.Println("Error deleting the index:", err)
+				os.Exit(exitCode(err))
+			}
+			n, _ := res.RowsAffected()
+			fmt.Printf("Removed %d chunks\n", n)
+		},
+	})
+
+	return indexCmd
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// diffLines returns a line diff of a and b, with lines prefixed by " ", "-",
+// or "+", computed from their longest common subsequence.
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		out = append(out, "+"+b[j])
+	}
+	return out
+}
+
+func newReplayCmd() *cobra.Command {
+	var model string
+	var maxTokens int
+	var temperature float32
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:   "replay <id>",
+		Short: "Rerun a stored conversation on another model and diff the answers",
+		Long:  "Rerun a stored conversation turn by turn on another model. Each turn is asked with the stored earlier turns as context, so every answer is compared under the same conditions as the original.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				log.Println("Error: invalid conversation id", args[0])
+				os.Exit(exitUsage)
+			}
+			conv, err := loadConversation(id)
+			if err != nil {
+				log.Println("Error loading the conversation:", err)
+				os.Exit(exitCode(err))
+			}
+			m, err := howdoi.ResolveModel(model, "", "", "")
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+
+			turn := 0
+			for i, msg := range conv.Messages {
+				if msg.Role != "user" {
+					continue
+				}
+				turn++
+				var messages []howdoi.Message
+				for _, h := range conv.Messages[:i+1] {
+					messages = append(messages, howdoi.Message{Role: h.Role, Content: howdoi.AdaptContent(m.Provider, h.Content)})
+				}
+				q := Query{
+					Request: howdoi.Request{
+						Model:       model,
+						ModelID:     m.ModelID,
+						Provider:    m.Provider,
+						Vendor:      m.Vendor,
+						URL:         m.URL,
+						APIKey:      m.APIKey,
+						System:      conv.System,
+						Messages:    messages,
+						MaxTokens:   maxTokens,
+						Temperature: temperature,
+						Verbose:     verbose,
+					},
+					Quiet:           true,
+					MaxRetries:      defaultMaxRetries,
+					OverloadRetries: defaultMaxRetries,
+				}
+				if err := howdoi.CheckCapabilities(q.Request); err != nil {
+					log.Println("Error:", err)
+					os.Exit(exitCode(err))
+				}
+				res, err := runQuery(q)
+				if err != nil {
+					log.Println("Error calling the API:", err)
+					os.Exit(exitCode(err))
+				}
+
+				var stored string
+				if i+1 < len(conv.Messages) && conv.Messages[i+1].Role == "assistant" {
+					stored = messageText(conv.Messages[i+1])
+				}
+				fmt.Printf("## turn %d\n\n", turn)
+				fmt.Printf("--- %s\n+++ %s\n", conv.Model, model)
+				a := strings.Split(strings.TrimRight(stored, "\n"), "\n")
+				b := strings.Split(strings.TrimRight(res.Answer, "\n"), "\n")
+				for _, line := range diffLines(a, b) {
+					fmt.Println(line)
+				}
+				fmt.Println()
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&model, "model", "m", "flash", "Model to replay the conversation on")
+	cmd.Flags().IntVarP(&maxTokens, "max-tokens", "t", 4096, "Maximum number of tokens to generate")
+	cmd.Flags().Float32VarP(&temperature, "temperature", "e", 0.10, "Temperature")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbosity")
+	return cmd
+}
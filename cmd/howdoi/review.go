@@ -0,0 +1,361 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+const reviewSystemPrompt = `You are reviewing a code change. For every file you get its diff and, for Go files, the complete declarations the change touches in their new version, with line numbers. Point out bugs, missed edge cases, and unclear code in the change, citing file and line. Skip praise and style nits a formatter would fix. If the change looks right, say so in one sentence.`
+
+// maxDeclLines is the longest declaration sent whole. Longer ones only get
+// declContextLines lines around every change.
+const (
+	maxDeclLines     = 150
+	declContextLines = 20
+)
+
+// diffHunk is a hunk of a unified diff.
+type diffHunk struct {
+	text string
+	// start and end are the first and last lines of the new file the hunk
+	// changes. A hunk that only removes lines changes the line after them.
+	start, end int
+}
+
+// fileDiff is the diff of a file. path is empty for deleted files.
+type fileDiff struct {
+	path  string
+	hunks []diffHunk
+}
+
+// parseDiff splits the output of git diff into files and hunks.
+func parseDiff(diff string) []fileDiff {
+	var files []fileDiff
+	var f *fileDiff
+	var h *diffHunk
+	line := 0
+	for _, l := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(l, "diff --git "):
+			files = append(files, fileDiff{})
+			f, h = &files[len(files)-1], nil
+		case f == nil:
+		case h == nil && strings.HasPrefix(l, "+++ "):
+			if p := strings.TrimPrefix(l, "+++ "); p != "/dev/null" {
+				f.path = strings.TrimPrefix(p, "b/")
+			}
+		case strings.HasPrefix(l, "@@ "):
+			// @@ -old,n +new,n @@ context
+			fields := strings.Fields(l)
+			if len(fields) < 3 {
+				continue
+			}
+			start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+			line, _ = strconv.Atoi(start)
+			f.hunks = append(f.hunks, diffHunk{text: l})
+			h = &f.hunks[len(f.hunks)-1]
+		case h != nil:
+			h.text += "\n" + l
+			switch {
+			case strings.HasPrefix(l, "+"):
+				h.mark(line)
+				line++
+			case strings.HasPrefix(l, "-"):
+				h.mark(max(line, 1))
+			case strings.HasPrefix(l, " "):
+				line++
+			}
+		}
+	}
+	return files
+}
+
+// mark records that the hunk changes line n of the new file.
+func (h *diffHunk) mark(n int) {
+	if h.start == 0 || n < h.start {
+		h.start = n
+	}
+	h.end = max(h.end, n)
+}
+
+// goDeclContext returns the top-level declarations of a Go file that the
+// hunks change, with their doc comments, as numbered lines. Lines shared by
+// several declarations or changes are printed once.
+func goDeclContext(path string, src []byte, hunks []diffHunk) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return "", err
+	}
+	var ranges [][2]int
+	for _, d := range file.Decls {
+		start, end := fset.Position(d.Pos()).Line, fset.Position(d.End()).Line
+		var touched []diffHunk
+		for _, h := range hunks {
+			if h.start != 0 && h.start <= end && h.end >= start {
+				touched = append(touched, h)
+			}
+		}
+		if len(touched) == 0 {
+			continue
+		}
+		if end-start >= maxDeclLines {
+			// Long declarations are cut down to their first line and the
+			// lines around the changes.
+			ranges = append(ranges, [2]int{start, start})
+			for _, h := range touched {
+				ranges = append(ranges, [2]int{max(h.start-declContextLines, start), min(h.end+declContextLines, end)})
+			}
+			continue
+		}
+		var doc *ast.CommentGroup
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			doc = d.Doc
+		case *ast.GenDecl:
+			doc = d.Doc
+		}
+		if doc != nil {
+			start = fset.Position(doc.Pos()).Line
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return numberedRanges(src, ranges), nil
+}
+
+// numberedRanges returns the lines of src in the ranges, which may overlap,
+// as numbered lines with "..." between the gaps.
+func numberedRanges(src []byte, ranges [][2]int) string {
+	if len(ranges) == 0 {
+		return ""
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] <= last[1]+1 {
+			last[1] = max(last[1], r[1])
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	lines := strings.Split(string(src), "\n")
+	var b strings.Builder
+	for i, r := range merged {
+		if i > 0 {
+			b.WriteString("...\n")
+		}
+		for n := r[0]; n <= r[1] && n <= len(lines); n++ {
+			fmt.Fprintf(&b, "%5d  %s\n", n, lines[n-1])
+		}
+	}
+	return b.String()
+}
+
+// reviewNewSide returns the revision holding the new version of the files
+// for the git diff arguments, or "" for the working tree.
+func reviewNewSide(rev string, staged bool) string {
+	if staged {
+		return ":"
+	}
+	// In a...b, as in a..b, the new side is b.
+	i := strings.LastIndex(rev, "..")
+	if i < 0 {
+		return ""
+	}
+	to := rev[i+2:]
+	if to == "" {
+		to = "HEAD"
+	}
+	return to + ":"
+}
+
+// readNewSide reads the new version of a file from git, or from the working
+// tree under root when side is "".
+func readNewSide(root, side, path string) ([]byte, error) {
+	if side == "" {
+		return os.ReadFile(filepath.Join(root, path))
+	}
+	return commandOutput("git", "-C", root, "show", side+path)
+}
+
+// reviewContent builds the documents of a review: the diff of every file
+// and, for Go files, the declarations the change touches.
+func reviewContent(root, side, diff string, verbose bool) ([]any, error) {
+	var content []any
+	for _, f := range parseDiff(diff) {
+		if len(f.hunks) == 0 {
+			continue
+		}
+		texts := make([]string, len(f.hunks))
+		for i, h := range f.hunks {
+			texts[i] = h.text
+		}
+		source := f.path
+		if source == "" {
+			source = "deleted file"
+		}
+		doc, err := howdoi.RenderDocument(howdoi.Document{Source: source + " (diff)", Language: "diff", Content: strings.Join(texts, "\n")})
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, doc)
+
+		if f.path == "" || filepath.Ext(f.path) != ".go" {
+			continue
+		}
+		src, err := readNewSide(root, side, f.path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.path, err)
+		}
+		decls, err := goDeclContext(f.path, src, f.hunks)
+		if err != nil {
+			// The diff alone still makes a review.
+			if verbose {
+				log.Printf("Error parsing %s, sending the diff only: %v\n", f.path, err)
+			}
+			continue
+		}
+		if decls == "" {
+			continue
+		}
+		doc, err = howdoi.RenderDocument(howdoi.Document{Source: f.path, Language: "go", Content: decls})
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, doc)
+	}
+	return content, nil
+}
+
+var errNoChanges = errors.New("no changes to review")
+
+func newReviewCmd() *cobra.Command {
+	var staged bool
+	var focus string
+	var model string
+	var maxTokens int
+	var temperature float32
+	var raw bool
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:   "review [<rev> | <rev>..<rev>] [-- <paths>...]",
+		Short: "Review the changes of a git diff",
+		Long:  "Review the uncommitted changes, the changes since <rev>, or the changes between two revisions. Besides the diff, the model gets the complete Go functions and declarations the change touches, found with go/parser, rather than whole files or bare hunks, which gives it the context it needs at a fraction of the tokens.",
+		Run: func(cmd *cobra.Command, args []string) {
+			rev := ""
+			var paths []string
+			if n := cmd.ArgsLenAtDash(); n >= 0 {
+				paths = args[n:]
+				args = args[:n]
+			}
+			if len(args) > 1 {
+				log.Println("Error: review takes at most one revision or range")
+				os.Exit(exitUsage)
+			}
+			if len(args) == 1 {
+				rev = args[0]
+			}
+
+			out, err := commandOutput("git", "rev-parse", "--show-toplevel")
+			if err != nil {
+				log.Println("Error: not in a git repository")
+				os.Exit(exitUsage)
+			}
+			root := strings.TrimSpace(string(out))
+			gitArgs := []string{"-C", root, "diff", "--no-color", "--no-ext-diff"}
+			if staged {
+				gitArgs = append(gitArgs, "--cached")
+			}
+			if rev != "" {
+				gitArgs = append(gitArgs, rev)
+			}
+			gitArgs = append(gitArgs, "--")
+			for _, p := range paths {
+				// Paths are relative to where howdoi runs, not to root.
+				if abs, err := filepath.Abs(p); err == nil {
+					p = abs
+				}
+				gitArgs = append(gitArgs, p)
+			}
+			diff, err := commandOutput("git", gitArgs...)
+			if err != nil {
+				log.Println("Error running git diff:", err)
+				os.Exit(exitCode(err))
+			}
+			content, err := reviewContent(root, reviewNewSide(rev, staged), string(diff), verbose)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			if len(content) == 0 {
+				log.Println("Error:", errNoChanges)
+				os.Exit(exitError)
+			}
+			question := "Review this change."
+			if focus != "" {
+				question += " Focus on " + focus + "."
+			}
+			content = append(content, howdoi.TextContent{Type: "text", Text: question})
+
+			m, err := howdoi.ResolveModel(model, "", "", "")
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			q := Query{
+				Request: howdoi.Request{
+					Model:       model,
+					ModelID:     m.ModelID,
+					Provider:    m.Provider,
+					Vendor:      m.Vendor,
+					URL:         m.URL,
+					APIKey:      m.APIKey,
+					System:      reviewSystemPrompt,
+					Messages:    []howdoi.Message{{Role: "user", Content: content}},
+					MaxTokens:   maxTokens,
+					Temperature: temperature,
+					Verbose:     verbose,
+				},
+				Markdown:        useMarkdown(raw),
+				Width:           answerWidth(),
+				MaxRetries:      defaultMaxRetries,
+				OverloadRetries: defaultMaxRetries,
+			}
+			if err := howdoi.CheckCapabilities(q.Request); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			res, err := runQuery(q)
+			if err != nil {
+				log.Println("Error calling the API:", err)
+				os.Exit(exitCode(err))
+			}
+			if verbose {
+				log.Printf("%s, $%.4f\n", res.Usage, res.Cost)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&staged, "staged", false, "Review the staged changes instead of the working tree")
+	cmd.Flags().StringVar(&focus, "focus", "", "What the review should focus on, e.g. \"error handling\"")
+	cmd.Flags().StringVarP(&model, "model", "m", "sonnet", "Model to review with")
+	cmd.Flags().IntVarP(&maxTokens, "max-tokens", "t", 4096, "Maximum number of tokens to generate")
+	cmd.Flags().Float32VarP(&temperature, "temperature", "e", 0.10, "Temperature")
+	cmd.Flags().BoolVar(&raw, "raw", false, "Print the review as plain text instead of rendered markdown")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbosity")
+	return cmd
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want []fileDiff
+	}{
+		{
+			name: "change",
+			diff: `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -10,4 +10,5 @@ func main() {
+ 	a := 1
+-	b := 2
++	b := 3
++	c := 4
+ 	fmt.Println(a, b)
+`,
+			want: []fileDiff{{path: "main.go", hunks: []diffHunk{{
+				text:  "@@ -10,4 +10,5 @@ func main() {\n \ta := 1\n-\tb := 2\n+\tb := 3\n+\tc := 4\n \tfmt.Println(a, b)\n",
+				start: 11, end: 12,
+			}}}},
+		},
+		{
+			name: "removed lines mark the line after them",
+			diff: `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -3,3 +3,2 @@
+ x
+-y
+ z
+`,
+			want: []fileDiff{{path: "a.go", hunks: []diffHunk{{text: "@@ -3,3 +3,2 @@\n x\n-y\n z\n", start: 4, end: 4}}}},
+		},
+		{
+			name: "several files and hunks",
+			diff: `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1 +1 @@
+-a
++b
+@@ -20,0 +21 @@
++c
+diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1 @@
++package main
+`,
+			want: []fileDiff{
+				{path: "a.go", hunks: []diffHunk{
+					{text: "@@ -1 +1 @@\n-a\n+b", start: 1, end: 1},
+					{text: "@@ -20,0 +21 @@\n+c", start: 21, end: 21},
+				}},
+				{path: "new.go", hunks: []diffHunk{{text: "@@ -0,0 +1 @@\n+package main\n", start: 1, end: 1}}},
+			},
+		},
+		{
+			name: "deleted file",
+			diff: `diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package main
+`,
+			want: []fileDiff{{hunks: []diffHunk{{text: "@@ -1 +0,0 @@\n-package main\n", start: 1, end: 1}}}},
+		},
+		{
+			name: "no diff",
+			diff: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDiff(tt.diff); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// askParams are the params of the ask method. Buffer is the text of the
+// editor buffer, sent as a document named Path.
+type askParams struct {
+	Model       string   `json:"model"`
+	Question    string   `json:"question"`
+	Buffer      string   `json:"buffer"`
+	Path        string   `json:"path"`
+	Files       []string `json:"files"`
+	System      string   `json:"system"`
+	MaxTokens   int      `json:"max_tokens"`
+	Temperature *float32 `json:"temperature"`
+}
+
+type askResult struct {
+	Answer       string  `json:"answer"`
+	Model        string  `json:"model"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+// cachedFile is a loaded file, reused until it changes on disk.
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	parts   []any
+}
+
+// rpcServer answers JSON-RPC requests, one per line, on stdin and writes
+// responses and answer notifications to stdout. Requests run concurrently.
+type rpcServer struct {
+	model   string
+	out     *json.Encoder
+	outMu   sync.Mutex
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	files   map[string]cachedFile
+	wg      sync.WaitGroup
+}
+
+func (s *rpcServer) write(v any) {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	if err := s.out.Encode(v); err != nil {
+		log.Println("Error writing the response:", err)
+	}
+}
+
+func (s *rpcServer) reply(id json.RawMessage, result any, err *rpcError) {
+	if id == nil {
+		// Notifications get no response.
+		return
+	}
+	if err == nil && result == nil {
+		result = struct{}{}
+	}
+	s.write(rpcResponse{JSONRPC: "2.0", ID: id, Result: result, Error: err})
+}
+
+// rpcMaxLine is the longest request line read, which holds the editor
+// buffer.
+const rpcMaxLine = 64 * 1024 * 1024
+
+// serve reads requests until in is closed or shutdown is called, then waits
+// for the requests still running. A line that is not a request gets a parse
+// error and the next line is read.
+func (s *rpcServer) serve(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), rpcMaxLine)
+	defer s.wg.Wait()
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.reply(json.RawMessage("null"), nil, &rpcError{rpcParseError, err.Error()})
+			continue
+		}
+		switch req.Method {
+		case "initialize":
+			aliases := make([]string, 0, len(howdoi.Models))
+			for alias := range howdoi.Models {
+				aliases = append(aliases, alias)
+			}
+			sort.Strings(aliases)
+			s.reply(req.ID, map[string]any{"name": "howdoi", "model": s.model, "models": aliases}, nil)
+		case "ask":
+			var p askParams
+			if err := json.Unmarshal(req.Params, &p); err != nil || p.Question == "" {
+				s.reply(req.ID, nil, &rpcError{rpcInvalidParams, "ask needs a question"})
+				continue
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			s.mu.Lock()
+			s.cancels[string(req.ID)] = cancel
+			s.mu.Unlock()
+			s.wg.Add(1)
+			go func(req rpcRequest) {
+				defer s.wg.Done()
+				defer func() {
+					s.mu.Lock()
+					delete(s.cancels, string(req.ID))
+					s.mu.Unlock()
+					cancel()
+				}()
+				res, err := s.ask(ctx, req.ID, p)
+				if err != nil {
+					s.reply(req.ID, nil, &rpcError{rpcServerError, err.Error()})
+					return
+				}
+				s.reply(req.ID, res, nil)
+			}(req)
+		case "cancel":
+			var p struct {
+				ID json.RawMessage `json:"id"`
+			}
+			if err := json.Unmarshal(req.Params, &p); err != nil {
+				s.reply(req.ID, nil, &rpcError{rpcInvalidParams, err.Error()})
+				continue
+			}
+			s.mu.Lock()
+			if cancel, ok := s.cancels[string(p.ID)]; ok {
+				cancel()
+			}
+			s.mu.Unlock()
+			s.reply(req.ID, nil, nil)
+		case "shutdown":
+			s.reply(req.ID, nil, nil)
+			return
+		default:
+			s.reply(req.ID, nil, &rpcError{rpcMethodNotFound, "unknown method " + req.Method})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Println("Error reading the requests:", err)
+	}
+}
+
+// loadFile loads a file, reusing the content of earlier requests when the
+// file has not changed.
+func (s *rpcServer) loadFile(file string, opts howdoi.LoadOptions) ([]any, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	key := opts.Provider + "\x00" + file
+	s.mu.Lock()
+	c, ok := s.files[key]
+	s.mu.Unlock()
+	if ok && c.modTime.Equal(fi.ModTime()) && c.size == fi.Size() {
+		return c.parts, nil
+	}
+	parts, _, err := howdoi.LoadFile(file, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.files[key] = cachedFile{modTime: fi.ModTime(), size: fi.Size(), parts: parts}
+	s.mu.Unlock()
+	return parts, nil
+}
+
+// ask streams the answer to a question as answer notifications carrying the
+// request id, and returns the complete answer.
+func (s *rpcServer) ask(ctx context.Context, id json.RawMessage, p askParams) (askResult, error) {
+	model := p.Model
+	if model == "" {
+		model = s.model
+	}
+	m, err := howdoi.ResolveModel(model, "", "", "")
+	if err != nil {
+		return askResult{}, err
+	}
+	req := howdoi.Request{
+		Model:       model,
+		ModelID:     m.ModelID,
+		Provider:    m.Provider,
+		Vendor:      m.Vendor,
+		URL:         m.URL,
+		APIKey:      m.APIKey,
+		System:      p.System,
+		MaxTokens:   p.MaxTokens,
+		Temperature: 0.1,
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = 4096
+	}
+	if p.Temperature != nil {
+		req.Temperature = *p.Temperature
+	}
+
+	var content []any
+	opts := howdoi.LoadOptions{Provider: m.Provider, ModelID: m.ModelID, Question: p.Question}
+	for _, f := range p.Files {
+		parts, err := s.loadFile(f, opts)
+		if err != nil {
+			return askResult{}, err
+		}
+		content = append(content, parts...)
+	}
+	if p.Buffer != "" {
+		doc, err := howdoi.RenderDocument(howdoi.Document{Source: p.Path, Language: howdoi.DetectLanguage(p.Path, p.Buffer), Content: p.Buffer})
+		if err != nil {
+			return askResult{}, err
+		}
+		content = append(content, doc)
+	}
+	content = append(content, howdoi.TextContent{Type: "text", Text: p.Question})
+	req.Messages = []howdoi.Message{{Role: "user", Content: content}}
+	if err := howdoi.CheckCapabilities(req); err != nil {
+		return askResult{}, err
+	}
+
+	client := howdoi.Client{MaxRetries: defaultMaxRetries, OverloadRetries: defaultMaxRetries}
+	respChan, err := complete(ctx, &client, req)
+	if err != nil {
+		return askResult{}, err
+	}
+	res := askResult{Model: m.ModelID}
+	var usage howdoi.Usage
+	var requestIDs []string
+	var streamErr error
+	for d := range respChan {
+		if d.Usage != nil {
+			usage = usage.Add(*d.Usage)
+			res.Cost += howdoi.CalculateCost(m.ModelID, *d.Usage)
+			if d.RequestID != "" {
+				requestIDs = append(requestIDs, d.RequestID)
+			}
+			continue
+		}
+		if d.Err != nil {
+			streamErr = d.Err
+		}
+		if d.Text != "" {
+			res.Answer += d.Text
+			s.write(rpcNotification{JSONRPC: "2.0", Method: "answer", Params: map[string]any{"id": id, "text": d.Text}})
+		}
+	}
+	res.InputTokens, res.OutputTokens = usage.PromptTokens(), usage.OutputTokens
+	if err := recordUsage(m.ModelID, usage, res.Cost, requestIDs, nil); err != nil {
+		log.Println("Error recording usage:", err)
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return res, errors.New("cancelled")
+	}
+	return res, streamErr
+}
+
+func newRPCCmd() *cobra.Command {
+	var model string
+
+	cmd := &cobra.Command{
+		Use:   "rpc",
+		Short: "Serve JSON-RPC on stdin and stdout for editor plugins",
+		Long: `Serve JSON-RPC 2.0 on stdin and stdout, one message per line, so an editor can keep a single howdoi process running.
+
+Methods:
+  initialize           returns the default model and the model aliases
+  ask                  {question, buffer, path, files, model, system, max_tokens, temperature}
+                       streams "answer" notifications {id, text} and returns
+                       {answer, model, input_tokens, output_tokens, cost}
+  cancel               {id} cancels a running ask
+  shutdown             stops the server
+
+Files are loaded once and reused until they change on disk.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			s := &rpcServer{
+				model:   model,
+				out:     json.NewEncoder(os.Stdout),
+				cancels: map[string]context.CancelFunc{},
+				files:   map[string]cachedFile{},
+			}
+			s.serve(os.Stdin)
+		},
+	}
+	cmd.Flags().StringVarP(&model, "model", "m", "sonnet", "Default model for requests that don't name one")
+	return cmd
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+// chatRequest is the body of an OpenAI chat completions request, as far as
+// howdoi understands it.
+type chatRequest struct {
+	Model               string        `json:"model"`
+	Messages            []chatMessage `json:"messages"`
+	MaxTokens           int           `json:"max_tokens"`
+	MaxCompletionTokens int           `json:"max_completion_tokens"`
+	Temperature         *float32      `json:"temperature"`
+	Stream              bool          `json:"stream"`
+	StreamOptions       *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+// chatMessage content is either a string or a list of text and image_url
+// parts.
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type chatPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func newChatUsage(u howdoi.Usage) *chatUsage {
+	return &chatUsage{PromptTokens: u.PromptTokens(), CompletionTokens: u.OutputTokens, TotalTokens: u.PromptTokens() + u.OutputTokens}
+}
+
+// errBadRequest marks errors in the request rather than the provider's.
+var errBadRequest = errors.New("bad request")
+
+// resolveServedModel accepts an alias or the model ID of an alias.
+func resolveServedModel(name string) (string, howdoi.ResolvedModel, error) {
+	if _, ok := howdoi.Models[name]; !ok {
+		for alias, id := range howdoi.Models {
+			if id == name {
+				name = alias
+				break
+			}
+		}
+	}
+	m, err := howdoi.ResolveModel(name, "", "", "")
+	return name, m, err
+}
+
+// decodeImageURL decodes a base64 data URL. Remote image URLs are not
+// fetched.
+func decodeImageURL(url string) (string, []byte, error) {
+	meta, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !strings.HasPrefix(url, "data:") || !ok || !strings.HasSuffix(meta, ";base64") {
+		return "", nil, fmt.Errorf("%w: only base64 data URLs are supported for images", errBadRequest)
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	ext := "." + strings.TrimPrefix(strings.TrimSuffix(meta, ";base64"), "image/")
+	return ext, b, nil
+}
+
+// chatToRequest converts the messages of an OpenAI request into howdoi's,
+// with the system messages joined into the system prompt.
+func chatToRequest(body chatRequest, provider string) (string, []howdoi.Message, error) {
+	var system []string
+	var messages []howdoi.Message
+	for _, m := range body.Messages {
+		var content []any
+		var text string
+		if err := json.Unmarshal(m.Content, &text); err == nil {
+			content = append(content, howdoi.TextContent{Type: "text", Text: text})
+		} else {
+			var parts []chatPart
+			if err := json.Unmarshal(m.Content, &parts); err != nil {
+				return "", nil, fmt.Errorf("%w: invalid content: %v", errBadRequest, err)
+			}
+			for _, p := range parts {
+				switch p.Type {
+				case "text":
+					content = append(content, howdoi.TextContent{Type: "text", Text: p.Text})
+				case "image_url":
+					ext, data, err := decodeImageURL(p.ImageURL.URL)
+					if err != nil {
+						return "", nil, err
+					}
+					content = append(content, howdoi.NewImageContent(provider, ext, data))
+				default:
+					return "", nil, fmt.Errorf("%w: unsupported content type %q", errBadRequest, p.Type)
+				}
+			}
+		}
+		switch m.Role {
+		case "system", "developer":
+			for _, c := range content {
+				if t, ok := c.(howdoi.TextContent); ok {
+					system = append(system, t.Text)
+				}
+			}
+		case "user", "assistant":
+			messages = append(messages, howdoi.Message{Role: m.Role, Content: content})
+		default:
+			return "", nil, fmt.Errorf("%w: unsupported role %q", errBadRequest, m.Role)
+		}
+	}
+	if len(messages) == 0 {
+		return "", nil, fmt.Errorf("%w: no messages", errBadRequest)
+	}
+	return strings.Join(system, "\n\n"), messages, nil
+}
+
+// chatServer serves the OpenAI chat completions API from howdoi's models.
+// Every request needs the bearer token, since it spends the user's API keys.
+type chatServer struct {
+	token   string
+	noCache bool
+	verbose bool
+	seq     atomic.Int64
+}
+
+// authorize checks the bearer token of a request and writes the error when
+// it is missing or wrong.
+func (s *chatServer) authorize(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeChatError(w, http.StatusUnauthorized, "missing or wrong bearer token")
+		return false
+	}
+	return true
+}
+
+// newServeToken returns a random bearer token.
+func newServeToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "howdoi-" + hex.EncodeToString(b), nil
+}
+
+func writeChatError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"message": msg, "type": "invalid_request_error"}})
+}
+
+func (s *chatServer) handleModels(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r) {
+		return
+	}
+	aliases := make([]string, 0, len(howdoi.Models))
+	for alias := range howdoi.Models {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	data := make([]map[string]any, len(aliases))
+	for i, alias := range aliases {
+		data[i] = map[string]any{"id": alias, "object": "model", "owned_by": "howdoi"}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data})
+}
+
+func (s *chatServer) handleChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeChatError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if !s.authorize(w, r) {
+		return
+	}
+	// Browsers send form and text bodies to any origin without asking.
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+		writeChatError(w, http.StatusUnsupportedMediaType, "the body must be application/json")
+		return
+	}
+	var body chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeChatError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	alias, m, err := resolveServedModel(body.Model)
+	if err != nil {
+		writeChatError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	system, messages, err := chatToRequest(body, m.Provider)
+	if err != nil {
+		writeChatError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q := Query{Request: howdoi.Request{
+		Model:       alias,
+		ModelID:     m.ModelID,
+		Provider:    m.Provider,
+		Vendor:      m.Vendor,
+		URL:         m.URL,
+		APIKey:      m.APIKey,
+		System:      system,
+		Messages:    messages,
+		MaxTokens:   max(body.MaxTokens, body.MaxCompletionTokens),
+		Temperature: 1,
+	}}
+	if q.MaxTokens == 0 {
+		q.MaxTokens = 4096
+	}
+	if body.Temperature != nil {
+		q.Temperature = *body.Temperature
+	}
+	if err := howdoi.CheckCapabilities(q.Request); err != nil {
+		writeChatError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id := fmt.Sprintf("chatcmpl-howdoi-%d", s.seq.Add(1))
+	created := time.Now().Unix()
+	chunk := func(delta map[string]string, finish any, usage *chatUsage) map[string]any {
+		c := map[string]any{"id": id, "object": "chat.completion.chunk", "created": created, "model": alias}
+		if usage != nil {
+			c["choices"] = []any{}
+			c["usage"] = usage
+		} else {
+			c["choices"] = []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finish}}
+		}
+		return c
+	}
+	flusher, _ := w.(http.Flusher)
+	writeEvent := func(v any) {
+		b, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", b)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if body.Stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	var res Result
+	cached := false
+	if !s.noCache {
+		res.Answer, cached = lookupCachedResponse(q)
+	}
+	if !cached {
+		client := howdoi.Client{MaxRetries: defaultMaxRetries, OverloadRetries: defaultMaxRetries}
+		respChan, err := complete(r.Context(), &client, q.Request)
+		if err != nil {
+			writeChatError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		var answer strings.Builder
+		var streamErr error
+		for d := range respChan {
+			if d.Usage != nil {
+				res.Usage = res.Usage.Add(*d.Usage)
+				res.Cost += howdoi.CalculateCost(q.ModelID, *d.Usage)
+				if d.RequestID != "" {
+					res.RequestIDs = append(res.RequestIDs, d.RequestID)
+				}
+				continue
+			}
+			if d.Err != nil {
+				streamErr = d.Err
+			}
+			if body.Stream && d.Text != "" {
+				writeEvent(chunk(map[string]string{"role": "assistant", "content": d.Text}, nil, nil))
+			}
+			answer.WriteString(d.Text)
+		}
+		res.Answer = answer.String()
+		if err := recordUsage(q.ModelID, res.Usage, res.Cost, res.RequestIDs, nil); err != nil {
+			log.Println("Error recording usage:", err)
+		}
+		if r.Context().Err() != nil {
+			return
+		}
+		if streamErr != nil {
+			if s.verbose {
+				log.Printf("%s: %v\n", alias, streamErr)
+			}
+			// Once streaming, the status is sent, so the error goes in an
+			// event as OpenAI sends it.
+			if body.Stream {
+				writeEvent(map[string]any{"error": map[string]string{"message": streamErr.Error(), "type": "server_error"}})
+				return
+			}
+			writeChatError(w, http.StatusBadGateway, streamErr.Error())
+			return
+		}
+		if !s.noCache {
+			if err := storeCachedResponse(q, res.Answer); err != nil {
+				log.Println("Error caching the response:", err)
+			}
+		}
+	} else if body.Stream {
+		writeEvent(chunk(map[string]string{"role": "assistant", "content": res.Answer}, nil, nil))
+	}
+	if s.verbose {
+		log.Printf("%s: %s, $%.4f, cached %t\n", alias, res.Usage, res.Cost, cached)
+	}
+
+	if body.Stream {
+		writeEvent(chunk(map[string]string{}, "stop", nil))
+		if body.StreamOptions != nil && body.StreamOptions.IncludeUsage {
+			writeEvent(chunk(nil, nil, newChatUsage(res.Usage)))
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": created,
+		"model":   alias,
+		"choices": []any{map[string]any{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": res.Answer},
+			"finish_reason": "stop",
+		}},
+		"usage": newChatUsage(res.Usage),
+	})
+}
+
+func newServeCmd() *cobra.Command {
+	var host string
+	var port int
+	var noCache bool
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve an OpenAI-compatible chat completions API backed by howdoi's models",
+		Long:  "Serve /v1/chat/completions and /v1/models so editors and other OpenAI clients can use howdoi's model aliases, providers, response cache, and cost tracking. Model IDs of aliases are accepted too. Clients authenticate with the serve_token of the config file as their API key, or with the key printed at startup when there is none.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := loadConfig()
+			if err != nil {
+				log.Println("Error reading the config file:", err)
+				os.Exit(exitUsage)
+			}
+			token := os.ExpandEnv(cfg.ServeToken)
+			if token == "" {
+				if token, err = newServeToken(); err != nil {
+					log.Println("Error:", err)
+					os.Exit(exitCode(err))
+				}
+				log.Println("API key:", token)
+			}
+			s := &chatServer{token: token, noCache: noCache, verbose: verbose}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/v1/chat/completions", s.handleChat)
+			mux.HandleFunc("/v1/models", s.handleModels)
+			addr := net.JoinHostPort(host, strconv.Itoa(port))
+			log.Printf("Serving on http://%s/v1\n", addr)
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+	cmd.Flags().StringVar(&host, "host", "127.0.0.1", "Address to listen on")
+	cmd.Flags().IntVar(&port, "port", 8080, "Port to listen on")
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "Do not read or write the response cache")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Log every request with its usage and cost")
+	return cmd
+}
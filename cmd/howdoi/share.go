@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const gistsURL = "https://api.github.com/gists"
+
+var errNoGitHubToken = errors.New("set GITHUB_TOKEN or log in with gh to share as a gist")
+
+// shareText formats an answer for sharing, with the question when given.
+func shareText(model, question, answer string) string {
+	var b strings.Builder
+	if question != "" {
+		fmt.Fprintf(&b, "## Question\n\n%s\n\n## Answer (%s)\n\n", question, model)
+	}
+	b.WriteString(strings.TrimSpace(answer) + "\n")
+	return b.String()
+}
+
+// share uploads text to the paste service at url, or to a secret GitHub gist
+// when url is empty, and returns the link to it.
+func share(text, url string) (string, error) {
+	if url == "" || url == "gist" {
+		return createGist(text)
+	}
+	return postPaste(url, text)
+}
+
+// githubToken returns the token of GITHUB_TOKEN, GH_TOKEN, or the gh CLI.
+func githubToken() string {
+	for _, name := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if t := os.Getenv(name); t != "" {
+			return t
+		}
+	}
+	if b, err := commandOutput("gh", "auth", "token"); err == nil {
+		return strings.TrimSpace(string(b))
+	}
+	return ""
+}
+
+// createGist creates a secret gist with a single markdown file.
+func createGist(text string) (string, error) {
+	token := githubToken()
+	if token == "" {
+		return "", errNoGitHubToken
+	}
+	body, err := json.Marshal(map[string]any{
+		"description": "howdoi answer",
+		"public":      false,
+		"files":       map[string]any{"howdoi.md": map[string]string{"content": text}},
+	})
+	if err != nil {
+		return "", err
+	}
+	r, err := http.NewRequest("POST", gistsURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	r.Header.Set("Accept", "application/vnd.github+json")
+	r.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("GitHub API: %s", res.Status)
+	}
+	var gist struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&gist); err != nil {
+		return "", err
+	}
+	return gist.HTMLURL, nil
+}
+
+// postPaste posts text as the body of the request, which is what paste
+// services like paste.rs expect, and reads the link from the response.
+func postPaste(url, text string) (string, error) {
+	res, err := http.Post(url, "text/plain; charset=utf-8", strings.NewReader(text))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode/100 != 2 {
+		return "", fmt.Errorf("%s: %s", url, res.Status)
+	}
+	link := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+		return "", fmt.Errorf("%s did not reply with a link", url)
+	}
+	return link, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+const cmdSystemPrompt = `You turn requests into a single shell command for %s on %s. Reply with only the command: no explanation, no markdown, no code fences. Chain steps with pipes or && when one command is not enough. Prefer tools that ship with the system.`
+
+// userShell returns the name of the user's shell.
+func userShell() string {
+	if runtime.GOOS == "windows" {
+		if os.Getenv("PSModulePath") != "" {
+			return "powershell"
+		}
+		return "cmd"
+	}
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return filepath.Base(sh)
+	}
+	return "sh"
+}
+
+// userOS describes the operating system, with the distribution on Linux.
+func userOS() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "macOS"
+	case "linux":
+		b, err := os.ReadFile("/etc/os-release")
+		if err != nil {
+			return "Linux"
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if name, ok := strings.CutPrefix(line, "PRETTY_NAME="); ok {
+				return "Linux (" + strings.Trim(name, `"`) + ")"
+			}
+		}
+		return "Linux"
+	}
+	return runtime.GOOS
+}
+
+// shellCommand runs a command line with the user's shell, attached to the
+// terminal.
+func shellCommand(shell, line string) *exec.Cmd {
+	var cmd *exec.Cmd
+	switch shell {
+	case "cmd":
+		cmd = exec.Command("cmd", "/C", line)
+	case "powershell":
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", line)
+	default:
+		if path := os.Getenv("SHELL"); path != "" {
+			cmd = exec.Command(path, "-c", line)
+		} else {
+			cmd = exec.Command("sh", "-c", line)
+		}
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd
+}
+
+// cleanCommand strips the code fences and prompt some models add anyway.
+func cleanCommand(answer string) string {
+	s := strings.TrimSpace(answer)
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s[strings.IndexByte(s+"\n", '\n'):], "\n")
+		s = strings.TrimSuffix(strings.TrimSpace(s), "```")
+	}
+	s = strings.TrimSpace(s)
+	return strings.TrimPrefix(s, "$ ")
+}
+
+// openTerminal opens the terminal to ask on, which stays reachable when
+// stdin or stdout is redirected: /dev/tty, or the console on Windows. Failing
+// that, stdin and stderr are used when both are terminals.
+func openTerminal() (in, out *os.File, err error) {
+	inName, outName := "/dev/tty", "/dev/tty"
+	if runtime.GOOS == "windows" {
+		inName, outName = "CONIN$", "CONOUT$"
+	}
+	if in, err = os.OpenFile(inName, os.O_RDWR, 0); err == nil {
+		if out, err = os.OpenFile(outName, os.O_RDWR, 0); err == nil {
+			return in, out, nil
+		}
+		in.Close()
+	}
+	if isTerminal(os.Stdin) && isTerminal(os.Stderr) {
+		return os.Stdin, os.Stderr, nil
+	}
+	return nil, nil, fmt.Errorf("no terminal to ask what to do with the command: %w", err)
+}
+
+// askAction asks on the terminal what to do with the command.
+func askAction() (string, error) {
+	in, out, err := openTerminal()
+	if err != nil {
+		return "", err
+	}
+	if in != os.Stdin {
+		defer in.Close()
+		defer out.Close()
+	}
+	fmt.Fprint(out, "[e]xecute / [c]opy / [a]bort: ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(answer)), nil
+}
+
+func newCmdCmd() *cobra.Command {
+	var model string
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:   "cmd <request>",
+		Short: "Generate a shell command, then execute or copy it",
+		Long:  "Ask the model for a single shell command for your shell and OS, print it, and offer to execute it, copy it to the clipboard, or abort.",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			m, err := howdoi.ResolveModel(model, "", "", "")
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			shell := userShell()
+			q := Query{
+				Request: howdoi.Request{
+					Model:       model,
+					ModelID:     m.ModelID,
+					Provider:    m.Provider,
+					Vendor:      m.Vendor,
+					URL:         m.URL,
+					APIKey:      m.APIKey,
+					System:      fmt.Sprintf(cmdSystemPrompt, shell, userOS()),
+					Messages:    []howdoi.Message{{Role: "user", Content: []any{howdoi.TextContent{Type: "text", Text: strings.Join(args, " ")}}}},
+					MaxTokens:   1024,
+					Temperature: 0.1,
+					Verbose:     verbose,
+				},
+				Quiet:           true,
+				MaxRetries:      defaultMaxRetries,
+				OverloadRetries: defaultMaxRetries,
+			}
+			if err := howdoi.CheckCapabilities(q.Request); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			res, err := runQuery(q)
+			if err != nil {
+				log.Println("Error calling the API:", err)
+				os.Exit(exitCode(err))
+			}
+			line := cleanCommand(res.Answer)
+			if line == "" {
+				log.Println("Error: the model returned no command")
+				os.Exit(exitError)
+			}
+			fmt.Println(line)
+
+			action, err := askAction()
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			switch action {
+			case "e", "execute":
+				err := shellCommand(shell, line).Run()
+				var exit *exec.ExitError
+				if errors.As(err, &exit) {
+					os.Exit(exit.ExitCode())
+				}
+				if err != nil {
+					log.Println("Error running the command:", err)
+					os.Exit(exitCode(err))
+				}
+			case "c", "copy":
+				if err := writeClipboard(line); err != nil {
+					log.Println("Error copying the command:", err)
+					os.Exit(exitCode(err))
+				}
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&model, "model", "m", "sonnet", "Model to use")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbosity")
+	return cmd
+}
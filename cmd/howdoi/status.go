@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+func newStatusCmd() *cobra.Command {
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Check that each provider with an API key is up and accepts the key",
+		Long:  "List the models of every provider with an API key, which costs nothing, and report whether the request succeeded and how long it took. Exits with status 1 when a provider with a key fails.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			providers := howdoi.Providers()
+			statuses := make([]howdoi.ProviderStatus, len(providers))
+			client := howdoi.Client{}
+			var wg sync.WaitGroup
+			for i, p := range providers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ctx, cancel := context.WithTimeout(context.Background(), timeout)
+					defer cancel()
+					statuses[i] = client.CheckProvider(ctx, p)
+					if errors.Is(statuses[i].Err, context.DeadlineExceeded) {
+						statuses[i].Err = fmt.Errorf("no response within %s", timeout)
+					}
+				}()
+			}
+			wg.Wait()
+
+			checked, failed := 0, false
+			for _, s := range statuses {
+				switch {
+				case s.NoKey:
+					fmt.Printf("%-12s %-7s %s is not set\n", s.Provider, "no key", s.KeyEnv)
+				case s.Err != nil:
+					checked++
+					failed = true
+					fmt.Printf("%-12s %-7s %s\n", s.Provider, "error", s.Err)
+				default:
+					checked++
+					fmt.Printf("%-12s %-7s %dms\n", s.Provider, "ok", s.Latency.Milliseconds())
+				}
+			}
+			if checked == 0 {
+				log.Println("Error: no provider has an API key; set one or use howdoi auth set")
+				os.Exit(exitAuth)
+			}
+			if failed {
+				os.Exit(exitError)
+			}
+		},
+	}
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Second, "Give up on a provider after this long")
+	return cmd
+}
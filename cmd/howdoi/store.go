@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+type VectorStore struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	CreatedAt  int64  `json:"created_at"`
+	UsageBytes int64  `json:"usage_bytes"`
+	FileCounts struct {
+		InProgress int `json:"in_progress"`
+		Completed  int `json:"completed"`
+		Failed     int `json:"failed"`
+		Total      int `json:"total"`
+	} `json:"file_counts"`
+}
+
+// openAIRequest sends a JSON request to the OpenAI API and decodes the JSON response into out.
+func openAIRequest(method, path string, body any, out any) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	r, err := http.NewRequest(method, howdoi.OpenAIBaseURL+path, rd)
+	if err != nil {
+		return err
+	}
+	r.Header.Add("content-type", "application/json")
+	return doOpenAIRequest(r, out)
+}
+
+func doOpenAIRequest(r *http.Request, out any) error {
+	apiKey := howdoi.APIKey("OPENAI_API_KEY")
+	if apiKey == "" {
+		return errors.New("OPENAI_API_KEY environment variable is not set and no key is stored with howdoi auth set openai")
+	}
+	r.Header.Add("Authorization", "Bearer "+apiKey)
+	r.Header.Add("OpenAI-Beta", "assistants=v2")
+
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	bodyBytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("API call failed with status code %d, error: %s", res.StatusCode, string(bodyBytes))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(bodyBytes, out)
+}
+
+// uploadOpenAIFile uploads a local file to the OpenAI files API and returns the file id.
+func uploadOpenAIFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.WriteField("purpose", "assistants"); err != nil {
+		return "", err
+	}
+	part, err := w.CreateFormFile("file", filepath.Base(file))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	r, err := http.NewRequest("POST", howdoi.OpenAIBaseURL+"/files", &body)
+	if err != nil {
+		return "", err
+	}
+	r.Header.Add("content-type", w.FormDataContentType())
+
+	var uploaded struct {
+		ID string `json:"id"`
+	}
+	if err := doOpenAIRequest(r, &uploaded); err != nil {
+		return "", err
+	}
+	return uploaded.ID, nil
+}
+
+func newStoreCmd() *cobra.Command {
+	storeCmd := &cobra.Command{
+		Use:   "store",
+		Short: "Manage OpenAI vector stores used with --store",
+	}
+
+	storeCmd.AddCommand(&cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a vector store",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var vs VectorStore
+			if err := openAIRequest("POST", "/vector_stores", map[string]string{"name": args[0]}, &vs); err != nil {
+				log.Println("Error creating the vector store:", err)
+				os.Exit(exitCode(err))
+			}
+			fmt.Println(vs.ID)
+		},
+	})
+
+	storeCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List vector stores",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var list struct {
+				Data []VectorStore `json:"data"`
+			}
+			if err := openAIRequest("GET", "/vector_stores", nil, &list); err != nil {
+				log.Println("Error listing the vector stores:", err)
+				os.Exit(exitCode(err))
+			}
+			for _, vs := range list.Data {
+				created := time.Unix(vs.CreatedAt, 0).Format("2006-01-02")
+				fmt.Printf("%s\t%s\t%d files\t%d bytes\t%s\n", vs.ID, vs.Name, vs.FileCounts.Total, vs.UsageBytes, created)
+			}
+		},
+	})
+
+	storeCmd.AddCommand(&cobra.Command{
+		Use:   "add <store-id> <files...>",
+		Short: "Upload files and add them to a vector store",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			storeID := args[0]
+			for _, file := range args[1:] {
+				fileID, err := uploadOpenAIFile(file)
+				if err != nil {
+					log.Printf("Error uploading %s: %v\n", file, err)
+					os.Exit(exitCode(err))
+				}
+				if err := openAIRequest("POST", "/vector_stores/"+storeID+"/files", map[string]string{"file_id": fileID}, nil); err != nil {
+					log.Printf("Error adding %s to the vector store: %v\n", file, err)
+					os.Exit(exitCode(err))
+				}
+				log.Printf("Added %s (%s)\n", file, fileID)
+			}
+		},
+	})
+
+	storeCmd.AddCommand(&cobra.Command{
+		Use:   "files <store-id>",
+		Short: "List the files in a vector store",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var list struct {
+				Data []struct {
+					ID     string `json:"id"`
+					Status string `json:"status"`
+				} `json:"data"`
+			}
+			if err := openAIRequest("GET", "/vector_stores/"+args[0]+"/files", nil, &list); err != nil {
+				log.Println("Error listing the vector store files:", err)
+				os.Exit(exitCode(err))
+			}
+			for _, f := range list.Data {
+				fmt.Printf("%s\t%s\n", f.ID, f.Status)
+			}
+		},
+	})
+
+	storeCmd.AddCommand(&cobra.Command{
+		Use:   "delete <store-id>",
+		Short: "Delete a vector store",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := openAIRequest("DELETE", "/vector_stores/"+args[0], nil, nil); err != nil {
+				log.Println("Error deleting the vector store:", err)
+				os.Exit(exitCode(err))
+			}
+		},
+	})
+
+	return storeCmd
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+const titleSystemPrompt = "Write a title of at most six words for the conversation below. Reply with only the title, without quotes or a final period."
+
+// titleModels are the cheap models tried in order for titles. The first one
+// with an API key is used.
+var titleModels = []string{"mini", "flash"}
+
+// titleModel is the title_model of the config file: a model alias, "none" to
+// not generate titles, or empty to pick one of titleModels.
+var titleModel string
+
+// titleTimeout bounds how long a title or caption may take.
+const titleTimeout = 10 * time.Second
+
+var errNoTitleModel = errors.New("no API key for a title model")
+
+// resolveTitleModel returns the model titles are generated with.
+func resolveTitleModel() (string, howdoi.ResolvedModel, error) {
+	if titleModel != "" {
+		m, err := howdoi.ResolveModel(titleModel, "", "", "")
+		return titleModel, m, err
+	}
+	for _, alias := range titleModels {
+		if m, err := howdoi.ResolveModel(alias, "", "", ""); err == nil && m.APIKey != "" {
+			return alias, m, nil
+		}
+	}
+	return "", howdoi.ResolvedModel{}, errNoTitleModel
+}
+
+// cleanTitle keeps the first line of the answer without quotes.
+func cleanTitle(answer string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(answer), "\n")
+	title = strings.Trim(strings.TrimSpace(title), `"'*#. `)
+	if len(title) > 80 {
+		title = title[:77] + "..."
+	}
+	return title
+}
+
+// generateTitle asks a cheap model for a short title of an exchange.
+func generateTitle(question, answer string) (string, error) {
+	if len(question) > 2000 {
+		question = question[:2000]
+	}
+	if len(answer) > 1000 {
+		answer = answer[:1000]
+	}
+	text := "Question:\n" + question + "\n\nAnswer:\n" + answer
+	title, err := askTitleModel(titleSystemPrompt, []any{howdoi.TextContent{Type: "text", Text: text}}, 30)
+	if err != nil {
+		return "", err
+	}
+	return cleanTitle(title), nil
+}
+
+// askTitleModel sends a single message to the model titles are generated
+// with and returns its answer.
+func askTitleModel(system string, content []any, maxTokens int) (string, error) {
+	alias, m, err := resolveTitleModel()
+	if err != nil {
+		return "", err
+	}
+	req := howdoi.Request{
+		Model:       alias,
+		ModelID:     m.ModelID,
+		Provider:    m.Provider,
+		Vendor:      m.Vendor,
+		URL:         m.URL,
+		APIKey:      m.APIKey,
+		System:      system,
+		Messages:    []howdoi.Message{{Role: "user", Content: howdoi.AdaptContent(m.Provider, content)}},
+		MaxTokens:   maxTokens,
+		Temperature: 0.2,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+	defer cancel()
+	respChan, err := complete(ctx, &howdoi.Client{}, req)
+	if err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	var usage howdoi.Usage
+	for d := range respChan {
+		if d.Usage != nil {
+			usage = usage.Add(*d.Usage)
+			continue
+		}
+		if d.Err != nil {
+			err = d.Err
+		}
+		text.WriteString(d.Text)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := recordUsage(m.ModelID, usage, howdoi.CalculateCost(m.ModelID, usage), nil, nil); err != nil {
+		log.Println("Error recording usage:", err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return text.String(), nil
+}
+
+func saveTitle(id int64, title string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec("UPDATE conversations SET title = ? WHERE id = ?", title, id)
+	return err
+}
+
+// mayTitle reports whether a conversation with a model may be sent to the
+// title model. Conversations with models on this machine or on a server of
+// the user's stay there, and so does everything in offline mode.
+func mayTitle(m howdoi.ResolvedModel, offline bool) bool {
+	return titleModel != "none" && !offline && !m.Vendor.Custom && !howdoi.IsLocalURL(m.URL)
+}
+
+// titleConversation stores a generated title for a new conversation. Titles
+// are a nicety, so failures are only logged in verbose mode.
+func titleConversation(id int64, question, reply howdoi.Message, verbose bool) {
+	title, err := generateTitle(questionText(question), messageText(reply))
+	if err == nil && title != "" {
+		err = saveTitle(id, title)
+	}
+	if err != nil && verbose {
+		log.Println("Error generating a title:", err)
+	}
+}
+
+// titleUntitled generates the missing titles of conversations listed by
+// howdoi history, which one-shot questions leave untitled rather than wait
+// for the title model before exiting. They are generated a few at a time.
+func titleUntitled(convs []*Conversation, offline, verbose bool) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 4)
+	for _, c := range convs {
+		if c.Title != "" || len(c.Messages) < 2 {
+			continue
+		}
+		m, err := howdoi.ResolveModel(c.Model, "", "", "")
+		if (err != nil && !errors.Is(err, howdoi.ErrNoAPIKey)) || !mayTitle(m, offline) {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			title, err := generateTitle(questionText(c.Messages[0]), messageText(c.Messages[1]))
+			if err == nil && title != "" {
+				c.Title = title
+				err = saveTitle(c.ID, title)
+			}
+			if err != nil && verbose {
+				log.Println("Error generating a title:", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+func newTokensCmd() *cobra.Command {
+	var model string
+
+	cmd := &cobra.Command{
+		Use:   "tokens <files...>",
+		Short: "Count the tokens of files with the model's tokenizer",
+		Long:  "Count the tokens each file, URL, or text argument adds to a prompt, with tiktoken for OpenAI models, the count tokens endpoint for Anthropic, and CountTokens for Gemini, and how much of the model's context window they fill. Counts for other models are estimates, marked with ~.",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			m, err := howdoi.ResolveModel(model, "", "", "")
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			opts := howdoi.LoadOptions{Provider: m.Provider, ModelID: m.ModelID}
+			var all []any
+			total := 0
+			for _, a := range args {
+				parts, _, err := howdoi.LoadArg(context.Background(), a, opts)
+				if err != nil {
+					log.Println("Error:", err)
+					os.Exit(exitCode(err))
+				}
+				all = append(all, parts...)
+				req := howdoi.Request{Model: model, ModelID: m.ModelID, Provider: m.Provider, Vendor: m.Vendor, URL: m.URL, APIKey: m.APIKey,
+					Messages: []howdoi.Message{{Role: "user", Content: parts}}}
+				n, exact, err := howdoi.CountTokens(context.Background(), req)
+				if err != nil {
+					log.Printf("Error counting the tokens of %s: %v\n", a, err)
+					os.Exit(exitCode(err))
+				}
+				approx := ""
+				if !exact {
+					approx = "~"
+				}
+				fmt.Printf("%s%d\t%s\n", approx, n, a)
+				total += n
+			}
+
+			// Counted together, the message overhead is only paid once.
+			if len(args) > 1 {
+				req := howdoi.Request{Model: model, ModelID: m.ModelID, Provider: m.Provider, Vendor: m.Vendor, URL: m.URL, APIKey: m.APIKey,
+					Messages: []howdoi.Message{{Role: "user", Content: all}}}
+				if n, _, err := howdoi.CountTokens(context.Background(), req); err == nil {
+					total = n
+				}
+				fmt.Printf("%d\ttotal\n", total)
+			}
+			if c, ok := howdoi.ModelCapabilities[m.ModelID]; ok {
+				fmt.Printf("%.1f%% of the %d token context window of %s\n", 100*float64(total)/float64(c.ContextWindow), c.ContextWindow, m.ModelID)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&model, "model", "m", "sonnet", "Model whose tokenizer to use")
+	return cmd
+}
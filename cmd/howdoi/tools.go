@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+// toolRegistry holds the tools that can be enabled with --tools.
+var toolRegistry = map[string]howdoi.Tool{}
+
+func registerTool(t howdoi.Tool) {
+	toolRegistry[t.Name] = t
+}
+
+// lookupTools returns the named tools, or every tool for "all".
+func lookupTools(names []string) ([]howdoi.Tool, error) {
+	var tools []howdoi.Tool
+	for _, name := range names {
+		if name == "all" {
+			all := make([]string, 0, len(toolRegistry))
+			for n := range toolRegistry {
+				all = append(all, n)
+			}
+			sort.Strings(all)
+			return lookupTools(all)
+		}
+		t, ok := toolRegistry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tool %q", name)
+		}
+		tools = append(tools, t)
+	}
+	return tools, nil
+}
+
+// maxToolOutput is the most tool output, in bytes, sent back to the model.
+const maxToolOutput = 16 * 1024
+
+func init() {
+	registerTool(howdoi.Tool{
+		Name:        "run_shell",
+		Description: "Run a shell command on the user's machine and return its combined stdout and stderr. The user confirms every command before it runs.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"command": map[string]any{"type": "string", "description": "The command to run with sh -c"},
+			},
+			"required": []any{"command"},
+		},
+		Run: runShellTool,
+	})
+}
+
+func runShellTool(args json.RawMessage) (string, error) {
+	var a struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if a.Command == "" {
+		return "", fmt.Errorf("missing command")
+	}
+	ok, err := confirm(fmt.Sprintf("Run `%s`?", a.Command))
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "The user declined to run the command.", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", a.Command)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	err = cmd.Run()
+
+	s := out.String()
+	if len(s) > maxToolOutput {
+		s = s[:maxToolOutput] + "\n[output truncated]"
+	}
+	if err != nil {
+		s += fmt.Sprintf("\n[%v]", err)
+	}
+	return s, nil
+}
+
+// confirm asks a yes or no question on the terminal, which still works when
+// stdin is piped into howdoi.
+func confirm(question string) (bool, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false, fmt.Errorf("no terminal to confirm on: %w", err)
+	}
+	defer tty.Close()
+	fmt.Fprintf(tty, "\n%s [y/N] ", question)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+	"github.com/spf13/cobra"
+)
+
+const traceSystemPrompt = `You are diagnosing a Go panic or crash. You get the output with the stack trace and, for the frames in the user's code, the functions they stopped in, with line numbers. Explain what went wrong, pointing at the line where the bug is rather than only where it surfaced, and suggest a fix as a code change. If the source shown is not enough to tell, say what else you need to see.`
+
+// traceFrameRe matches the file line of a frame in a Go stack trace, like
+// "\t/home/me/app/main.go:42 +0x1d".
+var traceFrameRe = regexp.MustCompile(`^\s+(\S+\.go):(\d+)(?:\s+\+0x[0-9a-f]+)?\s*$`)
+
+// maxTraceFiles is the most files attached for a trace. The panicking
+// goroutine comes first and its frames start at the panic, so the files
+// cited first are the ones that matter.
+const maxTraceFiles = 8
+
+// traceContextLines is the number of lines sent around a cited line of a file
+// that does not parse.
+const traceContextLines = 10
+
+var errNoTrace = errors.New("no Go stack trace on stdin")
+
+// traceFile is a file cited by a stack trace and the lines cited in it.
+type traceFile struct {
+	path  string
+	lines []int
+}
+
+// parseTrace returns the files of the frames of a stack trace in the order
+// they are first cited.
+func parseTrace(trace string) []traceFile {
+	var files []traceFile
+	index := map[string]int{}
+	for _, l := range strings.Split(trace, "\n") {
+		m := traceFrameRe.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		n, err := strconv.Atoi(m[2])
+		if err != nil || n < 1 {
+			continue
+		}
+		i, ok := index[m[1]]
+		if !ok {
+			i = len(files)
+			index[m[1]] = i
+			files = append(files, traceFile{path: m[1]})
+		}
+		if !slices.Contains(files[i].lines, n) {
+			files[i].lines = append(files[i].lines, n)
+		}
+	}
+	return files
+}
+
+// localPath returns the path relative to root of a file cited by a trace, or
+// "" when it is not in root. Binaries built elsewhere or with -trimpath cite
+// other paths, so the longest end of the path found under root is used. The
+// standard library and the module cache are never local.
+func localPath(root, path string) string {
+	slash := filepath.ToSlash(path)
+	if goroot := filepath.ToSlash(runtime.GOROOT()); goroot != "" && strings.HasPrefix(slash, goroot+"/") {
+		return ""
+	}
+	if strings.Contains(slash, "/pkg/mod/") {
+		return ""
+	}
+	parts := strings.Split(strings.TrimPrefix(slash, "/"), "/")
+	for i := range parts {
+		rel := filepath.Join(parts[i:]...)
+		if fi, err := os.Stat(filepath.Join(root, rel)); err == nil && fi.Mode().IsRegular() {
+			return rel
+		}
+	}
+	return ""
+}
+
+// traceSource returns the source of a file around the lines a trace cites:
+// the whole declarations they are in for Go files that parse, and the lines
+// around them otherwise.
+func traceSource(path string, src []byte, lines []int) string {
+	hunks := make([]diffHunk, len(lines))
+	for i, n := range lines {
+		hunks[i] = diffHunk{start: n, end: n}
+	}
+	if decls, err := goDeclContext(path, src, hunks); err == nil && decls != "" {
+		return decls
+	}
+	ranges := make([][2]int, len(lines))
+	for i, n := range lines {
+		ranges[i] = [2]int{max(n-traceContextLines, 1), n + traceContextLines}
+	}
+	return numberedRanges(src, ranges)
+}
+
+// traceContent builds the documents for a trace: the trace and the source of
+// the local files it cites.
+func traceContent(root, trace string, verbose bool) ([]any, error) {
+	files := parseTrace(trace)
+	if len(files) == 0 {
+		return nil, errNoTrace
+	}
+	doc, err := howdoi.RenderDocument(howdoi.Document{Source: "stack trace", Content: trace})
+	if err != nil {
+		return nil, err
+	}
+	content := []any{doc}
+	attached := 0
+	for _, f := range files {
+		if attached == maxTraceFiles {
+			break
+		}
+		rel := localPath(root, f.path)
+		if rel == "" {
+			continue
+		}
+		src, err := os.ReadFile(filepath.Join(root, rel))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", rel, err)
+		}
+		cited := make([]string, len(f.lines))
+		for i, n := range f.lines {
+			cited[i] = strconv.Itoa(n)
+		}
+		source := fmt.Sprintf("%s (line %s)", rel, strings.Join(cited, ", "))
+		if len(cited) > 1 {
+			source = fmt.Sprintf("%s (lines %s)", rel, strings.Join(cited, ", "))
+		}
+		if verbose {
+			log.Println("Attaching", source)
+		}
+		doc, err := howdoi.RenderDocument(howdoi.Document{Source: source, Language: "go", Content: traceSource(rel, src, f.lines)})
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, doc)
+		attached++
+	}
+	if attached == 0 && verbose {
+		log.Println("None of the files in the trace are in", root)
+	}
+	return content, nil
+}
+
+func newTraceCmd() *cobra.Command {
+	var model string
+	var maxTokens int
+	var temperature float32
+	var raw bool
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:   "trace [question]",
+		Short: "Diagnose a Go panic or stack trace read from stdin",
+		Long:  "Read a Go panic or stack trace from stdin and ask for a diagnosis, attaching the functions of the repository that its frames stop in, with line numbers. Files are looked up under the root of the git repository, or the current directory outside one, so traces from binaries built elsewhere or with -trimpath still find them. The standard library and module cache are left out.",
+		Example: `  go test ./... 2>&1 | howdoi trace
+  howdoi trace "this only happens under load" < crash.log`,
+		Run: func(cmd *cobra.Command, args []string) {
+			trace, err := readStdin()
+			if err != nil {
+				log.Println("Error reading stdin:", err)
+				os.Exit(exitCode(err))
+			}
+			if trace == "" {
+				log.Println("Error: pipe the trace in, as in go run . 2>&1 | howdoi trace")
+				os.Exit(exitUsage)
+			}
+			root, err := os.Getwd()
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			if out, err := commandOutput("git", "rev-parse", "--show-toplevel"); err == nil {
+				root = strings.TrimSpace(string(out))
+			}
+			content, err := traceContent(root, trace, verbose)
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			question := "Why does this crash, and how do I fix it?"
+			if len(args) > 0 {
+				question += " " + strings.Join(args, " ")
+			}
+			content = append(content, howdoi.TextContent{Type: "text", Text: question})
+
+			m, err := howdoi.ResolveModel(model, "", "", "")
+			if err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			q := Query{
+				Request: howdoi.Request{
+					Model:       model,
+					ModelID:     m.ModelID,
+					Provider:    m.Provider,
+					Vendor:      m.Vendor,
+					URL:         m.URL,
+					APIKey:      m.APIKey,
+					System:      traceSystemPrompt,
+					Messages:    []howdoi.Message{{Role: "user", Content: content}},
+					MaxTokens:   maxTokens,
+					Temperature: temperature,
+					Verbose:     verbose,
+				},
+				Markdown:        useMarkdown(raw),
+				Width:           answerWidth(),
+				MaxRetries:      defaultMaxRetries,
+				OverloadRetries: defaultMaxRetries,
+			}
+			if err := howdoi.CheckCapabilities(q.Request); err != nil {
+				log.Println("Error:", err)
+				os.Exit(exitCode(err))
+			}
+			res, err := runQuery(q)
+			if err != nil {
+				log.Println("Error calling the API:", err)
+				os.Exit(exitCode(err))
+			}
+			if verbose {
+				log.Printf("%s, $%.4f\n", res.Usage, res.Cost)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&model, "model", "m", "sonnet", "Model to diagnose with")
+	cmd.Flags().IntVarP(&maxTokens, "max-tokens", "t", 4096, "Maximum number of tokens to generate")
+	cmd.Flags().Float32VarP(&temperature, "temperature", "e", 0.10, "Temperature")
+	cmd.Flags().BoolVar(&raw, "raw", false, "Print the diagnosis as plain text instead of rendered markdown")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbosity")
+	return cmd
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/domluna/howdoi/pkg/howdoi"
+)
+
+// documentExts are binary formats that are still worth attaching when a
+// directory is walked.
+var documentExts = map[string]bool{".pdf": true, ".docx": true, ".xlsx": true, ".pptx": true}
+
+// globRegexp converts a gitignore style pattern to a regexp matching slash
+// separated paths. "**" matches any number of directories, "*" and "?" do
+// not match slashes.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+type ignoreRule struct {
+	// base is the directory of the .gitignore, relative to the walk root.
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// gitignore is the rules of the .gitignore files seen so far, in order, so
+// later and deeper rules win.
+type gitignore []ignoreRule
+
+// load adds the rules of the .gitignore in dir, if there is one.
+func (g *gitignore) load(dir, base string) error {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), " ")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		// Patterns without a slash match at any depth.
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		re, err := globRegexp(strings.TrimPrefix(line, "/"))
+		if err != nil {
+			continue
+		}
+		r.re = re
+		*g = append(*g, r)
+	}
+	return sc.Err()
+}
+
+// ignored reports whether the slash separated path rel is ignored.
+func (g gitignore) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range g {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		p := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			p = rel[len(r.base)+1:]
+		}
+		if r.re.MatchString(p) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// isBinary reports whether a file looks binary, by looking for a NUL byte in
+// its first few kilobytes.
+func isBinary(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, 8000)
+	n, _ := io.ReadFull(f, buf)
+	return bytes.IndexByte(buf[:n], 0) >= 0
+}
+
+// walkFiles returns the files below root whose slash separated path relative
+// to root is accepted by match, or all of them when match is nil. Hidden
+// files, files ignored by .gitignore, and binary files other than documents
+// are skipped.
+func walkFiles(root string, match func(rel string) bool) ([]string, error) {
+	var ignore gitignore
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if p != root && (d.Name()[0] == '.' || ignore.ignored(rel, d.IsDir())) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			base := rel
+			if p == root {
+				base = ""
+			}
+			return ignore.load(p, base)
+		}
+		if !d.Type().IsRegular() || (match != nil && !match(rel)) {
+			return nil
+		}
+		if isBinary(p) && !documentExts[strings.ToLower(filepath.Ext(p))] {
+			return nil
+		}
+		files = append(files, p)
+		return nil
+	})
+	return files, err
+}
+
+// globFiles returns the files below the current directory matching any of
+// the patterns.
+func globFiles(patterns []string) ([]string, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := globRegexp(filepath.ToSlash(p))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return walkFiles(".", func(rel string) bool {
+		for _, re := range res {
+			if re.MatchString(rel) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// warnContextWindow warns when the walked files add up to more than the
+// model's context window, naming the largest so they can be left out.
+func warnContextWindow(modelID string, walked map[string]int) {
+	c, ok := howdoi.ModelCapabilities[modelID]
+	if !ok {
+		return
+	}
+	total := 0
+	files := make([]string, 0, len(walked))
+	for f, n := range walked {
+		total += n
+		files = append(files, f)
+	}
+	if total <= c.ContextWindow {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return walked[files[i]] > walked[files[j]] })
+	var b strings.Builder
+	fmt.Fprintf(&b, "Warning: the %d files are about %d tokens, more than the %d token context window of %s. The largest are:", len(files), total, c.ContextWindow, modelID)
+	for _, f := range files[:min(len(files), 5)] {
+		fmt.Fprintf(&b, "\n  %s (%d tokens)", f, walked[f])
+	}
+	log.Println(b.String())
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/howdoi/main.go", true},
+		{"cmd/**", "cmd/howdoi/main.go", true},
+		{"cmd/**", "pkg/main.go", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"?.txt", "a.txt", true},
+		{"?.txt", "ab.txt", false},
+		{"?", "/", false},
+		{"[abc].md", "b.md", true},
+		{"[!abc].md", "b.md", false},
+		{"[!abc].md", "d.md", true},
+		{"[abc.md", "[abc.md", true},
+		{`\*.md`, "*.md", true},
+		{`\*.md`, "a.md", false},
+		{"a.b", "axb", false},
+		{"main.go", "main.go", true},
+	}
+	for _, tt := range tests {
+		re, err := globRegexp(tt.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", tt.pattern, err)
+			continue
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("%s matching %s: got %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGitignore(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".gitignore", "# comment\n*.log\n!keep.log\nbuild/\n/top.txt\ndocs/*.html\n")
+	write("sub/.gitignore", "*.tmp\n!*.log\n")
+
+	var g gitignore
+	if err := g.load(root, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.load(filepath.Join(root, "sub"), "sub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.load(filepath.Join(root, "missing"), "missing"); err != nil {
+		t.Fatalf("a directory without a .gitignore: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"deep/dir/app.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"x/build", true, true},
+		{"top.txt", false, true},
+		{"x/top.txt", false, false},
+		{"docs/index.html", false, true},
+		{"docs/api/index.html", false, false},
+		{"sub/a.tmp", false, true},
+		{"a.tmp", false, false},
+		{"sub/app.log", false, false},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := g.ignored(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("%s (dir %v): got ignored %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// windowWidth is not implemented outside Unix, where $COLUMNS is used.
+func windowWidth(f *os.File) int {
+	return 0
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// width is the --width flag: the column answers are wrapped at, 0 for the
+// terminal width, or negative to not wrap.
+var width int
+
+// answerWidth returns the column answers on stdout are wrapped at, or 0 to
+// leave them as they are. Only terminals are wrapped unless --width is set.
+func answerWidth() int {
+	switch {
+	case width > 0:
+		return width
+	case width < 0 || !isTerminal(os.Stdout):
+		return 0
+	}
+	return terminalWidth()
+}
+
+// mdListRe matches the marker of a list item or quote, which continuation
+// lines are indented past.
+var mdListRe = regexp.MustCompile(`^([-*+>]|\d+[.)])$`)
+
+// wrapWriter word wraps markdown as it streams. Fenced code, tables, and
+// headings are written as they are, and inline code, bold text, and links
+// are not broken, so the wrapped text still renders the same.
+type wrapWriter struct {
+	w     io.Writer
+	width int
+	// fence is the marker of the open code block.
+	fence string
+
+	// start is true until the first word of a line is complete, and lead
+	// holds the line until then.
+	start    bool
+	lead     string
+	verbatim bool
+	indent   string
+	col      int
+	spaces   int
+	word     strings.Builder
+}
+
+func newWrapWriter(w io.Writer, width int) *wrapWriter {
+	return &wrapWriter{w: w, width: width, start: true}
+}
+
+func (ww *wrapWriter) Write(p []byte) (int, error) {
+	for _, r := range string(p) {
+		ww.writeRune(r)
+	}
+	return len(p), nil
+}
+
+func (ww *wrapWriter) writeRune(r rune) {
+	switch {
+	case r == '\n':
+		if ww.start {
+			ww.startLine()
+		}
+		ww.flushWord()
+		io.WriteString(ww.w, "\n")
+		ww.start, ww.lead, ww.verbatim, ww.col, ww.spaces = true, "", false, 0, 0
+	case ww.start:
+		if (r == ' ' || r == '\t') && strings.TrimSpace(ww.lead) != "" {
+			ww.startLine()
+			ww.writeRune(r)
+			return
+		}
+		ww.lead += string(r)
+	case ww.verbatim:
+		io.WriteString(ww.w, string(r))
+	case r == ' ' && !openSpan(ww.word.String()):
+		ww.flushWord()
+		ww.spaces++
+	default:
+		ww.word.WriteRune(r)
+	}
+}
+
+// startLine decides how the line in lead is wrapped once its first word is
+// complete, and writes it.
+func (ww *wrapWriter) startLine() {
+	ww.start = false
+	first := strings.TrimLeft(ww.lead, " \t")
+	pad := ww.lead[:len(ww.lead)-len(first)]
+	if marker := strings.TrimSpace(first); strings.HasPrefix(marker, "```") || strings.HasPrefix(marker, "~~~") {
+		if ww.fence == "" {
+			ww.fence = marker[:3]
+		} else if strings.HasPrefix(marker, ww.fence) {
+			ww.fence = ""
+		}
+		ww.verbatim = true
+	}
+	if ww.fence != "" || strings.HasPrefix(first, "|") || strings.HasPrefix(first, "#") {
+		ww.verbatim = true
+	}
+	if ww.verbatim {
+		io.WriteString(ww.w, ww.lead)
+		return
+	}
+	if mdListRe.MatchString(first) {
+		// Quotes continue as quotes, list items under their text.
+		ww.indent = pad + strings.Repeat(" ", utf8.RuneCountInString(first)+1)
+		if first == ">" {
+			ww.indent = pad + "> "
+		}
+		io.WriteString(ww.w, ww.lead)
+		ww.col = utf8.RuneCountInString(ww.lead)
+		return
+	}
+	ww.indent = pad
+	io.WriteString(ww.w, pad)
+	ww.col = utf8.RuneCountInString(pad)
+	ww.word.WriteString(first)
+}
+
+// flushWord writes the pending word, first breaking the line when it would
+// not fit.
+func (ww *wrapWriter) flushWord() {
+	if ww.word.Len() == 0 {
+		return
+	}
+	word := ww.word.String()
+	ww.word.Reset()
+	n := utf8.RuneCountInString(word)
+	if ww.col+ww.spaces+n > ww.width && ww.col > len(ww.indent) {
+		io.WriteString(ww.w, "\n"+ww.indent)
+		ww.col, ww.spaces = len(ww.indent), 0
+	}
+	io.WriteString(ww.w, strings.Repeat(" ", ww.spaces)+word)
+	ww.col += ww.spaces + n
+	ww.spaces = 0
+}
+
+// Flush writes what is left of the last line.
+func (ww *wrapWriter) Flush() {
+	if ww.start {
+		if ww.lead == "" {
+			return
+		}
+		ww.startLine()
+	}
+	ww.flushWord()
+}
+
+// openSpan reports whether word ends inside inline code, bold text, or a
+// link, which a line is not broken in.
+func openSpan(word string) bool {
+	if strings.Count(word, "`")%2 == 1 || strings.Count(word, "**")%2 == 1 {
+		return true
+	}
+	return strings.Count(word, "[") > strings.Count(word, "]") || strings.Count(word, "](") > strings.Count(word, ")")
+}
+
+// wrapMarkdown word wraps a complete markdown answer.
+func wrapMarkdown(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+	var b strings.Builder
+	ww := newWrapWriter(&b, width)
+	io.WriteString(ww, text)
+	ww.Flush()
+	return b.String()
+}
+
+// lineWriter holds back a partial line until its newline arrives, so what
+// reads the answer from a pipe only ever sees whole lines.
+type lineWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	if i := bytes.LastIndexByte(lw.buf, '\n'); i >= 0 {
+		if _, err := lw.w.Write(lw.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		lw.buf = append(lw.buf[:0], lw.buf[i+1:]...)
+	}
+	return len(p), nil
+}
+
+// Flush writes the last line, which may have no newline.
+func (lw *lineWriter) Flush() {
+	if len(lw.buf) > 0 {
+		lw.w.Write(lw.buf)
+		lw.buf = lw.buf[:0]
+	}
+}
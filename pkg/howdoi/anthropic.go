@@ -0,0 +1,139 @@
+package howdoi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// anthropicProvider calls the Anthropic messages API.
+type anthropicProvider struct {
+	c *Client
+}
+
+func (p anthropicProvider) Stream(ctx context.Context, req Request) (<-chan Delta, error) {
+	rq := RequestBody{
+		Model:       req.ModelID,
+		Messages:    req.Messages,
+		MaxTokens:   req.MaxTokens,
+		Temperature: float64(req.Temperature),
+		Stream:      true,
+		System:      req.System,
+	}
+	if user := req.Metadata["user"]; user != "" {
+		rq.Metadata = map[string]string{"user_id": user}
+	}
+	if req.JSONMode {
+		// Anthropic has no JSON mode, so force a tool call whose input is
+		// the answer.
+		if req.Thinking > 0 {
+			return nil, errors.New("JSON mode can't be combined with extended thinking for Anthropic models")
+		}
+		schema := req.Schema
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		if schema["type"] != "object" {
+			return nil, errors.New("Anthropic models need a schema with a top level object type")
+		}
+		rq.Tools = []any{map[string]any{
+			"name":         "respond",
+			"description":  "Respond to the user with structured JSON.",
+			"input_schema": schema,
+		}}
+		rq.ToolChoice = map[string]any{"type": "tool", "name": "respond"}
+	}
+	if len(req.Tools) > 0 {
+		rq.Tools = toolDefinitions(req.Provider, req.Tools)
+	}
+	if req.WebSearch {
+		rq.Tools = append(rq.Tools, anthropicWebSearchTool)
+	}
+	if req.Thinking > 0 {
+		rq.Thinking = &AnthropicThinking{Type: "enabled", BudgetTokens: req.Thinking}
+		// Thinking requires a temperature of 1 and counts towards max_tokens.
+		rq.Temperature = 1
+		if rq.MaxTokens <= req.Thinking {
+			rq.MaxTokens += req.Thinking
+		}
+	}
+
+	auth := http.Header{}
+	auth.Set("x-api-key", req.APIKey)
+	auth.Set("anthropic-version", "2023-06-01")
+	betas := req.Betas
+	if hasDocuments(req.Messages) {
+		betas = append([]string{"pdfs-2024-09-25"}, betas...)
+	}
+	if len(betas) > 0 {
+		auth.Set("anthropic-beta", strings.Join(betas, ","))
+	}
+	r, err := newAPIRequest(ctx, req, rq, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := streamHandler(handleAnthropicEvent)
+	if req.WebSearch {
+		handle = citingAnthropicHandler()
+	}
+	return p.c.callAPI(req.ModelID, handle, r, req.Verbose)
+}
+
+// handleAnthropicEvent handles the messages streaming events from Anthropic.
+func handleAnthropicEvent(ev sseEvent, usage *Usage, emit func(Delta)) error {
+	var data struct {
+		Type    string `json:"type"`
+		Index   int    `json:"index"`
+		Message struct {
+			Usage Usage `json:"usage"`
+		} `json:"message"`
+		ContentBlock struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"content_block"`
+		Delta struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			Thinking    string `json:"thinking"`
+			PartialJSON string `json:"partial_json"`
+		} `json:"delta"`
+		Usage Usage `json:"usage"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(ev.Data), &data); err != nil {
+		return fmt.Errorf("decoding stream event: %w", err)
+	}
+	switch data.Type {
+	case "message_start":
+		*usage = data.Message.Usage
+	case "content_block_start":
+		if data.ContentBlock.Type == "tool_use" {
+			emit(Delta{ToolCall: &ToolCallDelta{Index: data.Index, ID: data.ContentBlock.ID, Name: data.ContentBlock.Name}})
+		}
+	case "content_block_delta":
+		switch data.Delta.Type {
+		case "text_delta":
+			emit(Delta{Text: data.Delta.Text})
+		case "thinking_delta":
+			emit(Delta{Reasoning: data.Delta.Thinking})
+		case "input_json_delta":
+			emit(Delta{ToolCall: &ToolCallDelta{Index: data.Index, Arguments: data.Delta.PartialJSON}})
+		}
+	case "message_delta":
+		// The output token count in message_delta is cumulative.
+		usage.OutputTokens = data.Usage.OutputTokens
+	case "message_stop":
+		return errStreamDone
+	case "error":
+		return fmt.Errorf("stream error: %s: %s", data.Error.Type, data.Error.Message)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package howdoi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandleAnthropicEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   []Delta
+		usage  Usage
+		err    string
+	}{
+		{
+			name: "text and usage",
+			events: []string{
+				`{"type":"message_start","message":{"usage":{"input_tokens":10,"cache_read_input_tokens":5,"output_tokens":1}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text"}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+				`{"type":"message_delta","usage":{"output_tokens":12}}`,
+			},
+			want:  []Delta{{Text: "Hi"}},
+			usage: Usage{InputTokens: 10, CacheReadTokens: 5, OutputTokens: 12},
+		},
+		{
+			name:   "thinking",
+			events: []string{`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hmm"}}`},
+			want:   []Delta{{Reasoning: "hmm"}},
+		},
+		{
+			name: "tool use",
+			events: []string{
+				`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"run_shell"}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"cmd\":"}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"ls\"}"}}`,
+			},
+			want: []Delta{
+				{ToolCall: &ToolCallDelta{Index: 1, ID: "toolu_1", Name: "run_shell"}},
+				{ToolCall: &ToolCallDelta{Index: 1, Arguments: `{"cmd":`}},
+				{ToolCall: &ToolCallDelta{Index: 1, Arguments: `"ls"}`}},
+			},
+		},
+		{
+			name:   "pings and unknown events are ignored",
+			events: []string{`{"type":"ping"}`, `{"type":"content_block_stop","index":0}`},
+		},
+		{
+			name:   "message stop",
+			events: []string{`{"type":"message_stop"}`},
+			err:    errStreamDone.Error(),
+		},
+		{
+			name:   "error",
+			events: []string{`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`},
+			err:    "stream error: overloaded_error: Overloaded",
+		},
+		{
+			name:   "bad JSON",
+			events: []string{`not json`},
+			err:    "decoding stream event",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, usage, err := handleEvents(handleAnthropicEvent, tt.events...)
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if usage != tt.usage {
+				t.Errorf("got usage %+v, want %+v", usage, tt.usage)
+			}
+		})
+	}
+}
+
+func TestCitingAnthropicHandler(t *testing.T) {
+	got, _, err := handleEvents(citingAnthropicHandler(),
+		`{"type":"content_block_delta","index":0,"delta":{"type":"citations_delta","citation":{"type":"web_search_result_location","url":"https://go.dev","title":"Go"}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Go is fast."}}`,
+		`{"type":"content_block_stop","index":0}`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Delta{{Text: "Go is fast."}, {Citation: &Citation{URL: "https://go.dev", Title: "Go"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package howdoi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+)
+
+// Attachment records what was sent for a file, URL, stdin, or the clipboard,
+// so answers in the history can be audited against their inputs without
+// storing them.
+type Attachment struct {
+	Source string
+	// Kind is text, pdf, office, image, url, stdin, or clipboard.
+	Kind string
+	// Detail is the language of text, the format of images and office
+	// files, or the PDF mode.
+	Detail string
+	Size   int64
+	SHA256 string
+	// Caption is a one-line description of an image, stored with the
+	// history so it can be searched.
+	Caption string
+}
+
+func NewAttachment(source, kind, detail string, data []byte) *Attachment {
+	sum := sha256.Sum256(data)
+	return &Attachment{Source: source, Kind: kind, Detail: detail, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+func fileAttachment(file, kind, detail string) (*Attachment, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return NewAttachment(file, kind, detail, data), nil
+}
+
+// Status compares a file attachment with the file on disk now.
+func (a Attachment) Status() string {
+	switch a.Kind {
+	case "url", "stdin", "clipboard":
+		return ""
+	}
+	now, err := fileAttachment(a.Source, a.Kind, a.Detail)
+	if errors.Is(err, os.ErrNotExist) {
+		return "missing"
+	}
+	if err != nil {
+		return "unreadable"
+	}
+	if now.SHA256 != a.SHA256 {
+		return "modified"
+	}
+	return "unchanged"
+}
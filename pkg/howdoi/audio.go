@@ -0,0 +1,152 @@
+package howdoi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// audioTypes are the audio formats transcribed to text, with their MIME
+// types.
+var audioTypes = map[string]string{".mp3": "audio/mpeg", ".wav": "audio/wav", ".m4a": "audio/mp4"}
+
+// whisperMaxBytes is the largest file the transcriptions API takes.
+const whisperMaxBytes = 25 << 20
+
+// geminiMaxAudioBytes is the largest recording sent inline to Gemini.
+const geminiMaxAudioBytes = 20 << 20
+
+const geminiTranscribePrompt = "Transcribe this recording word for word. Start every line with a [m:ss] timestamp, and with the speaker's name or Speaker 1, Speaker 2, ... when there are several speakers. Reply with only the transcript."
+
+var errNoTranscriptionKey = errors.New("transcribing audio needs OPENAI_API_KEY or GEMINI_API_KEY")
+
+// formatTimestamp formats seconds as m:ss, or h:mm:ss past an hour.
+func formatTimestamp(secs int) string {
+	if secs >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	}
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
+
+func loadAudio(file string, opts LoadOptions) ([]any, *Attachment, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading audio file: %w", err)
+	}
+	ext := strings.ToLower(filepath.Ext(file))
+	transcript, err := transcribeAudio(file, ext, data, opts.Provider)
+	if err != nil {
+		return nil, nil, fmt.Errorf("transcribing %s: %w", file, err)
+	}
+	doc, err := RenderDocument(Document{Source: file, Content: transcript})
+	if err != nil {
+		return nil, nil, err
+	}
+	return []any{doc}, NewAttachment(file, "audio", ext[1:], data), nil
+}
+
+// transcribeAudio returns a timestamped transcript of a recording from the
+// OpenAI transcriptions API, or from Gemini when there is no OpenAI key or
+// the question goes to Gemini anyway.
+func transcribeAudio(file, ext string, data []byte, provider string) (string, error) {
+	openaiKey, geminiKey := APIKey("OPENAI_API_KEY"), APIKey("GEMINI_API_KEY")
+	switch {
+	case geminiKey != "" && (provider == "google" || openaiKey == ""):
+		return transcribeGemini(ext, data, geminiKey)
+	case openaiKey != "":
+		return transcribeWhisper(file, data, openaiKey)
+	}
+	return "", errNoTranscriptionKey
+}
+
+func transcribeWhisper(file string, data []byte, key string) (string, error) {
+	if len(data) > whisperMaxBytes {
+		return "", fmt.Errorf("the transcriptions API takes files of at most %d MB", whisperMaxBytes>>20)
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("model", "whisper-1")
+	w.WriteField("response_format", "verbose_json")
+	part, err := w.CreateFormFile("file", filepath.Base(file))
+	if err != nil {
+		return "", err
+	}
+	part.Write(data)
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	r, err := http.NewRequest("POST", OpenAIBaseURL+"/audio/transcriptions", &body)
+	if err != nil {
+		return "", err
+	}
+	r.Header.Set("content-type", w.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer "+key)
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcriptions API: %s", res.Status)
+	}
+	var out struct {
+		Text     string `json:"text"`
+		Segments []struct {
+			Start float64 `json:"start"`
+			Text  string  `json:"text"`
+		} `json:"segments"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if len(out.Segments) == 0 {
+		return out.Text, nil
+	}
+	var b strings.Builder
+	for _, s := range out.Segments {
+		fmt.Fprintf(&b, "[%s] %s\n", formatTimestamp(int(s.Start)), strings.TrimSpace(s.Text))
+	}
+	return b.String(), nil
+}
+
+func transcribeGemini(ext string, data []byte, key string) (string, error) {
+	if len(data) > geminiMaxAudioBytes {
+		return "", fmt.Errorf("Gemini takes recordings of at most %d MB", geminiMaxAudioBytes>>20)
+	}
+	ctx := context.Background()
+	client, err := genaiClient(ctx, key, nil)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	m := client.GenerativeModel(Models["flash"])
+	m.SetTemperature(0)
+	res, err := m.GenerateContent(ctx, genai.Blob{MIMEType: audioTypes[ext], Data: data}, genai.Text(geminiTranscribePrompt))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, c := range res.Candidates {
+		if c.Content == nil {
+			continue
+		}
+		for _, p := range c.Content.Parts {
+			if t, ok := p.(genai.Text); ok {
+				b.WriteString(string(t))
+			}
+		}
+	}
+	if b.Len() == 0 {
+		return "", errors.New("Gemini returned no transcript")
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,127 @@
+package howdoi
+
+import (
+	"context"
+	"fmt"
+)
+
+// Capabilities describes what a model accepts, so requests can be checked
+// before they are sent instead of failing with an opaque provider error.
+type Capabilities struct {
+	Vision   bool
+	Audio    bool
+	Tools    bool
+	JSONMode bool
+	Thinking bool
+	// PDF is set for models that read PDF documents, with the images of
+	// their pages, natively.
+	PDF bool
+	// ContextWindow and MaxOutput are in tokens.
+	ContextWindow int
+	MaxOutput     int
+}
+
+// ModelCapabilities is keyed by model ID, like modelCosts. Models that are
+// not listed, such as those on OpenAI-compatible servers, are not checked.
+var ModelCapabilities = map[string]Capabilities{
+	"claude-3-5-sonnet-20240620": {Vision: true, Tools: true, JSONMode: true, ContextWindow: 200000, MaxOutput: 8192},
+	"claude-3-5-sonnet-20241022": {Vision: true, Tools: true, JSONMode: true, PDF: true, ContextWindow: 200000, MaxOutput: 8192},
+	"gpt-4o-mini":                {Vision: true, Tools: true, JSONMode: true, ContextWindow: 128000, MaxOutput: 16384},
+	"o1-mini":                    {ContextWindow: 128000, MaxOutput: 65536},
+	"o1-preview":                 {ContextWindow: 128000, MaxOutput: 32768},
+	"gemini-1.5-flash-latest":    {Vision: true, Audio: true, Tools: true, JSONMode: true, ContextWindow: 1048576, MaxOutput: 8192},
+	"gemini-1.5-pro-latest":      {Vision: true, Audio: true, Tools: true, JSONMode: true, ContextWindow: 2097152, MaxOutput: 8192},
+	"mistral-large-latest":       {Tools: true, JSONMode: true, ContextWindow: 131072, MaxOutput: 8192},
+	"codestral-latest":           {Tools: true, JSONMode: true, ContextWindow: 262144, MaxOutput: 8192},
+	"deepseek-chat":              {Tools: true, JSONMode: true, ContextWindow: 65536, MaxOutput: 8192},
+
+	"llama-3.3-70b-versatile": {Tools: true, JSONMode: true, ContextWindow: 131072, MaxOutput: 32768},
+	"llama-3.1-8b-instant":    {Tools: true, JSONMode: true, ContextWindow: 131072, MaxOutput: 8192},
+	"mixtral-8x7b-32768":      {Tools: true, JSONMode: true, ContextWindow: 32768, MaxOutput: 32768},
+
+	"meta-llama/Meta-Llama-3.1-405B-Instruct-Turbo": {Tools: true, JSONMode: true, ContextWindow: 130815, MaxOutput: 4096},
+	"meta-llama/Llama-3.3-70B-Instruct-Turbo":       {Tools: true, JSONMode: true, ContextWindow: 131072, MaxOutput: 8192},
+	"mistralai/Mixtral-8x7B-Instruct-v0.1":          {JSONMode: true, ContextWindow: 32768, MaxOutput: 4096},
+}
+
+// EstimateTokens roughly counts the prompt tokens of a request.
+func EstimateTokens(q Request) int {
+	n := len(q.System) / 4
+	for _, m := range q.Messages {
+		n += EstimateContentTokens(m.Content)
+	}
+	return n
+}
+
+// EstimateContentTokens roughly counts the tokens of message content: four
+// characters per token for text and a flat cost per image.
+func EstimateContentTokens(content []any) int {
+	n := 0
+	for _, c := range content {
+		switch v := c.(type) {
+		case TextContent:
+			n += len(v.Text) / 4
+		case ImageContent, ImageContentOpenAI:
+			n += 1000
+		case DocumentContent:
+			// Each page is sent as its text and an image.
+			n += 3000 * max(v.Pages, 1)
+		}
+	}
+	return n
+}
+
+func hasImages(messages []Message) bool {
+	for _, m := range messages {
+		for _, c := range m.Content {
+			switch c.(type) {
+			case ImageContent, ImageContentOpenAI:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasDocuments(messages []Message) bool {
+	for _, m := range messages {
+		for _, c := range m.Content {
+			if _, ok := c.(DocumentContent); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckCapabilities returns an error when the request uses something the model
+// does not support or does not fit in its context window.
+func CheckCapabilities(q Request) error {
+	c, ok := ModelCapabilities[q.ModelID]
+	if !ok {
+		return nil
+	}
+	if hasImages(q.Messages) && !c.Vision {
+		return fmt.Errorf("%s does not accept images", q.ModelID)
+	}
+	if hasDocuments(q.Messages) && !c.PDF {
+		return fmt.Errorf("%s does not read PDF documents", q.ModelID)
+	}
+	if q.JSONMode && !c.JSONMode {
+		return fmt.Errorf("%s does not support JSON output", q.ModelID)
+	}
+	if len(q.StoreIDs) > 0 && !c.Tools {
+		return fmt.Errorf("%s does not support tools, which vector store search needs", q.ModelID)
+	}
+	if len(q.Tools) > 0 && !c.Tools {
+		return fmt.Errorf("%s does not support tools", q.ModelID)
+	}
+	if q.Thinking > 0 && !c.Thinking {
+		return fmt.Errorf("%s does not support extended thinking", q.ModelID)
+	}
+	if q.MaxTokens > c.MaxOutput {
+		return fmt.Errorf("%s can write at most %d tokens, but %d were asked for", q.ModelID, c.MaxOutput, q.MaxTokens)
+	}
+	_, err := CheckContextWindow(context.Background(), q)
+	return err
+}
@@ -0,0 +1,263 @@
+package howdoi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Request is a fully assembled request to a model.
+type Request struct {
+	// Model is the model alias, see Models.
+	Model string
+	// ModelID is the model name sent to the provider.
+	ModelID     string
+	Provider    string
+	URL         string
+	APIKey      string
+	System      string
+	Messages    []Message
+	MaxTokens   int
+	Temperature float32
+	StoreIDs    []string
+	// Thinking is the extended thinking token budget for Anthropic models.
+	Thinking int
+	Verbose  bool
+	// JSONMode asks the provider for a JSON answer, matching Schema when set.
+	JSONMode bool
+	Schema   map[string]any
+	// Tools can be called by the model before it answers.
+	Tools []Tool
+	// CodeExecution and GoogleSearch turn on Gemini's built-in tools, which
+	// Google runs: a Python sandbox and grounding in Google Search results.
+	CodeExecution bool
+	GoogleSearch  bool
+	// WebSearch turns on the provider's own web search: Anthropic's
+	// web_search tool, OpenAI's web_search_preview through the responses
+	// API, or Google Search grounding. Cited pages become markdown footnotes.
+	// See NativeWebSearch.
+	WebSearch bool
+	// Vendor has the quirks of the OpenAI-compatible API being called.
+	Vendor Vendor
+	// Headers are added to every HTTP request, such as the auth headers of
+	// an LLM gateway.
+	Headers map[string]string
+	// Betas are Anthropic beta features, sent in the anthropic-beta header.
+	// See AnthropicBeta.
+	Betas []string
+	// Metadata tags the request with values like user or project for
+	// chargeback. Custom servers, which may be gateways, get all of it in the
+	// metadata field of the body (LiteLLM) and, as JSON, in MetadataHeader
+	// when it is set, such as x-portkey-metadata for Portkey. OpenAI and
+	// Anthropic only take the user.
+	Metadata       map[string]string
+	MetadataHeader string
+}
+
+// Client sends requests to the model providers.
+type Client struct {
+	// HTTPClient is used for every provider but Google, which goes through
+	// the genai SDK over http.DefaultTransport. http.DefaultClient is used
+	// when it is nil.
+	HTTPClient *http.Client
+	// MaxRetries is how many times a request is retried when it is rate
+	// limited or fails with a server error.
+	MaxRetries int
+	// OverloadRetries is how many times a request is retried while the
+	// provider is overloaded. It is separate from MaxRetries so callers with
+	// another model to switch to can give up early.
+	OverloadRetries int
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Complete sends the request and streams the answer. Errors before the
+// answer starts are returned, later ones are sent as a delta with Err set,
+// followed by the usage of the turn when the provider reported it. A stream
+// that is not cancelled ends with either that error or a Done delta.
+//
+// Tool call deltas are passed on as they arrive. The calls are then run and
+// their results sent back until the model answers without calling a tool.
+func (c *Client) Complete(ctx context.Context, req Request) (<-chan Delta, error) {
+	if req.JSONMode {
+		if req.System != "" {
+			req.System += "\n\n"
+		}
+		req.System += jsonModeInstruction
+		if req.Schema != nil && req.Vendor.JSONObjectOnly {
+			// The schema can't be sent as a response format, so describe it.
+			b, _ := json.Marshal(req.Schema)
+			req.System += " The JSON must match this JSON schema: " + string(b)
+		}
+	}
+
+	if len(req.StoreIDs) > 0 {
+		if req.Provider != "openai" {
+			return nil, errors.New("vector store search is only supported with OpenAI models")
+		}
+		return c.callFileSearchAPI(ctx, req)
+	}
+
+	if req.WebSearch {
+		if !NativeWebSearch(req.Provider, req.Vendor) {
+			return nil, fmt.Errorf("%s models have no web search tool", req.Provider)
+		}
+		if len(req.Tools) > 0 || req.JSONMode {
+			return nil, errors.New("web search can't be combined with tools or JSON mode")
+		}
+		if req.Provider == "google" {
+			req.WebSearch, req.GoogleSearch = false, true
+		}
+	}
+
+	if req.CodeExecution || req.GoogleSearch {
+		if req.Provider != "google" {
+			return nil, errors.New("code execution and Google Search grounding are only supported with Gemini models")
+		}
+		if len(req.Tools) > 0 || req.JSONMode {
+			return nil, errors.New("code execution and Google Search grounding can't be combined with tools or JSON mode")
+		}
+	}
+
+	if len(req.Tools) > 0 && req.JSONMode && req.Provider == "anthropic" {
+		return nil, errors.New("JSON mode can't be combined with tools for Anthropic models")
+	}
+
+	if req.WebSearch && req.Provider == "openai" {
+		respChan, err := c.callResponsesAPI(ctx, req, []map[string]any{{"type": "web_search_preview"}})
+		if err != nil {
+			return nil, err
+		}
+		return finish(ctx, footnotes(ctx, respChan)), nil
+	}
+
+	respChan, err := c.sendTurn(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if req.WebSearch {
+		return finish(ctx, footnotes(ctx, respChan)), nil
+	}
+	out := make(chan Delta)
+	go func() {
+		defer close(out)
+		for turn := 0; ; turn++ {
+			answer, calls, err := forward(ctx, respChan, out)
+			if err != nil {
+				return
+			}
+			if req.JSONMode && req.Provider == "anthropic" {
+				// The answer is the input of the forced respond tool call.
+				for _, call := range calls {
+					if call.Name == "respond" {
+						send(ctx, out, Delta{Text: call.Arguments})
+					}
+				}
+				return
+			}
+			if len(calls) == 0 || ctx.Err() != nil {
+				return
+			}
+			if turn == maxToolTurns {
+				send(ctx, out, Delta{Err: fmt.Errorf("the model made tool calls in more than %d turns", maxToolTurns)})
+				return
+			}
+			req.Messages = append(slices.Clip(req.Messages), runToolCalls(req.Provider, req.Tools, answer, calls, req.Verbose)...)
+			respChan, err = c.sendTurn(ctx, req)
+			if err != nil {
+				if ctx.Err() == nil {
+					send(ctx, out, Delta{Err: err})
+				}
+				return
+			}
+		}
+	}()
+	return finish(ctx, out), nil
+}
+
+// send passes d on unless the request was cancelled.
+func send(ctx context.Context, out chan<- Delta, d Delta) {
+	select {
+	case out <- d:
+	case <-ctx.Done():
+	}
+}
+
+// forward passes the deltas of one turn on to out and returns the text of
+// the turn and the tool calls assembled from it, or the error that ended it.
+func forward(ctx context.Context, in <-chan Delta, out chan<- Delta) (string, []ToolCall, error) {
+	var answer strings.Builder
+	var calls []*ToolCall
+	var err error
+	for d := range in {
+		if d.Err != nil && err == nil {
+			err = d.Err
+		}
+		if tc := d.ToolCall; tc != nil {
+			for len(calls) <= tc.Index {
+				calls = append(calls, &ToolCall{})
+			}
+			c := calls[tc.Index]
+			c.ID += tc.ID
+			c.Name += tc.Name
+			c.Arguments += tc.Arguments
+		}
+		answer.WriteString(d.Text)
+		send(ctx, out, d)
+	}
+	var complete []ToolCall
+	for _, c := range calls {
+		// Anthropic indexes text blocks too, which leaves gaps.
+		if c.Name != "" {
+			complete = append(complete, *c)
+		}
+	}
+	return answer.String(), complete, err
+}
+
+// finish passes the deltas on and ends the stream with a Done delta, unless
+// it ended with an error or was cancelled.
+func finish(ctx context.Context, in <-chan Delta) <-chan Delta {
+	out := make(chan Delta)
+	go func() {
+		defer close(out)
+		failed := false
+		for d := range in {
+			failed = failed || d.Err != nil
+			send(ctx, out, d)
+		}
+		if !failed && ctx.Err() == nil {
+			send(ctx, out, Delta{Done: true})
+		}
+	}()
+	return out
+}
+
+// sendTurn makes a single request through the provider of the request.
+func (c *Client) sendTurn(ctx context.Context, req Request) (<-chan Delta, error) {
+	p, err := c.Provider(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+	return p.Stream(ctx, req)
+}
+
+func (c *Client) callAPI(model string, handle streamHandler, r *http.Request, verbose bool) (chan Delta, error) {
+	if verbose {
+		Logf("Calling the API ... %s\n", model)
+	}
+	res, err := c.do(r, verbose)
+	if err != nil {
+		return nil, err
+	}
+	return streamResponse(model, res, handle, verbose), nil
+}
@@ -0,0 +1,242 @@
+package howdoi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Embeddings is an OpenAI-compatible embeddings API.
+type Embeddings struct {
+	URL   string
+	Model string
+	// KeyEnv names the API key, which is looked up with APIKey. Servers on
+	// this machine need none.
+	KeyEnv string
+}
+
+// OpenAIEmbeddings is OpenAI's small embedding model.
+var OpenAIEmbeddings = Embeddings{URL: OpenAIBaseURL + "/embeddings", Model: "text-embedding-3-small", KeyEnv: "OPENAI_API_KEY"}
+
+// clipChunkChars is the size of the sections a long page is split into.
+const clipChunkChars = 1600
+
+// clipByRelevance keeps the sections of content most similar to the question
+// that fit in maxTokens, in their original order. Sections are ranked by
+// embedding similarity when emb is set and by keyword overlap otherwise, or
+// when emb fails.
+func clipByRelevance(content, question string, maxTokens int, emb *Embeddings) string {
+	if maxTokens <= 0 || len(content)/4 <= maxTokens || strings.TrimSpace(question) == "" {
+		return content
+	}
+	chunks := splitChunks(content, clipChunkChars)
+	var scores []float64
+	if emb != nil {
+		var err error
+		scores, err = embeddingScores(*emb, question, chunks)
+		if err != nil {
+			Logf("Error ranking the page with embeddings, using keywords: %v\n", err)
+		}
+	}
+	if scores == nil {
+		scores = keywordScores(question, chunks)
+	}
+
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	keep := make([]bool, len(chunks))
+	budget := maxTokens * 4
+	for _, i := range order {
+		if len(chunks[i]) > budget {
+			continue
+		}
+		keep[i] = true
+		budget -= len(chunks[i])
+	}
+
+	// Gaps are marked so the model knows the page was cut.
+	var out strings.Builder
+	skipped := false
+	for i, c := range chunks {
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			out.WriteString("[...]\n\n")
+		}
+		skipped = false
+		out.WriteString(c + "\n\n")
+	}
+	if skipped {
+		out.WriteString("[...]")
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// splitChunks packs the non-empty lines of text into chunks of about size
+// bytes. Longer lines are split at spaces.
+func splitChunks(text string, size int) []string {
+	var chunks []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		for len(line) > size {
+			cut := strings.LastIndexByte(line[:size], ' ')
+			if cut <= 0 {
+				cut = size
+			}
+			flush()
+			chunks = append(chunks, line[:cut])
+			line = strings.TrimSpace(line[cut:])
+		}
+		if line == "" {
+			continue
+		}
+		if cur.Len()+len(line) > size {
+			flush()
+		}
+		if cur.Len() > 0 {
+			cur.WriteByte('\n')
+		}
+		cur.WriteString(line)
+	}
+	flush()
+	return chunks
+}
+
+// embeddingScores returns the cosine similarity of each chunk to the
+// question.
+func embeddingScores(emb Embeddings, question string, chunks []string) ([]float64, error) {
+	vecs, err := emb.Embed(append([]string{question}, chunks...))
+	if err != nil {
+		return nil, err
+	}
+	scores := make([]float64, len(chunks))
+	for i := range chunks {
+		scores[i] = Cosine(vecs[0], vecs[i+1])
+	}
+	return scores, nil
+}
+
+// embedBatch is the most texts sent in one embeddings request.
+const embedBatch = 256
+
+// Embed returns the embeddings of texts.
+func (e Embeddings) Embed(texts []string) ([][]float64, error) {
+	var key string
+	if e.KeyEnv != "" {
+		if key = APIKey(e.KeyEnv); key == "" {
+			return nil, fmt.Errorf("%w: set %s or store a key in the keychain", ErrNoAPIKey, e.KeyEnv)
+		}
+	}
+	vecs := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += embedBatch {
+		batch := texts[start:min(start+embedBatch, len(texts))]
+		body, err := json.Marshal(map[string]any{"model": e.Model, "input": batch})
+		if err != nil {
+			return nil, err
+		}
+		r, err := http.NewRequest("POST", e.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("content-type", "application/json")
+		if key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			return nil, err
+		}
+		var out struct {
+			Data []struct {
+				Index     int       `json:"index"`
+				Embedding []float64 `json:"embedding"`
+			} `json:"data"`
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("embeddings API: %s", res.Status)
+		}
+		err = json.NewDecoder(res.Body).Decode(&out)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		got := make([][]float64, len(batch))
+		for _, d := range out.Data {
+			if d.Index >= 0 && d.Index < len(got) {
+				got[d.Index] = d.Embedding
+			}
+		}
+		vecs = append(vecs, got...)
+	}
+	return vecs, nil
+}
+
+// Cosine is the cosine similarity of two vectors, or 0 when their lengths
+// differ.
+func Cosine(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// keywordScores scores each chunk by the question words it contains,
+// weighting rare words higher.
+func keywordScores(question string, chunks []string) []float64 {
+	words := func(s string) map[string]bool {
+		set := map[string]bool{}
+		for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			if len(w) >= 3 {
+				set[w] = true
+			}
+		}
+		return set
+	}
+	terms := words(question)
+	chunkWords := make([]map[string]bool, len(chunks))
+	df := map[string]int{}
+	for i, c := range chunks {
+		chunkWords[i] = words(c)
+		for t := range terms {
+			if chunkWords[i][t] {
+				df[t]++
+			}
+		}
+	}
+	scores := make([]float64, len(chunks))
+	for i := range chunks {
+		for t := range terms {
+			if chunkWords[i][t] {
+				scores[i] += math.Log(1 + float64(len(chunks))/float64(df[t]))
+			}
+		}
+	}
+	return scores
+}
@@ -0,0 +1,386 @@
+package howdoi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var documentTmpl = template.Must(template.New("documents").Parse(documentTemplate))
+
+// LoadOptions control how arguments are turned into message content.
+type LoadOptions struct {
+	Provider string
+	// ModelID decides whether PDFs can be sent as documents, see
+	// Capabilities.PDF.
+	ModelID   string
+	PDFHybrid bool
+	// PDFAsImages sends PDFs as documents to models that read them natively
+	// and as page images to the others.
+	PDFAsImages bool
+	// Question is used to keep the relevant sections of web pages longer
+	// than MaxPageTokens.
+	Question      string
+	MaxPageTokens int
+	// Embeddings ranks the sections of those pages by similarity to the
+	// question. They are ranked by keyword overlap when it is nil, which
+	// sends the pages nowhere.
+	Embeddings *Embeddings
+	// Render loads web pages that have little text without JavaScript in
+	// headless Chrome.
+	Render bool
+	// Refresh scrapes web pages again instead of reading them from the
+	// scrappy database.
+	Refresh bool
+	// Wayback reads pages that can't be scraped, or that have little text,
+	// such as paywalled ones, from their latest Wayback Machine snapshot.
+	Wayback bool
+	// Rows is the number of rows of CSV, TSV, and Parquet files sent, after
+	// a summary of their columns, DefaultTableRows when 0.
+	Rows int
+	// Depth is how many links away from a web page the pages of the same
+	// site it links to are loaded, up to MaxLinks of them, DefaultMaxLinks
+	// when 0.
+	Depth    int
+	MaxLinks int
+}
+
+// RenderDocument wraps a document in the document template.
+func RenderDocument(d Document) (TextContent, error) {
+	var docBuffer bytes.Buffer
+	if err := documentTmpl.Execute(&docBuffer, d); err != nil {
+		return TextContent{}, fmt.Errorf("rendering the template: %w", err)
+	}
+	return TextContent{Type: "text", Text: docBuffer.String()}, nil
+}
+
+// LoadArg turns a single command line argument into message content. Files
+// and URLs are loaded as documents or images, anything else is plain text
+// and has no attachment.
+func LoadArg(ctx context.Context, a string, opts LoadOptions) ([]any, *Attachment, error) {
+	if IsFile(a) {
+		return LoadFile(a, opts)
+	}
+	if IsURL(a) {
+		return loadURL(ctx, a, opts)
+	}
+	return []any{TextContent{Type: "text", Text: a}}, nil, nil
+}
+
+func LoadFile(file string, opts LoadOptions) ([]any, *Attachment, error) {
+	if ext := strings.ToLower(filepath.Ext(file)); officeExts[ext] {
+		return loadOffice(file, ext)
+	} else if audioTypes[ext] != "" {
+		return loadAudio(file, opts)
+	} else if _, ok := tableExts[ext]; ok {
+		return loadTable(file, ext, opts)
+	} else if ebookExts[ext] {
+		return loadEbook(file, ext)
+	}
+
+	ext, ok := isAcceptedImageFile(file)
+	if !ok {
+		fileContent, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading context file: %w", err)
+		}
+		lang := DetectLanguage(file, string(fileContent))
+		doc, err := RenderDocument(Document{
+			Source:   file,
+			Language: lang,
+			Content:  string(fileContent),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return []any{doc}, NewAttachment(file, "text", lang, fileContent), nil
+	}
+
+	if ext == ".pdf" {
+		att, err := fileAttachment(file, "pdf", "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading PDF file: %w", err)
+		}
+		parts, err := loadPDF(file, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if opts.PDFHybrid {
+			att.Detail = "hybrid"
+		} else if opts.PDFAsImages {
+			att.Detail = "images"
+		}
+		return parts, att, nil
+	}
+
+	imageContent, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading image file: %w", err)
+	}
+	att := NewAttachment(file, "image", ext[1:], imageContent)
+	original := imageContent
+	ext, imageContent, err = PrepareImage(file, ext, imageContent)
+	if err != nil {
+		return nil, nil, fmt.Errorf("preparing %s: %w", file, err)
+	}
+	if c, ok := ModelCapabilities[opts.ModelID]; ok && !c.Vision && HasOCR() {
+		// Models without vision get the text of the image instead, read at
+		// full size unless Tesseract can't read the format.
+		if convertedImageExts[strings.ToLower(filepath.Ext(file))] {
+			original = imageContent
+		}
+		text, err := OCRImage(original)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading %s with OCR: %w", file, err)
+		}
+		doc, err := RenderDocument(Document{Source: file + " (OCR)", Content: text})
+		if err != nil {
+			return nil, nil, err
+		}
+		att.Detail = "ocr"
+		return []any{doc}, att, nil
+	}
+	return []any{NewImageContent(opts.Provider, ext, imageContent)}, att, nil
+}
+
+func loadPDF(file string, opts LoadOptions) ([]any, error) {
+	if opts.PDFAsImages {
+		if opts.Provider == "anthropic" && ModelCapabilities[opts.ModelID].PDF {
+			return loadPDFDocument(file)
+		}
+		images, err := readPDFImages(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading PDF file: %w", err)
+		}
+		var parts []any
+		for i, img := range images {
+			parts = append(parts, TextContent{Type: "text", Text: fmt.Sprintf("Rendered image of page %d of %s:", i+1, file)})
+			parts = append(parts, NewImageContent(opts.Provider, ".png", img))
+		}
+		return parts, nil
+	}
+	if opts.PDFHybrid {
+		pages, err := readPDFHybrid(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading PDF file: %w", err)
+		}
+		var text strings.Builder
+		for _, p := range pages {
+			fmt.Fprintf(&text, "[page %d]\n%s\n", p.Number, p.Text)
+		}
+		doc, err := RenderDocument(Document{Source: file, Content: text.String()})
+		if err != nil {
+			return nil, err
+		}
+		parts := []any{doc}
+		for _, p := range pages {
+			if p.Image == nil {
+				continue
+			}
+			parts = append(parts, TextContent{Type: "text", Text: fmt.Sprintf("Rendered image of page %d of %s:", p.Number, file)})
+			parts = append(parts, NewImageContent(opts.Provider, ".png", p.Image))
+		}
+		return parts, nil
+	}
+
+	pages, err := readPDFContent(file, ModelCapabilities[opts.ModelID].Vision)
+	if err != nil {
+		return nil, fmt.Errorf("reading PDF file: %w", err)
+	}
+	var text strings.Builder
+	var scanned []string
+	for _, p := range pages {
+		text.WriteString(p.Text)
+		text.WriteString("\n")
+		if p.Scanned {
+			scanned = append(scanned, strconv.Itoa(p.Number))
+		}
+	}
+	if len(scanned) > 0 {
+		Logf("Warning: pages %s of %s have no text; install tesseract to read scans, or use a vision model\n", strings.Join(scanned, ", "), file)
+	}
+	doc, err := RenderDocument(Document{Source: file, Content: text.String()})
+	if err != nil {
+		return nil, err
+	}
+	parts := []any{doc}
+	for _, p := range pages {
+		if p.Image == nil {
+			continue
+		}
+		parts = append(parts, TextContent{Type: "text", Text: fmt.Sprintf("Rendered image of page %d of %s:", p.Number, file)})
+		parts = append(parts, NewImageContent(opts.Provider, ".png", p.Image))
+	}
+	return parts, nil
+}
+
+// loadPDFDocument attaches a PDF as is, for models that read the text and
+// the images of its pages themselves.
+func loadPDFDocument(file string) ([]any, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading PDF file: %w", err)
+	}
+	pages, err := countPDFPages(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading PDF file: %w", err)
+	}
+	return []any{
+		TextContent{Type: "text", Text: file + ":"},
+		NewDocumentContent(data, pages),
+	}, nil
+}
+
+func loadOffice(file, ext string) ([]any, *Attachment, error) {
+	att, err := fileAttachment(file, "office", ext[1:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading office file: %w", err)
+	}
+	content, err := readOfficeContent(file, ext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading office file: %w", err)
+	}
+	doc, err := RenderDocument(Document{Source: file, Content: content})
+	if err != nil {
+		return nil, nil, err
+	}
+	return []any{doc}, att, nil
+}
+
+// urlLoader fetches the text of URLs that scraping the HTML does not work
+// for.
+type urlLoader struct {
+	name  string
+	match func(u *url.URL) bool
+	load  func(ctx context.Context, rawURL string) (string, error)
+}
+
+// urlLoaders are tried in order before scraping the web page.
+var urlLoaders = []urlLoader{
+	{name: "YouTube transcript", match: isYouTubeURL, load: fetchYouTubeTranscript},
+	{name: "reddit thread", match: isRedditThreadURL, load: fetchRedditThread},
+	{name: "Hacker News thread", match: isHackerNewsURL, load: fetchHackerNewsThread},
+}
+
+func loadURL(ctx context.Context, rawURL string, opts LoadOptions) ([]any, *Attachment, error) {
+	content, source, err := fetchURL(ctx, rawURL, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Links are followed from the whole page, not only the sections kept.
+	page := content
+	if clipped := clipByRelevance(content, opts.Question, opts.MaxPageTokens, opts.Embeddings); len(clipped) < len(content) {
+		Logf("Kept about %d of the %d tokens of %s, by relevance to the question\n", len(clipped)/4, len(content)/4, rawURL)
+		content = clipped
+	}
+	doc, err := RenderDocument(Document{Source: source, Content: content})
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := []any{doc}
+	if opts.Depth > 0 {
+		parts = append(parts, loadLinkedPages(ctx, rawURL, page, opts)...)
+	}
+	return parts, NewAttachment(rawURL, "url", "", []byte(content)), nil
+}
+
+// fetchURL returns the text of a URL and the source to cite it by, from the
+// first matching urlLoader, the scrappy database unless opts.Refresh is set,
+// or by scraping the web page, which is then saved to the scrappy database.
+// When scraping fails or finds too little text, the page is rendered in
+// Chrome with opts.Render and read from its latest Wayback Machine snapshot
+// with opts.Wayback.
+func fetchURL(ctx context.Context, rawURL string, opts LoadOptions) (string, string, error) {
+	if u, err := url.Parse(rawURL); err == nil {
+		for _, l := range urlLoaders {
+			if !l.match(u) {
+				continue
+			}
+			Logf("Fetching the %s: %s\n", l.name, rawURL)
+			content, err := l.load(ctx, rawURL)
+			if err != nil {
+				return "", "", fmt.Errorf("fetching the %s: %w", l.name, err)
+			}
+			return content, rawURL, nil
+		}
+	}
+
+	if !opts.Refresh {
+		content, err := getContentFromScrappyDB(rawURL)
+		if err != nil {
+			Logf("Error checking scrappy database: %v\n", err)
+		}
+		if content != "" {
+			return content, rawURL, nil
+		}
+	}
+	Logf("Scraping the web page: %s\n", rawURL)
+	content, err := scrapeWebPage(ctx, rawURL)
+	if opts.Render && (err != nil || len(content) < minPageChars) {
+		Logf("Rendering the web page: %s\n", rawURL)
+		content, err = renderWebPage(ctx, rawURL)
+	}
+	if opts.Wayback && (err != nil || len(content) < minPageChars) {
+		Logf("Reading the Wayback Machine snapshot: %s\n", rawURL)
+		archived, source, werr := scrapeWayback(ctx, rawURL)
+		if werr == nil {
+			return archived, source, nil
+		}
+		Logf("Error reading the Wayback Machine snapshot: %v\n", werr)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("scraping the web page: %w", err)
+	}
+	if err := saveContentToScrappyDB(rawURL, content); err != nil {
+		Logf("Error saving to scrappy database: %v\n", err)
+	}
+	return content, rawURL, nil
+}
+
+var documentTemplate = `
+<document>
+  <source>
+  {{.Source}}
+  </source>
+{{- if .Language}}
+  <language>{{.Language}}</language>
+{{- end}}
+  <document_content>
+{{- if .Language}}
+  ` + "```" + `{{.Language}}
+{{.Content}}
+  ` + "```" + `
+{{- else}}
+  {{.Content}}
+{{- end}}
+  </document_content>
+</document>
+`
+
+func isAcceptedImageFile(file string) (string, bool) {
+	for _, ext := range []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".pdf", ".tiff", ".tif", ".bmp", ".heic", ".heif", ".avif"} {
+		if strings.HasSuffix(strings.ToLower(file), ext) {
+			if ext == ".jpg" {
+				return ".jpeg", true
+			}
+			return ext, true
+		}
+	}
+	return "", false
+}
+
+func IsFile(str string) bool {
+	_, err := os.Stat(str)
+	return err == nil
+}
+
+func IsURL(str string) bool {
+	_, err := url.ParseRequestURI(str)
+	return err == nil
+}
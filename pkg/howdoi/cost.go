@@ -0,0 +1,83 @@
+package howdoi
+
+type Cost struct {
+	// Input is the cost of tokens in the input message
+	Input float64
+	// Output is the cost of tokens in the output message
+	Output float64
+	// CacheRead is the cost of input tokens read from the prompt cache,
+	// Input when zero.
+	CacheRead float64
+	// CacheWrite is the cost of input tokens written to the prompt cache,
+	// Input when zero.
+	CacheWrite float64
+	// LongContextThreshold is the prompt size above which the long context
+	// rates apply to the whole request, no tier when zero.
+	LongContextThreshold int
+	LongInput            float64
+	LongOutput           float64
+}
+
+// Cost per token
+var modelCosts = map[string]Cost{
+	"claude-3-5-sonnet-20240620": {Input: 3.0 / 1000000, Output: 15.0 / 1000000, CacheRead: 0.30 / 1000000, CacheWrite: 3.75 / 1000000},
+	"claude-3-5-sonnet-20241022": {Input: 3.0 / 1000000, Output: 15.0 / 1000000, CacheRead: 0.30 / 1000000, CacheWrite: 3.75 / 1000000},
+	"gpt-4o-mini":                {Input: 0.15 / 1000000, Output: 0.60 / 1000000, CacheRead: 0.075 / 1000000},
+
+	// Not sure how tokens are counted with gemini
+	"gemini-1.5-flash-latest": {Input: 0.35 / 1000000, Output: 1.05 / 1000000, LongContextThreshold: 128000, LongInput: 0.70 / 1000000, LongOutput: 2.10 / 1000000},
+	"gemini-1.5-pro-latest":   {Input: 3.50 / 1000000, Output: 10.50 / 1000000, LongContextThreshold: 128000, LongInput: 7.00 / 1000000, LongOutput: 21.00 / 1000000},
+	"o1-mini":                 {Input: 3 / 1000000, Output: 12 / 1000000, CacheRead: 1.5 / 1000000},
+	"o1-preview":              {Input: 15 / 1000000, Output: 60 / 1000000, CacheRead: 7.5 / 1000000},
+	"mistral-large-latest":    {Input: 2.0 / 1000000, Output: 6.0 / 1000000},
+	"codestral-latest":        {Input: 0.3 / 1000000, Output: 0.9 / 1000000},
+	"deepseek-chat":           {Input: 0.27 / 1000000, Output: 1.10 / 1000000, CacheRead: 0.07 / 1000000},
+
+	"llama-3.3-70b-versatile": {Input: 0.59 / 1000000, Output: 0.79 / 1000000},
+	"llama-3.1-8b-instant":    {Input: 0.05 / 1000000, Output: 0.08 / 1000000},
+	"mixtral-8x7b-32768":      {Input: 0.24 / 1000000, Output: 0.24 / 1000000},
+
+	"meta-llama/Meta-Llama-3.1-405B-Instruct-Turbo": {Input: 3.50 / 1000000, Output: 3.50 / 1000000},
+	"meta-llama/Llama-3.3-70B-Instruct-Turbo":       {Input: 0.88 / 1000000, Output: 0.88 / 1000000},
+	"mistralai/Mixtral-8x7B-Instruct-v0.1":          {Input: 0.60 / 1000000, Output: 0.60 / 1000000},
+}
+
+// ModelCost returns the per token prices of a model by its ID, and whether
+// they are known.
+func ModelCost(model string) (Cost, bool) {
+	c, ok := modelCosts[model]
+	return c, ok
+}
+
+// CalculateCost returns the cost in dollars of the usage of a model by its ID.
+// Unknown models cost nothing.
+func CalculateCost(model string, usage Usage) float64 {
+	cost := modelCosts[model]
+	input, output := cost.Input, cost.Output
+	if cost.LongContextThreshold > 0 && usage.PromptTokens() > cost.LongContextThreshold {
+		input, output = cost.LongInput, cost.LongOutput
+	}
+	return cost.price(usage, input, output)
+}
+
+// price prices usage at the given input and output rates and the cache
+// rates of c.
+func (c Cost) price(usage Usage, input, output float64) float64 {
+	cacheRead, cacheWrite := c.CacheRead, c.CacheWrite
+	if cacheRead == 0 {
+		cacheRead = input
+	}
+	if cacheWrite == 0 {
+		cacheWrite = input
+	}
+	return float64(usage.InputTokens)*input +
+		float64(usage.CacheReadTokens)*cacheRead +
+		float64(usage.CacheWriteTokens)*cacheWrite +
+		float64(usage.OutputTokens)*output
+}
+
+// EstimateCost is the most a request should cost: its estimated prompt and
+// MaxTokens of output.
+func EstimateCost(req Request) float64 {
+	return CalculateCost(req.ModelID, Usage{InputTokens: EstimateTokens(req), OutputTokens: req.MaxTokens})
+}
@@ -0,0 +1,210 @@
+package howdoi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// maxSitemaps is the most sitemaps read from a sitemap index.
+const maxSitemaps = 50
+
+// sitemap is a sitemap or a sitemap index, which lists other sitemaps.
+type sitemap struct {
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// crawlPrefix is the directory of the start URL, the path all crawled pages
+// are below.
+func crawlPrefix(start *url.URL) string {
+	p := start.Path
+	if !strings.HasSuffix(p, "/") {
+		p = path.Dir("/" + strings.TrimPrefix(p, "/"))
+	}
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return p
+}
+
+// crawlScope returns whether a URL is below the directory of the start URL
+// on the same site.
+func crawlScope(start *url.URL) func(u *url.URL) bool {
+	prefix := crawlPrefix(start)
+	return func(u *url.URL) bool {
+		p := u.Path
+		if p == "" {
+			p = "/"
+		}
+		return sameSite(u.Host, start.Host) && (strings.HasPrefix(p, prefix) || p+"/" == prefix)
+	}
+}
+
+// readSitemap returns the page URLs of a sitemap, reading the sitemaps of a
+// sitemap index. Gzipped sitemaps are uncompressed.
+func readSitemap(ctx context.Context, rawURL string, read map[string]bool) ([]string, error) {
+	read[rawURL] = true
+	b, err := httpGet(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 2 && b[0] == 0x1f && b[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		if b, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+	var sm sitemap
+	if err := xml.Unmarshal(b, &sm); err != nil {
+		return nil, err
+	}
+	urls := sm.URLs
+	for _, s := range sm.Sitemaps {
+		s = strings.TrimSpace(s)
+		if read[s] || len(read) >= maxSitemaps {
+			continue
+		}
+		more, err := readSitemap(ctx, s, read)
+		if err != nil {
+			Logf("Error reading the sitemap %s: %v\n", s, err)
+			continue
+		}
+		urls = append(urls, more...)
+	}
+	return urls, nil
+}
+
+// sitemapURLs returns the pages of a site's sitemap in scope of the crawl,
+// from the sitemaps of its robots.txt, or the sitemap.xml of the start
+// directory or the site root. It returns none when the site has no sitemap.
+func sitemapURLs(ctx context.Context, start *url.URL, rb robots, inScope func(u *url.URL) bool) []string {
+	root := &url.URL{Scheme: start.Scheme, Host: start.Host}
+	dir := &url.URL{Scheme: start.Scheme, Host: start.Host, Path: crawlPrefix(start) + "sitemap.xml"}
+	candidates := append(slices.Clone(rb.sitemaps), dir.String(), root.JoinPath("sitemap.xml").String())
+
+	read := map[string]bool{}
+	for _, c := range candidates {
+		if read[c] {
+			continue
+		}
+		urls, err := readSitemap(ctx, c, read)
+		if err != nil {
+			continue
+		}
+		var pages []string
+		for _, raw := range urls {
+			if u, err := url.Parse(strings.TrimSpace(raw)); err == nil && inScope(u) {
+				u.Fragment = ""
+				pages = append(pages, u.String())
+			}
+		}
+		if len(pages) > 0 {
+			Logf("Crawling the %d pages of the sitemap %s\n", len(pages), c)
+			return pages
+		}
+	}
+	return nil
+}
+
+// Crawl loads the pages of a documentation site below the directory of the
+// start URL, up to maxPages of them, and passes each to save with its URL.
+// The pages are those of the site's sitemap when it has one, or the pages
+// reached by following links from the start page otherwise. Pages are read
+// and saved like URL arguments, see fetchURL, so a crawled site is in the
+// scrappy database. Pages that fail to load are skipped; an error from save
+// stops the crawl.
+//
+// The crawl keeps to the robots.txt of every host for Scraper.UserAgent: it
+// skips the pages it disallows and waits its Crawl-delay between requests,
+// when longer than Scraper.Delay.
+func Crawl(ctx context.Context, start string, maxPages int, opts LoadOptions, save func(pageURL, content string) error) error {
+	u, err := url.Parse(start)
+	if err != nil || u.Host == "" {
+		return errors.New("the start of a crawl must be a URL")
+	}
+	hostRobots := map[string]robots{}
+	robotsFor := func(u *url.URL) robots {
+		rb, ok := hostRobots[u.Host]
+		if ok {
+			return rb
+		}
+		rb, err := readRobots(ctx, u)
+		if err != nil && ctx.Err() == nil {
+			Logf("Error reading the robots.txt of %s, not crawling it: %v\n", u.Host, err)
+		}
+		if rb.delay > 0 {
+			Logf("Waiting %s between requests to %s, the Crawl-delay of its robots.txt\n", rb.delay, u.Host)
+			setHostDelay(u.Host, rb.delay)
+		}
+		hostRobots[u.Host] = rb
+		return rb
+	}
+	rb := robotsFor(u)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !rb.allows(u) {
+		return fmt.Errorf("the robots.txt of %s disallows crawling %s", u.Host, start)
+	}
+	inScope := crawlScope(u)
+	queue := sitemapURLs(ctx, u, rb, inScope)
+	followLinks := len(queue) == 0
+	if followLinks {
+		Logf("No sitemap found, following the links of %s\n", start)
+	}
+	queue = append([]string{start}, queue...)
+	seen := map[string]bool{}
+	saved, disallowed := 0, 0
+	for len(queue) > 0 && saved < maxPages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		pageURL := queue[0]
+		queue = queue[1:]
+		if seen[pageURL] {
+			continue
+		}
+		seen[pageURL] = true
+		if pu, err := url.Parse(pageURL); err != nil || !robotsFor(pu).allows(pu) {
+			disallowed++
+			continue
+		}
+		content, _, err := fetchURL(ctx, pageURL, opts)
+		if err != nil {
+			Logf("Error crawling %s: %v\n", pageURL, err)
+			continue
+		}
+		if err := save(pageURL, content); err != nil {
+			return err
+		}
+		saved++
+		if !followLinks {
+			continue
+		}
+		pu, _ := url.Parse(pageURL)
+		for _, link := range pageLinks(content, pu) {
+			if lu, err := url.Parse(link); err == nil && inScope(lu) && !seen[link] {
+				queue = append(queue, link)
+			}
+		}
+	}
+	if disallowed > 0 {
+		Logf("Skipped %d pages disallowed by robots.txt\n", disallowed)
+	}
+	if saved == maxPages && len(queue) > 0 {
+		Logf("Stopped after %d pages\n", maxPages)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package howdoi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// debugBodyLimit is how much of a request body is written to the debug log.
+const debugBodyLimit = 64 << 10
+
+// debugTransport writes every request and response, with its headers and
+// body line by line, to a log. Credentials are redacted.
+type debugTransport struct {
+	base http.RoundTripper
+	mu   sync.Mutex
+	w    io.Writer
+	n    int
+}
+
+// NewDebugTransport wraps base to write the exchanges it makes to w, with
+// API keys, tokens, and cookies redacted. Streamed responses are written as
+// their SSE frames arrive, so lines of concurrent requests interleave; every
+// line carries the number of its request.
+func NewDebugTransport(w io.Writer, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &debugTransport{base: base, w: w}
+}
+
+// isSecret reports whether a header or query parameter holds a credential.
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie":
+		return true
+	}
+	for _, s := range []string{"key", "token", "secret", "password"} {
+		if strings.HasSuffix(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	if len(q) == 0 {
+		return u.String()
+	}
+	for k := range q {
+		if isSecret(k) {
+			q.Set(k, "REDACTED")
+		}
+	}
+	c := *u
+	c.RawQuery = q.Encode()
+	return c.String()
+}
+
+func (t *debugTransport) write(id int, dir, format string, args ...any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "%s #%d %s %s\n", time.Now().Format("15:04:05.000"), id, dir, fmt.Sprintf(format, args...))
+}
+
+func (t *debugTransport) writeHeaders(id int, dir string, h http.Header) {
+	names := make([]string, 0, len(h))
+	for k := range h {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		v := strings.Join(h[k], ", ")
+		if isSecret(k) {
+			v = "REDACTED"
+		}
+		t.write(id, dir, "%s: %s", k, v)
+	}
+}
+
+func (t *debugTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.n++
+	id := t.n
+	t.mu.Unlock()
+
+	t.write(id, ">", "%s %s", r.Method, redactURL(r.URL))
+	t.writeHeaders(id, ">", r.Header)
+	if r.GetBody != nil {
+		if body, err := r.GetBody(); err == nil {
+			b, _ := io.ReadAll(io.LimitReader(body, debugBodyLimit+1))
+			body.Close()
+			switch {
+			case !utf8.Valid(b):
+				t.write(id, ">", "(%d bytes of binary data)", r.ContentLength)
+			case len(b) > debugBodyLimit:
+				t.write(id, ">", "%s ... (%d bytes)", b[:debugBodyLimit], r.ContentLength)
+			case len(b) > 0:
+				t.write(id, ">", "%s", b)
+			}
+		}
+	}
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(r)
+	if err != nil {
+		t.write(id, "!", "%v", err)
+		return nil, err
+	}
+	t.write(id, "<", "%s %s (%s)", res.Proto, res.Status, time.Since(start).Round(time.Millisecond))
+	t.writeHeaders(id, "<", res.Header)
+	res.Body = &debugBody{ReadCloser: res.Body, t: t, id: id}
+	return res, nil
+}
+
+// debugBody writes a response body to the log a line at a time as it is
+// read.
+type debugBody struct {
+	io.ReadCloser
+	t       *debugTransport
+	id      int
+	partial []byte
+}
+
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.partial = append(b.partial, p[:n]...)
+	for {
+		i := bytes.IndexByte(b.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if line := bytes.TrimRight(b.partial[:i], "\r"); len(line) > 0 {
+			b.t.write(b.id, "<", "%s", line)
+		}
+		b.partial = b.partial[i+1:]
+	}
+	if err != nil && err != io.EOF {
+		b.t.write(b.id, "!", "%v", err)
+	}
+	return n, err
+}
+
+func (b *debugBody) Close() error {
+	if len(b.partial) > 0 {
+		b.t.write(b.id, "<", "%s", b.partial)
+		b.partial = nil
+	}
+	return b.ReadCloser.Close()
+}
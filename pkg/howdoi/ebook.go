@@ -0,0 +1,468 @@
+package howdoi
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// ebookExts are the ebook formats split into sections. AZW is MOBI under
+// Amazon's name.
+var ebookExts = map[string]bool{".epub": true, ".mobi": true, ".azw": true}
+
+// ebookSection is a file of an EPUB spine or a page-broken part of a MOBI
+// book, with the title the table of contents gives it.
+type ebookSection struct {
+	Title string
+	Text  string
+}
+
+// ebook is the text of a book.
+type ebook struct {
+	Title    string
+	Author   string
+	Sections []ebookSection
+}
+
+// readEbook reads an EPUB or MOBI book. MOBI books with Huffman compression
+// are converted to EPUB with Calibre's ebook-convert.
+func readEbook(file, ext string) (ebook, error) {
+	if ext == ".epub" {
+		return readEPUB(file)
+	}
+	book, err := readMOBI(file)
+	if errors.Is(err, errMOBIHuffman) {
+		return convertEbook(file)
+	}
+	return book, err
+}
+
+// loadEbook attaches a book as an outline, with its title, author, and
+// sections, followed by a document per section, so questions can refer to
+// sections by number or title.
+func loadEbook(file, ext string) ([]any, *Attachment, error) {
+	att, err := fileAttachment(file, "ebook", ext[1:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading ebook file: %w", err)
+	}
+	book, err := readEbook(file, ext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+	if len(book.Sections) == 0 {
+		return nil, nil, fmt.Errorf("reading %s: the book has no text", file)
+	}
+	var outline strings.Builder
+	if book.Title != "" {
+		fmt.Fprintf(&outline, "Title: %s\n", book.Title)
+	}
+	if book.Author != "" {
+		fmt.Fprintf(&outline, "Author: %s\n", book.Author)
+	}
+	outline.WriteString("Sections:\n")
+	for i, s := range book.Sections {
+		fmt.Fprintf(&outline, "%d. %s\n", i+1, s.Title)
+	}
+	doc, err := RenderDocument(Document{Source: file, Content: outline.String()})
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := []any{doc}
+	for i, s := range book.Sections {
+		doc, err := RenderDocument(Document{Source: fmt.Sprintf("%s, section %d: %s", file, i+1, s.Title), Content: s.Text})
+		if err != nil {
+			return nil, nil, err
+		}
+		parts = append(parts, doc)
+	}
+	return parts, att, nil
+}
+
+// bookMarkdown renders a chapter of a book as markdown. Links are dropped,
+// since they point at other files of the book.
+func bookMarkdown(doc *html.Node) (title, text string) {
+	root := findElement(doc, atom.Body)
+	if root == nil {
+		root = doc
+	}
+	var clean func(n *html.Node)
+	clean = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.CommentNode || c.Type == html.ElementNode && droppedTags[c.DataAtom] {
+				n.RemoveChild(c)
+			} else {
+				if c.DataAtom == atom.A {
+					c.DataAtom, c.Data = atom.Span, "span"
+				}
+				clean(c)
+			}
+			c = next
+		}
+	}
+	clean(root)
+	for _, a := range []atom.Atom{atom.H1, atom.H2, atom.H3} {
+		if h := findElement(root, a); h != nil {
+			if title = innerText(h); title != "" {
+				break
+			}
+		}
+	}
+	md := &markdown{}
+	md.node(root)
+	return title, md.String()
+}
+
+// addSection adds a chapter to the book unless it has no text, like a cover.
+// Chapters the table of contents does not name are named by their heading.
+func (b *ebook) addSection(title string, doc *html.Node) {
+	heading, text := bookMarkdown(doc)
+	if text == "" {
+		return
+	}
+	if title == "" {
+		title = heading
+	}
+	if title == "" {
+		title = fmt.Sprintf("Untitled section %d", len(b.Sections)+1)
+	}
+	b.Sections = append(b.Sections, ebookSection{Title: strings.Join(strings.Fields(title), " "), Text: text})
+}
+
+type epubPackage struct {
+	Metadata struct {
+		Title   []string `xml:"title"`
+		Creator []string `xml:"creator"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		TOC      string `xml:"toc,attr"`
+		ItemRefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+type ncxPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Points []ncxPoint `xml:"navPoint"`
+}
+
+// readEPUB reads the files of an EPUB's spine in reading order.
+func readEPUB(file string) (ebook, error) {
+	var book ebook
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return book, err
+	}
+	defer zr.Close()
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := decodeZipXML(&zr.Reader, "META-INF/container.xml", &container); err != nil {
+		return book, fmt.Errorf("reading the container: %w", err)
+	}
+	if len(container.Rootfiles) == 0 {
+		return book, errors.New("the container names no package")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	var pkg epubPackage
+	if err := decodeZipXML(&zr.Reader, opfPath, &pkg); err != nil {
+		return book, fmt.Errorf("reading the package: %w", err)
+	}
+	if len(pkg.Metadata.Title) > 0 {
+		book.Title = strings.TrimSpace(pkg.Metadata.Title[0])
+	}
+	book.Author = strings.Join(pkg.Metadata.Creator, ", ")
+
+	// Paths in the package are relative to it, and those in the table of
+	// contents to the table.
+	resolve := func(from, href string) string {
+		href, _, _ = strings.Cut(href, "#")
+		if u, err := url.PathUnescape(href); err == nil {
+			href = u
+		}
+		return path.Join(path.Dir(from), href)
+	}
+	hrefs := map[string]string{}
+	titles := map[string]string{}
+	for _, item := range pkg.Manifest {
+		hrefs[item.ID] = resolve(opfPath, item.Href)
+		switch {
+		case slices.Contains(strings.Fields(item.Properties), "nav"):
+			navPath := resolve(opfPath, item.Href)
+			if doc, err := readZipXML(&zr.Reader, navPath, html.Parse); err == nil {
+				for name, title := range navTitles(doc) {
+					titles[resolve(navPath, name)] = title
+				}
+			}
+		case item.ID == pkg.Spine.TOC && len(titles) == 0:
+			ncxPath := resolve(opfPath, item.Href)
+			var ncx struct {
+				Points []ncxPoint `xml:"navMap>navPoint"`
+			}
+			if err := decodeZipXML(&zr.Reader, ncxPath, &ncx); err == nil {
+				var walk func(points []ncxPoint)
+				walk = func(points []ncxPoint) {
+					for _, p := range points {
+						if name := resolve(ncxPath, p.Content.Src); titles[name] == "" {
+							titles[name] = strings.TrimSpace(p.Label)
+						}
+						walk(p.Points)
+					}
+				}
+				walk(ncx.Points)
+			}
+		}
+	}
+	for _, ref := range pkg.Spine.ItemRefs {
+		name, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		doc, err := readZipXML(&zr.Reader, name, html.Parse)
+		if err != nil {
+			return book, fmt.Errorf("reading %s: %w", name, err)
+		}
+		book.addSection(titles[name], doc)
+	}
+	return book, nil
+}
+
+// navTitles returns the titles of the files linked from the table of
+// contents of an EPUB 3 navigation document, by their href.
+func navTitles(doc *html.Node) map[string]string {
+	var toc *html.Node
+	var find func(n *html.Node)
+	find = func(n *html.Node) {
+		if toc != nil {
+			return
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.Nav && attr(n, "epub:type") == "toc" {
+			toc = n
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	if toc == nil {
+		toc = findElement(doc, atom.Nav)
+	}
+	titles := map[string]string{}
+	if toc == nil {
+		return titles
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			href, _, _ := strings.Cut(attr(n, "href"), "#")
+			if href != "" && titles[href] == "" {
+				titles[href] = innerText(n)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(toc)
+	return titles
+}
+
+var errMOBIHuffman = errors.New("the book uses Huffman compression")
+
+// mobiPageBreakRe splits the HTML of a MOBI book into chapters.
+var mobiPageBreakRe = regexp.MustCompile(`(?i)<mbp:pagebreak\s*/?>`)
+
+// readMOBI reads the text of a MOBI book, uncompressed or with PalmDOC
+// compression, and splits it at its page breaks.
+func readMOBI(file string) (ebook, error) {
+	var book ebook
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return book, err
+	}
+	if len(data) < 78 || string(data[60:68]) != "BOOKMOBI" {
+		return book, errors.New("not a MOBI book")
+	}
+	n := int(binary.BigEndian.Uint16(data[76:]))
+	if len(data) < 78+8*n || n < 2 {
+		return book, errors.New("the MOBI record list is truncated")
+	}
+	record := func(i int) []byte {
+		start := int(binary.BigEndian.Uint32(data[78+8*i:]))
+		end := len(data)
+		if i+1 < n {
+			end = int(binary.BigEndian.Uint32(data[78+8*(i+1):]))
+		}
+		if start > end || end > len(data) {
+			return nil
+		}
+		return data[start:end]
+	}
+	r0 := record(0)
+	if len(r0) < 16 {
+		return book, errors.New("the MOBI header is truncated")
+	}
+	compression := binary.BigEndian.Uint16(r0)
+	textLength := int(binary.BigEndian.Uint32(r0[4:]))
+	textRecords := int(binary.BigEndian.Uint16(r0[8:]))
+	if binary.BigEndian.Uint16(r0[12:]) != 0 {
+		return book, errors.New("the book is DRM protected")
+	}
+	if compression == 17480 {
+		return book, errMOBIHuffman
+	}
+	if compression != 1 && compression != 2 {
+		return book, fmt.Errorf("unknown MOBI compression %d", compression)
+	}
+	encoding := "windows-1252"
+	var extraFlags uint16
+	if len(r0) >= 24 && string(r0[16:20]) == "MOBI" {
+		headerLength := int(binary.BigEndian.Uint32(r0[20:]))
+		if len(r0) >= 32 && binary.BigEndian.Uint32(r0[28:]) == 65001 {
+			encoding = "utf-8"
+		}
+		if headerLength >= 0xE4 && len(r0) >= 0xF4 {
+			extraFlags = binary.BigEndian.Uint16(r0[0xF2:])
+		}
+		if len(r0) >= 0x5C {
+			offset, length := int(binary.BigEndian.Uint32(r0[0x54:])), int(binary.BigEndian.Uint32(r0[0x58:]))
+			if offset+length <= len(r0) {
+				book.Title = string(r0[offset : offset+length])
+			}
+		}
+	}
+
+	var text []byte
+	for i := 1; i <= textRecords && i < n; i++ {
+		rec := record(i)
+		rec = rec[:len(rec)-min(mobiTrailingSize(rec, extraFlags), len(rec))]
+		if compression == 2 {
+			rec = palmDOCDecompress(rec)
+		}
+		text = append(text, rec...)
+	}
+	if len(text) > textLength {
+		text = text[:textLength]
+	}
+	r, err := charset.NewReaderLabel(encoding, bytes.NewReader(text))
+	if err != nil {
+		return book, err
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return book, err
+	}
+	for _, chapter := range mobiPageBreakRe.Split(string(decoded), -1) {
+		doc, err := html.Parse(strings.NewReader(chapter))
+		if err != nil {
+			return book, err
+		}
+		book.addSection("", doc)
+	}
+	return book, nil
+}
+
+// mobiTrailingSize is the size of the entries MOBI appends to text records,
+// described by the extra data flags of the header.
+func mobiTrailingSize(rec []byte, flags uint16) int {
+	size := 0
+	for f := flags >> 1; f != 0; f >>= 1 {
+		if f&1 == 0 {
+			continue
+		}
+		// The size of each entry is a variable width integer ending it,
+		// read forwards from where its first byte has the high bit set.
+		end := len(rec) - size
+		v := 0
+		for _, c := range rec[max(end-4, 0):max(end, 0)] {
+			if c&0x80 != 0 {
+				v = 0
+			}
+			v = v<<7 | int(c&0x7F)
+		}
+		size += v
+	}
+	if flags&1 != 0 && size < len(rec) {
+		size += int(rec[len(rec)-size-1]&3) + 1
+	}
+	return size
+}
+
+// palmDOCDecompress decompresses a PalmDOC record, LZ77 with its literals
+// and a byte pair encoding for a space and a character.
+func palmDOCDecompress(in []byte) []byte {
+	out := make([]byte, 0, 4096)
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+		switch {
+		case c >= 1 && c <= 8:
+			end := min(i+1+int(c), len(in))
+			out = append(out, in[i+1:end]...)
+			i = end - 1
+		case c < 0x80:
+			out = append(out, c)
+		case c >= 0xC0:
+			out = append(out, ' ', c^0x80)
+		default:
+			if i+1 >= len(in) {
+				return out
+			}
+			pair := int(c)<<8 | int(in[i+1])
+			i++
+			dist, length := (pair>>3)&0x7FF, pair&7+3
+			if dist == 0 || dist > len(out) {
+				continue
+			}
+			for j := 0; j < length; j++ {
+				out = append(out, out[len(out)-dist])
+			}
+		}
+	}
+	return out
+}
+
+// convertEbook converts a book to EPUB with Calibre's ebook-convert and
+// reads it.
+func convertEbook(file string) (ebook, error) {
+	if _, err := exec.LookPath("ebook-convert"); err != nil {
+		return ebook{}, fmt.Errorf("%w, which reading needs Calibre's ebook-convert", errMOBIHuffman)
+	}
+	dir, err := os.MkdirTemp("", "howdoi-ebook-")
+	if err != nil {
+		return ebook{}, err
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "book.epub")
+	if b, err := exec.Command("ebook-convert", file, out).CombinedOutput(); err != nil {
+		return ebook{}, fmt.Errorf("converting with ebook-convert: %v: %s", err, strings.TrimSpace(string(b)))
+	}
+	return readEPUB(out)
+}
@@ -0,0 +1,139 @@
+package howdoi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const OpenAIBaseURL = "https://api.openai.com/v1"
+
+// toResponsesInput converts a chat message into the input format of the responses API.
+func toResponsesInput(message Message) map[string]any {
+	content := []map[string]any{}
+	for _, c := range message.Content {
+		switch v := c.(type) {
+		case TextContent:
+			if message.Role == "assistant" {
+				content = append(content, map[string]any{"type": "output_text", "text": v.Text})
+			} else {
+				content = append(content, map[string]any{"type": "input_text", "text": v.Text})
+			}
+		case ImageContentOpenAI:
+			content = append(content, map[string]any{"type": "input_image", "image_url": v.ImageURL.Url})
+		default:
+			Logf("Unknown content type: %T\n", v)
+		}
+	}
+	return map[string]any{"role": message.Role, "content": content}
+}
+
+// callFileSearchAPI streams a response from the OpenAI responses API with the
+// hosted file_search tool enabled over the vector stores of the request.
+func (c *Client) callFileSearchAPI(ctx context.Context, req Request) (chan Delta, error) {
+	tools := []map[string]any{{
+		"type":             "file_search",
+		"vector_store_ids": req.StoreIDs,
+	}}
+	return c.callResponsesAPI(ctx, req, tools)
+}
+
+// responsesURL is the responses API next to the chat completions API of the
+// request, so gateways and proxies in front of OpenAI are called too.
+func responsesURL(req Request) string {
+	if req.URL == "" {
+		return OpenAIBaseURL + "/responses"
+	}
+	return strings.TrimSuffix(req.URL, "/chat/completions") + "/responses"
+}
+
+// callResponsesAPI streams a response from the OpenAI responses API with
+// hosted tools.
+func (c *Client) callResponsesAPI(ctx context.Context, req Request, tools []map[string]any) (chan Delta, error) {
+	if req.Verbose {
+		Logf("Calling the API ... %s\n", req.ModelID)
+	}
+	input := make([]map[string]any, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		input = append(input, toResponsesInput(m))
+	}
+	rq := map[string]any{
+		"model":             req.ModelID,
+		"input":             input,
+		"max_output_tokens": req.MaxTokens,
+		"temperature":       req.Temperature,
+		"stream":            true,
+		"tools":             tools,
+	}
+	if req.System != "" {
+		rq["instructions"] = req.System
+	}
+	if req.Vendor.Custom && len(req.Metadata) > 0 {
+		rq["metadata"] = req.Metadata
+	} else if req.Vendor.URL == vendors["openai"].URL && req.Metadata["user"] != "" {
+		rq["user"] = req.Metadata["user"]
+	}
+
+	auth := http.Header{}
+	if req.APIKey != "" {
+		auth.Set("Authorization", "Bearer "+req.APIKey)
+	}
+	req.URL = responsesURL(req)
+	r, err := newAPIRequest(ctx, req, rq, auth)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(r, req.Verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamResponse(req.ModelID, res, handleResponsesEvent, req.Verbose), nil
+}
+
+// handleResponsesEvent handles the OpenAI responses API streaming events.
+func handleResponsesEvent(ev sseEvent, usage *Usage, emit func(Delta)) error {
+	var data struct {
+		Type       string `json:"type"`
+		Delta      string `json:"delta"`
+		Message    string `json:"message"`
+		Annotation struct {
+			Type  string `json:"type"`
+			URL   string `json:"url"`
+			Title string `json:"title"`
+		} `json:"annotation"`
+		Response struct {
+			Usage struct {
+				InputTokens        int `json:"input_tokens"`
+				OutputTokens       int `json:"output_tokens"`
+				InputTokensDetails struct {
+					CachedTokens int `json:"cached_tokens"`
+				} `json:"input_tokens_details"`
+			} `json:"usage"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal([]byte(ev.Data), &data); err != nil {
+		return fmt.Errorf("decoding stream event: %w", err)
+	}
+	switch data.Type {
+	case "response.output_text.delta":
+		emit(Delta{Text: data.Delta})
+	case "response.reasoning_summary_text.delta":
+		emit(Delta{Reasoning: data.Delta})
+	case "response.output_text.annotation.added":
+		if data.Annotation.Type == "url_citation" {
+			emit(Delta{Citation: &Citation{URL: data.Annotation.URL, Title: data.Annotation.Title}})
+		}
+	case "response.completed":
+		cached := data.Response.Usage.InputTokensDetails.CachedTokens
+		usage.InputTokens = data.Response.Usage.InputTokens - cached
+		usage.CacheReadTokens = cached
+		usage.OutputTokens = data.Response.Usage.OutputTokens
+		return errStreamDone
+	case "error", "response.failed":
+		return fmt.Errorf("stream error: %s", data.Message)
+	}
+	return nil
+}
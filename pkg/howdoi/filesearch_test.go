@@ -0,0 +1,56 @@
+package howdoi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCallResponsesAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Metadata map[string]string `json:"metadata"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.URL.Path != "/v1/responses":
+			http.NotFound(w, r)
+		case r.Header.Get("Authorization") != "Bearer gateway-key" || r.Header.Get("X-Gateway") != "1":
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case r.Header.Get("X-Metadata") != `{"project":"p"}` || body.Metadata["project"] != "p":
+			http.Error(w, "no metadata", http.StatusBadRequest)
+		default:
+			io.WriteString(w, "data: {\"type\": \"response.output_text.delta\", \"delta\": \"hi\"}\n\n")
+			io.WriteString(w, "data: {\"type\": \"response.completed\"}\n\n")
+		}
+	}))
+	defer srv.Close()
+
+	req := Request{
+		ModelID:        "gpt",
+		URL:            srv.URL + "/v1/chat/completions",
+		APIKey:         "gateway-key",
+		StoreIDs:       []string{"vs_1"},
+		Vendor:         Vendor{API: "openai", Custom: true},
+		Headers:        map[string]string{"X-Gateway": "1"},
+		Metadata:       map[string]string{"project": "p"},
+		MetadataHeader: "X-Metadata",
+	}
+	respChan, err := (&Client{}).callFileSearchAPI(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text string
+	for d := range respChan {
+		if d.Err != nil {
+			t.Fatal(d.Err)
+		}
+		text += d.Text
+	}
+	if text != "hi" {
+		t.Errorf("got %q, want %q", text, "hi")
+	}
+}
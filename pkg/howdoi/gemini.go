@@ -0,0 +1,364 @@
+package howdoi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// geminiProvider calls Gemini through the genai SDK, or through the REST API
+// when Google's built-in tools are on, which the SDK can't turn on.
+type geminiProvider struct {
+	c *Client
+}
+
+func (p geminiProvider) Stream(ctx context.Context, req Request) (<-chan Delta, error) {
+	messages := slices.Clone(req.Messages)
+	if req.System != "" {
+		// Gemini gets the system prompt at the start of the first message.
+		first := messages[0]
+		first.Content = append([]any{TextContent{Type: "text", Text: req.System + "\n\n"}}, first.Content...)
+		messages[0] = first
+	}
+	if req.CodeExecution || req.GoogleSearch {
+		return p.c.callGeminiBuiltinTools(ctx, req, messages)
+	}
+	return callGeminiAPI(ctx, req, messages)
+}
+
+// genaiClient returns a genai client whose requests go through
+// http.DefaultTransport, with the API key and headers added, like the
+// requests to other providers. Given only an API key, the SDK would make a
+// transport of its own, without the proxy, offline mode, or debug log.
+func genaiClient(ctx context.Context, key string, headers map[string]string) (*genai.Client, error) {
+	if key == "" {
+		return nil, fmt.Errorf("%w: set GEMINI_API_KEY or store a key in the keychain", ErrNoAPIKey)
+	}
+	hc := &http.Client{Transport: genaiTransport{key: key, headers: headers}}
+	// The SDK refuses clients without the key option, which the HTTP client
+	// takes the place of.
+	return genai.NewClient(ctx, option.WithAPIKey(key), option.WithHTTPClient(hc))
+}
+
+// genaiTransport authenticates the requests of the genai SDK.
+type genaiTransport struct {
+	key     string
+	headers map[string]string
+}
+
+func (t genaiTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("x-goog-api-key", t.key)
+	for k, v := range t.headers {
+		r.Header.Set(k, v)
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// toGenaiParts converts message content into Gemini parts.
+func toGenaiParts(content []any) []genai.Part {
+	parts := []genai.Part{}
+	for _, c := range content {
+		switch v := c.(type) {
+		case TextContent:
+			parts = append(parts, genai.Text(v.Text))
+		case ImageContent:
+			parts = append(parts, genai.Blob{MIMEType: v.Source.MediaType, Data: v.Raw})
+		case ToolUseContent:
+			var args map[string]any
+			json.Unmarshal(v.Input, &args)
+			parts = append(parts, genai.FunctionCall{Name: v.Name, Args: args})
+		case ToolResultContent:
+			parts = append(parts, genai.FunctionResponse{Name: v.Name, Response: map[string]any{"output": v.Content}})
+		default:
+			Logf("Unknown content type: %T\n", v)
+		}
+	}
+	return parts
+}
+
+func callGeminiAPI(ctx context.Context, q Request, messages []Message) (chan Delta, error) {
+	model, verbose := q.ModelID, q.Verbose
+	if verbose {
+		Logf("Calling the API ... %s\n", model)
+	}
+	client, err := genaiClient(ctx, APIKey("GEMINI_API_KEY"), q.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	c := client.GenerativeModel(model)
+	c.SetTemperature(q.Temperature)
+	c.SetMaxOutputTokens(int32(q.MaxTokens))
+	if q.JSONMode {
+		c.ResponseMIMEType = "application/json"
+		if q.Schema != nil {
+			c.ResponseSchema = toGenaiSchema(q.Schema)
+		}
+	}
+	if len(q.Tools) > 0 {
+		c.Tools = genaiTools(q.Tools)
+	}
+
+	c.SafetySettings = []*genai.SafetySetting{
+		{
+			Category:  genai.HarmCategoryDangerousContent,
+			Threshold: genai.HarmBlockNone,
+		},
+		{
+			Category:  genai.HarmCategoryHarassment,
+			Threshold: genai.HarmBlockNone,
+		},
+		{
+			Category:  genai.HarmCategoryHateSpeech,
+			Threshold: genai.HarmBlockNone,
+		},
+		{
+			Category:  genai.HarmCategorySexuallyExplicit,
+			Threshold: genai.HarmBlockNone,
+		},
+	}
+
+	// Earlier turns of the conversation go into the chat history.
+	cs := c.StartChat()
+	for _, m := range messages[:len(messages)-1] {
+		role := m.Role
+		if role == "assistant" {
+			role = "model"
+		}
+		cs.History = append(cs.History, &genai.Content{Role: role, Parts: toGenaiParts(m.Content)})
+	}
+	parts := toGenaiParts(messages[len(messages)-1].Content)
+
+	respChan := make(chan Delta)
+	go func() {
+		defer close(respChan)
+		defer client.Close()
+		var usage Usage
+
+		calls := 0
+		iter := cs.SendMessageStream(ctx, parts...)
+		for {
+			resp, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					respChan <- Delta{Err: fmt.Errorf("reading the response: %w", err)}
+				}
+				break
+			}
+			// The usage metadata is cumulative over the stream.
+			if resp.UsageMetadata != nil {
+				usage.InputTokens = int(resp.UsageMetadata.PromptTokenCount)
+				usage.OutputTokens = int(resp.UsageMetadata.CandidatesTokenCount)
+			}
+			for _, cand := range resp.Candidates {
+				if cand.Content != nil {
+					for _, part := range cand.Content.Parts {
+						if fc, ok := part.(genai.FunctionCall); ok {
+							// Gemini sends whole calls without ids.
+							args, _ := json.Marshal(fc.Args)
+							respChan <- Delta{ToolCall: &ToolCallDelta{Index: calls, ID: fmt.Sprintf("call_%d", calls), Name: fc.Name, Arguments: string(args)}}
+							calls++
+							continue
+						}
+						respChan <- Delta{Text: fmt.Sprint(part)}
+					}
+				}
+			}
+		}
+		respChan <- Delta{Usage: &usage}
+	}()
+
+	return respChan, nil
+}
+
+// genaiTools describes the tools as Gemini function declarations.
+func genaiTools(tools []Tool) []*genai.Tool {
+	var decls []*genai.FunctionDeclaration
+	for _, t := range tools {
+		decls = append(decls, &genai.FunctionDeclaration{
+			Name:        t.Name,
+			Description: t.Description,
+			Parameters:  toGenaiSchema(t.Parameters),
+		})
+	}
+	return []*genai.Tool{{FunctionDeclarations: decls}}
+}
+
+// geminiStreamURL is the REST endpoint for Gemini streams. The genai SDK in
+// use predates code execution and Google Search grounding, so requests with
+// those tools are sent here instead.
+const geminiStreamURL = "https://generativelanguage.googleapis.com/v1beta/models/%s:streamGenerateContent?alt=sse"
+
+type geminiBlob struct {
+	MIMEType string `json:"mime_type"`
+	Data     string `json:"data"`
+}
+
+type geminiPart struct {
+	Text       string      `json:"text,omitempty"`
+	InlineData *geminiBlob `json:"inline_data,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// toGeminiParts converts message content into REST parts.
+func toGeminiParts(content []any) []geminiPart {
+	var parts []geminiPart
+	for _, c := range content {
+		switch v := c.(type) {
+		case TextContent:
+			parts = append(parts, geminiPart{Text: v.Text})
+		case ImageContent:
+			parts = append(parts, geminiPart{InlineData: &geminiBlob{MIMEType: v.Source.MediaType, Data: v.Source.Data}})
+		default:
+			Logf("Unknown content type: %T\n", v)
+		}
+	}
+	return parts
+}
+
+// callGeminiBuiltinTools asks Gemini with its code execution and Google
+// Search tools, which Google runs itself. Executed code and its output are
+// streamed as fenced blocks, and the sources of a grounded answer are listed
+// after it.
+func (c *Client) callGeminiBuiltinTools(ctx context.Context, q Request, messages []Message) (chan Delta, error) {
+	var tools []map[string]any
+	if q.CodeExecution {
+		tools = append(tools, map[string]any{"code_execution": map[string]any{}})
+	}
+	if q.GoogleSearch {
+		// Gemini 1.x models only have the older retrieval tool.
+		name := "google_search"
+		if strings.HasPrefix(q.ModelID, "gemini-1.") {
+			name = "google_search_retrieval"
+		}
+		tools = append(tools, map[string]any{name: map[string]any{}})
+	}
+	body := map[string]any{
+		"tools": tools,
+		"generationConfig": map[string]any{
+			"temperature":     q.Temperature,
+			"maxOutputTokens": q.MaxTokens,
+		},
+	}
+	var safety []map[string]string
+	for _, category := range []string{"HARM_CATEGORY_DANGEROUS_CONTENT", "HARM_CATEGORY_HARASSMENT", "HARM_CATEGORY_HATE_SPEECH", "HARM_CATEGORY_SEXUALLY_EXPLICIT"} {
+		safety = append(safety, map[string]string{"category": category, "threshold": "BLOCK_NONE"})
+	}
+	body["safetySettings"] = safety
+	var contents []geminiContent
+	for _, m := range messages {
+		role := m.Role
+		if role == "assistant" {
+			role = "model"
+		}
+		contents = append(contents, geminiContent{Role: role, Parts: toGeminiParts(m.Content)})
+	}
+	body["contents"] = contents
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling the request body: %w", err)
+	}
+	r, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf(geminiStreamURL, q.ModelID), bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("creating the request: %w", err)
+	}
+	r.Header.Set("content-type", "application/json")
+	r.Header.Set("x-goog-api-key", APIKey("GEMINI_API_KEY"))
+	for k, v := range q.Headers {
+		r.Header.Set(k, v)
+	}
+	return c.callAPI(q.ModelID, handleGeminiEvent, r, q.Verbose)
+}
+
+// handleGeminiEvent handles the chunks of a Gemini REST stream. Code the
+// model ran and its output are emitted as fenced blocks, and the sources of
+// a grounded answer, which come with the last chunk, as a list after it.
+func handleGeminiEvent(ev sseEvent, usage *Usage, emit func(Delta)) error {
+	var data struct {
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					Text           string `json:"text"`
+					ExecutableCode *struct {
+						Language string `json:"language"`
+						Code     string `json:"code"`
+					} `json:"executableCode"`
+					CodeExecutionResult *struct {
+						Outcome string `json:"outcome"`
+						Output  string `json:"output"`
+					} `json:"codeExecutionResult"`
+				} `json:"parts"`
+			} `json:"content"`
+			FinishReason      string `json:"finishReason"`
+			GroundingMetadata struct {
+				GroundingChunks []struct {
+					Web struct {
+						URI   string `json:"uri"`
+						Title string `json:"title"`
+					} `json:"web"`
+				} `json:"groundingChunks"`
+			} `json:"groundingMetadata"`
+		} `json:"candidates"`
+		// The usage metadata is cumulative over the stream.
+		UsageMetadata *struct {
+			PromptTokenCount     int `json:"promptTokenCount"`
+			CandidatesTokenCount int `json:"candidatesTokenCount"`
+		} `json:"usageMetadata"`
+		Error *struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(ev.Data), &data); err != nil {
+		return fmt.Errorf("decoding stream event: %w", err)
+	}
+	if data.Error != nil {
+		return fmt.Errorf("stream error: %s: %s", data.Error.Status, data.Error.Message)
+	}
+	if data.UsageMetadata != nil {
+		usage.InputTokens = data.UsageMetadata.PromptTokenCount
+		usage.OutputTokens = data.UsageMetadata.CandidatesTokenCount
+	}
+	for _, c := range data.Candidates {
+		for _, p := range c.Content.Parts {
+			switch {
+			case p.ExecutableCode != nil:
+				emit(Delta{Text: fmt.Sprintf("\n```%s\n%s\n```\n", strings.ToLower(p.ExecutableCode.Language), strings.TrimRight(p.ExecutableCode.Code, "\n"))})
+			case p.CodeExecutionResult != nil:
+				r := p.CodeExecutionResult
+				if r.Outcome != "OUTCOME_OK" {
+					emit(Delta{Text: fmt.Sprintf("\nThe code failed (%s):\n", r.Outcome)})
+				}
+				emit(Delta{Text: fmt.Sprintf("\n```output\n%s\n```\n\n", strings.TrimRight(r.Output, "\n"))})
+			case p.Text != "":
+				emit(Delta{Text: p.Text})
+			}
+		}
+		if chunks := c.GroundingMetadata.GroundingChunks; c.FinishReason != "" && len(chunks) > 0 {
+			var b strings.Builder
+			b.WriteString("\n\nSources:\n")
+			for i, g := range chunks {
+				fmt.Fprintf(&b, "%d. [%s](%s)\n", i+1, g.Web.Title, g.Web.URI)
+			}
+			emit(Delta{Text: b.String()})
+		}
+	}
+	return nil
+}
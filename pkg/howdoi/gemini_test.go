@@ -0,0 +1,106 @@
+package howdoi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandleGeminiEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   []Delta
+		usage  Usage
+		err    string
+	}{
+		{
+			name: "text and cumulative usage",
+			events: []string{
+				`{"candidates":[{"content":{"parts":[{"text":"Hello"}]}}],"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":1}}`,
+				`{"candidates":[{"content":{"parts":[{"text":" world"}]}}],"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":3}}`,
+			},
+			want:  []Delta{{Text: "Hello"}, {Text: " world"}},
+			usage: Usage{InputTokens: 8, OutputTokens: 3},
+		},
+		{
+			name: "code execution",
+			events: []string{
+				`{"candidates":[{"content":{"parts":[{"executableCode":{"language":"PYTHON","code":"print(1)\n"}},{"codeExecutionResult":{"outcome":"OUTCOME_OK","output":"1\n"}}]}}]}`,
+			},
+			want: []Delta{{Text: "\n```python\nprint(1)\n```\n"}, {Text: "\n```output\n1\n```\n\n"}},
+		},
+		{
+			name: "failed code",
+			events: []string{
+				`{"candidates":[{"content":{"parts":[{"codeExecutionResult":{"outcome":"OUTCOME_FAILED","output":"boom"}}]}}]}`,
+			},
+			want: []Delta{{Text: "\nThe code failed (OUTCOME_FAILED):\n"}, {Text: "\n```output\nboom\n```\n\n"}},
+		},
+		{
+			name: "grounding sources after the last chunk",
+			events: []string{
+				`{"candidates":[{"content":{"parts":[{"text":"Go 1.22"}]},"groundingMetadata":{"groundingChunks":[{"web":{"uri":"https://go.dev","title":"go.dev"}}]}}]}`,
+				`{"candidates":[{"content":{"parts":[{"text":"."}]},"finishReason":"STOP","groundingMetadata":{"groundingChunks":[{"web":{"uri":"https://go.dev","title":"go.dev"}}]}}]}`,
+			},
+			want: []Delta{{Text: "Go 1.22"}, {Text: "."}, {Text: "\n\nSources:\n1. [go.dev](https://go.dev)\n"}},
+		},
+		{
+			name:   "error",
+			events: []string{`{"error":{"status":"RESOURCE_EXHAUSTED","message":"quota"}}`},
+			err:    "stream error: RESOURCE_EXHAUSTED: quota",
+		},
+		{
+			name:   "bad JSON",
+			events: []string{`[`},
+			err:    "decoding stream event",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, usage, err := handleEvents(handleGeminiEvent, tt.events...)
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if usage != tt.usage {
+				t.Errorf("got usage %+v, want %+v", usage, tt.usage)
+			}
+		})
+	}
+}
+
+// roundTripFunc is an http.RoundTripper for tests.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestGenaiTransport(t *testing.T) {
+	saved := http.DefaultTransport
+	defer func() { http.DefaultTransport = saved }()
+	var got http.Header
+	http.DefaultTransport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		got = r.Header
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: r}, nil
+	})
+
+	tr := genaiTransport{key: "secret", headers: map[string]string{"x-gateway": "team"}}
+	r, _ := http.NewRequest("POST", "https://generativelanguage.googleapis.com/v1beta/models", nil)
+	if _, err := tr.RoundTrip(r); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("x-goog-api-key") != "secret" || got.Get("x-gateway") != "team" {
+		t.Errorf("the request went out with the headers %v", got)
+	}
+	if r.Header.Get("x-goog-api-key") != "" {
+		t.Error("the caller's request was changed")
+	}
+	if _, err := genaiClient(context.Background(), "", nil); !errors.Is(err, ErrNoAPIKey) {
+		t.Errorf("got %v without a key, want ErrNoAPIKey", err)
+	}
+}
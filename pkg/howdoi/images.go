@@ -0,0 +1,293 @@
+package howdoi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageConfig is how images are prepared before they are sent.
+type ImageConfig struct {
+	// MaxDimension is the longest side images are scaled down to. Providers
+	// scale larger images down themselves, after charging for the upload
+	// and its tokens. 0 sends images at their size.
+	MaxDimension int
+	// Quality is the JPEG quality of re-encoded images, from 1 to 100.
+	Quality int
+}
+
+// Images is used for every image attached. 1568 pixels is the size Anthropic
+// scales images down to, and within what OpenAI and Gemini use.
+var Images = ImageConfig{MaxDimension: 1568, Quality: 85}
+
+// maxImageBytes is the largest image every provider accepts: Anthropic's
+// limit. Larger images are re-encoded, and scaled down until they fit.
+const maxImageBytes = 5 << 20
+
+// sentImageFormats are the formats all providers take.
+var sentImageFormats = map[string]bool{"jpeg": true, "png": true, "gif": true, "webp": true}
+
+// convertedImageExts are formats Go can't decode, converted with an external
+// tool.
+var convertedImageExts = map[string]bool{".heic": true, ".heif": true, ".avif": true}
+
+// PrepareImage returns an image in a format every provider takes, scaled
+// down to Images.MaxDimension and under maxImageBytes, with its extension.
+// Images that already are are returned as they are. file is used to convert
+// formats Go can't decode, and may be "" for images that are not files.
+//
+// Images that are converted or re-encoded are cached with the rendered PDF
+// pages, by the hash of the image and the Images settings, so attaching the
+// same image again does not decode and encode it again.
+func PrepareImage(file, ext string, data []byte) (string, []byte, error) {
+	if asIs, ok := imageAsIs(ext, data); ok {
+		return asIs, data, nil
+	}
+	sum := sha256.Sum256(data)
+	name := fmt.Sprintf("image-%d-%d", Images.MaxDimension, Images.Quality)
+	var prepared string
+	out, err := pageCached(hex.EncodeToString(sum[:]), name, func() ([]byte, error) {
+		var b []byte
+		var err error
+		prepared, b, err = prepareImage(file, ext, data)
+		return b, err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if prepared == "" {
+		// Read from the cache. Images are cached as PNG or JPEG, the
+		// format of converted images, which Go may not decode.
+		prepared = ".jpeg"
+		if _, format, err := image.DecodeConfig(bytes.NewReader(out)); err == nil {
+			prepared = "." + format
+		}
+	}
+	return prepared, out, nil
+}
+
+// imageAsIs returns the extension an image is sent with when it is sent as
+// it is: in a format every provider takes, small enough, and upright, or in
+// a format Go can't read, which the provider judges.
+func imageAsIs(ext string, data []byte) (string, bool) {
+	if convertedImageExts[strings.ToLower(ext)] {
+		return "", false
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ext, true
+	}
+	tooBig := Images.MaxDimension > 0 && max(cfg.Width, cfg.Height) > Images.MaxDimension
+	orientation := 1
+	if format == "jpeg" {
+		orientation = exifOrientation(data)
+	}
+	if sentImageFormats[format] && !tooBig && len(data) <= maxImageBytes && orientation == 1 {
+		return "." + format, true
+	}
+	return "", false
+}
+
+// prepareImage converts, scales, rotates, and re-encodes an image for
+// PrepareImage.
+func prepareImage(file, ext string, data []byte) (string, []byte, error) {
+	if convertedImageExts[strings.ToLower(ext)] {
+		converted, err := convertImage(file)
+		if err != nil {
+			return "", nil, err
+		}
+		ext, data = ".jpeg", converted
+		if asIs, ok := imageAsIs(ext, data); ok {
+			return asIs, data, nil
+		}
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, fmt.Errorf("decoding the image: %w", err)
+	}
+	longest := max(cfg.Width, cfg.Height)
+	tooBig := Images.MaxDimension > 0 && longest > Images.MaxDimension
+	orientation := 1
+	if format == "jpeg" {
+		orientation = exifOrientation(data)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, fmt.Errorf("decoding the image: %w", err)
+	}
+	size := longest
+	if tooBig {
+		size = Images.MaxDimension
+	}
+	// Lossless sources stay PNG, which keeps text in screenshots sharp,
+	// unless it is too large. Animated GIFs keep their first frame.
+	lossless := format != "jpeg" && format != "webp"
+	for {
+		scaled := orient(scaleImage(img, size), orientation)
+		var buf bytes.Buffer
+		if lossless {
+			if err := png.Encode(&buf, scaled); err != nil {
+				return "", nil, err
+			}
+			if buf.Len() <= maxImageBytes {
+				return ".png", buf.Bytes(), nil
+			}
+			buf.Reset()
+		}
+		if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: Images.Quality}); err != nil {
+			return "", nil, err
+		}
+		if buf.Len() <= maxImageBytes || size <= 256 {
+			return ".jpeg", buf.Bytes(), nil
+		}
+		size = size * 3 / 4
+	}
+}
+
+// scaleImage scales an image down so its longest side is size pixels.
+func scaleImage(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if max(w, h) <= size {
+		return img
+	}
+	if w >= h {
+		w, h = size, max(h*size/w, 1)
+	} else {
+		w, h = max(w*size/h, 1), size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// exifOrientation returns the EXIF orientation of a JPEG, from 1 to 8, or 1
+// when it has none. Phones store photos as shot and tag how to turn them.
+func exifOrientation(data []byte) int {
+	// Walk the JPEG segments up to the APP1 holding the EXIF data.
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || i+2+n > len(data) {
+			break
+		}
+		seg := data[i+4 : i+2+n]
+		i += 2 + n
+		if marker != 0xE1 || !bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			continue
+		}
+		tiff := seg[6:]
+		if len(tiff) < 8 {
+			return 1
+		}
+		var order binary.ByteOrder = binary.BigEndian
+		if string(tiff[:2]) == "II" {
+			order = binary.LittleEndian
+		}
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return 1
+		}
+		count := int(order.Uint16(tiff[ifd:]))
+		for e := 0; e < count; e++ {
+			entry := ifd + 2 + e*12
+			if entry+12 > len(tiff) {
+				return 1
+			}
+			if order.Uint16(tiff[entry:]) == 0x0112 {
+				if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+					return o
+				}
+				return 1
+			}
+		}
+		return 1
+	}
+	return 1
+}
+
+// orient turns an image upright according to its EXIF orientation.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// Orientations 5 to 8 swap the sides.
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// convertImage converts an image Go can't decode, like a HEIC photo, to JPEG
+// with the first of sips (macOS), heif-convert (libheif), or ImageMagick
+// found.
+func convertImage(file string) ([]byte, error) {
+	if file == "" {
+		return nil, errors.New("only image files can be converted")
+	}
+	dir, err := os.MkdirTemp("", "howdoi-image-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "image.jpg")
+	tools := [][]string{
+		{"sips", "-s", "format", "jpeg", file, "--out", out},
+		{"heif-convert", file, out},
+		{"magick", file, out},
+		{"convert", file, out},
+	}
+	for _, t := range tools {
+		if _, err := exec.LookPath(t[0]); err != nil {
+			continue
+		}
+		if b, err := exec.Command(t[0], t[1:]...).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("converting %s with %s: %v: %s", file, t[0], err, strings.TrimSpace(string(b)))
+		}
+		return os.ReadFile(out)
+	}
+	return nil, fmt.Errorf("converting %s needs sips, heif-convert, or ImageMagick", filepath.Base(file))
+}
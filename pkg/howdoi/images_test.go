@@ -0,0 +1,66 @@
+package howdoi
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrepareImageCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	saved := Images
+	defer func() { Images = saved }()
+	Images = ImageConfig{MaxDimension: 100, Quality: 85}
+
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for x := range 400 {
+		img.Set(x, x%200, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	ext, first, err := PrepareImage("", ".png", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(first))
+	if ext != ".png" || err != nil || cfg.Width != 100 || cfg.Height != 50 {
+		t.Fatalf("got %s %dx%d, %v, want .png 100x50", ext, cfg.Width, cfg.Height, err)
+	}
+	cached, _ := filepath.Glob(filepath.Join(pageCacheDir(), "*-image-100-85"))
+	if len(cached) != 1 {
+		t.Fatalf("got cached files %q, want one", cached)
+	}
+
+	// A changed cache entry shows the second call read it.
+	if err := os.WriteFile(cached[0], first[:len(first)-1], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ext, again, err := PrepareImage("", ".png", data); err != nil || ext != ".png" || len(again) != len(first)-1 {
+		t.Errorf("got %s with %d bytes, %v, want the cached %d bytes", ext, len(again), err, len(first)-1)
+	}
+
+	// Other settings are another entry.
+	Images.MaxDimension = 50
+	if _, b, err := PrepareImage("", ".png", data); err != nil {
+		t.Fatal(err)
+	} else if cfg, _, _ := image.DecodeConfig(bytes.NewReader(b)); cfg.Width != 50 {
+		t.Errorf("got width %d, want 50", cfg.Width)
+	}
+
+	// Images sent as they are are not cached.
+	Images.MaxDimension = 1000
+	if _, b, err := PrepareImage("", ".png", data); err != nil || !bytes.Equal(b, data) {
+		t.Errorf("an image that fits was changed: %v", err)
+	}
+	if n, err := ClearPageCache(); err != nil || n != 2 {
+		t.Errorf("cleared %d files, %v, want 2", n, err)
+	}
+}
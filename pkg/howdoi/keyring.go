@@ -0,0 +1,86 @@
+package howdoi
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+// KeyringService is the service API keys are stored under in the OS keychain.
+// Each key's account is the environment variable it stands in for.
+const KeyringService = "howdoi"
+
+var (
+	keyringMu   sync.Mutex
+	keyringKeys = map[string]string{}
+)
+
+// APIKey returns the key stored in the keychain for the environment variable
+// env, or else the variable's value. Keychain lookups are cached, and a
+// missing or locked keychain falls back to the environment.
+func APIKey(env string) string {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	key, ok := keyringKeys[env]
+	if !ok {
+		key, _ = keyring.Get(KeyringService, env)
+		keyringKeys[env] = key
+	}
+	if key != "" {
+		return key
+	}
+	return os.Getenv(env)
+}
+
+// KeyEnv returns the environment variable with the API key of a provider.
+func KeyEnv(provider string) (string, error) {
+	v, ok := vendors[provider]
+	if !ok || v.KeyEnv == "" {
+		return "", fmt.Errorf("unknown provider %q", provider)
+	}
+	return v.KeyEnv, nil
+}
+
+// Providers returns the names of the known providers.
+func Providers() []string {
+	names := make([]string, 0, len(vendors))
+	for name := range vendors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetStoredKey stores the API key of the environment variable env in the
+// keychain.
+func SetStoredKey(env, key string) error {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	if err := keyring.Set(KeyringService, env, key); err != nil {
+		return err
+	}
+	keyringKeys[env] = key
+	return nil
+}
+
+// DeleteStoredKey removes the API key of the environment variable env from
+// the keychain.
+func DeleteStoredKey(env string) error {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	delete(keyringKeys, env)
+	return keyring.Delete(KeyringService, env)
+}
+
+// StoredKey reports whether the keychain has a key for the environment
+// variable env.
+func StoredKey(env string) (bool, error) {
+	_, err := keyring.Get(KeyringService, env)
+	if err == keyring.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
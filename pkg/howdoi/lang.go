@@ -0,0 +1,173 @@
+package howdoi
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// languageByExt maps file extensions to markdown fence language tags.
+var languageByExt = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".jsx":   "jsx",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".rs":    "rust",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".java":  "java",
+	".kt":    "kotlin",
+	".swift": "swift",
+	".rb":    "ruby",
+	".php":   "php",
+	".cs":    "csharp",
+	".scala": "scala",
+	".jl":    "julia",
+	".lua":   "lua",
+	".r":     "r",
+	".sh":    "bash",
+	".bash":  "bash",
+	".zsh":   "zsh",
+	".fish":  "fish",
+	".ps1":   "powershell",
+	".sql":   "sql",
+	".html":  "html",
+	".htm":   "html",
+	".css":   "css",
+	".scss":  "scss",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".xml":   "xml",
+	".md":    "markdown",
+	".proto": "protobuf",
+	".tf":    "hcl",
+	".zig":   "zig",
+	".ex":    "elixir",
+	".exs":   "elixir",
+	".erl":   "erlang",
+	".hs":    "haskell",
+	".ml":    "ocaml",
+	".clj":   "clojure",
+	".vim":   "vim",
+	".diff":  "diff",
+	".patch": "diff",
+}
+
+// languageByName maps well known extension-less file names to languages.
+var languageByName = map[string]string{
+	"makefile":    "makefile",
+	"gnumakefile": "makefile",
+	"dockerfile":  "dockerfile",
+	"justfile":    "just",
+	"gemfile":     "ruby",
+	"rakefile":    "ruby",
+	"go.mod":      "go",
+	"cmakelists":  "cmake",
+}
+
+// languageByInterpreter maps shebang interpreters to languages.
+var languageByInterpreter = map[string]string{
+	"sh":      "bash",
+	"bash":    "bash",
+	"zsh":     "zsh",
+	"fish":    "fish",
+	"python":  "python",
+	"python3": "python",
+	"node":    "javascript",
+	"deno":    "typescript",
+	"ruby":    "ruby",
+	"perl":    "perl",
+	"php":     "php",
+	"lua":     "lua",
+	"julia":   "julia",
+	"Rscript": "r",
+}
+
+// languagePatterns are content heuristics tried in order when neither the
+// file name nor a shebang identifies the language.
+var languagePatterns = []struct {
+	lang string
+	re   *regexp.Regexp
+}{
+	{"diff", regexp.MustCompile(`(?m)^(diff --git |--- a/.*\n\+\+\+ b/)`)},
+	{"go", regexp.MustCompile(`(?m)^package \w+\s*$[\s\S]*^func `)},
+	{"rust", regexp.MustCompile(`(?m)^\s*(pub )?fn \w+.*->|^use \w+::`)},
+	{"python", regexp.MustCompile(`(?m)^(def \w+\(.*\):|from [\w.]+ import |import \w+$|class \w+(\(.*\))?:)`)},
+	{"javascript", regexp.MustCompile(`(?m)(^const \w+ = require\(|^import .* from ['"]|^export (default |const |function ))`)},
+	{"c", regexp.MustCompile(`(?m)^#include [<"]`)},
+	{"html", regexp.MustCompile(`(?i)^\s*<(!doctype html|html)`)},
+	{"json", regexp.MustCompile(`^\s*[{\[]\s*"`)},
+	{"sql", regexp.MustCompile(`(?im)^\s*(select .* from |create table |insert into )`)},
+}
+
+// DetectLanguage guesses the programming language of a file from its name,
+// shebang line, or content. It returns "" when the language is unknown.
+func DetectLanguage(file, content string) string {
+	base := strings.ToLower(filepath.Base(file))
+	if lang, ok := languageByExt[filepath.Ext(base)]; ok {
+		return lang
+	}
+	if lang, ok := languageByName[strings.TrimSuffix(base, ".txt")]; ok {
+		return lang
+	}
+
+	if strings.HasPrefix(content, "#!") {
+		line, _, _ := strings.Cut(content, "\n")
+		fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+		if len(fields) > 0 {
+			interp := filepath.Base(fields[0])
+			if interp == "env" {
+				for _, f := range fields[1:] {
+					if !strings.HasPrefix(f, "-") {
+						interp = f
+						break
+					}
+				}
+			}
+			if lang, ok := languageByInterpreter[interp]; ok {
+				return lang
+			}
+		}
+	}
+
+	// Only look at the start of large files.
+	if len(content) > 4096 {
+		content = content[:4096]
+	}
+	for _, p := range languagePatterns {
+		if p.re.MatchString(content) {
+			return p.lang
+		}
+	}
+	return ""
+}
+
+// NormalizeLanguage maps fence tags such as "py" or "sh" to the language
+// names used by DetectLanguage.
+func NormalizeLanguage(tag string) string {
+	tag = strings.ToLower(tag)
+	if lang, ok := languageByExt["."+tag]; ok {
+		return lang
+	}
+	if lang, ok := languageByInterpreter[tag]; ok {
+		return lang
+	}
+	switch tag {
+	case "golang":
+		return "go"
+	case "shell", "console", "shellsession":
+		return "bash"
+	case "c++":
+		return "cpp"
+	}
+	return tag
+}
@@ -0,0 +1,102 @@
+package howdoi
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultMaxLinks is the most linked pages loaded for a URL with
+// LoadOptions.Depth when LoadOptions.MaxLinks is 0.
+const DefaultMaxLinks = 10
+
+var markdownLinkRe = regexp.MustCompile(`\]\((https?://[^)\s]+)\)`)
+
+// pageExts are the extensions of links that are taken for web pages, besides
+// links with none.
+var pageExts = map[string]bool{".html": true, ".htm": true, ".xhtml": true, ".php": true, ".asp": true, ".aspx": true, ".md": true}
+
+// sameSite reports whether two hosts are the same site, with or without www.
+func sameSite(a, b string) bool {
+	return strings.TrimPrefix(strings.ToLower(a), "www.") == strings.TrimPrefix(strings.ToLower(b), "www.")
+}
+
+// pageLinks returns the links of a page's markdown to other pages of its
+// site, in order, without fragments or duplicates.
+func pageLinks(content string, page *url.URL) []string {
+	var links []string
+	seen := map[string]bool{}
+	for _, m := range markdownLinkRe.FindAllStringSubmatch(content, -1) {
+		u, err := url.Parse(m[1])
+		if err != nil || !sameSite(u.Host, page.Host) {
+			continue
+		}
+		if ext := strings.ToLower(path.Ext(u.Path)); ext != "" && !pageExts[ext] {
+			continue
+		}
+		u.Fragment, u.RawFragment = "", ""
+		link := u.String()
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// loadLinkedPages loads the pages of the same site linked from a page, and
+// the pages linked from those, opts.Depth links away, as a document each.
+// Pages are loaded closest first, up to opts.MaxLinks of them, counting
+// those that fail to load, which are skipped.
+func loadLinkedPages(ctx context.Context, rawURL, content string, opts LoadOptions) []any {
+	maxLinks := opts.MaxLinks
+	if maxLinks <= 0 {
+		maxLinks = DefaultMaxLinks
+	}
+	type page struct {
+		url, content string
+	}
+	seen := map[string]bool{strings.SplitN(rawURL, "#", 2)[0]: true}
+	level := []page{{rawURL, content}}
+	var parts []any
+	followed := 0
+	for depth := 0; depth < opts.Depth && len(level) > 0; depth++ {
+		var next []page
+		for _, p := range level {
+			u, err := url.Parse(p.url)
+			if err != nil {
+				continue
+			}
+			for _, link := range pageLinks(p.content, u) {
+				if seen[link] {
+					continue
+				}
+				if followed == maxLinks {
+					Logf("Followed %d links from %s, the most allowed\n", maxLinks, rawURL)
+					return parts
+				}
+				seen[link] = true
+				followed++
+				linked, source, err := fetchURL(ctx, link, opts)
+				if err != nil {
+					Logf("Error following %s: %v\n", link, err)
+					continue
+				}
+				next = append(next, page{link, linked})
+				if clipped := clipByRelevance(linked, opts.Question, opts.MaxPageTokens, opts.Embeddings); len(clipped) < len(linked) {
+					linked = clipped
+				}
+				doc, err := RenderDocument(Document{Source: source, Content: linked})
+				if err != nil {
+					Logf("Error following %s: %v\n", link, err)
+					continue
+				}
+				parts = append(parts, doc)
+			}
+		}
+		level = next
+	}
+	return parts
+}
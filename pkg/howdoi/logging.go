@@ -0,0 +1,11 @@
+package howdoi
+
+// Logf receives what the library reports as it works: the pages it loads,
+// retried API calls, and warnings that don't stop a request. It discards
+// them unless the caller sets it, e.g. to log.Printf.
+var Logf = func(format string, args ...any) {}
+
+// Progress, when set, is called about ten times a second while a long job
+// runs, such as extracting the text of a large PDF, with the units of work
+// done of the total, and once more with finished set when the job ends.
+var Progress func(task string, done, total int, finished bool)
@@ -0,0 +1,215 @@
+package howdoi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var Models = map[string]string{
+	"sonnet": "claude-3-5-sonnet-20240620",
+	"mini":   "gpt-4o-mini",
+	"o1":     "o1-mini",
+	"o1pro":  "o1-preview",
+	"flash":  "gemini-1.5-flash-latest",
+	"pro":    "gemini-1.5-pro-latest",
+
+	"mistral-large": "mistral-large-latest",
+	"codestral":     "codestral-latest",
+	"deepseek-chat": "deepseek-chat",
+
+	// Groq serves the small Llama and Mixtral models fastest, so their
+	// plain aliases go there.
+	"llama":    "llama-3.3-70b-versatile",
+	"llama-8b": "llama-3.1-8b-instant",
+	"mixtral":  "mixtral-8x7b-32768",
+
+	"llama-405b":       "meta-llama/Meta-Llama-3.1-405B-Instruct-Turbo",
+	"together-llama":   "meta-llama/Llama-3.3-70B-Instruct-Turbo",
+	"together-mixtral": "mistralai/Mixtral-8x7B-Instruct-v0.1",
+}
+
+var modelToProvider = map[string]string{
+	"sonnet": "anthropic",
+	"mini":   "openai",
+	"o1":     "openai",
+	"o1p":    "openai",
+	"flash":  "google",
+	"pro":    "google",
+
+	"mistral-large": "mistral",
+	"codestral":     "mistral",
+	"deepseek-chat": "deepseek",
+
+	"llama":    "groq",
+	"llama-8b": "groq",
+	"mixtral":  "groq",
+
+	"llama-405b":       "together",
+	"together-llama":   "together",
+	"together-mixtral": "together",
+}
+
+// ModelProvider returns the provider an alias is sent to, like anthropic or
+// groq, or "" for unknown aliases.
+func ModelProvider(alias string) string {
+	return modelToProvider[alias]
+}
+
+// Vendor describes a model provider. API is the wire format it speaks, so an
+// OpenAI-compatible provider only needs an entry in vendors, its models in
+// Models and modelToProvider, and its prices in modelCosts.
+type Vendor struct {
+	API    string
+	URL    string
+	KeyEnv string
+	// NoStreamOptions is set for APIs that reject stream_options. They send
+	// the usage in the last chunk anyway.
+	NoStreamOptions bool
+	// JSONObjectOnly is set for APIs with a JSON mode but without
+	// structured outputs, so schemas are only checked locally.
+	JSONObjectOnly bool
+	// Custom is set for servers given by a base URL, which may be gateways
+	// that accept request metadata.
+	Custom bool
+	// EmbeddingModel is the vendor's model for its embeddings endpoint, next
+	// to its chat completions one, when it has one.
+	EmbeddingModel string
+}
+
+// Embeddings returns the embeddings API of the vendor, if it has one.
+func (v Vendor) Embeddings() (Embeddings, bool) {
+	if v.EmbeddingModel == "" {
+		return Embeddings{}, false
+	}
+	return Embeddings{URL: strings.TrimSuffix(v.URL, "/chat/completions") + "/embeddings", Model: v.EmbeddingModel, KeyEnv: v.KeyEnv}, true
+}
+
+var vendors = map[string]Vendor{
+	"openai":    {API: "openai", URL: "https://api.openai.com/v1/chat/completions", KeyEnv: "OPENAI_API_KEY", EmbeddingModel: OpenAIEmbeddings.Model},
+	"anthropic": {API: "anthropic", URL: "https://api.anthropic.com/v1/messages", KeyEnv: "ANTHROPIC_API_KEY"},
+	"google":    {API: "google", KeyEnv: "GEMINI_API_KEY"},
+	"mistral":   {API: "openai", URL: "https://api.mistral.ai/v1/chat/completions", KeyEnv: "MISTRAL_API_KEY", NoStreamOptions: true, EmbeddingModel: "mistral-embed"},
+	"deepseek":  {API: "openai", URL: "https://api.deepseek.com/chat/completions", KeyEnv: "DEEPSEEK_API_KEY", JSONObjectOnly: true},
+	"groq":      {API: "openai", URL: "https://api.groq.com/openai/v1/chat/completions", KeyEnv: "GROQ_API_KEY", JSONObjectOnly: true},
+	"together":  {API: "openai", URL: "https://api.together.xyz/v1/chat/completions", KeyEnv: "TOGETHER_API_KEY", NoStreamOptions: true, JSONObjectOnly: true},
+}
+
+// ModelDef defines a model alias at runtime, e.g. from the config file.
+type ModelDef struct {
+	ID       string
+	Provider string
+	// Cost is per token. A zero Cost keeps the known prices of the ID.
+	Cost Cost
+	// Capabilities keep the known capabilities of the ID when nil.
+	Capabilities *Capabilities
+}
+
+// RegisterModel adds or replaces a model alias. The provider must be built
+// in or added with RegisterVendor first.
+func RegisterModel(alias string, d ModelDef) error {
+	if d.ID == "" {
+		return fmt.Errorf("model %q has no id", alias)
+	}
+	if _, ok := vendors[d.Provider]; !ok {
+		return fmt.Errorf("unknown provider %q for model %q", d.Provider, alias)
+	}
+	Models[alias] = d.ID
+	modelToProvider[alias] = d.Provider
+	if d.Cost != (Cost{}) {
+		modelCosts[d.ID] = d.Cost
+	}
+	if d.Capabilities != nil {
+		ModelCapabilities[d.ID] = *d.Capabilities
+	}
+	return nil
+}
+
+// RegisterVendor adds or replaces a provider that speaks one of the
+// supported APIs.
+func RegisterVendor(name string, v Vendor) error {
+	switch v.API {
+	case "openai", "anthropic":
+		if v.URL == "" {
+			return fmt.Errorf("provider %q has no url", name)
+		}
+	case "google":
+	default:
+		return fmt.Errorf("provider %q has an unknown api %q", name, v.API)
+	}
+	vendors[name] = v
+	return nil
+}
+
+// ErrUnsupportedModel is returned for an unknown alias without a base URL or
+// model ID to fall back on.
+var ErrUnsupportedModel = errors.New("unsupported model")
+
+// ErrNoAPIKey is returned when the provider's API key is neither in the
+// keychain nor in its environment variable.
+var ErrNoAPIKey = errors.New("no API key")
+
+// ResolvedModel is a model with the endpoint and key used to call it.
+type ResolvedModel struct {
+	ModelID string
+	// Provider is the API the model is called with.
+	Provider string
+	Vendor   Vendor
+	URL      string
+	APIKey   string
+}
+
+// ResolveModel looks up a model alias. Unknown aliases are accepted as raw
+// model IDs when an OpenAI-compatible base URL or model ID is given.
+func ResolveModel(model, baseURL, modelID, apiKeyEnv string) (ResolvedModel, error) {
+	var m ResolvedModel
+	id, ok := Models[model]
+	if !ok && baseURL == "" && modelID == "" {
+		return m, fmt.Errorf("%w %q", ErrUnsupportedModel, model)
+	}
+	vendor := modelToProvider[model]
+	if !ok {
+		// Unknown aliases are raw model IDs on an OpenAI-compatible server.
+		id, vendor = model, "openai"
+	}
+	if modelID != "" {
+		id = modelID
+	}
+
+	v, ok := vendors[vendor]
+	if !ok {
+		return m, fmt.Errorf("unsupported provider for model %q", model)
+	}
+	if baseURL != "" {
+		v = Vendor{API: "openai", URL: strings.TrimSuffix(baseURL, "/") + "/chat/completions", KeyEnv: "OPENAI_API_KEY", Custom: true}
+	}
+	if apiKeyEnv != "" {
+		v.KeyEnv = apiKeyEnv
+	}
+	m = ResolvedModel{ModelID: id, Provider: v.API, Vendor: v, URL: v.URL, APIKey: APIKey(v.KeyEnv)}
+
+	// Self-hosted servers usually do not need a key.
+	if m.APIKey == "" && baseURL == "" {
+		return m, fmt.Errorf("%w: set %s or store a key in the keychain", ErrNoAPIKey, v.KeyEnv)
+	}
+	return m, nil
+}
+
+// AnthropicBetas are the short names of Anthropic beta features.
+// token-efficient-tools cuts the output tokens of tool calls, and
+// fine-grained-tool-streaming streams tool inputs without buffering them
+// until each value is complete.
+var AnthropicBetas = map[string]string{
+	"token-efficient-tools":       "token-efficient-tools-2025-02-19",
+	"fine-grained-tool-streaming": "fine-grained-tool-streaming-2025-05-14",
+	"interleaved-thinking":        "interleaved-thinking-2025-05-14",
+}
+
+// AnthropicBeta returns the dated name of a beta feature. Names that are not
+// in AnthropicBetas are returned as they are, so any beta can be used.
+func AnthropicBeta(name string) string {
+	if full, ok := AnthropicBetas[name]; ok {
+		return full
+	}
+	return name
+}
@@ -0,0 +1,68 @@
+package howdoi
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// minOCRTextLength is the amount of extracted text below which a PDF page is
+// taken for a scan and read with OCR.
+const minOCRTextLength = 20
+
+// ocrRenderWidth is the width pages are rendered at for OCR, about 300 DPI
+// for A4 and Letter pages, the resolution Tesseract reads best.
+const ocrRenderWidth = 2500
+
+// OCRLanguages are the Tesseract languages scans are read in, like
+// "eng+deu". Tesseract's default is used when it is empty.
+var OCRLanguages string
+
+var tesseractPath = sync.OnceValue(func() string {
+	p, _ := exec.LookPath("tesseract")
+	return p
+})
+
+// HasOCR reports whether Tesseract is installed to read scans.
+func HasOCR() bool {
+	return tesseractPath() != ""
+}
+
+// OCRImage returns the text Tesseract reads in an image.
+func OCRImage(img []byte) (string, error) {
+	args := []string{"stdin", "stdout"}
+	if OCRLanguages != "" {
+		args = append(args, "-l", OCRLanguages)
+	}
+	cmd := exec.Command(tesseractPath(), args...)
+	cmd.Stdin = bytes.NewReader(img)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("running tesseract: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// ocrPageCached reads the text of a scanned page of the PDF with hash sum
+// with OCR, or from the page cache.
+func ocrPageCached(sum string, number int, page *model.PdfPage) (string, error) {
+	name := fmt.Sprintf("%d.txt", number)
+	if OCRLanguages != "" {
+		name = fmt.Sprintf("%d.%s.txt", number, OCRLanguages)
+	}
+	b, err := pageCached(sum, name, func() ([]byte, error) {
+		img, err := renderPageWidth(page, ocrRenderWidth)
+		if err != nil {
+			return nil, err
+		}
+		text, err := OCRImage(img)
+		return []byte(text), err
+	})
+	return string(b), err
+}
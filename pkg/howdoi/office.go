@@ -0,0 +1,366 @@
+package howdoi
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// officeExts are the Office Open XML formats converted to text.
+var officeExts = map[string]bool{".docx": true, ".xlsx": true, ".pptx": true}
+
+// readOfficeContent converts a .docx, .xlsx, or .pptx file to text, with
+// tables as markdown.
+func readOfficeContent(file, ext string) (string, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	switch ext {
+	case ".docx":
+		return readZipXML(&zr.Reader, "word/document.xml", ooxmlText)
+	case ".pptx":
+		return readSlides(&zr.Reader)
+	case ".xlsx":
+		return readWorkbook(&zr.Reader)
+	}
+	return "", fmt.Errorf("unsupported office format %s", ext)
+}
+
+func readZipXML[T any](zr *zip.Reader, name string, parse func(io.Reader) (T, error)) (T, error) {
+	var zero T
+	f, err := zr.Open(name)
+	if err != nil {
+		return zero, err
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+func decodeZipXML(zr *zip.Reader, name string, v any) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return xml.NewDecoder(f).Decode(v)
+}
+
+var headingStyleRe = regexp.MustCompile(`^(?:Heading|heading )(\d)$`)
+
+// ooxmlText extracts the paragraphs and tables of a Word document body or a
+// slide. Both use p, t, tbl, tr, and tc elements, in different namespaces.
+func ooxmlText(r io.Reader) (string, error) {
+	dec := xml.NewDecoder(r)
+	var out, para, cell strings.Builder
+	var table [][]string
+	var row []string
+	depth := 0
+	inText := false
+	heading := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				heading = 0
+			case "pStyle":
+				for _, a := range t.Attr {
+					if a.Name.Local != "val" {
+						continue
+					}
+					if m := headingStyleRe.FindStringSubmatch(a.Value); m != nil {
+						heading, _ = strconv.Atoi(m[1])
+					} else if a.Value == "Title" {
+						heading = 1
+					}
+				}
+			case "t":
+				inText = true
+			case "tab":
+				para.WriteByte(' ')
+			case "br", "cr":
+				para.WriteByte('\n')
+			case "tbl":
+				depth++
+				if depth == 1 {
+					table = nil
+				}
+			case "tr":
+				if depth == 1 {
+					row = nil
+				}
+			case "tc":
+				if depth == 1 {
+					cell.Reset()
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(para.String())
+				switch {
+				case text == "":
+				case depth > 0:
+					if cell.Len() > 0 {
+						cell.WriteByte('\n')
+					}
+					cell.WriteString(text)
+				case heading > 0:
+					fmt.Fprintf(&out, "%s %s\n\n", strings.Repeat("#", heading), text)
+				default:
+					out.WriteString(text + "\n\n")
+				}
+			case "tc":
+				if depth == 1 {
+					row = append(row, cell.String())
+				}
+			case "tr":
+				if depth == 1 {
+					table = append(table, row)
+				}
+			case "tbl":
+				depth--
+				if depth == 0 {
+					out.WriteString(markdownTable(table) + "\n")
+				}
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+var slideRe = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// readSlides extracts the text of each slide of a presentation in order.
+func readSlides(zr *zip.Reader) (string, error) {
+	type slide struct {
+		n    int
+		name string
+	}
+	var slides []slide
+	for _, f := range zr.File {
+		if m := slideRe.FindStringSubmatch(f.Name); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			slides = append(slides, slide{n, f.Name})
+		}
+	}
+	sort.Slice(slides, func(i, j int) bool { return slides[i].n < slides[j].n })
+
+	var out strings.Builder
+	for _, s := range slides {
+		text, err := readZipXML(zr, s.name, ooxmlText)
+		if err != nil {
+			return "", fmt.Errorf("slide %d: %w", s.n, err)
+		}
+		fmt.Fprintf(&out, "## Slide %d\n\n%s\n\n", s.n, text)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// readWorkbook renders each sheet of a workbook as a markdown table.
+func readWorkbook(zr *zip.Reader) (string, error) {
+	// Workbooks without text cells have no shared strings.
+	shared, err := readZipXML(zr, "xl/sharedStrings.xml", sharedStrings)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("shared strings: %w", err)
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeZipXML(zr, "xl/workbook.xml", &workbook); err != nil {
+		return "", fmt.Errorf("workbook: %w", err)
+	}
+	if err := decodeZipXML(zr, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", fmt.Errorf("workbook relationships: %w", err)
+	}
+	targets := map[string]string{}
+	for _, r := range rels.Relationships {
+		if strings.HasPrefix(r.Target, "/") {
+			targets[r.ID] = strings.TrimPrefix(r.Target, "/")
+		} else {
+			targets[r.ID] = path.Join("xl", r.Target)
+		}
+	}
+
+	var out strings.Builder
+	for _, s := range workbook.Sheets {
+		rows, err := readZipXML(zr, targets[s.ID], func(r io.Reader) ([][]string, error) { return sheetRows(r, shared) })
+		if err != nil {
+			return "", fmt.Errorf("sheet %s: %w", s.Name, err)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "## %s\n\n%s\n", s.Name, markdownTable(rows))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// sharedStrings reads the shared string table of a workbook. Phonetic runs
+// are skipped.
+func sharedStrings(r io.Reader) ([]string, error) {
+	dec := xml.NewDecoder(r)
+	var strs []string
+	var s strings.Builder
+	inText, inPhonetic := false, false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return strs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				s.Reset()
+			case "t":
+				inText = !inPhonetic
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				strs = append(strs, s.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		case xml.CharData:
+			if inText {
+				s.Write(t)
+			}
+		}
+	}
+}
+
+// sheetRows reads the cell values of a worksheet into rows, placing cells
+// by their references so empty cells keep their columns.
+func sheetRows(r io.Reader, shared []string) ([][]string, error) {
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.NewDecoder(r).Decode(&sheet); err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		var cells []string
+		for _, c := range row.Cells {
+			col := len(cells)
+			if c.Ref != "" {
+				col = columnIndex(c.Ref)
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			v := c.Value
+			switch c.Type {
+			case "s":
+				if i, err := strconv.Atoi(v); err == nil && i >= 0 && i < len(shared) {
+					v = shared[i]
+				}
+			case "inlineStr":
+				v = c.Inline
+			case "b":
+				v = map[string]string{"0": "FALSE", "1": "TRUE"}[v]
+			}
+			cells[col] = v
+		}
+		rows = append(rows, cells)
+	}
+	// Drop trailing empty rows.
+	for len(rows) > 0 && strings.Join(rows[len(rows)-1], "") == "" {
+		rows = rows[:len(rows)-1]
+	}
+	return rows, nil
+}
+
+// columnIndex returns the zero based column of a cell reference like "AB12".
+func columnIndex(ref string) int {
+	n := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		n = n*26 + int(c-'A'+1)
+	}
+	return n - 1
+}
+
+// markdownTable renders rows as a markdown table with the first row as the
+// header.
+func markdownTable(rows [][]string) string {
+	width := 0
+	for _, r := range rows {
+		width = max(width, len(r))
+	}
+	if width == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer("|", `\|`, "\n", "<br>")
+	var b strings.Builder
+	line := func(cells []string) {
+		b.WriteString("|")
+		for i := 0; i < width; i++ {
+			var c string
+			if i < len(cells) {
+				c = escape.Replace(strings.TrimSpace(cells[i]))
+			}
+			b.WriteString(" " + c + " |")
+		}
+		b.WriteString("\n")
+	}
+	line(rows[0])
+	b.WriteString(strings.Repeat("| --- ", width) + "|\n")
+	for _, r := range rows[1:] {
+		line(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package howdoi
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// ErrOffline is returned for network calls to other hosts than this machine
+// in offline mode.
+var ErrOffline = errors.New("offline mode only allows localhost")
+
+// IsLocalURL reports whether a URL points at this machine, as the servers of
+// Ollama, LM Studio, or llama.cpp usually do.
+func IsLocalURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return isLocalHost(u.Hostname())
+}
+
+func isLocalHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// OfflineTransport refuses requests to hosts other than this machine and
+// passes the rest to Base, or http.DefaultTransport when it is nil.
+type OfflineTransport struct {
+	Base http.RoundTripper
+}
+
+func (t OfflineTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !isLocalHost(r.URL.Hostname()) {
+		return nil, fmt.Errorf("%w, refusing to connect to %s", ErrOffline, r.URL.Host)
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
@@ -0,0 +1,185 @@
+package howdoi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// openAIProvider calls the chat completions API of OpenAI and the
+// OpenAI-compatible servers, with the quirks of their Vendor.
+type openAIProvider struct {
+	c *Client
+}
+
+func (p openAIProvider) Stream(ctx context.Context, req Request) (<-chan Delta, error) {
+	// o1 models don't stream, and only take the default temperature.
+	isReasoningCall := req.Model == "o1" || req.Model == "o1p"
+
+	rq := RequestBody{
+		Model:    req.ModelID,
+		Messages: req.Messages,
+	}
+	if isReasoningCall {
+		rq.MaxCompletionTokens = req.MaxTokens
+		rq.Temperature = float64(1.0)
+	} else {
+		rq.MaxTokens = req.MaxTokens
+		rq.Temperature = float64(req.Temperature)
+		rq.Stream = true
+		if !req.Vendor.NoStreamOptions {
+			rq.StreamOptions = &OpenAIStreamOptions{
+				IncludeUsage: true,
+			}
+		}
+		if req.JSONMode && req.Schema != nil && !req.Vendor.JSONObjectOnly {
+			rq.ResponseFormat = map[string]any{
+				"type":        "json_schema",
+				"json_schema": map[string]any{"name": "response", "schema": req.Schema},
+			}
+		} else if req.JSONMode {
+			rq.ResponseFormat = map[string]any{"type": "json_object"}
+		}
+		if len(req.Tools) > 0 {
+			rq.Tools = toolDefinitions(req.Provider, req.Tools)
+		}
+		if req.Vendor.Custom && len(req.Metadata) > 0 {
+			rq.Metadata = req.Metadata
+		} else if req.Vendor.URL == vendors["openai"].URL {
+			rq.User = req.Metadata["user"]
+		}
+		// The system prompt is a separate message.
+		if req.System != "" {
+			rq.Messages = append([]Message{{Role: "system", Content: []any{TextContent{Type: "text", Text: req.System}}}}, rq.Messages...)
+		}
+	}
+
+	auth := http.Header{}
+	if req.APIKey != "" {
+		auth.Set("Authorization", "Bearer "+req.APIKey)
+	}
+	r, err := newAPIRequest(ctx, req, rq, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	if isReasoningCall {
+		text, usage, err := p.c.callReasoningAPI(req.ModelID, r, req.Verbose)
+		if err != nil {
+			return nil, err
+		}
+		respChan := make(chan Delta, 2)
+		respChan <- Delta{Text: text}
+		respChan <- Delta{Usage: &usage}
+		close(respChan)
+		return respChan, nil
+	}
+	return p.c.callAPI(req.ModelID, handleOpenAIEvent, r, req.Verbose)
+}
+
+func (c *Client) callReasoningAPI(model string, r *http.Request, verbose bool) (string, Usage, error) {
+	if verbose {
+		Logf("Calling the API ... %s\n", model)
+	}
+	res, err := c.do(r, verbose)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	defer res.Body.Close()
+
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	var rb struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens        int `json:"prompt_tokens"`
+			CompletionTokens    int `json:"completion_tokens"`
+			TotalTokens         int `json:"total_tokens"`
+			PromptTokensDetails struct {
+				CachedTokens int `json:"cached_tokens"`
+			} `json:"prompt_tokens_details"`
+			CompletionTokensDetails struct {
+				ReasoningTokens int `json:"reasoning_tokens"`
+			} `json:"completion_tokens_details"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(buf, &rb); err != nil {
+		return "", Usage{}, err
+	}
+
+	usage := Usage{
+		InputTokens:     rb.Usage.PromptTokens - rb.Usage.PromptTokensDetails.CachedTokens,
+		CacheReadTokens: rb.Usage.PromptTokensDetails.CachedTokens,
+		OutputTokens:    rb.Usage.CompletionTokens,
+	}
+
+	return rb.Choices[0].Message.Content, usage, nil
+}
+
+// handleOpenAIEvent handles chat completion chunks from OpenAI and
+// OpenAI-compatible servers.
+func handleOpenAIEvent(ev sseEvent, usage *Usage, emit func(Delta)) error {
+	if ev.Data == "[DONE]" {
+		return errStreamDone
+	}
+	var data struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+				// DeepSeek and other reasoning models served through
+				// OpenAI-compatible APIs stream their thinking here.
+				ReasoningContent string `json:"reasoning_content"`
+				ToolCalls        []struct {
+					Index    int    `json:"index"`
+					ID       string `json:"id"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"delta"`
+		} `json:"choices"`
+		Usage *struct {
+			PromptTokens        int `json:"prompt_tokens"`
+			CompletionTokens    int `json:"completion_tokens"`
+			PromptTokensDetails struct {
+				CachedTokens int `json:"cached_tokens"`
+			} `json:"prompt_tokens_details"`
+			// DeepSeek reports cache hits here instead.
+			PromptCacheHitTokens int `json:"prompt_cache_hit_tokens"`
+		} `json:"usage"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(ev.Data), &data); err != nil {
+		return fmt.Errorf("decoding stream event: %w", err)
+	}
+	if data.Error != nil {
+		return fmt.Errorf("stream error: %s", data.Error.Message)
+	}
+	for _, c := range data.Choices {
+		if c.Delta.Content != "" || c.Delta.ReasoningContent != "" {
+			emit(Delta{Text: c.Delta.Content, Reasoning: c.Delta.ReasoningContent})
+		}
+		for _, tc := range c.Delta.ToolCalls {
+			emit(Delta{ToolCall: &ToolCallDelta{Index: tc.Index, ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments}})
+		}
+	}
+	// The usage is sent once, in the final chunk, when include_usage is set.
+	if data.Usage != nil {
+		cached := max(data.Usage.PromptTokensDetails.CachedTokens, data.Usage.PromptCacheHitTokens)
+		usage.InputTokens = data.Usage.PromptTokens - cached
+		usage.CacheReadTokens = cached
+		usage.OutputTokens = data.Usage.CompletionTokens
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package howdoi
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandleOpenAIEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   []Delta
+		usage  Usage
+		err    string
+	}{
+		{
+			name:   "text",
+			events: []string{`{"choices":[{"delta":{"content":"Hello"}}]}`, `{"choices":[{"delta":{"content":" world"}}]}`},
+			want:   []Delta{{Text: "Hello"}, {Text: " world"}},
+		},
+		{
+			name:   "reasoning",
+			events: []string{`{"choices":[{"delta":{"reasoning_content":"hmm"}}]}`},
+			want:   []Delta{{Reasoning: "hmm"}},
+		},
+		{
+			name:   "empty deltas are dropped",
+			events: []string{`{"choices":[{"delta":{"role":"assistant"}}]}`},
+		},
+		{
+			name: "tool calls",
+			events: []string{
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"run_shell","arguments":""}}]}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"cmd\":\"ls\"}"}}]}}]}`,
+			},
+			want: []Delta{
+				{ToolCall: &ToolCallDelta{Index: 0, ID: "call_1", Name: "run_shell"}},
+				{ToolCall: &ToolCallDelta{Index: 0, Arguments: `{"cmd":"ls"}`}},
+			},
+		},
+		{
+			name:   "usage with cached tokens",
+			events: []string{`{"choices":[],"usage":{"prompt_tokens":100,"completion_tokens":20,"prompt_tokens_details":{"cached_tokens":60}}}`},
+			usage:  Usage{InputTokens: 40, CacheReadTokens: 60, OutputTokens: 20},
+		},
+		{
+			name:   "DeepSeek cache hits",
+			events: []string{`{"choices":[],"usage":{"prompt_tokens":100,"completion_tokens":20,"prompt_cache_hit_tokens":30}}`},
+			usage:  Usage{InputTokens: 70, CacheReadTokens: 30, OutputTokens: 20},
+		},
+		{
+			name:   "done",
+			events: []string{`{"choices":[{"delta":{"content":"a"}}]}`, "[DONE]", `{"choices":[{"delta":{"content":"b"}}]}`},
+			want:   []Delta{{Text: "a"}},
+			err:    errStreamDone.Error(),
+		},
+		{
+			name:   "error",
+			events: []string{`{"error":{"message":"overloaded"}}`},
+			err:    "stream error: overloaded",
+		},
+		{
+			name:   "bad JSON",
+			events: []string{`{"choices":`},
+			err:    "decoding stream event",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, usage, err := handleEvents(handleOpenAIEvent, tt.events...)
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+			if tt.err == errStreamDone.Error() && !errors.Is(err, errStreamDone) {
+				t.Errorf("got %v, want errStreamDone", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if usage != tt.usage {
+				t.Errorf("got usage %+v, want %+v", usage, tt.usage)
+			}
+		})
+	}
+}
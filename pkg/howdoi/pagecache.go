@@ -0,0 +1,125 @@
+package howdoi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/model"
+)
+
+// pageCacheTTL is how long a rendered page is kept after it was last used.
+const pageCacheTTL = 30 * 24 * time.Hour
+
+var prunePageCache sync.Once
+
+// pageCacheDir holds the PNG renderings of PDF pages and the OCR text of
+// scanned ones, named after the hash of the PDF and the page number, so
+// attaching the same PDF again does not render or read it again, and the
+// prepared images of PrepareImage. It is "" when there is no cache
+// directory.
+func pageCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "howdoi", "pages")
+}
+
+// fileSum returns the hex SHA-256 of a file's content.
+func fileSum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// renderPageCached renders a page of the PDF with hash sum, reading the
+// rendering from the cache when it is there.
+func renderPageCached(sum string, number int, page *model.PdfPage) ([]byte, error) {
+	return pageCached(sum, fmt.Sprintf("%d.png", number), func() ([]byte, error) {
+		return renderPage(page)
+	})
+}
+
+// pageCached returns the cached file name of the PDF with hash sum, making
+// it with fn when it is not there. The cache is best effort: an empty sum or
+// a failed read or write only means calling fn.
+func pageCached(sum, name string, fn func() ([]byte, error)) ([]byte, error) {
+	dir := pageCacheDir()
+	if dir == "" || sum == "" {
+		return fn()
+	}
+	path := filepath.Join(dir, sum+"-"+name)
+	if b, err := os.ReadFile(path); err == nil {
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return b, nil
+	}
+	b, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	prunePageCache.Do(func() { pruneDir(dir, pageCacheTTL) })
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return b, nil
+	}
+	// Written under another name first so concurrent runs never read a
+	// partial file.
+	tmp, err := os.CreateTemp(dir, ".page-*")
+	if err != nil {
+		return b, nil
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return b, nil
+}
+
+// pruneDir removes the files in dir not modified within ttl.
+func pruneDir(dir string, ttl time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && !e.IsDir() && time.Since(info.ModTime()) > ttl {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+// ClearPageCache removes the cached renderings of PDF pages and prepared
+// images, and returns how many there were.
+func ClearPageCache() (int, error) {
+	dir := pageCacheDir()
+	if dir == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), os.RemoveAll(dir)
+}
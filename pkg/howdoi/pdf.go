@@ -0,0 +1,276 @@
+package howdoi
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/unidoc/unipdf/v3/common"
+	"github.com/unidoc/unipdf/v3/extractor"
+	"github.com/unidoc/unipdf/v3/model"
+	"github.com/unidoc/unipdf/v3/render"
+)
+
+// progressMinPages is the page count from which extraction progress is shown.
+const progressMinPages = 20
+
+// progressMu lets one PDF at a time show its progress when several are
+// loaded at once.
+var progressMu sync.Mutex
+
+func openPDF(file string) (*os.File, *model.PdfReader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	pdfReader, err := model.NewPdfReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, pdfReader, nil
+}
+
+// processPDFPages runs fn over every page of a PDF with a pool of workers and
+// returns the results in page order. The PDF reader is not safe for
+// concurrent use, so each worker opens its own.
+func processPDFPages[T any](file string, fn func(page *model.PdfPage, number int) (T, error)) ([]T, error) {
+	common.SetLogger(common.NewConsoleLogger(common.LogLevelError))
+
+	f, pdfReader, err := openPDF(file)
+	if err != nil {
+		return nil, err
+	}
+	numPages, err := pdfReader.GetNumPages()
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	workers := min(runtime.NumCPU(), numPages)
+	results := make([]T, numPages)
+	pages := make(chan int)
+	errs := make(chan error, workers)
+	var done atomic.Int64
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, pdfReader, err := openPDF(file)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer f.Close()
+			for i := range pages {
+				page, err := pdfReader.GetPage(i + 1)
+				if err != nil {
+					errs <- err
+					return
+				}
+				r, err := fn(page, i+1)
+				if err != nil {
+					errs <- fmt.Errorf("page %d: %w", i+1, err)
+					return
+				}
+				results[i] = r
+				done.Add(1)
+			}
+		}()
+	}
+
+	stopProgress := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		if numPages < progressMinPages || Progress == nil || !progressMu.TryLock() {
+			return
+		}
+		defer progressMu.Unlock()
+		task := "Extracting the pages of " + file
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				Progress(task, int(done.Load()), numPages, false)
+			case <-stopProgress:
+				Progress(task, int(done.Load()), numPages, true)
+				return
+			}
+		}
+	}()
+
+	var firstErr error
+feed:
+	for i := 0; i < numPages; i++ {
+		select {
+		case pages <- i:
+		case firstErr = <-errs:
+			break feed
+		}
+	}
+	close(pages)
+	wg.Wait()
+	close(stopProgress)
+	<-progressDone
+
+	if firstErr == nil {
+		select {
+		case firstErr = <-errs:
+		default:
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// readPDFContent extracts the text of every page of a PDF. Pages with next
+// to no text are taken for scans and read with OCR when Tesseract is
+// installed. Otherwise, with renderScans, they are rendered for a vision
+// model to read; the pages left with neither have Scanned set.
+func readPDFContent(file string, renderScans bool) ([]PDFPage, error) {
+	sum := sync.OnceValue(func() string {
+		s, _ := fileSum(file)
+		return s
+	})
+	ocr := HasOCR()
+	return processPDFPages(file, func(page *model.PdfPage, number int) (PDFPage, error) {
+		ex, err := extractor.New(page)
+		if err != nil {
+			return PDFPage{}, err
+		}
+		text, err := ex.ExtractText()
+		if err != nil {
+			return PDFPage{}, err
+		}
+		p := PDFPage{Number: number, Text: text}
+		if len(strings.TrimSpace(text)) >= minOCRTextLength {
+			return p, nil
+		}
+		switch {
+		case ocr:
+			if p.Text, err = ocrPageCached(sum(), number, page); err != nil {
+				return PDFPage{}, fmt.Errorf("page %d: %w", number, err)
+			}
+		case renderScans:
+			if p.Image, err = renderPageCached(sum(), number, page); err != nil {
+				return PDFPage{}, err
+			}
+		default:
+			p.Scanned = true
+		}
+		return p, nil
+	})
+}
+
+// minPageTextLength is the amount of extracted text below which a page is
+// assumed to be mostly graphics or a scan.
+const minPageTextLength = 200
+
+// PDFPage is the extracted content of a single page in hybrid mode.
+type PDFPage struct {
+	Number int
+	Text   string
+	// Image is the PNG rendering of the page, set only when the text
+	// extraction is unlikely to capture the page content.
+	Image []byte
+	// Scanned is set for a page with no text that could not be read with
+	// OCR or rendered.
+	Scanned bool
+}
+
+// needsPageImage decides whether a page should be sent as an image in
+// addition to its text, based on how well the text extraction went.
+func needsPageImage(text string, numChars, numMisses, numTables, numImages int) bool {
+	if numTables > 0 || numImages > 0 {
+		return true
+	}
+	// Characters that could not be mapped to unicode usually mean custom
+	// font encodings, where the extracted text is garbage.
+	if numChars > 0 && numMisses*10 > numChars {
+		return true
+	}
+	return len(strings.TrimSpace(text)) < minPageTextLength
+}
+
+// readPDFHybrid extracts text from every page of a PDF and renders the pages
+// that contain tables, figures, or poorly extracted text as PNG images.
+func readPDFHybrid(file string) ([]PDFPage, error) {
+	sum, _ := fileSum(file)
+	return processPDFPages(file, func(page *model.PdfPage, number int) (PDFPage, error) {
+		ex, err := extractor.New(page)
+		if err != nil {
+			return PDFPage{}, err
+		}
+
+		pageText, numChars, numMisses, err := ex.ExtractPageText()
+		if err != nil {
+			return PDFPage{}, err
+		}
+		text := pageText.Text()
+
+		images, err := ex.ExtractPageImages(nil)
+		if err != nil {
+			return PDFPage{}, err
+		}
+
+		p := PDFPage{Number: number, Text: text}
+		if needsPageImage(text, numChars, numMisses, len(pageText.Tables()), len(images.Images)) {
+			p.Image, err = renderPageCached(sum, number, page)
+			if err != nil {
+				return PDFPage{}, err
+			}
+		}
+		return p, nil
+	})
+}
+
+// readPDFImages renders every page of a PDF as a PNG image, or reads the
+// renderings from the page cache.
+func readPDFImages(file string) ([][]byte, error) {
+	sum, _ := fileSum(file)
+	return processPDFPages(file, func(page *model.PdfPage, number int) ([]byte, error) {
+		return renderPageCached(sum, number, page)
+	})
+}
+
+func renderPage(page *model.PdfPage) ([]byte, error) {
+	return renderPageWidth(page, 0)
+}
+
+// renderPageWidth renders a page as a PNG image width pixels wide, or at its
+// size when width is 0.
+func renderPageWidth(page *model.PdfPage, width int) ([]byte, error) {
+	device := render.NewImageDevice()
+	device.OutputWidth = width
+	img, err := device.Render(page)
+	if err != nil {
+		return nil, fmt.Errorf("rendering page: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// countPDFPages returns the number of pages of a PDF.
+func countPDFPages(file string) (int, error) {
+	f, pdfReader, err := openPDF(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return pdfReader.GetNumPages()
+}
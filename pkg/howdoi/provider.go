@@ -0,0 +1,65 @@
+package howdoi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Provider sends a single turn of a request to a model provider's API and
+// streams the answer. Client.Complete builds on it: running tool calls and
+// sending their results back, emulating JSON mode, and numbering citations.
+//
+// A stream sends an Err delta when it fails after it started, then the usage
+// if it is known; Done is left to Complete. A provider's stream is parsed by
+// a streamHandler, a function of the events alone, so the parsing can be
+// tested without a server.
+type Provider interface {
+	Stream(ctx context.Context, req Request) (<-chan Delta, error)
+}
+
+// providers make the Provider of each API. Providers send through the client,
+// so they retry as it is configured to.
+var providers = map[string]func(c *Client) Provider{
+	"openai":    func(c *Client) Provider { return openAIProvider{c} },
+	"anthropic": func(c *Client) Provider { return anthropicProvider{c} },
+	"google":    func(c *Client) Provider { return geminiProvider{c} },
+}
+
+// Provider returns the Provider of an API: openai, which OpenAI-compatible
+// servers use too, anthropic, or google.
+func (c *Client) Provider(api string) (Provider, error) {
+	newProvider, ok := providers[api]
+	if !ok {
+		return nil, fmt.Errorf("no provider for the %s API", api)
+	}
+	return newProvider(c), nil
+}
+
+// newAPIRequest builds the POST of a JSON body to the request's URL. It has
+// the provider's auth headers, the metadata for gateways, and the configured
+// headers, which take precedence.
+func newAPIRequest(ctx context.Context, req Request, body any, auth http.Header) (*http.Request, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling the request body: %w", err)
+	}
+	r, err := http.NewRequestWithContext(ctx, "POST", req.URL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("creating the request: %w", err)
+	}
+	r.Header.Add("content-type", "application/json")
+	for k, v := range auth {
+		r.Header[k] = v
+	}
+	if req.Vendor.Custom && req.MetadataHeader != "" && len(req.Metadata) > 0 {
+		b, _ := json.Marshal(req.Metadata)
+		r.Header.Set(req.MetadataHeader, string(b))
+	}
+	for k, v := range req.Headers {
+		r.Header.Set(k, v)
+	}
+	return r, nil
+}
@@ -0,0 +1,581 @@
+package howdoi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// The extraction follows Mozilla's Readability: paragraphs score the
+// elements around them by their length and commas, class names and ids
+// nudge the scores, and the best scored element, less its share of link
+// text, is the article.
+
+var (
+	unlikelyRe = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|gdpr|header|legends|menu|modal|newsletter|pager|pagination|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe`)
+	maybeRe    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveRe = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeRe = regexp.MustCompile(`(?i)-ad-|hidden|banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// ErrNoReadableContent is returned for web pages with no text to extract,
+// such as pages built with JavaScript, which LoadOptions.Render loads.
+var ErrNoReadableContent = errors.New("no readable content found on the page")
+
+// minPageChars is the least text of a page that is not taken for an empty
+// shell, such as a page built with JavaScript or a paywall.
+const minPageChars = 200
+
+// droppedTags never hold article text.
+var droppedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true,
+	atom.Nav: true, atom.Aside: true, atom.Form: true, atom.Button: true,
+	atom.Svg: true, atom.Canvas: true, atom.Select: true, atom.Input: true,
+	atom.Template: true, atom.Object: true, atom.Embed: true, atom.Dialog: true,
+}
+
+// scrapeWebPage fetches a web page and returns its main text as markdown.
+func scrapeWebPage(ctx context.Context, rawURL string) (string, error) {
+	res, err := scrapeGet(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := charset.NewReader(res.Body, res.Header.Get("Content-Type"))
+	if err != nil {
+		return "", err
+	}
+	doc, err := html.Parse(body)
+	if err != nil {
+		return "", err
+	}
+	return readableMarkdown(doc, res.Request.URL)
+}
+
+// readableMarkdown returns the title and main content of a parsed page as
+// markdown, with links resolved against base.
+func readableMarkdown(doc *html.Node, base *url.URL) (string, error) {
+	title := pageTitle(doc)
+	root := findElement(doc, atom.Body)
+	if root == nil {
+		root = doc
+	}
+	prune(root, false)
+
+	md := &markdown{base: base}
+	for _, n := range articleNodes(root) {
+		md.node(n)
+	}
+	content := md.String()
+	if content == "" {
+		return "", ErrNoReadableContent
+	}
+	if title != "" && !strings.HasPrefix(content, "# ") {
+		content = "# " + title + "\n\n" + content
+	}
+	return content, nil
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// pageTitle prefers the og:title, which leaves out the site name.
+func pageTitle(doc *html.Node) string {
+	var title, og string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.DataAtom == atom.Title && title == "":
+				title = innerText(n)
+			case n.DataAtom == atom.Meta && attr(n, "property") == "og:title":
+				og = strings.TrimSpace(attr(n, "content"))
+			case n.DataAtom == atom.Body:
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	if og != "" {
+		return og
+	}
+	return title
+}
+
+func attr(n *html.Node, key string) string {
+	v, _ := attrValue(n, key)
+	return v
+}
+
+// prune removes scripts, navigation, hidden elements, and elements whose
+// class or id marks them as boilerplate. Headers and footers inside an
+// article are kept.
+func prune(n *html.Node, inArticle bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || c.Type == html.ElementNode && isBoilerplate(c, inArticle) {
+			n.RemoveChild(c)
+		} else {
+			prune(c, inArticle || c.DataAtom == atom.Article)
+		}
+		c = next
+	}
+}
+
+func isBoilerplate(n *html.Node, inArticle bool) bool {
+	if droppedTags[n.DataAtom] {
+		return true
+	}
+	if !inArticle && (n.DataAtom == atom.Header || n.DataAtom == atom.Footer) {
+		return true
+	}
+	if _, hidden := attrValue(n, "hidden"); hidden || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	if style := strings.ReplaceAll(attr(n, "style"), " ", ""); strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden") {
+		return true
+	}
+	switch n.DataAtom {
+	case atom.Body, atom.Article, atom.Main, atom.A, atom.Table, atom.Tbody, atom.Tr, atom.Td, atom.Th:
+		return false
+	}
+	match := attr(n, "class") + " " + attr(n, "id")
+	return unlikelyRe.MatchString(match) && !maybeRe.MatchString(match)
+}
+
+func attrValue(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// innerText is the text of a node with whitespace collapsed.
+func innerText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// linkDensity is the share of a node's text that is inside links.
+func linkDensity(n *html.Node) float64 {
+	text := len(innerText(n))
+	if text == 0 {
+		return 0
+	}
+	links := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			links += len(innerText(n))
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return float64(links) / float64(text)
+}
+
+// classWeight scores the class name and id of an element.
+func classWeight(n *html.Node) float64 {
+	w := 0.0
+	for _, s := range []string{attr(n, "class"), attr(n, "id")} {
+		if s == "" {
+			continue
+		}
+		if negativeRe.MatchString(s) {
+			w -= 25
+		}
+		if positiveRe.MatchString(s) {
+			w += 25
+		}
+	}
+	return w
+}
+
+func initialScore(n *html.Node) float64 {
+	s := classWeight(n)
+	switch n.DataAtom {
+	case atom.Div, atom.Article, atom.Main:
+		s += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		s += 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		s -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		s -= 5
+	}
+	return s
+}
+
+// hasBlockChildren reports whether a div holds paragraphs or other blocks,
+// as opposed to being used as a paragraph itself.
+func hasBlockChildren(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.DataAtom {
+		case atom.P, atom.Div, atom.Table, atom.Pre, atom.Blockquote, atom.Ul, atom.Ol, atom.Section, atom.Article,
+			atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			return true
+		}
+	}
+	return false
+}
+
+// articleNodes returns the best scored element and the siblings that look
+// like part of the same article, or root when nothing scores.
+func articleNodes(root *html.Node) []*html.Node {
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type != html.ElementNode {
+			return
+		}
+		switch n.DataAtom {
+		case atom.P, atom.Pre, atom.Td:
+		case atom.Div:
+			if hasBlockChildren(n) {
+				return
+			}
+		default:
+			return
+		}
+		text := innerText(n)
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text)/100), 3)
+		// The parent gets the full score, the grandparent half, and the
+		// level above a sixth.
+		a := n.Parent
+		for level := 0; a != nil && a.Type == html.ElementNode && level < 3; level++ {
+			if _, ok := scores[a]; !ok {
+				scores[a] = initialScore(a)
+				candidates = append(candidates, a)
+			}
+			div := float64(1)
+			if level > 0 {
+				div = float64(level * 2)
+				if level > 1 {
+					div = float64(level * 3)
+				}
+			}
+			scores[a] += score / div
+			a = a.Parent
+		}
+	}
+	walk(root)
+
+	var top *html.Node
+	best := 0.0
+	for _, c := range candidates {
+		scores[c] *= 1 - linkDensity(c)
+		if top == nil || scores[c] > best {
+			top, best = c, scores[c]
+		}
+	}
+	if top == nil || top.Parent == nil {
+		return []*html.Node{root}
+	}
+
+	threshold := max(10, best*0.2)
+	var nodes []*html.Node
+	for s := top.Parent.FirstChild; s != nil; s = s.NextSibling {
+		if s.Type != html.ElementNode {
+			continue
+		}
+		keep := s == top
+		if score, ok := scores[s]; ok && score+classWeight(s)*0.2 >= threshold {
+			keep = true
+		}
+		if s.DataAtom == atom.P {
+			text, density := innerText(s), linkDensity(s)
+			if len(text) > 80 && density < 0.25 || len(text) <= 80 && density == 0 && strings.Contains(text, ". ") {
+				keep = true
+			}
+		}
+		if keep {
+			nodes = append(nodes, s)
+		}
+	}
+	return nodes
+}
+
+// markdown renders HTML as markdown.
+type markdown struct {
+	b    strings.Builder
+	base *url.URL
+}
+
+func (m *markdown) String() string {
+	lines := strings.Split(m.b.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " ")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// text writes inline text, collapsing its whitespace with what came before.
+func (m *markdown) text(s string) {
+	out := m.b.String()
+	space := !(out == "" || strings.HasSuffix(out, "\n") || strings.HasSuffix(out, " "))
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" && space {
+			m.b.WriteByte(' ')
+		}
+		return
+	}
+	if space && strings.TrimLeft(s, " \t\r\n") != s {
+		m.b.WriteByte(' ')
+	}
+	m.b.WriteString(strings.Join(fields, " "))
+	if strings.TrimRight(s, " \t\r\n") != s {
+		m.b.WriteByte(' ')
+	}
+}
+
+// block ends the current paragraph.
+func (m *markdown) block() {
+	out := m.b.String()
+	switch {
+	case out == "", strings.HasSuffix(out, "\n\n"):
+	case strings.HasSuffix(out, "\n"):
+		m.b.WriteByte('\n')
+	default:
+		m.b.WriteString("\n\n")
+	}
+}
+
+// inline renders the children of n on a single line.
+func (m *markdown) inline(n *html.Node) string {
+	sub := &markdown{base: m.base}
+	sub.children(n)
+	return strings.Join(strings.Fields(sub.b.String()), " ")
+}
+
+func (m *markdown) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		m.node(c)
+	}
+}
+
+func (m *markdown) node(n *html.Node) {
+	if n.Type == html.TextNode {
+		m.text(n.Data)
+		return
+	}
+	if n.Type != html.ElementNode {
+		m.children(n)
+		return
+	}
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		if text := m.inline(n); text != "" {
+			m.block()
+			m.b.WriteString(strings.Repeat("#", int(n.Data[1]-'0')) + " " + text)
+			m.block()
+		}
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Footer, atom.Figure, atom.Figcaption, atom.Dl, atom.Dt, atom.Dd, atom.Details, atom.Summary:
+		m.block()
+		m.children(n)
+		m.block()
+	case atom.Br:
+		m.b.WriteByte('\n')
+	case atom.Hr:
+		m.block()
+		m.b.WriteString("---")
+		m.block()
+	case atom.Pre:
+		m.block()
+		m.b.WriteString("```\n" + strings.Trim(rawText(n), "\n") + "\n```")
+		m.block()
+	case atom.Code, atom.Kbd, atom.Samp:
+		if text := innerText(n); text != "" {
+			m.b.WriteString("`" + text + "`")
+		}
+	case atom.Strong, atom.B:
+		m.wrap(n, "**")
+	case atom.Em, atom.I:
+		m.wrap(n, "_")
+	case atom.A:
+		m.link(n)
+	case atom.Ul, atom.Ol:
+		m.list(n)
+	case atom.Blockquote:
+		sub := &markdown{base: m.base}
+		sub.children(n)
+		if text := sub.String(); text != "" {
+			m.block()
+			m.b.WriteString("> " + strings.ReplaceAll(text, "\n", "\n> "))
+			m.block()
+		}
+	case atom.Table:
+		m.table(n)
+	case atom.Img, atom.Picture, atom.Video, atom.Audio, atom.Source:
+	default:
+		m.children(n)
+	}
+}
+
+func (m *markdown) wrap(n *html.Node, mark string) {
+	if text := m.inline(n); text != "" {
+		m.b.WriteString(mark + text + mark)
+	}
+}
+
+func (m *markdown) link(n *html.Node) {
+	text := m.inline(n)
+	if text == "" {
+		return
+	}
+	href := strings.TrimSpace(attr(n, "href"))
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+		m.b.WriteString(text)
+		return
+	}
+	if u, err := url.Parse(href); err == nil && m.base != nil {
+		href = m.base.ResolveReference(u).String()
+	}
+	m.b.WriteString("[" + text + "](" + href + ")")
+}
+
+func (m *markdown) list(n *html.Node) {
+	m.block()
+	i := 0
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		i++
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", i)
+		}
+		sub := &markdown{base: m.base}
+		sub.children(li)
+		text := sub.String()
+		if text == "" {
+			continue
+		}
+		// Nested lists and paragraphs are indented under the item.
+		text = strings.ReplaceAll(text, "\n\n", "\n")
+		m.b.WriteString(marker + strings.ReplaceAll(text, "\n", "\n"+strings.Repeat(" ", len(marker))) + "\n")
+	}
+	m.block()
+}
+
+func (m *markdown) table(n *html.Node) {
+	var rows [][]string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+						row = append(row, strings.ReplaceAll(m.inline(cell), "|", `\|`))
+					}
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			case atom.Table:
+				// Nested tables are flattened into the rows of this one.
+				walk(c)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return
+	}
+	// Layout tables with a single column are paragraphs.
+	cols := 0
+	for _, r := range rows {
+		cols = max(cols, len(r))
+	}
+	m.block()
+	if cols == 1 {
+		for _, r := range rows {
+			m.b.WriteString(r[0] + "\n\n")
+		}
+		return
+	}
+	for i, r := range rows {
+		for len(r) < cols {
+			r = append(r, "")
+		}
+		m.b.WriteString("| " + strings.Join(r, " | ") + " |\n")
+		if i == 0 {
+			m.b.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+		}
+	}
+	m.block()
+}
+
+// rawText is the text of a node with its whitespace kept, for pre blocks.
+func rawText(n *html.Node) string {
+	var b bytes.Buffer
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.DataAtom == atom.Br:
+			b.WriteByte('\n')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package howdoi
+
+import (
+	"errors"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// TestReadableMarkdown extracts every page in testdata/readability and
+// compares the markdown with the .md file next to it. Run the tests with
+// -update to rewrite them after a deliberate change.
+func TestReadableMarkdown(t *testing.T) {
+	pages, err := filepath.Glob(filepath.Join("testdata", "readability", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Fatal("no pages in testdata/readability")
+	}
+	base, _ := url.Parse("https://example.com/docs/page.html")
+	for _, page := range pages {
+		t.Run(filepath.Base(page), func(t *testing.T) {
+			f, err := os.Open(page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			doc, err := html.Parse(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := readableMarkdown(doc, base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := strings.TrimSuffix(page, ".html") + ".md"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("markdown differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestReadableMarkdownNoContent(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><head><title>Loading...</title></head><body><div id="root"></div></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readableMarkdown(doc, nil); !errors.Is(err, ErrNoReadableContent) {
+		t.Errorf("got %v, want ErrNoReadableContent", err)
+	}
+}
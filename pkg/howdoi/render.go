@@ -0,0 +1,79 @@
+package howdoi
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"golang.org/x/net/html"
+)
+
+const (
+	// renderTimeout bounds loading and rendering a page.
+	renderTimeout = 45 * time.Second
+	// renderIdleWait is how long to wait for the network to go idle after
+	// the page loads. Pages that keep polling are read when it runs out.
+	renderIdleWait = 10 * time.Second
+)
+
+// renderWebPage loads a page in headless Chrome, waits for its scripts to
+// finish fetching, and returns its main text as markdown.
+func renderWebPage(ctx context.Context, rawURL string) (string, error) {
+	opts := chromedp.DefaultExecAllocatorOptions[:]
+	if Scraper.UserAgent != "" {
+		opts = append(opts, chromedp.UserAgent(Scraper.UserAgent))
+	}
+	ctx, cancel := chromedp.NewExecAllocator(ctx, opts...)
+	defer cancel()
+	ctx, cancel = chromedp.NewContext(ctx)
+	defer cancel()
+	ctx, cancel = context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+
+	// The blank page Chrome starts with goes idle too, so only idle events
+	// after the navigation count.
+	var loaded atomic.Bool
+	idle := make(chan struct{}, 1)
+	chromedp.ListenTarget(ctx, func(ev any) {
+		if e, ok := ev.(*page.EventLifecycleEvent); ok && e.Name == "networkIdle" && loaded.Load() {
+			select {
+			case idle <- struct{}{}:
+			default:
+			}
+		}
+	})
+	var doc string
+	err := chromedp.Run(ctx,
+		page.SetLifecycleEventsEnabled(true),
+		chromedp.Navigate(rawURL),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			loaded.Store(true)
+			select {
+			case <-idle:
+			case <-time.After(renderIdleWait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			return nil
+		}),
+		chromedp.OuterHTML("html", &doc, chromedp.ByQuery),
+	)
+	if err != nil {
+		return "", fmt.Errorf("rendering with Chrome: %w", err)
+	}
+
+	root, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		return "", err
+	}
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return readableMarkdown(root, base)
+}
@@ -0,0 +1,204 @@
+package howdoi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrOverloaded is returned when the provider is still overloaded after all
+// retries. Anthropic answers with 529 overloaded_error at peak hours.
+var ErrOverloaded = errors.New("the provider is overloaded")
+
+// APIError is an error status returned by a provider, with the provider's
+// error code and message when the body has them, so callers can decide on
+// their own retries and fallbacks.
+type APIError struct {
+	// Provider is the host of the API, which tells gateways and
+	// OpenAI-compatible servers apart.
+	Provider   string
+	StatusCode int
+	// Code is the provider's error code, or its error type when there is
+	// no code, e.g. rate_limit_exceeded or overloaded_error.
+	Code    string
+	Message string
+	// Retryable is set for rate limits, server errors, and overload, which
+	// may pass when the request is sent again later.
+	Retryable bool
+	Body      string
+}
+
+func newAPIError(r *http.Request, status int, body []byte) *APIError {
+	e := &APIError{
+		Provider:   r.URL.Hostname(),
+		StatusCode: status,
+		Retryable:  isRetryable(status) || isOverloaded(status, body),
+		Body:       string(body),
+	}
+	e.Code, e.Message = parseErrorBody(body)
+	return e
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Body
+	}
+	if e.Code != "" {
+		msg = e.Code + ": " + msg
+	}
+	return fmt.Sprintf("API call to %s failed with status code %d, error: %s", e.Provider, e.StatusCode, msg)
+}
+
+// parseErrorBody returns the code and message of an error body. OpenAI and
+// the APIs modeled on it nest them in an error object with a code and type,
+// Anthropic in an error object with a type, and some servers put them at the
+// top level or make error a string.
+func parseErrorBody(body []byte) (code, message string) {
+	type details struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    any    `json:"code"`
+	}
+	var b struct {
+		details
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &b) != nil {
+		return "", ""
+	}
+	d := b.details
+	if len(b.Error) > 0 && string(b.Error) != "null" {
+		var nested details
+		if json.Unmarshal(b.Error, &nested) == nil {
+			d = nested
+		} else {
+			json.Unmarshal(b.Error, &d.Message)
+		}
+	}
+	switch c := d.Code.(type) {
+	case string:
+		code = c
+	case float64:
+		code = strconv.Itoa(int(c))
+	}
+	if code == "" && d.Type != "error" {
+		code = d.Type
+	}
+	return code, d.Message
+}
+
+const (
+	// retryBackoff is the first wait before retrying a rate limited or
+	// failed request. It doubles with each attempt.
+	retryBackoff = time.Second
+	// overloadBackoff is the first wait for overloaded requests, which
+	// start higher since overload tends to last a while.
+	overloadBackoff = 5 * time.Second
+	// maxRetryAfter caps the wait asked for by a Retry-After header.
+	maxRetryAfter = time.Minute
+)
+
+// do sends r and returns the response when it succeeds. Rate limited, failed,
+// and overloaded requests are retried with a jittered exponential backoff,
+// or after the Retry-After delay when the provider gives one.
+func (c *Client) do(r *http.Request, verbose bool) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := c.httpClient().Do(r)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode == http.StatusOK {
+			return res, nil
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		err = newAPIError(r, res.StatusCode, body)
+
+		overloaded := isOverloaded(res.StatusCode, body)
+		retries, base := c.MaxRetries, retryBackoff
+		if overloaded {
+			retries, base = c.OverloadRetries, overloadBackoff
+		} else if !isRetryable(res.StatusCode) {
+			return nil, err
+		}
+		if attempt >= retries {
+			if overloaded {
+				return nil, fmt.Errorf("%w: %w", ErrOverloaded, err)
+			}
+			return nil, err
+		}
+
+		wait, ok := retryAfter(res.Header.Get("Retry-After"))
+		if !ok {
+			wait = backoff(base, attempt)
+		}
+		if verbose {
+			Logf("API call failed with status code %d, retrying in %s (%d/%d)\n", res.StatusCode, wait.Round(100*time.Millisecond), attempt+1, retries)
+		}
+		select {
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+		if r, err = rewind(r); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func isOverloaded(status int, body []byte) bool {
+	return status == 529 || bytes.Contains(body, []byte("overloaded_error"))
+}
+
+func isRetryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(header); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		d = time.Until(t)
+	} else {
+		return 0, false
+	}
+	return min(max(d, 0), maxRetryAfter), true
+}
+
+// backoff doubles base for each attempt and spreads it by half either way so
+// clients that failed together don't retry together.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << attempt
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
+
+// rewind returns a copy of r with a fresh body so it can be sent again.
+func rewind(r *http.Request) (*http.Request, error) {
+	if r.GetBody == nil {
+		return r, nil
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r = r.Clone(r.Context())
+	r.Body = body
+	return r, nil
+}
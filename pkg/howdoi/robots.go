@@ -0,0 +1,174 @@
+package howdoi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRule is an Allow or Disallow line of a robots.txt. Longer patterns
+// take precedence.
+type robotsRule struct {
+	pattern string
+	re      *regexp.Regexp
+	allow   bool
+}
+
+// robots is what the robots.txt of a site asks of a crawler with a given
+// user agent, as described in RFC 9309.
+type robots struct {
+	rules []robotsRule
+	// delay is the Crawl-delay, which the RFC leaves out but many sites set.
+	delay    time.Duration
+	sitemaps []string
+}
+
+// robotsGroup is the rules given to a set of user agents.
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+	delay  time.Duration
+}
+
+// parseRobots reads the rules of a robots.txt for userAgent. The groups
+// naming the longest part of the user agent apply, or those for * when none
+// does, case-insensitively.
+func parseRobots(r io.Reader, userAgent string) robots {
+	var rb robots
+	var groups []*robotsGroup
+	var g *robotsGroup
+	inRules := false
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		k, v = strings.ToLower(strings.TrimSpace(k)), strings.TrimSpace(v)
+		switch k {
+		case "user-agent":
+			// Consecutive user-agent lines share the rules after them.
+			if g == nil || inRules {
+				g = &robotsGroup{}
+				groups = append(groups, g)
+				inRules = false
+			}
+			g.agents = append(g.agents, strings.ToLower(v))
+		case "allow", "disallow":
+			if g == nil {
+				continue
+			}
+			inRules = true
+			// An empty Disallow allows everything, like no rule.
+			if v == "" {
+				continue
+			}
+			if re, err := robotsPattern(v); err == nil {
+				g.rules = append(g.rules, robotsRule{pattern: v, re: re, allow: k == "allow"})
+			}
+		case "crawl-delay":
+			if g == nil {
+				continue
+			}
+			inRules = true
+			if s, err := strconv.ParseFloat(v, 64); err == nil && s > 0 {
+				g.delay = time.Duration(s * float64(time.Second))
+			}
+		case "sitemap":
+			rb.sitemaps = append(rb.sitemaps, v)
+		}
+	}
+
+	ua := strings.ToLower(userAgent)
+	best := -1
+	var matched []*robotsGroup
+	for _, g := range groups {
+		for _, a := range g.agents {
+			n := len(a)
+			if a == "*" {
+				n = 0
+			} else if a == "" || !strings.Contains(ua, a) {
+				continue
+			}
+			if n > best {
+				best, matched = n, nil
+			}
+			if n == best {
+				matched = append(matched, g)
+			}
+			break
+		}
+	}
+	for _, g := range matched {
+		rb.rules = append(rb.rules, g.rules...)
+		rb.delay = max(rb.delay, g.delay)
+	}
+	return rb
+}
+
+// robotsPattern compiles a path pattern, in which * matches any characters
+// and a trailing $ the end of the path.
+func robotsPattern(pattern string) (*regexp.Regexp, error) {
+	end := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if end {
+		expr += "$"
+	}
+	return regexp.Compile(expr)
+}
+
+// allows reports whether the robots.txt lets the page be crawled. The
+// longest matching rule wins, Allow on a tie.
+func (rb robots) allows(u *url.URL) bool {
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	allowed, longest := true, -1
+	for _, r := range rb.rules {
+		if !r.re.MatchString(p) {
+			continue
+		}
+		if n := len(r.pattern); n > longest || n == longest && r.allow {
+			allowed, longest = r.allow, n
+		}
+	}
+	return allowed
+}
+
+// disallowAll is the robots.txt of a site whose robots.txt could not be
+// read for a reason other than it not existing.
+var disallowAll = robots{rules: []robotsRule{{pattern: "/", re: regexp.MustCompile("^/"), allow: false}}}
+
+// readRobots reads the robots.txt of the site of u for Scraper.UserAgent.
+// A site without one may be crawled whole; one whose robots.txt fails with a
+// server error or does not answer may not be crawled at all.
+func readRobots(ctx context.Context, u *url.URL) (robots, error) {
+	root := &url.URL{Scheme: u.Scheme, Host: u.Host}
+	b, err := httpGet(ctx, root.JoinPath("robots.txt").String())
+	var se *statusError
+	switch {
+	case errors.As(err, &se) && se.StatusCode < http.StatusInternalServerError:
+		return robots{}, nil
+	case err != nil:
+		return disallowAll, err
+	}
+	return parseRobots(bytes.NewReader(b), Scraper.UserAgent), nil
+}
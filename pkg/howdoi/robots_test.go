@@ -0,0 +1,115 @@
+package howdoi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	const txt = `# example
+User-agent: *
+Disallow: /private/
+Allow: /private/open
+Disallow: /*.pdf$
+Crawl-delay: 1
+
+User-agent: howdoi
+User-agent: other
+Disallow: /admin
+Allow: /admin/docs/
+Crawl-delay: 2.5
+
+User-agent: BadBot
+Disallow: /
+
+Sitemap: https://example.com/sitemap.xml
+`
+	tests := []struct {
+		agent string
+		path  string
+		want  bool
+	}{
+		{"curl/8.0", "/", true},
+		{"curl/8.0", "/private/x", false},
+		{"curl/8.0", "/private/open/x", true},
+		{"curl/8.0", "/docs/manual.pdf", false},
+		{"curl/8.0", "/docs/manual.pdf?download=1", true},
+		{DefaultUserAgent, "/private/x", true},
+		{DefaultUserAgent, "/admin", false},
+		{DefaultUserAgent, "/admin/users", false},
+		{DefaultUserAgent, "/admin/docs/intro", true},
+		{"Mozilla/5.0 (compatible; BadBot/1.0)", "/", false},
+		{"Mozilla/5.0 (compatible; BadBot/1.0)", "", false},
+	}
+	for _, tt := range tests {
+		rb := parseRobots(strings.NewReader(txt), tt.agent)
+		u := &url.URL{Scheme: "https", Host: "example.com"}
+		u, _ = u.Parse(tt.path)
+		if got := rb.allows(u); got != tt.want {
+			t.Errorf("%s %q: got allowed %v, want %v", tt.agent, tt.path, got, tt.want)
+		}
+	}
+
+	rb := parseRobots(strings.NewReader(txt), DefaultUserAgent)
+	if rb.delay != 2500*time.Millisecond {
+		t.Errorf("got crawl delay %s, want 2.5s", rb.delay)
+	}
+	if len(rb.sitemaps) != 1 || rb.sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("got sitemaps %q", rb.sitemaps)
+	}
+	if rb := parseRobots(strings.NewReader(txt), "curl/8.0"); rb.delay != time.Second {
+		t.Errorf("got crawl delay %s for *, want 1s", rb.delay)
+	}
+}
+
+func TestParseRobotsTies(t *testing.T) {
+	rb := parseRobots(strings.NewReader("User-agent: *\nDisallow: /page\nAllow: /page\nDisallow:\n"), "curl")
+	if !rb.allows(&url.URL{Path: "/page"}) {
+		t.Error("Allow did not win a tie with Disallow")
+	}
+	if rb := parseRobots(strings.NewReader("Disallow: /\n"), "curl"); !rb.allows(&url.URL{Path: "/"}) {
+		t.Error("a rule outside any group applied")
+	}
+}
+
+func TestReadRobots(t *testing.T) {
+	var status atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s := int(status.Load()); s != http.StatusOK {
+			w.WriteHeader(s)
+			return
+		}
+		w.Write([]byte("User-agent: *\nDisallow: /secret\n"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL + "/docs/")
+
+	tests := []struct {
+		status int
+		page   string
+		want   bool
+		err    bool
+	}{
+		{http.StatusOK, "/secret", false, false},
+		{http.StatusOK, "/docs/", true, false},
+		{http.StatusNotFound, "/secret", true, false},
+		{http.StatusForbidden, "/secret", true, false},
+		{http.StatusServiceUnavailable, "/docs/", false, true},
+	}
+	for _, tt := range tests {
+		status.Store(int32(tt.status))
+		rb, err := readRobots(context.Background(), u)
+		if (err != nil) != tt.err {
+			t.Errorf("%d: got error %v", tt.status, err)
+		}
+		if got := rb.allows(&url.URL{Path: tt.page}); got != tt.want {
+			t.Errorf("%d %s: got allowed %v, want %v", tt.status, tt.page, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package howdoi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// jsonModeInstruction is added to the system prompt in JSON mode. OpenAI
+// rejects json_object requests that never mention JSON.
+const jsonModeInstruction = "Respond only with a single valid JSON value, without any surrounding prose or code fences."
+
+// LoadSchema reads a JSON schema file.
+func LoadSchema(file string) (map[string]any, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	return schema, nil
+}
+
+// extractJSON strips the code fences models sometimes wrap JSON in.
+func extractJSON(answer string) string {
+	answer = strings.TrimSpace(answer)
+	if strings.HasPrefix(answer, "```") {
+		answer = strings.TrimPrefix(answer, "```json")
+		answer = strings.TrimPrefix(answer, "```")
+		answer = strings.TrimSuffix(strings.TrimSpace(answer), "```")
+	}
+	return strings.TrimSpace(answer)
+}
+
+// ParseJSONAnswer checks that the answer is valid JSON matching the schema,
+// when there is one, and returns it compacted.
+func ParseJSONAnswer(answer string, schema map[string]any) (json.RawMessage, error) {
+	raw := extractJSON(answer)
+	var v any
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return nil, fmt.Errorf("the answer is not valid JSON: %w", err)
+	}
+	if schema != nil {
+		if err := validateJSON(v, schema, "$"); err != nil {
+			return nil, fmt.Errorf("the answer does not match the schema: %w", err)
+		}
+	}
+	return json.RawMessage(raw), nil
+}
+
+// validateJSON validates a decoded JSON value against the commonly used
+// subset of JSON schema: type, enum, const, properties, required,
+// additionalProperties, items, minItems, and maxItems.
+func validateJSON(v any, schema map[string]any, path string) error {
+	if t, ok := schema["type"]; ok {
+		var types []string
+		switch t := t.(type) {
+		case string:
+			types = []string{t}
+		case []any:
+			for _, x := range t {
+				if s, ok := x.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		if !slices.ContainsFunc(types, func(t string) bool { return hasJSONType(v, t) }) {
+			return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonTypeOf(v))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(e any) bool { return jsonEqual(e, v) }) {
+			return fmt.Errorf("%s: value is not one of the allowed values", path)
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, v) {
+		return fmt.Errorf("%s: value does not match the constant", path)
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				name, _ := r.(string)
+				if _, ok := v[name]; !ok {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ps, ok := props[k].(map[string]any)
+			if !ok {
+				if ap, ok := schema["additionalProperties"].(bool); ok && !ap {
+					return fmt.Errorf("%s: unexpected property %q", path, k)
+				}
+				if ap, ok := schema["additionalProperties"].(map[string]any); ok {
+					if err := validateJSON(v[k], ap, path+"."+k); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := validateJSON(v[k], ps, path+"."+k); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if n, ok := schema["minItems"].(float64); ok && float64(len(v)) < n {
+			return fmt.Errorf("%s: expected at least %v items, got %d", path, n, len(v))
+		}
+		if n, ok := schema["maxItems"].(float64); ok && float64(len(v)) > n {
+			return fmt.Errorf("%s: expected at most %v items, got %d", path, n, len(v))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, x := range v {
+				if err := validateJSON(x, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func hasJSONType(v any, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	default:
+		return jsonTypeOf(v) == t
+	}
+}
+
+func jsonTypeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func jsonEqual(a, b any) bool {
+	ja, err1 := json.Marshal(a)
+	jb, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(ja) == string(jb)
+}
+
+// toGenaiSchema converts a JSON schema into Gemini's OpenAPI subset.
+func toGenaiSchema(schema map[string]any) *genai.Schema {
+	s := &genai.Schema{}
+	t, _ := schema["type"].(string)
+	if ts, ok := schema["type"].([]any); ok {
+		// Gemini has no union types; a nullable type is the closest.
+		for _, x := range ts {
+			if x == "null" {
+				s.Nullable = true
+			} else if xs, ok := x.(string); ok && t == "" {
+				t = xs
+			}
+		}
+	}
+	switch t {
+	case "string":
+		s.Type = genai.TypeString
+	case "number":
+		s.Type = genai.TypeNumber
+	case "integer":
+		s.Type = genai.TypeInteger
+	case "boolean":
+		s.Type = genai.TypeBoolean
+	case "array":
+		s.Type = genai.TypeArray
+	default:
+		s.Type = genai.TypeObject
+	}
+	s.Description, _ = schema["description"].(string)
+	if enum, ok := schema["enum"].([]any); ok {
+		s.Format = "enum"
+		for _, e := range enum {
+			s.Enum = append(s.Enum, fmt.Sprint(e))
+		}
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		s.Items = toGenaiSchema(items)
+	}
+	if props, ok := schema["properties"].(map[string]any); ok {
+		s.Properties = map[string]*genai.Schema{}
+		for name, p := range props {
+			if ps, ok := p.(map[string]any); ok {
+				s.Properties[name] = toGenaiSchema(ps)
+			}
+		}
+	}
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				s.Required = append(s.Required, name)
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package howdoi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateJSON(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"required": ["name", "tags"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": "integer"},
+			"score": {"type": ["number", "null"]},
+			"kind": {"enum": ["a", "b"]},
+			"version": {"const": 2},
+			"tags": {"type": "array", "minItems": 1, "maxItems": 2, "items": {"type": "string"}},
+			"extra": {"type": "object", "additionalProperties": {"type": "boolean"}}
+		}
+	}`
+	tests := []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{"valid", `{"name": "x", "age": 3, "score": null, "kind": "a", "version": 2, "tags": ["t"], "extra": {"on": true}}`, ""},
+		{"wrong type", `[]`, "$: expected object, got array"},
+		{"missing required", `{"name": "x"}`, `$: missing required property "tags"`},
+		{"unexpected property", `{"name": "x", "tags": ["t"], "other": 1}`, `$: unexpected property "other"`},
+		{"integer", `{"name": "x", "tags": ["t"], "age": 3.5}`, "$.age: expected integer, got number"},
+		{"union type", `{"name": "x", "tags": ["t"], "score": "high"}`, "$.score: expected number or null, got string"},
+		{"enum", `{"name": "x", "tags": ["t"], "kind": "c"}`, "$.kind: value is not one of the allowed values"},
+		{"const", `{"name": "x", "tags": ["t"], "version": 1}`, "$.version: value does not match the constant"},
+		{"min items", `{"name": "x", "tags": []}`, "$.tags: expected at least 1 items, got 0"},
+		{"max items", `{"name": "x", "tags": ["a", "b", "c"]}`, "$.tags: expected at most 2 items, got 3"},
+		{"items", `{"name": "x", "tags": ["a", 1]}`, "$.tags[1]: expected string, got number"},
+		{"additional properties schema", `{"name": "x", "tags": ["t"], "extra": {"on": "yes"}}`, "$.extra.on: expected boolean, got string"},
+	}
+	var s map[string]any
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v any
+			if err := json.Unmarshal([]byte(tt.value), &v); err != nil {
+				t.Fatal(err)
+			}
+			err := validateJSON(v, s, "$")
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseJSONAnswer(t *testing.T) {
+	schema := map[string]any{"type": "object", "required": []any{"ok"}}
+	tests := []struct {
+		answer string
+		want   string
+		err    string
+	}{
+		{`{"ok": true}`, `{"ok": true}`, ""},
+		{"```json\n{\"ok\": true}\n```", `{"ok": true}`, ""},
+		{"```\n{\"ok\": true}\n```", `{"ok": true}`, ""},
+		{`Sure! {"ok": true}`, "", "not valid JSON"},
+		{`{}`, "", "does not match the schema"},
+	}
+	for _, tt := range tests {
+		got, err := ParseJSONAnswer(tt.answer, schema)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%q: got error %v, want %q", tt.answer, err, tt.err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.answer, got, tt.want)
+		}
+	}
+}
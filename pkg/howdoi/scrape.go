@@ -0,0 +1,120 @@
+package howdoi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent identifies howdoi in a way sites that refuse unknown
+// clients still accept.
+const DefaultUserAgent = "Mozilla/5.0 (compatible; howdoi; +https://github.com/domluna/howdoi)"
+
+// ScraperConfig is how web pages and transcripts are fetched.
+type ScraperConfig struct {
+	UserAgent      string
+	AcceptLanguage string
+	// Delay is the least time between two requests to the same host.
+	Delay time.Duration
+	// Timeout bounds a request, reading the body included.
+	Timeout time.Duration
+}
+
+// Scraper is used for every page fetched for a URL argument.
+var Scraper = ScraperConfig{UserAgent: DefaultUserAgent, AcceptLanguage: "en-US,en;q=0.9", Timeout: 10 * time.Second}
+
+// scrapeMaxBytes is the most of a response body that is read. Pages are
+// rarely over a few megabytes, and more would not fit a context window.
+const scrapeMaxBytes = 20 << 20
+
+var (
+	hostMu   sync.Mutex
+	hostNext = map[string]time.Time{}
+	// hostDelay is the least time between two requests to a host asked for
+	// by its robots.txt, when longer than Scraper.Delay.
+	hostDelay = map[string]time.Duration{}
+)
+
+// setHostDelay sets the least time between two requests to host.
+func setHostDelay(host string, d time.Duration) {
+	hostMu.Lock()
+	defer hostMu.Unlock()
+	hostDelay[host] = d
+}
+
+// waitForHost sleeps until Scraper.Delay, or the delay set for host, has
+// passed since the last request to host, or ctx is done.
+func waitForHost(ctx context.Context, host string) {
+	hostMu.Lock()
+	delay := max(Scraper.Delay, hostDelay[host])
+	if delay <= 0 {
+		hostMu.Unlock()
+		return
+	}
+	now := time.Now()
+	at := hostNext[host]
+	if at.Before(now) {
+		at = now
+	}
+	hostNext[host] = at.Add(delay)
+	hostMu.Unlock()
+	select {
+	case <-time.After(time.Until(at)):
+	case <-ctx.Done():
+	}
+}
+
+// scrapeGet fetches a URL with the Scraper settings. The body must be
+// closed, and only its first scrapeMaxBytes are read.
+func scrapeGet(ctx context.Context, rawURL string) (*http.Response, error) {
+	r, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if Scraper.UserAgent != "" {
+		r.Header.Set("User-Agent", Scraper.UserAgent)
+	}
+	if Scraper.AcceptLanguage != "" {
+		r.Header.Set("Accept-Language", Scraper.AcceptLanguage)
+	}
+	waitForHost(ctx, r.URL.Host)
+	// The client's transport is looked up on every request, so it is the
+	// http.DefaultTransport set up by the caller.
+	client := http.Client{Timeout: Scraper.Timeout}
+	res, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, &statusError{URL: rawURL, StatusCode: res.StatusCode, Status: res.Status}
+	}
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(res.Body, scrapeMaxBytes), res.Body}
+	return res, nil
+}
+
+// statusError is returned by scrapeGet for responses other than 200 OK.
+type statusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.URL, e.Status)
+}
+
+func httpGet(ctx context.Context, rawURL string) ([]byte, error) {
+	res, err := scrapeGet(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return io.ReadAll(res.Body)
+}
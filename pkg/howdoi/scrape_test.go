@@ -0,0 +1,56 @@
+package howdoi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrapeGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/big":
+			io.WriteString(w, strings.Repeat("x", scrapeMaxBytes+1000))
+		case "/slow":
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		case "/agent":
+			io.WriteString(w, r.Header.Get("User-Agent"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	saved := Scraper
+	defer func() { Scraper = saved }()
+
+	b, err := httpGet(context.Background(), srv.URL+"/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != scrapeMaxBytes {
+		t.Errorf("read %d bytes, want %d", len(b), scrapeMaxBytes)
+	}
+	if b, err := httpGet(context.Background(), srv.URL+"/agent"); err != nil || string(b) != Scraper.UserAgent {
+		t.Errorf("got user agent %q, %v, want %q", b, err, Scraper.UserAgent)
+	}
+	if _, err := httpGet(context.Background(), srv.URL+"/missing"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got %v, want a 404 error", err)
+	}
+	Scraper.Timeout = 100 * time.Millisecond
+	if _, err := httpGet(context.Background(), srv.URL+"/slow"); err == nil {
+		t.Error("a request slower than the timeout succeeded")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := httpGet(ctx, srv.URL+"/agent"); err == nil {
+		t.Error("a request with a cancelled context succeeded")
+	}
+}
@@ -0,0 +1,91 @@
+package howdoi
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ScrapeTTL is how long a page scraped by howdoi is read from the scrappy
+// database before it is scraped again. Notes saved by scrappy itself do not
+// expire.
+var ScrapeTTL = 7 * 24 * time.Hour
+
+// openScrappyDB opens the scrappy notes database, creating it when scrappy
+// is not installed. scraped_at is added to record when howdoi scraped a
+// page; it is NULL for notes saved by scrappy.
+func openScrappyDB() (*sql.DB, error) {
+	dir := filepath.Join(os.Getenv("HOME"), ".scrappy")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	// Pages loaded at once write to it at the same time.
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "scrappy_notes.db")+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS notes (url TEXT PRIMARY KEY, content TEXT NOT NULL, scraped_at INTEGER)"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('notes') WHERE name = 'scraped_at'").Scan(&n); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if n == 0 {
+		if _, err := db.Exec("ALTER TABLE notes ADD COLUMN scraped_at INTEGER"); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// getContentFromScrappyDB returns the saved content of a URL, or "" when
+// there is none or howdoi scraped it longer than ScrapeTTL ago.
+func getContentFromScrappyDB(url string) (string, error) {
+	db, err := openScrappyDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var content string
+	var scrapedAt sql.NullInt64
+	err = db.QueryRow("SELECT content, scraped_at FROM notes WHERE url = ?", url).Scan(&content, &scrapedAt)
+	if err == sql.ErrNoRows {
+		return "", nil // No content found, but not an error
+	}
+	if err != nil {
+		return "", err
+	}
+	if scrapedAt.Valid && time.Since(time.Unix(scrapedAt.Int64, 0)) > ScrapeTTL {
+		return "", nil
+	}
+	return content, nil
+}
+
+// saveContentToScrappyDB stores the scraped content of a URL. Notes saved by
+// scrappy itself are left alone.
+func saveContentToScrappyDB(url, content string) error {
+	db, err := openScrappyDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var scrapedAt sql.NullInt64
+	err = db.QueryRow("SELECT scraped_at FROM notes WHERE url = ?", url).Scan(&scrapedAt)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = db.Exec("INSERT INTO notes (url, content, scraped_at) VALUES (?, ?, ?)", url, content, time.Now().Unix())
+	case err != nil:
+	case scrapedAt.Valid:
+		_, err = db.Exec("UPDATE notes SET content = ?, scraped_at = ? WHERE url = ?", content, time.Now().Unix(), url)
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package howdoi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// snapshotVersion is bumped when the snapshot format changes.
+const snapshotVersion = 1
+
+// Snapshot is a fully rendered request as saved to a prompt file, so it can
+// be resent exactly, attached to a bug report, or kept under version
+// control. API keys and headers are left out, and tools are saved by name.
+type Snapshot struct {
+	Version     int               `json:"version"`
+	Model       string            `json:"model"`
+	ModelID     string            `json:"model_id"`
+	Provider    string            `json:"provider"`
+	URL         string            `json:"url,omitempty"`
+	Vendor      Vendor            `json:"vendor"`
+	System      string            `json:"system,omitempty"`
+	Messages    []Message         `json:"messages"`
+	MaxTokens   int               `json:"max_tokens"`
+	Temperature float32           `json:"temperature"`
+	StoreIDs    []string          `json:"store_ids,omitempty"`
+	Thinking    int               `json:"thinking,omitempty"`
+	JSONMode    bool              `json:"json_mode,omitempty"`
+	Schema      map[string]any    `json:"schema,omitempty"`
+	Tools       []string          `json:"tools,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	// CodeExecution and GoogleSearch are Gemini's built-in tools, and
+	// WebSearch the provider's web search.
+	CodeExecution bool `json:"code_execution,omitempty"`
+	GoogleSearch  bool `json:"google_search,omitempty"`
+	WebSearch     bool `json:"web_search,omitempty"`
+}
+
+// NewSnapshot captures a request.
+func NewSnapshot(req Request) Snapshot {
+	s := Snapshot{
+		Version:       snapshotVersion,
+		Model:         req.Model,
+		ModelID:       req.ModelID,
+		Provider:      req.Provider,
+		URL:           req.URL,
+		Vendor:        req.Vendor,
+		System:        req.System,
+		Messages:      req.Messages,
+		MaxTokens:     req.MaxTokens,
+		Temperature:   req.Temperature,
+		StoreIDs:      req.StoreIDs,
+		Thinking:      req.Thinking,
+		JSONMode:      req.JSONMode,
+		Schema:        req.Schema,
+		Metadata:      req.Metadata,
+		CodeExecution: req.CodeExecution,
+		GoogleSearch:  req.GoogleSearch,
+		WebSearch:     req.WebSearch,
+	}
+	for _, t := range req.Tools {
+		s.Tools = append(s.Tools, t.Name)
+	}
+	return s
+}
+
+// Resolve returns the model of the snapshot with the API key read from the
+// environment.
+func (s Snapshot) Resolve() (ResolvedModel, error) {
+	m := ResolvedModel{ModelID: s.ModelID, Provider: s.Provider, Vendor: s.Vendor, URL: s.URL, APIKey: APIKey(s.Vendor.KeyEnv)}
+	if m.APIKey == "" && !s.Vendor.Custom {
+		return m, fmt.Errorf("%w: set %s or store a key in the keychain", ErrNoAPIKey, s.Vendor.KeyEnv)
+	}
+	return m, nil
+}
+
+// SaveSnapshot writes the request to a prompt file. The same request always
+// gives the same file.
+func SaveSnapshot(path string, req Request) error {
+	b, err := json.MarshalIndent(NewSnapshot(req), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// LoadSnapshot reads a prompt file written by SaveSnapshot.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("%s has snapshot version %d, expected %d", path, s.Version, snapshotVersion)
+	}
+	if len(s.Messages) == 0 {
+		return nil, errors.New("the prompt file has no messages")
+	}
+	return &s, nil
+}
@@ -0,0 +1,133 @@
+package howdoi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// sseEvent is a single server-sent event.
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// readSSE parses a server-sent event stream and calls fn for every event.
+// Multi-line data fields are joined with newlines and comment lines are
+// ignored, as described in the HTML living standard. Parsing stops at the end
+// of the stream or when fn returns an error; errStreamDone stops it cleanly.
+func readSSE(r io.Reader, fn func(sseEvent) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var ev sseEvent
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			ev = sseEvent{}
+			return nil
+		}
+		ev.Data = strings.Join(data, "\n")
+		err := fn(ev)
+		ev, data = sseEvent{}, nil
+		return err
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			if err := dispatch(); err != nil {
+				return filterStreamDone(err)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	// A stream may end without a trailing blank line.
+	return filterStreamDone(dispatch())
+}
+
+// errStreamDone is returned by event handlers to stop reading a stream.
+var errStreamDone = errors.New("stream done")
+
+func filterStreamDone(err error) error {
+	if errors.Is(err, errStreamDone) {
+		return nil
+	}
+	return err
+}
+
+// Delta is an increment of streamed output. Reasoning carries the model's
+// thinking, when the provider exposes it, separately from the answer text.
+type Delta struct {
+	Text      string
+	Reasoning string
+	ToolCall  *ToolCallDelta
+	// Citation is a web page cited by the text before it, from a provider's
+	// web search.
+	Citation *Citation
+	// Usage is sent once a response is complete.
+	Usage *Usage
+	// RequestID is the provider's id of the request, sent with the usage
+	// when the provider gives one.
+	RequestID string
+	// Err is the error that ended the stream early, like a dropped
+	// connection or an error event from the provider.
+	Err error
+	// Done marks the end of an answer that completed, after every turn.
+	Done bool
+}
+
+// Citation is a source of an answer.
+type Citation struct {
+	URL   string
+	Title string
+}
+
+// streamHandler turns provider stream events into deltas, recording usage as
+// it goes.
+type streamHandler func(ev sseEvent, usage *Usage, emit func(Delta)) error
+
+// streamResponse reads the event stream in the response body on a goroutine
+// and sends the deltas to the returned channel, then the error that stopped
+// it, if any, and the usage.
+func streamResponse(model string, res *http.Response, handle streamHandler, verbose bool) chan Delta {
+	respChan := make(chan Delta)
+	go func() {
+		defer close(respChan)
+		defer res.Body.Close()
+		var usage Usage
+		// OpenAI and most compatible APIs name the header x-request-id,
+		// Anthropic request-id.
+		requestID := res.Header.Get("x-request-id")
+		if requestID == "" {
+			requestID = res.Header.Get("request-id")
+		}
+
+		err := readSSE(res.Body, func(ev sseEvent) error {
+			return handle(ev, &usage, func(d Delta) { respChan <- d })
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			respChan <- Delta{Err: fmt.Errorf("reading the response: %w", err)}
+		}
+		respChan <- Delta{Usage: &usage, RequestID: requestID}
+	}()
+	return respChan
+}
@@ -0,0 +1,77 @@
+package howdoi
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadSSE(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []sseEvent
+	}{
+		{"data only", "data: a\n\ndata: b\n\n", []sseEvent{{Data: "a"}, {Data: "b"}}},
+		{"named events", "event: ping\ndata: {}\n\n", []sseEvent{{Event: "ping", Data: "{}"}}},
+		{"multi-line data", "data: a\ndata: b\n\n", []sseEvent{{Data: "a\nb"}}},
+		{"CRLF line endings", "data: a\r\n\r\n", []sseEvent{{Data: "a"}}},
+		{"comments are skipped", ": keep-alive\ndata: a\n\n", []sseEvent{{Data: "a"}}},
+		{"no space after the colon", "data:a\n\n", []sseEvent{{Data: "a"}}},
+		{"events without data are dropped", "event: ping\n\ndata: a\n\n", []sseEvent{{Data: "a"}}},
+		{"no trailing blank line", "data: a", []sseEvent{{Data: "a"}}},
+		{"unknown fields", "id: 1\nretry: 10\ndata: a\n\n", []sseEvent{{Data: "a"}}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []sseEvent
+			err := readSSE(strings.NewReader(tt.stream), func(ev sseEvent) error {
+				got = append(got, ev)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSSEStops(t *testing.T) {
+	stream := "data: a\n\ndata: b\n\ndata: c\n\n"
+	var n int
+	err := readSSE(strings.NewReader(stream), func(ev sseEvent) error {
+		n++
+		if ev.Data == "b" {
+			return errStreamDone
+		}
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Errorf("errStreamDone: got %d events and %v, want 2 and nil", n, err)
+	}
+
+	failed := errors.New("failed")
+	err = readSSE(strings.NewReader(stream), func(sseEvent) error { return failed })
+	if !errors.Is(err, failed) {
+		t.Errorf("got %v, want %v", err, failed)
+	}
+}
+
+// handleEvents runs a stream handler over events with the given data, as
+// streamResponse does, and returns what it emitted, the usage, and the error
+// that stopped it.
+func handleEvents(handle streamHandler, data ...string) ([]Delta, Usage, error) {
+	var deltas []Delta
+	var usage Usage
+	for _, d := range data {
+		if err := handle(sseEvent{Data: d}, &usage, func(d Delta) { deltas = append(deltas, d) }); err != nil {
+			return deltas, usage, err
+		}
+	}
+	return deltas, usage, nil
+}
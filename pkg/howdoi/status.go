@@ -0,0 +1,81 @@
+package howdoi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ProviderStatus is the result of checking a provider.
+type ProviderStatus struct {
+	Provider string
+	// KeyEnv is the environment variable of the API key, "" for servers
+	// that take none.
+	KeyEnv string
+	// NoKey is set when the API key is missing, and the provider was not
+	// checked.
+	NoKey   bool
+	Latency time.Duration
+	Err     error
+}
+
+// modelsURL returns the endpoint listing the models of a provider, which
+// every supported API has and which costs nothing to call.
+func modelsURL(v Vendor) string {
+	switch v.API {
+	case "google":
+		return "https://generativelanguage.googleapis.com/v1beta/models"
+	case "anthropic":
+		return strings.TrimSuffix(v.URL, "/messages") + "/models"
+	}
+	return strings.TrimSuffix(v.URL, "/chat/completions") + "/models"
+}
+
+// CheckProvider lists the models of a provider to check that it is up and
+// accepts the API key, and times the request.
+func (c *Client) CheckProvider(ctx context.Context, provider string) ProviderStatus {
+	v, ok := vendors[provider]
+	s := ProviderStatus{Provider: provider, KeyEnv: v.KeyEnv}
+	if !ok {
+		s.Err = fmt.Errorf("unknown provider %q", provider)
+		return s
+	}
+	key := ""
+	if v.KeyEnv != "" {
+		if key = APIKey(v.KeyEnv); key == "" {
+			s.NoKey = true
+			return s
+		}
+	}
+
+	r, err := http.NewRequestWithContext(ctx, "GET", modelsURL(v), nil)
+	if err != nil {
+		s.Err = err
+		return s
+	}
+	switch v.API {
+	case "google":
+		r.Header.Set("x-goog-api-key", key)
+	case "anthropic":
+		r.Header.Set("x-api-key", key)
+		r.Header.Set("anthropic-version", "2023-06-01")
+	default:
+		if key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+	}
+
+	start := time.Now()
+	res, err := c.do(r, false)
+	s.Latency = time.Since(start)
+	if err != nil {
+		s.Err = err
+		return s
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	return s
+}
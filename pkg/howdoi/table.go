@@ -0,0 +1,279 @@
+package howdoi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tableExts are the tabular formats summarized instead of sent whole, with
+// their delimiter. Parquet is read as CSV from DuckDB.
+var tableExts = map[string]rune{".csv": ',', ".tsv": '\t', ".parquet": ','}
+
+// DefaultTableRows is the number of rows of a table sent when
+// LoadOptions.Rows is 0.
+const DefaultTableRows = 50
+
+// maxDistinct is the most distinct values counted per column.
+const maxDistinct = 1000
+
+// tableDateLayouts are the date formats recognized in columns.
+var tableDateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02", "01/02/2006", "2006/01/02"}
+
+// tableColumn gathers what the summary says about a column as rows are read.
+type tableColumn struct {
+	name  string
+	empty int
+	// The values seen so far all parse as each of these.
+	isInt, isNumber, isBool, isDate bool
+	seen, counted                   bool
+	min, max                        float64
+	minDate, maxDate                time.Time
+	minText, maxText                string
+	distinct                        map[string]bool
+}
+
+func (c *tableColumn) add(v string) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		c.empty++
+		return
+	}
+	if !c.seen {
+		c.seen = true
+		c.isInt, c.isNumber, c.isBool, c.isDate = true, true, true, true
+	}
+	if len(c.distinct) <= maxDistinct {
+		c.distinct[v] = true
+	}
+	if c.isInt {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			c.isInt = false
+		}
+	}
+	if c.isNumber {
+		if f, err := strconv.ParseFloat(v, 64); err != nil {
+			c.isNumber = false
+		} else if !c.counted {
+			c.min, c.max, c.counted = f, f, true
+		} else {
+			c.min, c.max = min(c.min, f), max(c.max, f)
+		}
+	}
+	if c.isBool {
+		switch strings.ToLower(v) {
+		case "true", "false":
+		default:
+			c.isBool = false
+		}
+	}
+	if c.isDate {
+		t, ok := parseTableDate(v)
+		switch {
+		case !ok:
+			c.isDate = false
+		case c.minDate.IsZero() || t.Before(c.minDate):
+			c.minDate, c.minText = t, v
+		}
+		if ok && t.After(c.maxDate) {
+			c.maxDate, c.maxText = t, v
+		}
+	}
+}
+
+func parseTableDate(v string) (time.Time, bool) {
+	for _, layout := range tableDateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// describe returns the type of the column and what is known of its values.
+func (c *tableColumn) describe() string {
+	var parts []string
+	switch {
+	case !c.seen:
+		parts = append(parts, "always empty")
+	case c.isBool:
+		parts = append(parts, "boolean")
+	case c.isInt:
+		parts = append(parts, fmt.Sprintf("integer, %s to %s", strconv.FormatFloat(c.min, 'f', -1, 64), strconv.FormatFloat(c.max, 'f', -1, 64)))
+	case c.isNumber:
+		parts = append(parts, fmt.Sprintf("number, %s to %s", strconv.FormatFloat(c.min, 'g', -1, 64), strconv.FormatFloat(c.max, 'g', -1, 64)))
+	case c.isDate:
+		parts = append(parts, fmt.Sprintf("date, %s to %s", c.minText, c.maxText))
+	default:
+		parts = append(parts, "text")
+	}
+	if c.seen && !c.isBool {
+		if len(c.distinct) > maxDistinct {
+			parts = append(parts, fmt.Sprintf("over %d distinct values", maxDistinct))
+		} else if len(c.distinct) == 1 {
+			parts = append(parts, "1 distinct value")
+		} else {
+			parts = append(parts, fmt.Sprintf("%d distinct values", len(c.distinct)))
+		}
+	}
+	if c.seen && c.empty > 0 {
+		parts = append(parts, fmt.Sprintf("%d empty", c.empty))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sampledRow is a row of a table shown in its summary, numbered from 1 after
+// the header.
+type sampledRow struct {
+	n      int
+	fields []string
+}
+
+// summarizeTable reads a table with a header row and returns the number of
+// rows and columns, what each column holds, and the first half of rows rows
+// followed by a sample of the rest. Tables of up to rows rows are shown
+// whole. The sample is the same on every run, so the prompt can be cached.
+func summarizeTable(r io.Reader, comma rune, rows int) (string, error) {
+	if rows <= 0 {
+		rows = DefaultTableRows
+	}
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return "The table is empty.\n", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	columns := make([]*tableColumn, len(header))
+	for i, name := range header {
+		columns[i] = &tableColumn{name: name, distinct: map[string]bool{}}
+	}
+
+	head := rows - rows/2
+	var sample []sampledRow
+	rng := rand.New(rand.NewPCG(1, 2))
+	total := 0
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		total++
+		for i, v := range rec {
+			if i < len(columns) {
+				columns[i].add(v)
+			}
+		}
+		// The first rows are kept, and a reservoir sample of the rest.
+		switch {
+		case len(sample) < rows:
+			sample = append(sample, sampledRow{total, rec})
+		default:
+			if j := head + rng.IntN(total-head); j < rows {
+				sample[j] = sampledRow{total, rec}
+			}
+		}
+	}
+	slices.SortFunc(sample, func(a, b sampledRow) int { return a.n - b.n })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Table with %d rows and %d columns.", total, len(columns))
+	whole := total <= rows
+	if !whole {
+		fmt.Fprintf(&b, " %d rows are shown: the first %d and %d sampled from the rest, numbered in the row column.", len(sample), head, len(sample)-head)
+	}
+	b.WriteString("\n\nColumns:\n")
+	for _, c := range columns {
+		fmt.Fprintf(&b, "- %s: %s\n", c.name, c.describe())
+	}
+	b.WriteString("\nRows:\n")
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+	w.Comma = comma
+	if whole {
+		w.Write(header)
+	} else {
+		w.Write(append([]string{"row"}, header...))
+	}
+	for _, s := range sample {
+		if whole {
+			w.Write(s.fields)
+		} else {
+			w.Write(append([]string{strconv.Itoa(s.n)}, s.fields...))
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	b.Write(out.Bytes())
+	return b.String(), nil
+}
+
+// readTable summarizes a CSV, TSV, or Parquet file, see summarizeTable.
+func readTable(file, ext string, rows int) (string, error) {
+	if ext != ".parquet" {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		return summarizeTable(f, tableExts[ext], rows)
+	}
+	if _, err := exec.LookPath("duckdb"); err != nil {
+		return "", errors.New("reading Parquet files needs duckdb")
+	}
+	query := fmt.Sprintf("SELECT * FROM read_parquet('%s')", strings.ReplaceAll(file, "'", "''"))
+	cmd := exec.Command("duckdb", "-csv", "-c", query)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	summary, err := summarizeTable(stdout, ',', rows)
+	// Drain what a failed summary left so duckdb can exit.
+	io.Copy(io.Discard, stdout)
+	if werr := cmd.Wait(); werr != nil {
+		return "", fmt.Errorf("running duckdb: %v: %s", werr, strings.TrimSpace(stderr.String()))
+	}
+	return summary, err
+}
+
+func loadTable(file, ext string, opts LoadOptions) ([]any, *Attachment, error) {
+	att, err := fileAttachment(file, "table", ext[1:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading table file: %w", err)
+	}
+	summary, err := readTable(file, ext, opts.Rows)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+	doc, err := RenderDocument(Document{Source: file, Content: summary})
+	if err != nil {
+		return nil, nil, err
+	}
+	return []any{doc}, att, nil
+}
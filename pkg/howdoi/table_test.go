@@ -0,0 +1,83 @@
+package howdoi
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		comma rune
+		want  string
+	}{
+		{
+			name:  "empty",
+			table: "",
+			comma: ',',
+			want:  "The table is empty.\n",
+		},
+		{
+			name:  "column types",
+			table: "\ufeffid,price,ok,day,name,note\n1,2.5,true,2024-01-02,b,\n3,-1,false,2023-12-31,a,\n2,10,TRUE,2024-03-01,b,\n",
+			comma: ',',
+			want: "Table with 3 rows and 6 columns.\n\nColumns:\n" +
+				"- id: integer, 1 to 3, 3 distinct values\n" +
+				"- price: number, -1 to 10, 3 distinct values\n" +
+				"- ok: boolean\n" +
+				"- day: date, 2023-12-31 to 2024-03-01, 3 distinct values\n" +
+				"- name: text, 2 distinct values\n" +
+				"- note: always empty\n" +
+				"\nRows:\nid,price,ok,day,name,note\n1,2.5,true,2024-01-02,b,\n3,-1,false,2023-12-31,a,\n2,10,TRUE,2024-03-01,b,\n",
+		},
+		{
+			name:  "tabs and empty cells",
+			table: "a\tb\nx\t\ny\t1\n",
+			comma: '\t',
+			want:  "Table with 2 rows and 2 columns.\n\nColumns:\n- a: text, 2 distinct values\n- b: integer, 1 to 1, 1 distinct value, 1 empty\n\nRows:\na\tb\nx\t\ny\t1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := summarizeTable(strings.NewReader(tt.table), tt.comma, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeTableSample(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("n\n")
+	for i := 1; i <= 1000; i++ {
+		fmt.Fprintf(&b, "%d\n", i)
+	}
+	got, err := summarizeTable(strings.NewReader(b.String()), ',', 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := summarizeTable(strings.NewReader(b.String()), ',', 10)
+	if got != again {
+		t.Error("the sample differs between runs")
+	}
+	if !strings.HasPrefix(got, "Table with 1000 rows and 1 columns. 10 rows are shown: the first 5 and 5 sampled from the rest") {
+		t.Errorf("got header %q", strings.SplitN(got, "\n", 2)[0])
+	}
+	_, rows, _ := strings.Cut(got, "\nRows:\n")
+	lines := strings.Split(strings.TrimSpace(rows), "\n")
+	if len(lines) != 11 || lines[0] != "row,n" || lines[1] != "1,1" || lines[5] != "5,5" {
+		t.Errorf("got rows %q", lines)
+	}
+	for _, l := range lines[6:] {
+		n, v, _ := strings.Cut(l, ",")
+		if n != v {
+			t.Errorf("row %s has the value %s", n, v)
+		}
+	}
+}
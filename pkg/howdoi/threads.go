@@ -0,0 +1,340 @@
+package howdoi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// threadComments is how many top level comments of a thread are kept.
+	threadComments = 20
+	// threadReplies is how many replies to a comment are kept.
+	threadReplies = 5
+	// threadDepth is how deep replies are followed.
+	threadDepth = 3
+)
+
+// thread is a discussion post and its top comments.
+type thread struct {
+	Title    string
+	Meta     string
+	Link     string
+	Text     string
+	Comments []threadComment
+}
+
+type threadComment struct {
+	Author string
+	// Score is shown when it is set; Hacker News does not publish it.
+	Score   *int
+	Text    string
+	Replies []threadComment
+}
+
+// markdown renders a thread with its comments as nested lists.
+func (t thread) markdown() string {
+	var b strings.Builder
+	b.WriteString("# " + t.Title + "\n\n" + t.Meta + "\n")
+	if t.Link != "" {
+		b.WriteString("\nLink: " + t.Link + "\n")
+	}
+	if t.Text != "" {
+		b.WriteString("\n" + t.Text + "\n")
+	}
+	if len(t.Comments) > 0 {
+		b.WriteString("\n## Comments\n\n")
+		writeComments(&b, t.Comments, 0)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func writeComments(b *strings.Builder, comments []threadComment, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, c := range comments {
+		head := "**" + c.Author + "**"
+		if c.Score != nil {
+			head += fmt.Sprintf(" (%d points)", *c.Score)
+		}
+		lines := strings.Split(strings.TrimSpace(c.Text), "\n")
+		for i := 1; i < len(lines); i++ {
+			if lines[i] != "" {
+				lines[i] = indent + "  " + lines[i]
+			}
+		}
+		b.WriteString(indent + "- " + head + ": " + strings.Join(lines, "\n") + "\n")
+		writeComments(b, c.Replies, depth+1)
+	}
+}
+
+// keepComments drops empty comments and trims a level of replies to n.
+func keepComments(comments []threadComment, n int) []threadComment {
+	var kept []threadComment
+	for _, c := range comments {
+		if len(kept) == n {
+			break
+		}
+		if strings.TrimSpace(c.Text) == "" && len(c.Replies) == 0 {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// redditHosts are the hosts reddit threads are linked from.
+var redditHosts = map[string]bool{
+	"reddit.com": true, "www.reddit.com": true, "old.reddit.com": true,
+	"new.reddit.com": true, "np.reddit.com": true, "m.reddit.com": true,
+}
+
+// redditThreadPath returns the path of a reddit thread's JSON, or "" for
+// other URLs. Links to a comment keep only that comment's subthread.
+func redditThreadPath(u *url.URL) string {
+	if u.Hostname() == "redd.it" {
+		if id := strings.Trim(u.Path, "/"); id != "" && !strings.Contains(id, "/") {
+			return "/comments/" + id
+		}
+		return ""
+	}
+	if !redditHosts[u.Hostname()] {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, p := range parts {
+		if p != "comments" || i+1 >= len(parts) {
+			continue
+		}
+		path := "/comments/" + parts[i+1]
+		if i+3 < len(parts) {
+			path += "/_/" + parts[i+3]
+		}
+		return path
+	}
+	return ""
+}
+
+func isRedditThreadURL(u *url.URL) bool {
+	return redditThreadPath(u) != ""
+}
+
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Kind string          `json:"kind"`
+			Data json.RawMessage `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+type redditPost struct {
+	Title       string `json:"title"`
+	Author      string `json:"author"`
+	Subreddit   string `json:"subreddit"`
+	Score       int    `json:"score"`
+	NumComments int    `json:"num_comments"`
+	Selftext    string `json:"selftext"`
+	URL         string `json:"url"`
+	IsSelf      bool   `json:"is_self"`
+}
+
+type redditComment struct {
+	Author string `json:"author"`
+	Score  int    `json:"score"`
+	Body   string `json:"body"`
+	// Replies is "" when there are none, or else a listing.
+	Replies json.RawMessage `json:"replies"`
+}
+
+// fetchRedditThread returns a reddit post and its top comments from the
+// thread's JSON.
+func fetchRedditThread(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("sort", "top")
+	q.Set("limit", strconv.Itoa(threadComments))
+	q.Set("depth", strconv.Itoa(threadDepth))
+	q.Set("raw_json", "1")
+	b, err := httpGet(ctx, "https://www.reddit.com"+redditThreadPath(u)+".json?"+q.Encode())
+	if err != nil {
+		return "", err
+	}
+	var listings []redditListing
+	if err := json.Unmarshal(b, &listings); err != nil {
+		return "", fmt.Errorf("parsing the thread: %w", err)
+	}
+	if len(listings) != 2 || len(listings[0].Data.Children) == 0 {
+		return "", fmt.Errorf("parsing the thread: unexpected response")
+	}
+	var post redditPost
+	if err := json.Unmarshal(listings[0].Data.Children[0].Data, &post); err != nil {
+		return "", fmt.Errorf("parsing the post: %w", err)
+	}
+	t := thread{
+		Title:    post.Title,
+		Meta:     fmt.Sprintf("r/%s, posted by u/%s, %d points, %d comments", post.Subreddit, post.Author, post.Score, post.NumComments),
+		Text:     post.Selftext,
+		Comments: keepComments(redditComments(listings[1], 0), threadComments),
+	}
+	if !post.IsSelf {
+		t.Link = post.URL
+	}
+	return t.markdown(), nil
+}
+
+func redditComments(l redditListing, depth int) []threadComment {
+	var comments []threadComment
+	for _, c := range l.Data.Children {
+		// "more" stands in for comments that were not sent.
+		if c.Kind != "t1" {
+			continue
+		}
+		var rc redditComment
+		if err := json.Unmarshal(c.Data, &rc); err != nil {
+			continue
+		}
+		if rc.Body == "[deleted]" || rc.Body == "[removed]" {
+			rc.Body = ""
+		}
+		score := rc.Score
+		tc := threadComment{Author: "u/" + rc.Author, Score: &score, Text: rc.Body}
+		var replies redditListing
+		if depth+1 < threadDepth && json.Unmarshal(rc.Replies, &replies) == nil {
+			tc.Replies = keepComments(redditComments(replies, depth+1), threadReplies)
+		}
+		comments = append(comments, tc)
+	}
+	return comments
+}
+
+// hackerNewsID returns the item ID of a Hacker News link, or "" for other
+// URLs.
+func hackerNewsID(u *url.URL) string {
+	if u.Hostname() != "news.ycombinator.com" || u.Path != "/item" {
+		return ""
+	}
+	id := u.Query().Get("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		return ""
+	}
+	return id
+}
+
+func isHackerNewsURL(u *url.URL) bool {
+	return hackerNewsID(u) != ""
+}
+
+type hnItem struct {
+	ID       int      `json:"id"`
+	Author   string   `json:"author"`
+	Title    string   `json:"title"`
+	URL      string   `json:"url"`
+	Text     string   `json:"text"`
+	Points   *int     `json:"points"`
+	Children []hnItem `json:"children"`
+}
+
+// fetchHackerNewsThread returns a Hacker News story and its top comments.
+// Algolia's API sends the whole tree at once; the official API has the
+// order the comments are ranked in on the site.
+func fetchHackerNewsThread(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	id := hackerNewsID(u)
+	b, err := httpGet(ctx, "https://hn.algolia.com/api/v1/items/"+id)
+	if err != nil {
+		return "", err
+	}
+	var item hnItem
+	if err := json.Unmarshal(b, &item); err != nil {
+		return "", fmt.Errorf("parsing the thread: %w", err)
+	}
+	if b, err := httpGet(ctx, "https://hacker-news.firebaseio.com/v0/item/"+id+".json"); err == nil {
+		var ranked struct {
+			Kids []int `json:"kids"`
+		}
+		if json.Unmarshal(b, &ranked) == nil {
+			item.Children = rankItems(item.Children, ranked.Kids)
+		}
+	}
+
+	meta := "Hacker News, posted by " + item.Author
+	if item.Points != nil {
+		meta += fmt.Sprintf(", %d points", *item.Points)
+	}
+	title := item.Title
+	if title == "" {
+		// A link to a comment.
+		title = "Comment by " + item.Author
+		item.Children = []hnItem{{Author: item.Author, Text: item.Text, Children: item.Children}}
+		item.Text = ""
+	}
+	t := thread{
+		Title:    title,
+		Meta:     meta,
+		Link:     item.URL,
+		Text:     htmlToMarkdown(item.Text),
+		Comments: keepComments(hnComments(item.Children, 0), threadComments),
+	}
+	return t.markdown(), nil
+}
+
+// rankItems orders items by their position in ids. Items not in ids go last.
+func rankItems(items []hnItem, ids []int) []hnItem {
+	pos := make(map[int]int, len(ids))
+	for i, id := range ids {
+		pos[id] = i
+	}
+	rank := func(it hnItem) int {
+		if i, ok := pos[it.ID]; ok {
+			return i
+		}
+		return len(ids)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return rank(items[i]) < rank(items[j]) })
+	return items
+}
+
+func hnComments(items []hnItem, depth int) []threadComment {
+	var comments []threadComment
+	for _, it := range items {
+		c := threadComment{Author: it.Author, Text: htmlToMarkdown(it.Text)}
+		if c.Author == "" {
+			c.Author = "[deleted]"
+		}
+		if depth+1 < threadDepth {
+			c.Replies = keepComments(hnComments(it.Children, depth+1), threadReplies)
+		}
+		comments = append(comments, c)
+	}
+	return comments
+}
+
+// htmlToMarkdown converts an HTML fragment, such as a Hacker News comment,
+// to markdown.
+func htmlToMarkdown(s string) string {
+	if s == "" {
+		return ""
+	}
+	nodes, err := html.ParseFragment(strings.NewReader(s), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return html.UnescapeString(s)
+	}
+	md := &markdown{}
+	for _, n := range nodes {
+		md.node(n)
+	}
+	return md.String()
+}
@@ -0,0 +1,159 @@
+package howdoi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// ErrContextWindow is returned when a prompt does not fit in the context
+// window of the model.
+var ErrContextWindow = errors.New("the prompt exceeds the context window")
+
+// CountTokens counts the prompt tokens of a request with the provider's own
+// tokenizer: tiktoken for OpenAI, the count tokens endpoint for Anthropic, and
+// CountTokens for Gemini. Other servers get EstimateTokens, and exact is
+// false.
+func CountTokens(ctx context.Context, req Request) (n int, exact bool, err error) {
+	switch {
+	case req.Provider == "google":
+		n, err = countGeminiTokens(ctx, req)
+	case req.Provider == "anthropic":
+		n, err = countAnthropicTokens(ctx, req)
+	case req.Vendor.URL == vendors["openai"].URL:
+		n, err = countOpenAITokens(req)
+	default:
+		return EstimateTokens(req), false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return n, true, nil
+}
+
+// countOpenAITokens counts tokens the way OpenAI documents for chat
+// messages. Images are estimated.
+func countOpenAITokens(req Request) (int, error) {
+	enc, err := tiktoken.EncodingForModel(req.ModelID)
+	if err != nil {
+		// Models newer than the tokenizer tables use o200k_base.
+		enc, err = tiktoken.GetEncoding("o200k_base")
+		if err != nil {
+			return 0, err
+		}
+	}
+	count := func(s string) int { return len(enc.Encode(s, nil, nil)) }
+	// Every reply is primed with <|start|>assistant<|message|>.
+	n := 3
+	if req.System != "" {
+		n += 4 + count(req.System)
+	}
+	for _, m := range req.Messages {
+		n += 4 + count(m.Role)
+		for _, c := range m.Content {
+			if t, ok := c.(TextContent); ok {
+				n += count(t.Text)
+			} else {
+				n += EstimateContentTokens([]any{c})
+			}
+		}
+	}
+	return n, nil
+}
+
+// countAnthropicTokens asks the count tokens endpoint, which is free.
+func countAnthropicTokens(ctx context.Context, req Request) (int, error) {
+	body := map[string]any{"model": req.ModelID, "messages": req.Messages}
+	if req.System != "" {
+		body["system"] = req.System
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = toolDefinitions(req.Provider, req.Tools)
+	}
+
+	auth := http.Header{}
+	auth.Set("x-api-key", req.APIKey)
+	auth.Set("anthropic-version", "2023-06-01")
+	betas := append([]string{"token-counting-2024-11-01"}, req.Betas...)
+	if hasDocuments(req.Messages) {
+		betas = append(betas, "pdfs-2024-09-25")
+	}
+	auth.Set("anthropic-beta", strings.Join(betas, ","))
+	req.URL = strings.TrimSuffix(req.URL, "/") + "/count_tokens"
+	r, err := newAPIRequest(ctx, req, body, auth)
+	if err != nil {
+		return 0, err
+	}
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("count tokens API: %s", res.Status)
+	}
+	var out struct {
+		InputTokens int `json:"input_tokens"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return 0, err
+	}
+	return out.InputTokens, nil
+}
+
+// countGeminiTokens counts the parts of all messages, with the system
+// prompt, as callGeminiAPI sends them.
+func countGeminiTokens(ctx context.Context, req Request) (int, error) {
+	client, err := genaiClient(ctx, APIKey("GEMINI_API_KEY"), req.Headers)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+	var parts []genai.Part
+	if req.System != "" {
+		parts = append(parts, genai.Text(req.System+"\n\n"))
+	}
+	for _, m := range req.Messages {
+		parts = append(parts, toGenaiParts(m.Content)...)
+	}
+	res, err := client.GenerativeModel(req.ModelID).CountTokens(ctx, parts...)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.TotalTokens), nil
+}
+
+// CheckContextWindow makes sure the prompt fits in the context window of the
+// model and returns its size. Prompts whose estimate is well within the
+// window are not counted, since counting can take a request. When the prompt
+// fits but leaves less room than max tokens for the answer, a warning is
+// logged.
+func CheckContextWindow(ctx context.Context, req Request) (int, error) {
+	c, ok := ModelCapabilities[req.ModelID]
+	n := EstimateTokens(req)
+	if !ok || n+req.MaxTokens < c.ContextWindow/2 {
+		return n, nil
+	}
+	what := "about "
+	if counted, exact, err := CountTokens(ctx, req); err != nil {
+		Logf("Error counting tokens, using an estimate: %v\n", err)
+	} else {
+		n = counted
+		if exact {
+			what = ""
+		}
+	}
+	if n > c.ContextWindow {
+		return n, fmt.Errorf("%w: it is %s%d tokens and %s reads at most %d", ErrContextWindow, what, n, req.ModelID, c.ContextWindow)
+	}
+	if n+req.MaxTokens > c.ContextWindow {
+		Logf("Warning: the prompt is %s%d tokens, which leaves %d of the %d output tokens asked for in the context window of %s\n", what, n, c.ContextWindow-n, req.MaxTokens, req.ModelID)
+	}
+	return n, nil
+}
@@ -0,0 +1,70 @@
+package howdoi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckContextWindow(t *testing.T) {
+	var count, calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/v1/messages/count_tokens" || r.Header.Get("x-api-key") != "key" || r.Header.Get("X-Gateway") != "1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"input_tokens": %d}`, count)
+	}))
+	defer srv.Close()
+
+	var logged string
+	defer func(logf func(string, ...any)) { Logf = logf }(Logf)
+	Logf = func(format string, args ...any) { logged += fmt.Sprintf(format, args...) }
+
+	// The window of the model is 200000 tokens, and the long prompt is
+	// estimated at 100000, which is counted.
+	long := strings.Repeat("a", 400000)
+	tests := []struct {
+		name    string
+		system  string
+		count   int
+		want    int
+		calls   int
+		warning bool
+		err     error
+	}{
+		{"well within the window is not counted", "short", 0, 1, 0, false, nil},
+		{"fits", long, 150000, 150000, 1, false, nil},
+		{"leaves too little room for the answer", long, 195000, 195000, 1, true, nil},
+		{"exceeds the window", long, 250000, 250000, 1, false, ErrContextWindow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, calls, logged = tt.count, 0, ""
+			req := Request{
+				ModelID:   "claude-3-5-sonnet-20241022",
+				Provider:  "anthropic",
+				URL:       srv.URL + "/v1/messages",
+				APIKey:    "key",
+				System:    tt.system,
+				MaxTokens: 8192,
+				Headers:   map[string]string{"X-Gateway": "1"},
+			}
+			n, err := CheckContextWindow(context.Background(), req)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if n != tt.want || calls != tt.calls {
+				t.Errorf("got %d tokens in %d calls, want %d in %d", n, calls, tt.want, tt.calls)
+			}
+			if warned := strings.HasPrefix(logged, "Warning:"); warned != tt.warning {
+				t.Errorf("got log %q, want a warning: %v", logged, tt.warning)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package howdoi
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Tool is a function the model can call while answering.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments object.
+	Parameters map[string]any
+	Run        func(args json.RawMessage) (string, error)
+}
+
+// maxToolTurns bounds the number of tool call rounds in one query.
+const maxToolTurns = 10
+
+// ToolCall is a complete call of a tool by the model.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// ToolCallDelta is a streamed piece of a tool call. Providers send the id and
+// name first and then the arguments in fragments, all with the same index.
+type ToolCallDelta struct {
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// ToolUseContent is a tool call in an assistant message, in the Anthropic
+// shape. It is also used to keep Gemini function calls in the history.
+type ToolUseContent struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+// ToolResultContent is the output of a tool call, in the Anthropic shape.
+type ToolResultContent struct {
+	Type      string `json:"type"`
+	ToolUseID string `json:"tool_use_id"`
+	Content   string `json:"content"`
+	// Name is needed for Gemini function responses.
+	Name string `json:"-"`
+}
+
+type OpenAIToolCall struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"`
+	Function OpenAIFunctionCall `json:"function"`
+}
+
+type OpenAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// toolDefinitions describes the tools in the request format of a provider.
+func toolDefinitions(provider string, tools []Tool) []any {
+	defs := make([]any, 0, len(tools))
+	for _, t := range tools {
+		if provider == "anthropic" {
+			defs = append(defs, map[string]any{
+				"name":         t.Name,
+				"description":  t.Description,
+				"input_schema": t.Parameters,
+			})
+			continue
+		}
+		defs = append(defs, map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  t.Parameters,
+			},
+		})
+	}
+	return defs
+}
+
+// runToolCalls runs the tool calls of a turn and returns the messages that
+// record them, the assistant's calls followed by their results, in the shape
+// expected by the provider.
+func runToolCalls(provider string, tools []Tool, answer string, calls []ToolCall, verbose bool) []Message {
+	assistant := Message{Role: "assistant"}
+	if answer != "" {
+		assistant.Content = append(assistant.Content, TextContent{Type: "text", Text: answer})
+	}
+	var results []Message
+	var resultParts []any
+	for _, call := range calls {
+		output := runTool(tools, call, verbose)
+		switch provider {
+		case "openai":
+			assistant.ToolCalls = append(assistant.ToolCalls, OpenAIToolCall{
+				ID:       call.ID,
+				Type:     "function",
+				Function: OpenAIFunctionCall{Name: call.Name, Arguments: call.Arguments},
+			})
+			results = append(results, Message{
+				Role:       "tool",
+				ToolCallID: call.ID,
+				Content:    []any{TextContent{Type: "text", Text: output}},
+			})
+		default:
+			args := json.RawMessage(call.Arguments)
+			if !json.Valid(args) {
+				args = json.RawMessage("{}")
+			}
+			assistant.Content = append(assistant.Content, ToolUseContent{Type: "tool_use", ID: call.ID, Name: call.Name, Input: args})
+			resultParts = append(resultParts, ToolResultContent{Type: "tool_result", ToolUseID: call.ID, Content: output, Name: call.Name})
+		}
+	}
+	if len(resultParts) > 0 {
+		results = append(results, Message{Role: "user", Content: resultParts})
+	}
+	return append([]Message{assistant}, results...)
+}
+
+// runTool runs a single tool call. Errors are returned to the model as the
+// output so it can correct itself.
+func runTool(tools []Tool, call ToolCall, verbose bool) string {
+	for _, t := range tools {
+		if t.Name != call.Name {
+			continue
+		}
+		if verbose {
+			Logf("Calling %s(%s)\n", call.Name, call.Arguments)
+		}
+		args := json.RawMessage(call.Arguments)
+		if len(args) == 0 {
+			args = json.RawMessage("{}")
+		}
+		out, err := t.Run(args)
+		if err != nil {
+			return "Error: " + err.Error()
+		}
+		return out
+	}
+	return fmt.Sprintf("Error: unknown tool %q", call.Name)
+}
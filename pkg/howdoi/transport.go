@@ -0,0 +1,76 @@
+package howdoi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// TransportOptions configure the connections to the providers for networks
+// that go through a proxy or intercept TLS.
+type TransportOptions struct {
+	// Proxy is the URL of the proxy for every request but those to the
+	// hosts in NO_PROXY. Without it HTTPS_PROXY and HTTP_PROXY are used.
+	Proxy string
+	// CACerts are PEM files of certificate authorities to trust on top of
+	// the system's, like that of a proxy that intercepts TLS.
+	CACerts []string
+	// Insecure skips verifying the certificates of servers.
+	Insecure bool
+}
+
+// NewTransport returns a copy of http.DefaultTransport with the options
+// applied. Setting it as http.DefaultTransport configures every provider and
+// the scraper. The genai SDK is given an HTTP client that uses it, see
+// genaiClient, since it makes a transport of its own otherwise.
+func NewTransport(o TransportOptions) (*http.Transport, error) {
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("http.DefaultTransport is not an *http.Transport")
+	}
+	t := base.Clone()
+	if o.Proxy != "" {
+		proxy := o.Proxy
+		if !strings.Contains(proxy, "://") {
+			proxy = "http://" + proxy
+		}
+		if _, err := url.Parse(proxy); err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		cfg := httpproxy.FromEnvironment()
+		cfg.HTTPProxy, cfg.HTTPSProxy = proxy, proxy
+		proxyFunc := cfg.ProxyFunc()
+		t.Proxy = func(r *http.Request) (*url.URL, error) { return proxyFunc(r.URL) }
+	}
+	if len(o.CACerts) == 0 && !o.Insecure {
+		return t, nil
+	}
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.InsecureSkipVerify = o.Insecure
+	if len(o.CACerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, f := range o.CACerts {
+			pem, err := os.ReadFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("reading the CA certificate: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no PEM certificates in %s", f)
+			}
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	return t, nil
+}
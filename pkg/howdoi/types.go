@@ -0,0 +1,254 @@
+package howdoi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type TextContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type Source struct {
+	Type      string `json:"type"`
+	Data      string `json:"data"`
+	MediaType string `json:"media_type"`
+}
+
+type ImageContent struct {
+	Type   string `json:"type"`
+	Source Source `json:"source"`
+	Raw    []byte `json:"-"`
+}
+
+// DocumentContent is a PDF sent to Anthropic models as is.
+type DocumentContent struct {
+	Type   string `json:"type"`
+	Source Source `json:"source"`
+	// Pages is used to estimate the tokens of the document.
+	Pages int `json:"-"`
+}
+
+// NewDocumentContent builds a PDF document content part.
+func NewDocumentContent(data []byte, pages int) DocumentContent {
+	src := Source{Type: "base64", MediaType: "application/pdf", Data: base64.StdEncoding.EncodeToString(data)}
+	return DocumentContent{Type: "document", Source: src, Pages: pages}
+}
+
+type ImageContentOpenAI struct {
+	Type     string                   `json:"type"`
+	ImageURL ImageContentOpenAISource `json:"image_url"`
+}
+
+type ImageContentOpenAISource struct {
+	Url string `json:"url"`
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content []any  `json:"content"`
+	// ToolCalls and ToolCallID carry OpenAI tool calls and their results.
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// UnmarshalJSON decodes the content parts of a stored message back into
+// their concrete types.
+func (m *Message) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Role    string            `json:"role"`
+		Content []json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	m.Role = raw.Role
+	m.Content = nil
+	for _, c := range raw.Content {
+		var typ struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(c, &typ); err != nil {
+			return err
+		}
+		switch typ.Type {
+		case "text":
+			var t TextContent
+			if err := json.Unmarshal(c, &t); err != nil {
+				return err
+			}
+			m.Content = append(m.Content, t)
+		case "image":
+			var img ImageContent
+			if err := json.Unmarshal(c, &img); err != nil {
+				return err
+			}
+			raw, err := base64.StdEncoding.DecodeString(img.Source.Data)
+			if err != nil {
+				return err
+			}
+			img.Raw = raw
+			m.Content = append(m.Content, img)
+		case "document":
+			var doc DocumentContent
+			if err := json.Unmarshal(c, &doc); err != nil {
+				return err
+			}
+			m.Content = append(m.Content, doc)
+		case "image_url":
+			var img ImageContentOpenAI
+			if err := json.Unmarshal(c, &img); err != nil {
+				return err
+			}
+			m.Content = append(m.Content, img)
+		default:
+			return fmt.Errorf("unknown content type %q", typ.Type)
+		}
+	}
+	return nil
+}
+
+// ImageMediaType returns the media type of an image, sniffed from its
+// content, or derived from the file extension ext when the content is not a
+// known image format.
+func ImageMediaType(ext string, data []byte) string {
+	if t := http.DetectContentType(data); strings.HasPrefix(t, "image/") {
+		return t
+	}
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	if ext == "jpg" {
+		ext = "jpeg"
+	}
+	return "image/" + ext
+}
+
+// NewImageContent builds the image content part in the shape expected by the
+// provider. ext is only used when the format can't be told from the data.
+func NewImageContent(provider, ext string, data []byte) any {
+	mediaType := ImageMediaType(ext, data)
+	base64String := base64.StdEncoding.EncodeToString(data)
+	if provider == "openai" {
+		return ImageContentOpenAI{
+			Type: "image_url",
+			ImageURL: ImageContentOpenAISource{
+				Url: fmt.Sprintf("data:%s;base64,%s", mediaType, base64String),
+			},
+		}
+	}
+	src := Source{Data: base64String, MediaType: mediaType, Type: "base64"}
+	return ImageContent{Type: "image", Source: src, Raw: data}
+}
+
+// AdaptContent converts image parts stored for one provider into the shape
+// expected by another, so a conversation can continue with a different model.
+func AdaptContent(provider string, content []any) []any {
+	out := make([]any, 0, len(content))
+	for _, c := range content {
+		switch v := c.(type) {
+		case ImageContent:
+			if provider == "openai" {
+				c = NewImageContent(provider, "", v.Raw)
+			}
+		case ImageContentOpenAI:
+			if provider != "openai" {
+				mediaType, data, ok := strings.Cut(strings.TrimPrefix(v.ImageURL.Url, "data:"), ";base64,")
+				raw, err := base64.StdEncoding.DecodeString(data)
+				if ok && err == nil {
+					c = NewImageContent(provider, strings.TrimPrefix(mediaType, "image/"), raw)
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type RequestBody struct {
+	Model               string               `json:"model"`
+	Messages            []Message            `json:"messages"`
+	MaxTokens           int                  `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                  `json:"max_completion_tokens,omitempty"`
+	Temperature         float64              `json:"temperature,omitempty"`
+	Stream              bool                 `json:"stream"`
+	StreamOptions       *OpenAIStreamOptions `json:"stream_options,omitempty"`
+	System              string               `json:"system,omitempty"` // New field for Anthropic
+	Thinking            *AnthropicThinking   `json:"thinking,omitempty"`
+	ResponseFormat      any                  `json:"response_format,omitempty"`
+	Tools               []any                `json:"tools,omitempty"`
+	ToolChoice          any                  `json:"tool_choice,omitempty"`
+	Metadata            map[string]string    `json:"metadata,omitempty"`
+	User                string               `json:"user,omitempty"`
+}
+
+type AnthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type ResponseContentText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type Choices struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinsihReason string  `json:"finish_reason"`
+}
+
+type ResponseBody struct {
+	Choices    []Choices             `json:"choices"`
+	Content    []ResponseContentText `json:"content"`
+	Role       []string              `json:"role"`
+	Type       string                `json:"type"`
+	Usage      Usage                 `json:"usage"`
+	Model      string                `json:"model"`
+	StopReason string                `json:"stop_reason"`
+	ID         string                `json:"id"`
+}
+
+type Usage struct {
+	// InputTokens excludes tokens read from or written to the prompt cache.
+	InputTokens      int `json:"input_tokens"`
+	OutputTokens     int `json:"output_tokens"`
+	CacheReadTokens  int `json:"cache_read_input_tokens"`
+	CacheWriteTokens int `json:"cache_creation_input_tokens"`
+}
+
+// PromptTokens is the total size of the prompt, cached or not.
+func (u Usage) PromptTokens() int {
+	return u.InputTokens + u.CacheReadTokens + u.CacheWriteTokens
+}
+
+// Add returns the sum of two usages, such as those of the turns of a query.
+func (u Usage) Add(v Usage) Usage {
+	return Usage{
+		InputTokens:      u.InputTokens + v.InputTokens,
+		OutputTokens:     u.OutputTokens + v.OutputTokens,
+		CacheReadTokens:  u.CacheReadTokens + v.CacheReadTokens,
+		CacheWriteTokens: u.CacheWriteTokens + v.CacheWriteTokens,
+	}
+}
+
+func (u Usage) String() string {
+	s := fmt.Sprintf("Input Tokens: %d, Output Tokens: %d", u.InputTokens, u.OutputTokens)
+	if u.CacheReadTokens > 0 || u.CacheWriteTokens > 0 {
+		s += fmt.Sprintf(", Cache Read Tokens: %d, Cache Write Tokens: %d", u.CacheReadTokens, u.CacheWriteTokens)
+	}
+	return s
+}
+
+type Document struct {
+	Source string
+	// Language is the detected programming language of the content, empty for prose.
+	Language string
+	Content  string
+}
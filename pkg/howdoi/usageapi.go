@@ -0,0 +1,253 @@
+package howdoi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminKeyEnvs are the environment variables of the admin keys that the
+// usage and cost reports of each provider need. Providers without a usage API
+// are not listed.
+var AdminKeyEnvs = map[string]string{
+	"openai":    "OPENAI_ADMIN_KEY",
+	"anthropic": "ANTHROPIC_ADMIN_KEY",
+}
+
+// ProviderUsage is the usage and cost of a model as reported by its provider,
+// for the whole organization.
+type ProviderUsage struct {
+	// Model is the ID the provider reports, usually a dated snapshot.
+	Model string
+	Usage Usage
+	// Requests is 0 when the provider does not count them.
+	Requests int
+	// Cost is in dollars.
+	Cost float64
+}
+
+// FetchProviderUsage returns the usage and costs of each model since a time
+// from the provider's admin API.
+func (c *Client) FetchProviderUsage(ctx context.Context, provider string, since time.Time) ([]ProviderUsage, error) {
+	env, ok := AdminKeyEnvs[provider]
+	if !ok {
+		return nil, fmt.Errorf("%s has no usage API", provider)
+	}
+	key := APIKey(env)
+	if key == "" {
+		return nil, fmt.Errorf("%w: set %s or store a key in the keychain", ErrNoAPIKey, env)
+	}
+	byModel := map[string]*ProviderUsage{}
+	get := func(model string) *ProviderUsage {
+		if byModel[model] == nil {
+			byModel[model] = &ProviderUsage{Model: model}
+		}
+		return byModel[model]
+	}
+
+	switch provider {
+	case "openai":
+		q := url.Values{"start_time": {strconv.FormatInt(since.Unix(), 10)}, "bucket_width": {"1d"}, "group_by": {"model"}, "limit": {"31"}}
+		err := c.adminPages(ctx, provider, key, OpenAIBaseURL+"/organization/usage/completions", q, func(b []byte) error {
+			var page struct {
+				Data []struct {
+					Results []struct {
+						Model             string `json:"model"`
+						InputTokens       int    `json:"input_tokens"`
+						InputCachedTokens int    `json:"input_cached_tokens"`
+						OutputTokens      int    `json:"output_tokens"`
+						Requests          int    `json:"num_model_requests"`
+					} `json:"results"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(b, &page); err != nil {
+				return err
+			}
+			for _, d := range page.Data {
+				for _, r := range d.Results {
+					u := get(r.Model)
+					// input_tokens includes the cached ones.
+					u.Usage = u.Usage.Add(Usage{InputTokens: r.InputTokens - r.InputCachedTokens, CacheReadTokens: r.InputCachedTokens, OutputTokens: r.OutputTokens})
+					u.Requests += r.Requests
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		q = url.Values{"start_time": {strconv.FormatInt(since.Unix(), 10)}, "bucket_width": {"1d"}, "group_by": {"line_item"}, "limit": {"180"}}
+		err = c.adminPages(ctx, provider, key, OpenAIBaseURL+"/organization/costs", q, func(b []byte) error {
+			var page struct {
+				Data []struct {
+					Results []struct {
+						Amount struct {
+							Value float64 `json:"value"`
+						} `json:"amount"`
+						// LineItem is like "gpt-4o-2024-08-06, input".
+						LineItem string `json:"line_item"`
+					} `json:"results"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(b, &page); err != nil {
+				return err
+			}
+			for _, d := range page.Data {
+				for _, r := range d.Results {
+					model, _, _ := strings.Cut(r.LineItem, ",")
+					if u, ok := byModel[strings.TrimSpace(model)]; ok {
+						u.Cost += r.Amount.Value
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+	case "anthropic":
+		base := strings.TrimSuffix(vendors["anthropic"].URL, "/messages") + "/organizations"
+		q := url.Values{"starting_at": {since.UTC().Format(time.RFC3339)}, "bucket_width": {"1d"}, "group_by[]": {"model"}, "limit": {"31"}}
+		err := c.adminPages(ctx, provider, key, base+"/usage_report/messages", q, func(b []byte) error {
+			var page struct {
+				Data []struct {
+					Results []struct {
+						Model         string `json:"model"`
+						Uncached      int    `json:"uncached_input_tokens"`
+						CacheRead     int    `json:"cache_read_input_tokens"`
+						CacheCreation struct {
+							Ephemeral5m int `json:"ephemeral_5m_input_tokens"`
+							Ephemeral1h int `json:"ephemeral_1h_input_tokens"`
+						} `json:"cache_creation"`
+						OutputTokens int `json:"output_tokens"`
+					} `json:"results"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(b, &page); err != nil {
+				return err
+			}
+			for _, d := range page.Data {
+				for _, r := range d.Results {
+					u := get(r.Model)
+					u.Usage = u.Usage.Add(Usage{
+						InputTokens:      r.Uncached,
+						CacheReadTokens:  r.CacheRead,
+						CacheWriteTokens: r.CacheCreation.Ephemeral5m + r.CacheCreation.Ephemeral1h,
+						OutputTokens:     r.OutputTokens,
+					})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		q = url.Values{"starting_at": {since.UTC().Format(time.RFC3339)}, "group_by[]": {"description"}, "limit": {"31"}}
+		err = c.adminPages(ctx, provider, key, base+"/cost_report", q, func(b []byte) error {
+			var page struct {
+				Data []struct {
+					Results []struct {
+						// Amount is a decimal string in cents.
+						Amount string `json:"amount"`
+						Model  string `json:"model"`
+					} `json:"results"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(b, &page); err != nil {
+				return err
+			}
+			for _, d := range page.Data {
+				for _, r := range d.Results {
+					cents, err := strconv.ParseFloat(r.Amount, 64)
+					if u, ok := byModel[r.Model]; ok && err == nil {
+						u.Cost += cents / 100
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	usages := make([]ProviderUsage, 0, len(byModel))
+	for _, u := range byModel {
+		usages = append(usages, *u)
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Model < usages[j].Model })
+	return usages, nil
+}
+
+// adminPages calls a paginated admin endpoint, passing each page's body to
+// fn until there are no more.
+func (c *Client) adminPages(ctx context.Context, provider, key, endpoint string, q url.Values, fn func([]byte) error) error {
+	for {
+		r, err := http.NewRequestWithContext(ctx, "GET", endpoint+"?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		if provider == "anthropic" {
+			r.Header.Set("x-api-key", key)
+			r.Header.Set("anthropic-version", "2023-06-01")
+		} else {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		res, err := c.do(r, false)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			HasMore  bool   `json:"has_more"`
+			NextPage string `json:"next_page"`
+		}
+		b, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return fmt.Errorf("decoding the usage report: %w", err)
+		}
+		if err := fn(b); err != nil {
+			return fmt.Errorf("decoding the usage report: %w", err)
+		}
+		if !page.HasMore || page.NextPage == "" {
+			return nil
+		}
+		q.Set("page", page.NextPage)
+	}
+}
+
+// PricedModel returns the model of the price table that a provider's model
+// ID is priced as: the ID itself, or the longest known ID it starts with, so
+// dated snapshots like gpt-4o-2024-08-06 are priced as gpt-4o. A -latest
+// suffix of a known ID is ignored.
+func PricedModel(id string) (string, bool) {
+	if _, ok := modelCosts[id]; ok {
+		return id, true
+	}
+	best := ""
+	for known := range modelCosts {
+		base := strings.TrimSuffix(known, "-latest")
+		if strings.HasPrefix(id, base) && len(base) > len(strings.TrimSuffix(best, "-latest")) {
+			best = known
+		}
+	}
+	return best, best != ""
+}
+
+// TableCost prices usage summed over many requests with the price table,
+// at the base rates, since long context rates apply to single requests.
+func TableCost(model string, usage Usage) float64 {
+	c := modelCosts[model]
+	return c.price(usage, c.Input, c.Output)
+}
@@ -0,0 +1,62 @@
+package howdoi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const waybackAvailableURL = "https://archive.org/wayback/available?url="
+
+var errNoSnapshot = errors.New("the Wayback Machine has no snapshot of the page")
+
+// waybackSnapshot returns the URL of the latest Wayback Machine snapshot of a
+// page, without the archive's toolbar, and when it was taken.
+func waybackSnapshot(ctx context.Context, rawURL string) (string, time.Time, error) {
+	b, err := httpGet(ctx, waybackAvailableURL+url.QueryEscape(rawURL))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	var res struct {
+		Snapshots struct {
+			Closest struct {
+				Available bool   `json:"available"`
+				URL       string `json:"url"`
+				Timestamp string `json:"timestamp"`
+				Status    string `json:"status"`
+			} `json:"closest"`
+		} `json:"archived_snapshots"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return "", time.Time{}, err
+	}
+	c := res.Snapshots.Closest
+	if !c.Available || c.Status != "200" {
+		return "", time.Time{}, errNoSnapshot
+	}
+	taken, err := time.Parse("20060102150405", c.Timestamp)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("snapshot timestamp: %w", err)
+	}
+	// The id_ flag serves the page as it was archived, without the toolbar.
+	snapshot := strings.Replace(c.URL, "/"+c.Timestamp+"/", "/"+c.Timestamp+"id_/", 1)
+	return snapshot, taken, nil
+}
+
+// scrapeWayback scrapes the latest snapshot of a page and returns its text
+// and a source noting the snapshot date.
+func scrapeWayback(ctx context.Context, rawURL string) (string, string, error) {
+	snapshot, taken, err := waybackSnapshot(ctx, rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	content, err := scrapeWebPage(ctx, snapshot)
+	if err != nil {
+		return "", "", err
+	}
+	return content, fmt.Sprintf("%s (Wayback Machine snapshot of %s)", rawURL, taken.Format("2006-01-02")), nil
+}
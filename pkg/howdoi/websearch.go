@@ -0,0 +1,243 @@
+package howdoi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// anthropicWebSearchTool is Anthropic's server-side web search tool. max_uses
+// bounds the searches, which are billed per use, of a single answer.
+var anthropicWebSearchTool = map[string]any{
+	"type":     "web_search_20250305",
+	"name":     "web_search",
+	"max_uses": 5,
+}
+
+// NativeWebSearch reports whether a provider searches the web itself when
+// asked to with Request.WebSearch. Other providers need search results
+// attached instead, see SearchWeb.
+func NativeWebSearch(provider string, v Vendor) bool {
+	switch provider {
+	case "google":
+		return true
+	case "anthropic":
+		return v.URL == vendors["anthropic"].URL
+	case "openai":
+		return v.URL == vendors["openai"].URL
+	}
+	return false
+}
+
+// citingAnthropicHandler handles an Anthropic stream with web search. The
+// citations of a text block come before its text, so they are held until the
+// block ends to follow the text they cite.
+func citingAnthropicHandler() streamHandler {
+	var pending []Citation
+	return func(ev sseEvent, usage *Usage, emit func(Delta)) error {
+		var data struct {
+			Type  string `json:"type"`
+			Delta struct {
+				Type     string `json:"type"`
+				Citation struct {
+					Type  string `json:"type"`
+					URL   string `json:"url"`
+					Title string `json:"title"`
+				} `json:"citation"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(ev.Data), &data); err != nil {
+			return fmt.Errorf("decoding stream event: %w", err)
+		}
+		switch {
+		case data.Type == "content_block_delta" && data.Delta.Type == "citations_delta":
+			if c := data.Delta.Citation; c.Type == "web_search_result_location" {
+				pending = append(pending, Citation{URL: c.URL, Title: c.Title})
+			}
+			return nil
+		case data.Type == "content_block_stop":
+			for _, c := range pending {
+				emit(Delta{Citation: &c})
+			}
+			pending = nil
+		}
+		return handleAnthropicEvent(ev, usage, emit)
+	}
+}
+
+// footnotes turns the citations in a stream into markdown footnote markers,
+// numbered by source, and lists the sources after the answer.
+func footnotes(ctx context.Context, in <-chan Delta) <-chan Delta {
+	out := make(chan Delta)
+	go func() {
+		defer close(out)
+		var sources []Citation
+		numbers := map[string]int{}
+		// marked holds the sources already cited since the last text, so
+		// repeated citations of a passage get one marker.
+		marked := map[int]bool{}
+		for d := range in {
+			if c := d.Citation; c != nil {
+				n, ok := numbers[c.URL]
+				if !ok {
+					sources = append(sources, *c)
+					n = len(sources)
+					numbers[c.URL] = n
+				}
+				if !marked[n] {
+					marked[n] = true
+					send(ctx, out, Delta{Text: fmt.Sprintf("[^%d]", n)})
+				}
+				continue
+			}
+			if d.Text != "" {
+				clear(marked)
+			}
+			send(ctx, out, d)
+		}
+		if len(sources) == 0 {
+			return
+		}
+		var b strings.Builder
+		b.WriteString("\n\n")
+		for i, c := range sources {
+			title := c.Title
+			if title == "" {
+				title = c.URL
+			}
+			fmt.Fprintf(&b, "[^%d]: [%s](%s)\n", i+1, title, c.URL)
+		}
+		send(ctx, out, Delta{Text: b.String()})
+	}()
+	return out
+}
+
+// SearchEngine is a web search API, whose top results are attached for
+// models without a web search tool of their own.
+type SearchEngine struct {
+	// Provider is brave, searxng, or tavily.
+	Provider string
+	// URL is the search endpoint, by default that of the provider. SearXNG
+	// instances are self-hosted, so it is needed for them.
+	URL string
+	// KeyEnv names the API key, which is looked up with APIKey. It is
+	// BRAVE_API_KEY or TAVILY_API_KEY by default, and SearXNG needs none.
+	KeyEnv string
+}
+
+// ErrNoSearchEngine is returned by SearchWeb when no search API is set.
+var ErrNoSearchEngine = errors.New("no web search API is set")
+
+// searchEndpoints are the default search endpoints and API keys.
+var searchEndpoints = map[string]struct{ URL, KeyEnv string }{
+	"brave":   {"https://api.search.brave.com/res/v1/web/search", "BRAVE_API_KEY"},
+	"searxng": {},
+	"tavily":  {"https://api.tavily.com/search", "TAVILY_API_KEY"},
+}
+
+// SearchWeb returns the URLs of the top n results of the search API for a
+// query.
+func SearchWeb(ctx context.Context, s SearchEngine, query string, n int) ([]string, error) {
+	if s.Provider == "" {
+		return nil, ErrNoSearchEngine
+	}
+	endpoint, ok := searchEndpoints[s.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown search provider %q, use brave, searxng, or tavily", s.Provider)
+	}
+	if s.URL == "" {
+		s.URL = endpoint.URL
+	}
+	if s.URL == "" {
+		return nil, fmt.Errorf("%s needs the URL of an instance", s.Provider)
+	}
+	if s.KeyEnv == "" {
+		s.KeyEnv = endpoint.KeyEnv
+	}
+	var key string
+	if s.KeyEnv != "" {
+		if key = APIKey(s.KeyEnv); key == "" {
+			return nil, fmt.Errorf("%w: set %s or store a key in the keychain", ErrNoAPIKey, s.KeyEnv)
+		}
+	}
+
+	var r *http.Request
+	var err error
+	switch s.Provider {
+	case "brave":
+		r, err = http.NewRequestWithContext(ctx, "GET", s.URL+"?"+url.Values{"q": {query}, "count": {fmt.Sprint(n)}}.Encode(), nil)
+		if err == nil {
+			r.Header.Set("X-Subscription-Token", key)
+		}
+	case "searxng":
+		r, err = http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(s.URL, "/")+"/search?"+url.Values{"q": {query}, "format": {"json"}}.Encode(), nil)
+		if err == nil && key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+	case "tavily":
+		body, _ := json.Marshal(map[string]any{"query": query, "max_results": n})
+		r, err = http.NewRequestWithContext(ctx, "POST", s.URL, bytes.NewReader(body))
+		if err == nil {
+			r.Header.Set("content-type", "application/json")
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("searching the web: %w", err)
+	}
+	r.Header.Set("accept", "application/json")
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("searching the web: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("searching the web: %s API: %s", s.Provider, res.Status)
+	}
+	urls, err := searchResultURLs(s.Provider, res.Body, n)
+	if err != nil {
+		return nil, fmt.Errorf("reading the search results: %w", err)
+	}
+	return urls, nil
+}
+
+// searchResultURLs decodes the response of a search API into the URLs of
+// its first n web results.
+func searchResultURLs(provider string, r io.Reader, n int) ([]string, error) {
+	type result struct {
+		URL string `json:"url"`
+	}
+	var out struct {
+		// Brave nests the web results, which come with news and videos.
+		Web struct {
+			Results []result `json:"results"`
+		} `json:"web"`
+		Results []result `json:"results"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r, scrapeMaxBytes)).Decode(&out); err != nil {
+		return nil, err
+	}
+	results := out.Results
+	if provider == "brave" {
+		results = out.Web.Results
+	}
+	var urls []string
+	seen := map[string]bool{}
+	for _, res := range results {
+		if len(urls) == n {
+			break
+		}
+		if u, err := url.Parse(res.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || seen[res.URL] {
+			continue
+		}
+		seen[res.URL] = true
+		urls = append(urls, res.URL)
+	}
+	return urls, nil
+}
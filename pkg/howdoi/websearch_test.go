@@ -0,0 +1,59 @@
+package howdoi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestSearchWeb(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/brave" && r.Header.Get("X-Subscription-Token") == "brave-key":
+			io.WriteString(w, `{"web": {"results": [{"url": "https://a.example"}, {"url": "https://b.example"}, {"url": "https://c.example"}]}}`)
+		case r.URL.Path == "/searxng/search" && r.URL.Query().Get("format") == "json":
+			io.WriteString(w, `{"results": [{"url": "https://a.example"}, {"url": "https://a.example"}, {"url": "javascript:alert(1)"}, {"url": "https://b.example"}]}`)
+		case r.URL.Path == "/tavily" && r.Method == "POST" && r.Header.Get("Authorization") == "Bearer tavily-key":
+			io.WriteString(w, `{"results": [{"url": "https://a.example", "title": "A"}]}`)
+		default:
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("TEST_BRAVE_KEY", "brave-key")
+	t.Setenv("TEST_TAVILY_KEY", "tavily-key")
+
+	tests := []struct {
+		name   string
+		engine SearchEngine
+		want   []string
+		err    error
+	}{
+		{"brave", SearchEngine{Provider: "brave", URL: srv.URL + "/brave", KeyEnv: "TEST_BRAVE_KEY"}, []string{"https://a.example", "https://b.example"}, nil},
+		{"searxng skips duplicates and other schemes", SearchEngine{Provider: "searxng", URL: srv.URL + "/searxng/"}, []string{"https://a.example", "https://b.example"}, nil},
+		{"tavily", SearchEngine{Provider: "tavily", URL: srv.URL + "/tavily", KeyEnv: "TEST_TAVILY_KEY"}, []string{"https://a.example"}, nil},
+		{"none", SearchEngine{}, nil, ErrNoSearchEngine},
+		{"missing key", SearchEngine{Provider: "brave", URL: srv.URL + "/brave", KeyEnv: "TEST_MISSING_KEY"}, nil, ErrNoAPIKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SearchWeb(context.Background(), tt.engine, "query", 2)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, e := range []SearchEngine{{Provider: "bing"}, {Provider: "searxng"}, {Provider: "tavily", URL: srv.URL + "/unauthorized", KeyEnv: "TEST_TAVILY_KEY"}} {
+		if _, err := SearchWeb(context.Background(), e, "query", 2); err == nil {
+			t.Errorf("%+v: got no error", e)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package howdoi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var youtubeIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// youtubeVideoID returns the video ID of a YouTube link, or "" for other
+// URLs.
+func youtubeVideoID(u *url.URL) string {
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	var id string
+	switch host {
+	case "youtu.be":
+		id = strings.Trim(u.Path, "/")
+	case "youtube.com", "m.youtube.com", "music.youtube.com", "youtube-nocookie.com":
+		if u.Path == "/watch" {
+			id = u.Query().Get("v")
+			break
+		}
+		for _, prefix := range []string{"/shorts/", "/live/", "/embed/"} {
+			if rest, ok := strings.CutPrefix(u.Path, prefix); ok {
+				id = strings.Trim(rest, "/")
+			}
+		}
+	}
+	if !youtubeIDRe.MatchString(id) {
+		return ""
+	}
+	return id
+}
+
+func isYouTubeURL(u *url.URL) bool {
+	return youtubeVideoID(u) != ""
+}
+
+// captionTrack is a caption track listed in a watch page.
+type captionTrack struct {
+	BaseURL      string `json:"baseUrl"`
+	LanguageCode string `json:"languageCode"`
+	// Kind is "asr" for automatic captions.
+	Kind string `json:"kind"`
+}
+
+type playerResponse struct {
+	VideoDetails struct {
+		Title  string `json:"title"`
+		Author string `json:"author"`
+	} `json:"videoDetails"`
+	Captions struct {
+		Renderer struct {
+			Tracks []captionTrack `json:"captionTracks"`
+		} `json:"playerCaptionsTracklistRenderer"`
+	} `json:"captions"`
+}
+
+// fetchYouTubeTranscript returns the title and timestamped transcript of a
+// YouTube video, preferring English captions written by a person over
+// automatic ones.
+func fetchYouTubeTranscript(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	id := youtubeVideoID(u)
+	page, err := httpGet(ctx, "https://www.youtube.com/watch?v="+id)
+	if err != nil {
+		return "", fmt.Errorf("fetching the watch page: %w", err)
+	}
+	player, err := parsePlayerResponse(page)
+	if err != nil {
+		return "", err
+	}
+	track := pickCaptionTrack(player.Captions.Renderer.Tracks)
+	if track == nil {
+		return "", errors.New("the video has no captions")
+	}
+	captions, err := httpGet(ctx, track.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("fetching the captions: %w", err)
+	}
+	transcript, err := parseTranscript(captions)
+	if err != nil {
+		return "", fmt.Errorf("parsing the captions: %w", err)
+	}
+	d := player.VideoDetails
+	return fmt.Sprintf("Title: %s\nChannel: %s\n\n%s", d.Title, d.Author, transcript), nil
+}
+
+// parsePlayerResponse decodes the ytInitialPlayerResponse object embedded in
+// a watch page.
+func parsePlayerResponse(page []byte) (*playerResponse, error) {
+	const marker = "ytInitialPlayerResponse = "
+	i := bytes.Index(page, []byte(marker))
+	if i < 0 {
+		return nil, errors.New("no player response in the watch page")
+	}
+	var p playerResponse
+	// The decoder stops at the end of the object, ignoring the script after it.
+	if err := json.NewDecoder(bytes.NewReader(page[i+len(marker):])).Decode(&p); err != nil {
+		return nil, fmt.Errorf("decoding the player response: %w", err)
+	}
+	return &p, nil
+}
+
+func pickCaptionTrack(tracks []captionTrack) *captionTrack {
+	var best *captionTrack
+	score := -1
+	for i, t := range tracks {
+		s := 0
+		if strings.HasPrefix(t.LanguageCode, "en") {
+			s += 2
+		}
+		if t.Kind != "asr" {
+			s++
+		}
+		if s > score {
+			best, score = &tracks[i], s
+		}
+	}
+	return best
+}
+
+// parseTranscript renders timedtext captions as one "[m:ss] text" line per
+// caption.
+func parseTranscript(b []byte) (string, error) {
+	var doc struct {
+		Texts []struct {
+			Start string `xml:"start,attr"`
+			Text  string `xml:",chardata"`
+		} `xml:"text"`
+	}
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for _, t := range doc.Texts {
+		// The text is HTML escaped inside the XML escaping.
+		text := strings.Join(strings.Fields(html.UnescapeString(t.Text)), " ")
+		if text == "" {
+			continue
+		}
+		start, _ := strconv.ParseFloat(t.Start, 64)
+		fmt.Fprintf(&out, "[%s] %s\n", formatTimestamp(int(start)), text)
+	}
+	if out.Len() == 0 {
+		return "", errors.New("the captions are empty")
+	}
+	return out.String(), nil
+}